@@ -179,3 +179,12 @@ func (gkm *GPGKeypairManager) ParametersForGenerate(passphrase string, name stri
 var (
 	CompileAttributeConstraints = compileAttributeConstraints
 )
+
+// MockRunExtKeyMgr mocks running the external keypair manager helper.
+func MockRunExtKeyMgr(mock func(keyMgrPath string, input []byte) ([]byte, error)) (restore func()) {
+	prevRunExtKeyMgr := runExtKeyMgr
+	runExtKeyMgr = mock
+	return func() {
+		runExtKeyMgr = prevRunExtKeyMgr
+	}
+}
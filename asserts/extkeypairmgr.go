@@ -0,0 +1,349 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+/*
+An external keypair manager delegates to a helper program holding the
+keys, e.g. a front for a PKCS#11 token or a signing service.
+
+The helper is run once per request, it reads a JSON object from its
+stdin and writes a JSON object back to its stdout. Requests have an
+"op" field and possibly a "key-name", responses carry an "error" field
+when something went wrong. The operations are:
+
+ features:   {"signing": ["RSA-PKCS"], "public-keys": ["DER"]}
+ key-names:  {"key-names": [<name>...]}
+ public-key: {"public-key": <base64 DER PKIX RSA public key>}
+ sign:       request with "digest" (base64) and "hash": "SHA512",
+             {"signature": <base64 RSA PKCS#1 v1.5 signature>}
+ generate:   creates a new RSA 4096 bits key, optional
+ delete:     deletes a key, optional
+*/
+
+// KeyInfo holds the name and id of a key held by a keypair manager.
+type KeyInfo struct {
+	Name string
+	ID   string
+}
+
+type extKeyMgrRequest struct {
+	Op      string `json:"op"`
+	KeyName string `json:"key-name,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Digest  []byte `json:"digest,omitempty"`
+}
+
+type extKeyMgrResponse struct {
+	Error string `json:"error,omitempty"`
+
+	Signing    []string `json:"signing,omitempty"`
+	PublicKeys []string `json:"public-keys,omitempty"`
+	KeyNames   []string `json:"key-names,omitempty"`
+	PublicKey  []byte   `json:"public-key,omitempty"`
+	Signature  []byte   `json:"signature,omitempty"`
+}
+
+func runExtKeyMgrImpl(keyMgrPath string, input []byte) ([]byte, error) {
+	cmd := exec.Command(keyMgrPath)
+	var outBuf bytes.Buffer
+	var errBuf bytes.Buffer
+
+	cmd.Stdin = bytes.NewBuffer(input)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("external keypair manager %q failed: %v (%q)", keyMgrPath, err, errBuf.Bytes())
+	}
+	return outBuf.Bytes(), nil
+}
+
+var runExtKeyMgr = runExtKeyMgrImpl
+
+// ExternalKeypairManager is a key pair manager delegating to an
+// external helper program. Importing keys through the keypair manager
+// interface is not supported.
+type ExternalKeypairManager struct {
+	keyMgrPath string
+	// cache of the keys by name, the public keys need to be
+	// retrieved to compute their ids
+	cache map[string]*extPGPPrivateKey
+}
+
+// NewExternalKeypairManager creates a new key pair manager delegating
+// to the helper program at keyMgrPath, checking that the latter
+// supports the needed features.
+func NewExternalKeypairManager(keyMgrPath string) (*ExternalKeypairManager, error) {
+	em := &ExternalKeypairManager{
+		keyMgrPath: keyMgrPath,
+		cache:      make(map[string]*extPGPPrivateKey),
+	}
+	resp, err := em.keyMgr(&extKeyMgrRequest{Op: "features"})
+	if err != nil {
+		return nil, err
+	}
+	if !contains(resp.Signing, "RSA-PKCS") {
+		return nil, fmt.Errorf("external keypair manager %q does not support RSA-PKCS signing", keyMgrPath)
+	}
+	if !contains(resp.PublicKeys, "DER") {
+		return nil, fmt.Errorf("external keypair manager %q does not support DER public keys", keyMgrPath)
+	}
+	return em, nil
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (em *ExternalKeypairManager) keyMgr(req *extKeyMgrRequest) (*extKeyMgrResponse, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runExtKeyMgr(em.keyMgrPath, input)
+	if err != nil {
+		return nil, err
+	}
+	var resp extKeyMgrResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("cannot decode external keypair manager %q %s response: %v", em.keyMgrPath, req.Op, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("external keypair manager %q %s failed: %s", em.keyMgrPath, req.Op, resp.Error)
+	}
+	return &resp, nil
+}
+
+func (em *ExternalKeypairManager) keyNames() ([]string, error) {
+	resp, err := em.keyMgr(&extKeyMgrRequest{Op: "key-names"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.KeyNames, nil
+}
+
+func (em *ExternalKeypairManager) loadKey(name string) (*extPGPPrivateKey, error) {
+	if privKey := em.cache[name]; privKey != nil {
+		return privKey, nil
+	}
+	resp, err := em.keyMgr(&extKeyMgrRequest{Op: "public-key", KeyName: name})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode external key %q: %v", name, err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("expected RSA public key for external key %q, got instead: %T", name, pub)
+	}
+
+	pgpPubKey := packet.NewRSAPublicKey(v1FixedTimestamp, rsaPub)
+	var exported bytes.Buffer
+	if err := pgpPubKey.Serialize(&exported); err != nil {
+		return nil, err
+	}
+	privKey, err := newExtPGPPrivateKey(&exported, "external keypair manager", func(content []byte) ([]byte, error) {
+		return em.sign(name, pgpPubKey.KeyId, content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	em.cache[name] = privKey
+	return privKey, nil
+}
+
+// sign has the helper produce a RSA signature and wraps it into an
+// OpenPGP signature packet.
+func (em *ExternalKeypairManager) sign(name string, keyID uint64, content []byte) ([]byte, error) {
+	// hashed subpackets: creation time and issuer key id
+	hashed := make([]byte, 0, 16)
+	hashed = append(hashed, 5, 2)
+	hashed = appendUint32(hashed, uint32(time.Now().Unix()))
+	hashed = append(hashed, 9, 16)
+	hashed = appendUint64(hashed, keyID)
+
+	// v4, binary document signature, RSA, SHA512
+	prefix := []byte{4, 0, byte(packet.PubKeyAlgoRSA), 10}
+	prefix = appendUint16(prefix, uint16(len(hashed)))
+	prefix = append(prefix, hashed...)
+
+	h := crypto.SHA512.New()
+	h.Write(content)
+	h.Write(prefix)
+	trailer := []byte{4, 0xff}
+	trailer = appendUint32(trailer, uint32(len(prefix)))
+	h.Write(trailer)
+	digest := h.Sum(nil)
+
+	resp, err := em.keyMgr(&extKeyMgrRequest{
+		Op:      "sign",
+		KeyName: name,
+		Hash:    "SHA512",
+		Digest:  digest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsaSig := bytes.TrimLeft(resp.Signature, "\x00")
+	if len(rsaSig) == 0 {
+		return nil, fmt.Errorf("external keypair manager %q returned an empty signature", em.keyMgrPath)
+	}
+
+	body := append([]byte(nil), prefix...)
+	// no unhashed subpackets
+	body = appendUint16(body, 0)
+	body = append(body, digest[0], digest[1])
+	bitLen := 8*len(rsaSig) - (8 - bitLength(rsaSig[0]))
+	body = appendUint16(body, uint16(bitLen))
+	body = append(body, rsaSig...)
+
+	// new format signature packet with a five-octet length
+	pkt := []byte{0xc0 | 2, 0xff}
+	pkt = appendUint32(pkt, uint32(len(body)))
+	return append(pkt, body...), nil
+}
+
+func bitLength(b byte) int {
+	n := 0
+	for ; b != 0; b >>= 1 {
+		n++
+	}
+	return n
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// List returns the names and ids of the keys held by the helper.
+func (em *ExternalKeypairManager) List() ([]KeyInfo, error) {
+	names, err := em.keyNames()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]KeyInfo, len(names))
+	for i, name := range names {
+		privKey, err := em.loadKey(name)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = KeyInfo{
+			Name: name,
+			ID:   privKey.PublicKey().ID(),
+		}
+	}
+	return res, nil
+}
+
+func (em *ExternalKeypairManager) Put(privKey PrivateKey) error {
+	return fmt.Errorf("cannot import private key into external keypair manager")
+}
+
+func (em *ExternalKeypairManager) Get(keyID string) (PrivateKey, error) {
+	keys, err := em.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.ID == keyID {
+			return em.cache[k.Name], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find external key %q", keyID)
+}
+
+// GetByName looks up a private key by name and returns it.
+func (em *ExternalKeypairManager) GetByName(name string) (PrivateKey, error) {
+	names, err := em.keyNames()
+	if err != nil {
+		return nil, err
+	}
+	if !contains(names, name) {
+		return nil, fmt.Errorf("cannot find external key named %q", name)
+	}
+	return em.loadKey(name)
+}
+
+// Export returns the encoded text of the named public key.
+func (em *ExternalKeypairManager) Export(name string) ([]byte, error) {
+	privKey, err := em.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return EncodePublicKey(privKey.PublicKey())
+}
+
+// Generate has the helper create a new key with the given name.
+func (em *ExternalKeypairManager) Generate(name string) error {
+	names, err := em.keyNames()
+	if err != nil {
+		return err
+	}
+	if contains(names, name) {
+		return fmt.Errorf("external key named %q already exists", name)
+	}
+	_, err = em.keyMgr(&extKeyMgrRequest{Op: "generate", KeyName: name})
+	return err
+}
+
+// Delete has the helper remove the named key pair.
+func (em *ExternalKeypairManager) Delete(name string) error {
+	if _, err := em.GetByName(name); err != nil {
+		return err
+	}
+	delete(em.cache, name)
+	_, err := em.keyMgr(&extKeyMgrRequest{Op: "delete", KeyName: name})
+	return err
+}
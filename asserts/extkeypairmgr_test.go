@@ -0,0 +1,272 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type extKeypairMgrSuite struct {
+	rsaKey *rsa.PrivateKey
+	pubKey asserts.PublicKey
+
+	keys map[string]*rsa.PrivateKey
+	ops  []string
+
+	restore func()
+}
+
+var _ = Suite(&extKeypairMgrSuite{})
+
+func (ekms *extKeypairMgrSuite) SetUpSuite(c *C) {
+	var err error
+	ekms.rsaKey, err = rsa.GenerateKey(rand.Reader, 4096)
+	c.Assert(err, IsNil)
+	ekms.pubKey = asserts.RSAPublicKey(&ekms.rsaKey.PublicKey)
+}
+
+type extKeyMgrRequest struct {
+	Op      string `json:"op"`
+	KeyName string `json:"key-name"`
+	Hash    string `json:"hash"`
+	Digest  []byte `json:"digest"`
+}
+
+func (ekms *extKeypairMgrSuite) mockKeyMgr(c *C, keyMgrPath string, input []byte) ([]byte, error) {
+	c.Check(keyMgrPath, Equals, "/path/to/keymgr")
+	var req extKeyMgrRequest
+	err := json.Unmarshal(input, &req)
+	c.Assert(err, IsNil)
+	ekms.ops = append(ekms.ops, req.Op)
+
+	var resp map[string]interface{}
+	switch req.Op {
+	case "features":
+		resp = map[string]interface{}{
+			"signing":     []string{"RSA-PKCS"},
+			"public-keys": []string{"DER"},
+		}
+	case "key-names":
+		names := []string{}
+		for name := range ekms.keys {
+			names = append(names, name)
+		}
+		resp = map[string]interface{}{"key-names": names}
+	case "public-key":
+		key := ekms.keys[req.KeyName]
+		if key == nil {
+			resp = map[string]interface{}{"error": "no such key"}
+			break
+		}
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		c.Assert(err, IsNil)
+		resp = map[string]interface{}{"public-key": der}
+	case "sign":
+		c.Check(req.Hash, Equals, "SHA512")
+		sig, err := rsa.SignPKCS1v15(rand.Reader, ekms.keys[req.KeyName], crypto.SHA512, req.Digest)
+		c.Assert(err, IsNil)
+		resp = map[string]interface{}{"signature": sig}
+	case "generate":
+		ekms.keys[req.KeyName] = ekms.rsaKey
+		resp = map[string]interface{}{}
+	case "delete":
+		delete(ekms.keys, req.KeyName)
+		resp = map[string]interface{}{}
+	default:
+		c.Fatalf("unexpected op %q", req.Op)
+	}
+	return json.Marshal(resp)
+}
+
+func (ekms *extKeypairMgrSuite) SetUpTest(c *C) {
+	ekms.keys = map[string]*rsa.PrivateKey{
+		"default": ekms.rsaKey,
+	}
+	ekms.ops = nil
+	ekms.restore = asserts.MockRunExtKeyMgr(func(keyMgrPath string, input []byte) ([]byte, error) {
+		return ekms.mockKeyMgr(c, keyMgrPath, input)
+	})
+}
+
+func (ekms *extKeypairMgrSuite) TearDownTest(c *C) {
+	ekms.restore()
+}
+
+func (ekms *extKeypairMgrSuite) TestFeaturesErrors(c *C) {
+	restore := asserts.MockRunExtKeyMgr(func(keyMgrPath string, input []byte) ([]byte, error) {
+		return []byte(`{"signing": ["RSA-PSS"], "public-keys": ["DER"]}`), nil
+	})
+	defer restore()
+	_, err := asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Check(err, ErrorMatches, `external keypair manager "/path/to/keymgr" does not support RSA-PKCS signing`)
+
+	restore = asserts.MockRunExtKeyMgr(func(keyMgrPath string, input []byte) ([]byte, error) {
+		return []byte(`{"signing": ["RSA-PKCS"], "public-keys": ["PEM"]}`), nil
+	})
+	defer restore()
+	_, err = asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Check(err, ErrorMatches, `external keypair manager "/path/to/keymgr" does not support DER public keys`)
+
+	restore = asserts.MockRunExtKeyMgr(func(keyMgrPath string, input []byte) ([]byte, error) {
+		return []byte(`{"error": "boom"}`), nil
+	})
+	defer restore()
+	_, err = asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Check(err, ErrorMatches, `external keypair manager "/path/to/keymgr" features failed: boom`)
+}
+
+func (ekms *extKeypairMgrSuite) TestGetByNameAndGet(c *C) {
+	em, err := asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Assert(err, IsNil)
+
+	privKey, err := em.GetByName("default")
+	c.Assert(err, IsNil)
+	c.Check(privKey.PublicKey().ID(), Equals, ekms.pubKey.ID())
+
+	privKey, err = em.Get(ekms.pubKey.ID())
+	c.Assert(err, IsNil)
+	c.Check(privKey.PublicKey().ID(), Equals, ekms.pubKey.ID())
+
+	_, err = em.GetByName("other")
+	c.Check(err, ErrorMatches, `cannot find external key named "other"`)
+	_, err = em.Get("unknown-id")
+	c.Check(err, ErrorMatches, `cannot find external key "unknown-id"`)
+
+	// the public key was retrieved only once
+	n := 0
+	for _, op := range ekms.ops {
+		if op == "public-key" {
+			n++
+		}
+	}
+	c.Check(n, Equals, 1)
+}
+
+func (ekms *extKeypairMgrSuite) TestList(c *C) {
+	em, err := asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Assert(err, IsNil)
+
+	keys, err := em.List()
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []asserts.KeyInfo{
+		{Name: "default", ID: ekms.pubKey.ID()},
+	})
+}
+
+func (ekms *extKeypairMgrSuite) TestPut(c *C) {
+	em, err := asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Assert(err, IsNil)
+
+	err = em.Put(testPrivKey0)
+	c.Check(err, ErrorMatches, "cannot import private key into external keypair manager")
+}
+
+func (ekms *extKeypairMgrSuite) TestSignAndCheck(c *C) {
+	em, err := asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Assert(err, IsNil)
+
+	signDB, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		KeypairManager: em,
+	})
+	c.Assert(err, IsNil)
+
+	headers := map[string]interface{}{
+		"authority-id":  "dev1-id",
+		"snap-sha3-384": blobSHA3_384,
+		"snap-id":       "snap-id-1",
+		"grade":         "devel",
+		"snap-size":     "1025",
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}
+	snapBuild, err := signDB.Sign(asserts.SnapBuildType, headers, nil, ekms.pubKey.ID())
+	c.Assert(err, IsNil)
+
+	// check the signature verifies
+	content, encSig := snapBuild.Signature()
+	c.Check(content, NotNil)
+	c.Check(encSig, NotNil)
+	err = asserts.CheckSignature(snapBuild, asserts.BootstrapAccountKeyForTest("dev1-id", ekms.pubKey), nil, time.Time{})
+	c.Check(err, IsNil)
+}
+
+func (ekms *extKeypairMgrSuite) TestGenerateAndDelete(c *C) {
+	em, err := asserts.NewExternalKeypairManager("/path/to/keymgr")
+	c.Assert(err, IsNil)
+
+	err = em.Generate("default")
+	c.Check(err, ErrorMatches, `external key named "default" already exists`)
+
+	delete(ekms.keys, "default")
+	err = em.Generate("new-key")
+	c.Assert(err, IsNil)
+
+	exported, err := em.Export("new-key")
+	c.Assert(err, IsNil)
+	expected, err := asserts.EncodePublicKey(ekms.pubKey)
+	c.Assert(err, IsNil)
+	c.Check(exported, DeepEquals, expected)
+
+	err = em.Delete("new-key")
+	c.Assert(err, IsNil)
+	_, err = em.GetByName("new-key")
+	c.Check(err, ErrorMatches, `cannot find external key named "new-key"`)
+
+	err = em.Delete("new-key")
+	c.Check(err, ErrorMatches, `cannot find external key named "new-key"`)
+}
+
+func (ekms *extKeypairMgrSuite) TestRunHelper(c *C) {
+	ekms.restore()
+	defer func() {
+		ekms.restore = func() {}
+	}()
+
+	helper := filepath.Join(c.MkDir(), "keymgr")
+	err := ioutil.WriteFile(helper, []byte(`#!/bin/sh
+cat > /dev/null
+echo '{"signing": ["RSA-PKCS"], "public-keys": ["DER"], "key-names": []}'
+`), 0755)
+	c.Assert(err, IsNil)
+
+	em, err := asserts.NewExternalKeypairManager(helper)
+	c.Assert(err, IsNil)
+	keys, err := em.List()
+	c.Assert(err, IsNil)
+	c.Check(keys, HasLen, 0)
+
+	err = ioutil.WriteFile(helper, []byte("#!/bin/sh\necho failure >&2\nexit 1\n"), 0755)
+	c.Assert(err, IsNil)
+	_, err = em.List()
+	c.Check(err, ErrorMatches, `external keypair manager ".*/keymgr" failed: exit status 1 \("failure\\n"\)`)
+
+	os.Remove(helper)
+}
@@ -119,3 +119,29 @@ func (f *fetcher) fetchAccountKey(keyID string) error {
 func (f *fetcher) Save(a Assertion) error {
 	return f.chase(a.Ref(), a)
 }
+
+// WithPrerequisites returns the given assertions preceded by their
+// prerequisites and the account-keys that signed them, recursively,
+// as found in db. The result is ordered such that it can be added to
+// another database as is. Assertions trusted by db are left out.
+func WithPrerequisites(db RODatabase, as []Assertion) ([]Assertion, error) {
+	var res []Assertion
+	retrieve := func(ref *Ref) (Assertion, error) {
+		a, err := ref.Resolve(db.Find)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find %s %v: %v", ref.Type.Name, ref.PrimaryKey, err)
+		}
+		return a, nil
+	}
+	save := func(a Assertion) error {
+		res = append(res, a)
+		return nil
+	}
+	f := NewFetcher(db, retrieve, save)
+	for _, a := range as {
+		if err := f.Save(a); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -172,3 +172,52 @@ func (s *fetcherSuite) TestSave(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(snapDecl.(*asserts.SnapDeclaration).SnapName(), Equals, "foo")
 }
+
+func (s *fetcherSuite) TestWithPrerequisites(c *C) {
+	s.prereqSnapAssertions(c, 10, 11)
+
+	snapRevs, err := s.storeSigning.FindMany(asserts.SnapRevisionType, map[string]string{
+		"snap-id": "snap-id-1",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(snapRevs, HasLen, 2)
+
+	as, err := asserts.WithPrerequisites(s.storeSigning, snapRevs)
+	c.Assert(err, IsNil)
+
+	// the trusted assertions are left out, everything comes once and
+	// after its prerequisites
+	var types []string
+	for _, a := range as {
+		types = append(types, a.Type().Name)
+	}
+	c.Check(types, DeepEquals, []string{
+		"account-key", "account", "snap-declaration", "snap-revision", "snap-revision",
+	})
+
+	// it can be added as is to an empty database
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.storeSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+	for _, a := range as {
+		c.Assert(db.Add(a), IsNil)
+	}
+}
+
+func (s *fetcherSuite) TestWithPrerequisitesMissing(c *C) {
+	dev1Acct := assertstest.NewAccount(s.storeSigning, "developer1", nil, "")
+	headers := map[string]interface{}{
+		"series":       "16",
+		"snap-id":      "snap-id-1",
+		"snap-name":    "foo",
+		"publisher-id": dev1Acct.AccountID(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+	snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, headers, nil, "")
+	c.Assert(err, IsNil)
+
+	_, err = asserts.WithPrerequisites(s.storeSigning, []asserts.Assertion{snapDecl})
+	c.Check(err, ErrorMatches, `cannot find account \[.*\]: assertion not found`)
+}
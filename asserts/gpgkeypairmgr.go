@@ -260,6 +260,22 @@ func (gkm *GPGKeypairManager) Get(keyID string) (PrivateKey, error) {
 	return nil, fmt.Errorf("cannot find key %q in GPG keyring", keyID)
 }
 
+// List returns the names and ids of the RSA keys in the local GPG setup.
+func (gkm *GPGKeypairManager) List() ([]KeyInfo, error) {
+	var res []KeyInfo
+	collect := func(privk PrivateKey, fpr string, uid string) error {
+		res = append(res, KeyInfo{
+			Name: uid,
+			ID:   privk.PublicKey().ID(),
+		})
+		return nil
+	}
+	if err := gkm.Walk(collect); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func (gkm *GPGKeypairManager) sign(fingerprint string, content []byte) ([]byte, error) {
 	out, err := gkm.gpg(content, "--personal-digest-preferences", "SHA512", "--default-key", "0x"+fingerprint, "--detach-sign")
 	if err != nil {
@@ -79,6 +79,15 @@ func (gkms *gpgKeypairMgrSuite) TestGetNotFound(c *C) {
 	c.Check(got, IsNil)
 }
 
+func (gkms *gpgKeypairMgrSuite) TestList(c *C) {
+	gpgKeypairMgr := gkms.keypairMgr.(*asserts.GPGKeypairManager)
+	keys, err := gpgKeypairMgr.List()
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 1)
+	c.Check(keys[0].ID, Equals, assertstest.DevKeyID)
+	c.Check(keys[0].Name, Not(Equals), "")
+}
+
 func (gkms *gpgKeypairMgrSuite) TestUseInSigning(c *C) {
 	store := assertstest.NewStoreStack("trusted", testPrivKey0, testPrivKey1)
 
@@ -0,0 +1,407 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+// a filesystem based backstore for assertions that keeps an index of
+// the stored assertions, their primary keys and string headers, to
+// avoid walking the storage tree and decoding every candidate
+// assertion when searching
+
+const (
+	indexedLayoutVersion = "v1"
+	indexedRoot          = "asserts-" + indexedLayoutVersion
+	indexFname           = "index"
+	// migratedFname marks a plain filesystem backstore whose
+	// assertions were imported
+	migratedFname = "MIGRATED-TO-" + indexedRoot
+)
+
+// indexEntry is what is recorded about a stored assertion, the index
+// file is a journal of these, one JSON object per line, the last
+// entry for a given type and primary key wins. Entries are journaled
+// before the assertion is written, so only the last one can refer to
+// an assertion that did not make it to disk.
+type indexEntry struct {
+	Type     string            `json:"type"`
+	Key      []string          `json:"key"`
+	Revision int               `json:"revision"`
+	Headers  map[string]string `json:"headers"`
+
+	mu sync.Mutex
+	// decoded is the assertion once it has been read and decoded
+	decoded Assertion
+}
+
+func newIndexEntry(assertType *AssertionType, assert Assertion) *indexEntry {
+	key := make([]string, len(assertType.PrimaryKey))
+	for i, k := range assertType.PrimaryKey {
+		key[i] = assert.HeaderString(k)
+	}
+	headers := make(map[string]string)
+	for k, v := range assert.Headers() {
+		// only string headers can match a search
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		}
+	}
+	return &indexEntry{
+		Type:     assertType.Name,
+		Key:      key,
+		Revision: assert.Revision(),
+		Headers:  headers,
+		decoded:  assert,
+	}
+}
+
+func (e *indexEntry) match(headers map[string]string) bool {
+	for k, expected := range headers {
+		v, ok := e.Headers[k]
+		if !ok || v != expected {
+			return false
+		}
+	}
+	return true
+}
+
+type indexedBackstore struct {
+	// entries are stored with the same layout as the plain
+	// filesystem backstore uses
+	fs *filesystemBackstore
+
+	mu sync.RWMutex
+	// index maps type names and then joined primary keys to entries
+	index map[string]map[string]*indexEntry
+	// superseded counts the journal entries replaced by newer ones
+	superseded int
+}
+
+// OpenIndexedBackstore opens a filesystem backed assertions backstore
+// under path that maintains an index of the stored assertions for fast
+// searching. The assertions of a previous plain filesystem backstore
+// under path are imported into it the first time it is opened. The
+// plain backstore is left in place and marked as migrated: it does not
+// see the assertions added afterwards, so going back to using it loses
+// them.
+func OpenIndexedBackstore(path string) (Backstore, error) {
+	top := filepath.Join(path, indexedRoot)
+	err := ensureTop(top)
+	if err != nil {
+		return nil, err
+	}
+	ibs := &indexedBackstore{
+		fs: &filesystemBackstore{top: top},
+	}
+
+	err = ibs.loadIndex()
+	if os.IsNotExist(err) {
+		err = ibs.rebuildIndex(filepath.Join(path, assertionsRoot))
+	} else if err == errBrokenIndex {
+		// the entries are authoritative, the index can be
+		// missing the last writes
+		err = ibs.rebuildIndex("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ibs, nil
+}
+
+var errBrokenIndex = fmt.Errorf("broken assertion index")
+
+func indexKey(key []string) string {
+	return strings.Join(key, "\x00")
+}
+
+func (ibs *indexedBackstore) indexPath() string {
+	return filepath.Join(ibs.fs.top, indexFname)
+}
+
+// record adds the entry to the in-memory index
+func (ibs *indexedBackstore) record(e *indexEntry) {
+	byKey := ibs.index[e.Type]
+	if byKey == nil {
+		byKey = make(map[string]*indexEntry)
+		ibs.index[e.Type] = byKey
+	}
+	k := indexKey(e.Key)
+	if _, ok := byKey[k]; ok {
+		ibs.superseded++
+	}
+	byKey[k] = e
+}
+
+func (ibs *indexedBackstore) loadIndex() error {
+	f, err := os.Open(ibs.indexPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ibs.index = make(map[string]map[string]*indexEntry)
+	ibs.superseded = 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	var last *indexEntry
+	for scanner.Scan() {
+		var e indexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return errBrokenIndex
+		}
+		assertType := Type(e.Type)
+		if assertType == nil || len(e.Key) != len(assertType.PrimaryKey) {
+			return errBrokenIndex
+		}
+		ibs.record(&e)
+		last = &e
+	}
+	if err := scanner.Err(); err != nil {
+		return errBrokenIndex
+	}
+
+	// the write of the assertion of the last entry might have been
+	// interrupted
+	if last != nil {
+		a, err := ibs.fs.readAssertion(Type(last.Type), buildDiskPrimaryPath(last.Key))
+		if err != nil || a.Revision() != last.Revision {
+			return errBrokenIndex
+		}
+		last.decoded = a
+	}
+	return nil
+}
+
+// rebuildIndex recreates the index from the stored entries, importing
+// also the assertions from the plain filesystem backstore under
+// importFrom if set and present.
+func (ibs *indexedBackstore) rebuildIndex(importFrom string) error {
+	ibs.index = make(map[string]map[string]*indexEntry)
+	ibs.superseded = 0
+
+	for _, assertType := range typeRegistry {
+		err := ibs.fs.Search(assertType, nil, func(a Assertion) {
+			ibs.record(newIndexEntry(assertType, a))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if importFrom != "" && osutil.IsDirectory(importFrom) {
+		from := &filesystemBackstore{top: importFrom}
+		for _, assertType := range typeRegistry {
+			var imported []Assertion
+			err := from.Search(assertType, nil, func(a Assertion) {
+				imported = append(imported, a)
+			})
+			if err != nil {
+				return fmt.Errorf("cannot import assertions: %v", err)
+			}
+			for _, a := range imported {
+				e := newIndexEntry(assertType, a)
+				if cur := ibs.lookup(assertType, e.Key); cur != nil && cur.Revision >= e.Revision {
+					continue
+				}
+				err := atomicWriteEntry(Encode(a), false, ibs.fs.top, assertType.Name, buildDiskPrimaryPath(e.Key))
+				if err != nil {
+					return fmt.Errorf("cannot import assertions: %v", err)
+				}
+				ibs.record(e)
+			}
+		}
+		if err := ibs.writeIndex(); err != nil {
+			return err
+		}
+		// later changes are not reflected there
+		marker := filepath.Join(importFrom, migratedFname)
+		content := []byte("The assertions here were imported into " + indexedRoot + ", which has the current ones.\n")
+		if err := osutil.AtomicWriteFile(marker, content, 0644, 0); err != nil {
+			return fmt.Errorf("cannot mark imported assertions as migrated: %v", err)
+		}
+		return nil
+	}
+
+	return ibs.writeIndex()
+}
+
+// writeIndex writes out the whole index, compacting it
+func (ibs *indexedBackstore) writeIndex() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, byKey := range ibs.index {
+		for _, e := range byKey {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+	}
+	err := osutil.AtomicWriteFile(ibs.indexPath(), buf.Bytes(), 0664, 0)
+	if err != nil {
+		return fmt.Errorf("broken assertion storage, cannot write index: %v", err)
+	}
+	ibs.superseded = 0
+	return nil
+}
+
+func (ibs *indexedBackstore) appendIndex(e *indexEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(ibs.indexPath(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("broken assertion storage, cannot update index: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("broken assertion storage, cannot update index: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("broken assertion storage, cannot update index: %v", err)
+	}
+	return nil
+}
+
+func (ibs *indexedBackstore) lookup(assertType *AssertionType, key []string) *indexEntry {
+	return ibs.index[assertType.Name][indexKey(key)]
+}
+
+// assertion returns the assertion of the entry reading it if needed
+func (ibs *indexedBackstore) assertion(assertType *AssertionType, e *indexEntry) (Assertion, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.decoded != nil {
+		return e.decoded, nil
+	}
+	a, err := ibs.fs.readAssertion(assertType, buildDiskPrimaryPath(e.Key))
+	if err == ErrNotFound {
+		return nil, fmt.Errorf("broken assertion storage, indexed entry is missing: %s/%s", assertType.Name, buildDiskPrimaryPath(e.Key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.decoded = a
+	return a, nil
+}
+
+func (ibs *indexedBackstore) Put(assertType *AssertionType, assert Assertion) error {
+	ibs.mu.Lock()
+	defer ibs.mu.Unlock()
+
+	e := newIndexEntry(assertType, assert)
+	if cur := ibs.lookup(assertType, e.Key); cur != nil {
+		curRev := cur.Revision
+		rev := assert.Revision()
+		if curRev >= rev {
+			return &RevisionError{Current: curRev, Used: rev}
+		}
+	}
+
+	// journal the entry first, if the assertion does not make it to
+	// disk the index is found broken when opened next and rebuilt
+	if err := ibs.appendIndex(e); err != nil {
+		return err
+	}
+	err := atomicWriteEntry(Encode(assert), false, ibs.fs.top, assertType.Name, buildDiskPrimaryPath(e.Key))
+	if err != nil {
+		// drop the journaled entry
+		if err := ibs.writeIndex(); err != nil {
+			return err
+		}
+		return fmt.Errorf("broken assertion storage, cannot write assertion: %v", err)
+	}
+	ibs.record(e)
+
+	// compact the journal once it is mostly superseded entries
+	if ibs.superseded > 64 && ibs.superseded > ibs.size() {
+		return ibs.writeIndex()
+	}
+	return nil
+}
+
+func (ibs *indexedBackstore) size() int {
+	n := 0
+	for _, byKey := range ibs.index {
+		n += len(byKey)
+	}
+	return n
+}
+
+func (ibs *indexedBackstore) Get(assertType *AssertionType, key []string) (Assertion, error) {
+	ibs.mu.RLock()
+	defer ibs.mu.RUnlock()
+
+	e := ibs.lookup(assertType, key)
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	return ibs.assertion(assertType, e)
+}
+
+func (ibs *indexedBackstore) Search(assertType *AssertionType, headers map[string]string, foundCb func(Assertion)) error {
+	ibs.mu.RLock()
+	defer ibs.mu.RUnlock()
+
+	byKey := ibs.index[assertType.Name]
+
+	// with the full primary key a single entry can match
+	key := make([]string, len(assertType.PrimaryKey))
+	fullKey := true
+	for i, k := range assertType.PrimaryKey {
+		key[i] = headers[k]
+		if key[i] == "" {
+			fullKey = false
+		}
+	}
+	var cands []*indexEntry
+	if fullKey {
+		if e := byKey[indexKey(key)]; e != nil {
+			cands = append(cands, e)
+		}
+	} else {
+		for _, e := range byKey {
+			cands = append(cands, e)
+		}
+	}
+
+	for _, e := range cands {
+		if !e.match(headers) {
+			continue
+		}
+		a, err := ibs.assertion(assertType, e)
+		if err != nil {
+			return err
+		}
+		foundCb(a)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+)
+
+type indexedBackstoreSuite struct {
+	topDir string
+}
+
+var _ = Suite(&indexedBackstoreSuite{})
+
+func (ibss *indexedBackstoreSuite) SetUpTest(c *C) {
+	ibss.topDir = filepath.Join(c.MkDir(), "asserts-db")
+}
+
+func testOnlyAssertion(c *C, primaryKey string, revision int, other string) asserts.Assertion {
+	a, err := asserts.Decode([]byte(fmt.Sprintf("type: test-only\n"+
+		"authority-id: auth-id1\n"+
+		"primary-key: %s\n"+
+		"revision: %d\n"+
+		"other: %s\n"+
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij"+
+		"\n\n"+
+		"AXNpZw==", primaryKey, revision, other)))
+	c.Assert(err, IsNil)
+	return a
+}
+
+func searchKeys(c *C, bs asserts.Backstore, headers map[string]string) []string {
+	var keys []string
+	err := bs.Search(asserts.TestOnlyType, headers, func(a asserts.Assertion) {
+		keys = append(keys, fmt.Sprintf("%s@%d", a.HeaderString("primary-key"), a.Revision()))
+	})
+	c.Assert(err, IsNil)
+	sort.Strings(keys)
+	return keys
+}
+
+func (ibss *indexedBackstoreSuite) TestOpenOK(c *C) {
+	// ensure umask is clean when creating the DB dir
+	oldUmask := syscall.Umask(0)
+	defer syscall.Umask(oldUmask)
+
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Check(err, IsNil)
+	c.Check(bs, NotNil)
+
+	info, err := os.Stat(filepath.Join(ibss.topDir, "asserts-v1"))
+	c.Assert(err, IsNil)
+	c.Assert(info.IsDir(), Equals, true)
+	c.Check(info.Mode().Perm(), Equals, os.FileMode(0775))
+	c.Check(osutil.FileExists(filepath.Join(ibss.topDir, "asserts-v1", "index")), Equals, true)
+}
+
+func (ibss *indexedBackstoreSuite) TestOpenWorldWritableFail(c *C) {
+	// make it world-writable
+	oldUmask := syscall.Umask(0)
+	os.MkdirAll(filepath.Join(ibss.topDir, "asserts-v1"), 0777)
+	syscall.Umask(oldUmask)
+
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, ErrorMatches, "assert storage root unexpectedly world-writable: .*")
+	c.Check(bs, IsNil)
+}
+
+func (ibss *indexedBackstoreSuite) TestPutGetSearch(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+
+	_, err = bs.Get(asserts.TestOnlyType, []string{"foo"})
+	c.Check(err, Equals, asserts.ErrNotFound)
+
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x")), IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "bar", 0, "y")), IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 1, "y")), IsNil)
+
+	a, err := bs.Get(asserts.TestOnlyType, []string{"foo"})
+	c.Assert(err, IsNil)
+	c.Check(a.Revision(), Equals, 1)
+
+	c.Check(searchKeys(c, bs, nil), DeepEquals, []string{"bar@0", "foo@1"})
+	c.Check(searchKeys(c, bs, map[string]string{"primary-key": "foo"}), DeepEquals, []string{"foo@1"})
+	c.Check(searchKeys(c, bs, map[string]string{"other": "y"}), DeepEquals, []string{"bar@0", "foo@1"})
+	c.Check(searchKeys(c, bs, map[string]string{"other": "x"}), HasLen, 0)
+	c.Check(searchKeys(c, bs, map[string]string{"primary-key": "bar", "other": "x"}), HasLen, 0)
+	// a missing header does not match the empty string
+	c.Check(searchKeys(c, bs, map[string]string{"missing": ""}), HasLen, 0)
+
+	// the entries use the same layout as the plain filesystem backstore
+	c.Check(osutil.FileExists(filepath.Join(ibss.topDir, "asserts-v1", "test-only", "foo", "active")), Equals, true)
+}
+
+func (ibss *indexedBackstoreSuite) TestPutOldRevision(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+
+	err = bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 1, "x"))
+	c.Assert(err, IsNil)
+	err = bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x"))
+	c.Check(err, ErrorMatches, `revision 0 is older than current revision 1`)
+	c.Check(err, DeepEquals, &asserts.RevisionError{Current: 1, Used: 0})
+}
+
+func (ibss *indexedBackstoreSuite) TestReopen(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x")), IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 2, "y")), IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "bar", 0, "x")), IsNil)
+
+	bs, err = asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Check(searchKeys(c, bs, nil), DeepEquals, []string{"bar@0", "foo@2"})
+	c.Check(searchKeys(c, bs, map[string]string{"other": "x"}), DeepEquals, []string{"bar@0"})
+
+	err = bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 1, "x"))
+	c.Check(err, DeepEquals, &asserts.RevisionError{Current: 2, Used: 1})
+}
+
+func (ibss *indexedBackstoreSuite) TestReopenBrokenIndex(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x")), IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "bar", 0, "x")), IsNil)
+
+	// simulate a torn write of the last index entry
+	indexPath := filepath.Join(ibss.topDir, "asserts-v1", "index")
+	content, err := ioutil.ReadFile(indexPath)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(indexPath, content[:len(content)-10], 0664), IsNil)
+
+	bs, err = asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Check(searchKeys(c, bs, nil), DeepEquals, []string{"bar@0", "foo@0"})
+}
+
+func (ibss *indexedBackstoreSuite) TestMissingEntry(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x")), IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "bar", 0, "x")), IsNil)
+
+	err = os.Remove(filepath.Join(ibss.topDir, "asserts-v1", "test-only", "foo", "active"))
+	c.Assert(err, IsNil)
+
+	bs, err = asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	_, err = bs.Get(asserts.TestOnlyType, []string{"foo"})
+	c.Check(err, ErrorMatches, "broken assertion storage, indexed entry is missing: test-only/foo/active")
+}
+
+func (ibss *indexedBackstoreSuite) TestReopenInterruptedPut(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x")), IsNil)
+
+	// simulate a crash after journaling the next revision but before
+	// writing it
+	indexPath := filepath.Join(ibss.topDir, "asserts-v1", "index")
+	f, err := os.OpenFile(indexPath, os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteString(`{"type":"test-only","key":["foo"],"revision":1,"headers":{"other":"y"}}` + "\n")
+	c.Assert(err, IsNil)
+	f.Close()
+
+	bs, err = asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	a, err := bs.Get(asserts.TestOnlyType, []string{"foo"})
+	c.Assert(err, IsNil)
+	c.Check(a.Revision(), Equals, 0)
+	c.Check(searchKeys(c, bs, map[string]string{"other": "x"}), DeepEquals, []string{"foo@0"})
+
+	// and the revision can be put again
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 1, "y")), IsNil)
+	bs, err = asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Check(searchKeys(c, bs, nil), DeepEquals, []string{"foo@1"})
+}
+
+func (ibss *indexedBackstoreSuite) TestMigrateFromFSBackstore(c *C) {
+	fsbs, err := asserts.OpenFSBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Assert(fsbs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x")), IsNil)
+	c.Assert(fsbs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 3, "y")), IsNil)
+	c.Assert(fsbs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "bar", 0, "x")), IsNil)
+
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Check(searchKeys(c, bs, nil), DeepEquals, []string{"bar@0", "foo@3"})
+
+	// the old storage is marked as migrated
+	c.Check(osutil.FileExists(filepath.Join(ibss.topDir, "asserts-v0", "MIGRATED-TO-asserts-v1")), Equals, true)
+
+	// the old storage is left alone but not imported again
+	c.Assert(fsbs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "baz", 0, "x")), IsNil)
+	bs, err = asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Check(searchKeys(c, bs, nil), DeepEquals, []string{"bar@0", "foo@3"})
+}
+
+func (ibss *indexedBackstoreSuite) TestIndexCompaction(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+
+	for i := 0; i < 200; i++ {
+		c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", i, "x")), IsNil)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(ibss.topDir, "asserts-v1", "index"))
+	c.Assert(err, IsNil)
+	lines := 0
+	for _, b := range content {
+		if b == '\n' {
+			lines++
+		}
+	}
+	c.Check(lines < 100, Equals, true, Commentf("%d index lines", lines))
+
+	bs, err = asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	c.Check(searchKeys(c, bs, nil), DeepEquals, []string{"foo@199"})
+}
+
+func (ibss *indexedBackstoreSuite) TestDatabaseFindMany(c *C) {
+	bs, err := asserts.OpenIndexedBackstore(ibss.topDir)
+	c.Assert(err, IsNil)
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{Backstore: bs})
+	c.Assert(err, IsNil)
+
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "foo", 0, "x")), IsNil)
+	c.Assert(bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, "bar", 0, "y")), IsNil)
+
+	res, err := db.FindMany(asserts.TestOnlyType, map[string]string{"other": "y"})
+	c.Assert(err, IsNil)
+	c.Assert(res, HasLen, 1)
+	c.Check(res[0].HeaderString("primary-key"), Equals, "bar")
+}
+
+// benchmarks comparing FindMany over the plain filesystem backstore
+// and the indexed one, run them with: go test -check.b -check.f Benchmark
+
+const benchmarkAssertions = 2000
+
+func (ibss *indexedBackstoreSuite) benchmarkFindMany(c *C, open func(string) (asserts.Backstore, error)) {
+	bs, err := open(ibss.topDir)
+	c.Assert(err, IsNil)
+	for i := 0; i < benchmarkAssertions; i++ {
+		err := bs.Put(asserts.TestOnlyType, testOnlyAssertion(c, fmt.Sprintf("key%d", i), 0, fmt.Sprintf("v%d", i%10)))
+		c.Assert(err, IsNil)
+	}
+	// reopen to start without anything cached
+	bs, err = open(ibss.topDir)
+	c.Assert(err, IsNil)
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{Backstore: bs})
+	c.Assert(err, IsNil)
+
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		res, err := db.FindMany(asserts.TestOnlyType, map[string]string{"other": "v3"})
+		if err != nil || len(res) != benchmarkAssertions/10 {
+			c.Fatalf("unexpected FindMany result: %d %v", len(res), err)
+		}
+	}
+}
+
+func (ibss *indexedBackstoreSuite) BenchmarkFindManyFSBackstore(c *C) {
+	ibss.benchmarkFindMany(c, asserts.OpenFSBackstore)
+}
+
+func (ibss *indexedBackstoreSuite) BenchmarkFindManyIndexedBackstore(c *C) {
+	ibss.benchmarkFindMany(c, asserts.OpenIndexedBackstore)
+}
@@ -0,0 +1,168 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repair holds a repair assertion, which carries a script to be run
+// once on the devices matching its filters to fix them out-of-band.
+type Repair struct {
+	assertionBase
+
+	repairID      int
+	series        []string
+	architectures []string
+	models        []string
+	disabled      bool
+	timestamp     time.Time
+}
+
+// BrandID returns the brand identifier of the repair. Same as the authority id.
+func (r *Repair) BrandID() string {
+	return r.HeaderString("brand-id")
+}
+
+// RepairID returns the sequential identifier of the repair within the brand.
+func (r *Repair) RepairID() int {
+	return r.repairID
+}
+
+// Summary returns the short description of what the repair does.
+func (r *Repair) Summary() string {
+	return r.HeaderString("summary")
+}
+
+// Series returns the series the repair applies to, all of them if empty.
+func (r *Repair) Series() []string {
+	return r.series
+}
+
+// Architectures returns the architectures the repair applies to, all of
+// them if empty.
+func (r *Repair) Architectures() []string {
+	return r.architectures
+}
+
+// Models returns the brand-id/model pairs the repair applies to, all of
+// them if empty.
+func (r *Repair) Models() []string {
+	return r.models
+}
+
+// Disabled returns whether the repair was disabled and must not be run.
+func (r *Repair) Disabled() bool {
+	return r.disabled
+}
+
+// Timestamp returns the time when the repair was issued.
+func (r *Repair) Timestamp() time.Time {
+	return r.timestamp
+}
+
+// Applies returns whether the repair applies to a device of the given
+// series, architecture and brand-id/model.
+func (r *Repair) Applies(series, architecture, brandID, model string) bool {
+	if len(r.series) != 0 && !contains(r.series, series) {
+		return false
+	}
+	if len(r.architectures) != 0 && !contains(r.architectures, architecture) {
+		return false
+	}
+	if len(r.models) != 0 && !contains(r.models, brandID+"/"+model) {
+		return false
+	}
+	return true
+}
+
+var validRepairModel = regexp.MustCompile("^[a-zA-Z0-9](?:-?[a-zA-Z0-9])*/[a-zA-Z0-9](?:-?[a-zA-Z0-9])*$")
+
+func assembleRepair(assert assertionBase) (Assertion, error) {
+	err := checkAuthorityMatchesBrand(&assert)
+	if err != nil {
+		return nil, err
+	}
+
+	repairID, err := checkInt(assert.headers, "repair-id")
+	if err != nil {
+		return nil, err
+	}
+	if repairID < 1 {
+		return nil, fmt.Errorf(`"repair-id" header must be >=1: %d`, repairID)
+	}
+	// the primary key is compared as a string, reject leading zeros
+	if assert.HeaderString("repair-id") != strconv.Itoa(repairID) {
+		return nil, fmt.Errorf(`"repair-id" header must be a plain integer: %q`, assert.HeaderString("repair-id"))
+	}
+
+	if _, err := checkNotEmptyString(assert.headers, "summary"); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(assert.HeaderString("summary"), "\n\r") {
+		return nil, fmt.Errorf(`"summary" header cannot have newlines`)
+	}
+
+	series, err := checkStringList(assert.headers, "series")
+	if err != nil {
+		return nil, err
+	}
+	architectures, err := checkStringList(assert.headers, "architectures")
+	if err != nil {
+		return nil, err
+	}
+	models, err := checkStringList(assert.headers, "models")
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		if !validRepairModel.MatchString(m) {
+			return nil, fmt.Errorf(`"models" header contains an invalid element, expected brand-id/model: %q`, m)
+		}
+	}
+
+	disabled, err := checkOptionalBool(assert.headers, "disabled")
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := checkRFC3339Date(assert.headers, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(assert.body) == 0 {
+		return nil, fmt.Errorf("repair assertion body cannot be empty, it holds the script to run")
+	}
+
+	return &Repair{
+		assertionBase: assert,
+		repairID:      repairID,
+		series:        series,
+		architectures: architectures,
+		models:        models,
+		disabled:      disabled,
+		timestamp:     timestamp,
+	}, nil
+}
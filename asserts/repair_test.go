@@ -0,0 +1,163 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type repairSuite struct {
+	ts     time.Time
+	tsLine string
+}
+
+var _ = Suite(&repairSuite{})
+
+func (rs *repairSuite) SetUpSuite(c *C) {
+	rs.ts = time.Now().Truncate(time.Second).UTC()
+	rs.tsLine = "timestamp: " + rs.ts.Format(time.RFC3339) + "\n"
+}
+
+const repairScript = `#!/bin/sh
+echo fixing
+`
+
+func (rs *repairSuite) makeValidEncoded() string {
+	return "type: repair\n" +
+		"authority-id: acme\n" +
+		"brand-id: acme\n" +
+		"repair-id: 42\n" +
+		"summary: fix the frobinator\n" +
+		"series:\n  - 16\n" +
+		"architectures:\n  - amd64\n  - armhf\n" +
+		"models:\n  - acme/frobinator\n" +
+		rs.tsLine +
+		"body-length: " + strconv.Itoa(len(repairScript)) + "\n" +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		repairScript +
+		"\n\n" +
+		"AXNpZw=="
+}
+
+func (rs *repairSuite) TestDecodeOK(c *C) {
+	encoded := rs.makeValidEncoded()
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.RepairType)
+	repair := a.(*asserts.Repair)
+	c.Check(repair.AuthorityID(), Equals, "acme")
+	c.Check(repair.BrandID(), Equals, "acme")
+	c.Check(repair.RepairID(), Equals, 42)
+	c.Check(repair.Summary(), Equals, "fix the frobinator")
+	c.Check(repair.Series(), DeepEquals, []string{"16"})
+	c.Check(repair.Architectures(), DeepEquals, []string{"amd64", "armhf"})
+	c.Check(repair.Models(), DeepEquals, []string{"acme/frobinator"})
+	c.Check(repair.Disabled(), Equals, false)
+	c.Check(repair.Timestamp(), Equals, rs.ts)
+	c.Check(string(repair.Body()), Equals, repairScript)
+}
+
+func (rs *repairSuite) TestApplies(c *C) {
+	encoded := rs.makeValidEncoded()
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	repair := a.(*asserts.Repair)
+
+	c.Check(repair.Applies("16", "amd64", "acme", "frobinator"), Equals, true)
+	c.Check(repair.Applies("16", "armhf", "acme", "frobinator"), Equals, true)
+	c.Check(repair.Applies("18", "amd64", "acme", "frobinator"), Equals, false)
+	c.Check(repair.Applies("16", "i386", "acme", "frobinator"), Equals, false)
+	c.Check(repair.Applies("16", "amd64", "acme", "other"), Equals, false)
+
+	// no filters, applies everywhere
+	encoded = strings.Replace(encoded, "series:\n  - 16\n", "", 1)
+	encoded = strings.Replace(encoded, "architectures:\n  - amd64\n  - armhf\n", "", 1)
+	encoded = strings.Replace(encoded, "models:\n  - acme/frobinator\n", "", 1)
+	a, err = asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	repair = a.(*asserts.Repair)
+	c.Check(repair.Applies("18", "i386", "other", "other"), Equals, true)
+}
+
+const (
+	repairErrPrefix = "assertion repair: "
+)
+
+func (rs *repairSuite) TestDecodeInvalid(c *C) {
+	encoded := rs.makeValidEncoded()
+
+	invalidTests := []struct{ original, invalid, expectedErr string }{
+		{"brand-id: acme\n", "brand-id: other\n", `authority-id and brand-id must match, repair assertions are expected to be signed by the brand: "acme" != "other"`},
+		{"repair-id: 42\n", "", `"repair-id" header is mandatory`},
+		{"repair-id: 42\n", "repair-id: x\n", `"repair-id" header is not an integer: x`},
+		{"repair-id: 42\n", "repair-id: 0\n", `"repair-id" header must be >=1: 0`},
+		{"repair-id: 42\n", "repair-id: 042\n", `"repair-id" header must be a plain integer: "042"`},
+		{"summary: fix the frobinator\n", "", `"summary" header is mandatory`},
+		{"series:\n  - 16\n", "series: 16\n", `"series" header must be a list of strings`},
+		{"architectures:\n  - amd64\n  - armhf\n", "architectures: amd64\n", `"architectures" header must be a list of strings`},
+		{"models:\n  - acme/frobinator\n", "models:\n  - frobinator\n", `"models" header contains an invalid element, expected brand-id/model: "frobinator"`},
+		{rs.tsLine, rs.tsLine + "disabled: maybe\n", `"disabled" header must be 'true' or 'false'`},
+		{rs.tsLine, "", `"timestamp" header is mandatory`},
+	}
+
+	for _, test := range invalidTests {
+		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
+		_, err := asserts.Decode([]byte(invalid))
+		c.Check(err, ErrorMatches, repairErrPrefix+test.expectedErr)
+	}
+}
+
+func (rs *repairSuite) TestDecodeEmptyBody(c *C) {
+	encoded := "type: repair\n" +
+		"authority-id: acme\n" +
+		"brand-id: acme\n" +
+		"repair-id: 42\n" +
+		"summary: fix the frobinator\n" +
+		rs.tsLine +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+	_, err := asserts.Decode([]byte(encoded))
+	c.Check(err, ErrorMatches, repairErrPrefix+"repair assertion body cannot be empty, it holds the script to run")
+}
+
+func (rs *repairSuite) TestRepairCheck(c *C) {
+	storeDB, db := makeStoreAndCheckDB(c)
+	brandDB := setup3rdPartySigning(c, "acme", storeDB, db)
+
+	headers := map[string]interface{}{
+		"brand-id":  "acme",
+		"repair-id": "1",
+		"summary":   "fix the frobinator",
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	repair, err := brandDB.Sign(asserts.RepairType, headers, []byte(repairScript), "")
+	c.Assert(err, IsNil)
+
+	err = db.Check(repair)
+	c.Assert(err, IsNil)
+}
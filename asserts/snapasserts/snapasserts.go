@@ -22,6 +22,7 @@ package snapasserts
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/release"
@@ -45,6 +46,39 @@ func findSnapDeclaration(snapID, name string, db asserts.RODatabase) (*asserts.S
 	return snapDecl, nil
 }
 
+// CheckSigningKeyNotRevoked checks that the account-key that signed the assertion, in its latest revision known to the database, was valid at the time the assertion was issued. That stops being the case if the key got revoked since, by a new revision of its account-key assertion superseding the one the assertion was checked against when added, with the validity of the key cut short. Assertions issued outside of the validity of a key never revised are reported as signed with an expired or not yet valid key.
+func CheckSigningKeyNotRevoked(a asserts.Assertion, db asserts.RODatabase) error {
+	tstamped, ok := a.(interface {
+		Timestamp() time.Time
+	})
+	if !ok {
+		return nil
+	}
+	keyA, err := db.Find(asserts.AccountKeyType, map[string]string{
+		"public-key-sha3-384": a.SignKeyID(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot find the account-key that signed the %s assertion: %v", a.Type().Name, err)
+	}
+	accKey := keyA.(*asserts.AccountKey)
+
+	timestamp := tstamped.Timestamp()
+	until := accKey.Until()
+	expired := !until.IsZero() && !timestamp.Before(until)
+	notYetValid := timestamp.Before(accKey.Since())
+	if !expired && !notYetValid {
+		return nil
+	}
+	switch {
+	case accKey.Revision() > 0:
+		return fmt.Errorf("%s assertion is signed with key %q from %q revoked by revision %d of its account-key", a.Type().Name, a.SignKeyID(), a.AuthorityID(), accKey.Revision())
+	case expired:
+		return fmt.Errorf("%s assertion is signed with key %q from %q expired since %s", a.Type().Name, a.SignKeyID(), a.AuthorityID(), until.Format(time.RFC3339))
+	default:
+		return fmt.Errorf("%s assertion is signed with key %q from %q not valid until %s", a.Type().Name, a.SignKeyID(), a.AuthorityID(), accKey.Since().Format(time.RFC3339))
+	}
+}
+
 // CrossCheck tries to cross check the name, hash digest and size of a snap plus its metadata in a SideInfo with the relevant snap assertions in a database that should have been populated with them.
 func CrossCheck(name, snapSHA3_384 string, snapSize uint64, si *snap.SideInfo, db asserts.RODatabase) error {
 	// get relevant assertions and do cross checks
@@ -60,6 +94,10 @@ func CrossCheck(name, snapSHA3_384 string, snapSize uint64, si *snap.SideInfo, d
 		return fmt.Errorf("snap %q file does not have expected size according to signatures (download is broken or tampered): %d != %d", name, snapSize, snapRev.SnapSize())
 	}
 
+	if err := CheckSigningKeyNotRevoked(snapRev, db); err != nil {
+		return fmt.Errorf("cannot install snap %q: %v", name, err)
+	}
+
 	snapID := si.SnapID
 
 	if snapRev.SnapID() != snapID || snapRev.SnapRevision() != si.Revision.N {
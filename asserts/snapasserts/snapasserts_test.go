@@ -210,6 +210,103 @@ func (s *snapassertsSuite) TestCrossCheckRevokedSnapDecl(c *C) {
 	c.Check(err, ErrorMatches, `cannot install snap "foo" with a revoked snap declaration`)
 }
 
+// revokeStoreKey adds a new revision of the store account-key with its validity ending at until.
+func (s *snapassertsSuite) revokeStoreKey(c *C, revision int, until time.Time) {
+	storeKey := s.storeSigning.StoreAccountKey("")
+	pubKey, err := s.storeSigning.PublicKey("")
+	c.Assert(err, IsNil)
+	revoked := assertstest.NewAccountKey(s.storeSigning.RootSigning, s.storeSigning.TrustedAccount, map[string]interface{}{
+		"name":     "store",
+		"since":    storeKey.Since().Format(time.RFC3339),
+		"until":    until.Format(time.RFC3339),
+		"revision": fmt.Sprintf("%d", revision),
+	}, pubKey, "")
+	err = s.localDB.Add(revoked)
+	c.Assert(err, IsNil)
+}
+
+func (s *snapassertsSuite) TestCrossCheckRevokedSigningKey(c *C) {
+	since := s.storeSigning.StoreAccountKey("").Since()
+	digest := makeDigest(12)
+	size := uint64(len(fakeSnap(12)))
+	headers := map[string]interface{}{
+		"snap-id":       "snap-id-1",
+		"snap-sha3-384": digest,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-revision": "12",
+		"developer-id":  s.dev1Acct.AccountID(),
+		"timestamp":     since.Add(time.Hour).Format(time.RFC3339),
+	}
+	snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, headers, nil, "")
+	c.Assert(err, IsNil)
+	err = s.localDB.Add(snapRev)
+	c.Assert(err, IsNil)
+
+	si := &snap.SideInfo{
+		SnapID:   "snap-id-1",
+		Revision: snap.R(12),
+	}
+
+	c.Check(snapasserts.CheckSigningKeyNotRevoked(snapRev, s.localDB), IsNil)
+
+	// the key validity ending after the snap-revision was issued is fine
+	s.revokeStoreKey(c, 1, since.Add(2*time.Hour))
+	c.Check(snapasserts.CheckSigningKeyNotRevoked(snapRev, s.localDB), IsNil)
+	c.Check(snapasserts.CrossCheck("foo", digest, size, si, s.localDB), IsNil)
+
+	// the key got revoked as of before the snap-revision was issued
+	s.revokeStoreKey(c, 2, since.Add(time.Minute))
+
+	err = snapasserts.CheckSigningKeyNotRevoked(snapRev, s.localDB)
+	c.Check(err, ErrorMatches, `snap-revision assertion is signed with key ".*" from "can0nical" revoked by revision 2 of its account-key`)
+
+	err = snapasserts.CrossCheck("foo", digest, size, si, s.localDB)
+	c.Check(err, ErrorMatches, `cannot install snap "foo": snap-revision assertion is signed with key ".*" from "can0nical" revoked by revision 2 of its account-key`)
+}
+
+func (s *snapassertsSuite) TestCheckSigningKeyNotRevokedOutsideValidity(c *C) {
+	// an account-key never revised, with a validity not covering the
+	// timestamp of the snap-revision, as can be the case for
+	// assertions coming in other ways than through a database
+	since := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	until := since.Add(24 * time.Hour)
+	devKey, _ := assertstest.GenerateKey(752)
+	devPubKey := devKey.PublicKey()
+	devAccKey := assertstest.NewAccountKey(s.storeSigning, s.dev1Acct, map[string]interface{}{
+		"name":  "default",
+		"since": since.Format(time.RFC3339),
+		"until": until.Format(time.RFC3339),
+	}, devPubKey, "")
+	err := s.localDB.Add(devAccKey)
+	c.Assert(err, IsNil)
+	devSigning := assertstest.NewSigningDB(s.dev1Acct.AccountID(), devKey)
+
+	for _, t := range []struct {
+		timestamp time.Time
+		err       string
+	}{
+		{since.Add(time.Hour), ""},
+		{until, `snap-build assertion is signed with key ".*" from ".*" expired since ` + until.Format(time.RFC3339)},
+		{since.Add(-time.Hour), `snap-build assertion is signed with key ".*" from ".*" not valid until ` + since.Format(time.RFC3339)},
+	} {
+		snapBuild, err := devSigning.Sign(asserts.SnapBuildType, map[string]interface{}{
+			"authority-id":  s.dev1Acct.AccountID(),
+			"snap-sha3-384": makeDigest(1),
+			"snap-id":       "snap-id-1",
+			"snap-size":     "1",
+			"grade":         "devel",
+			"timestamp":     t.timestamp.Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, IsNil)
+		err = snapasserts.CheckSigningKeyNotRevoked(snapBuild, s.localDB)
+		if t.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, t.err)
+		}
+	}
+}
+
 func (s *snapassertsSuite) TestDeriveSideInfoHappy(c *C) {
 	digest := makeDigest(42)
 	size := uint64(len(fakeSnap(42)))
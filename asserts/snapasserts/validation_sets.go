@@ -0,0 +1,163 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapasserts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/snap"
+)
+
+// ValidationSetKey returns the account-id/name key identifying the
+// validation set independently of its sequence.
+func ValidationSetKey(accountID, name string) string {
+	return accountID + "/" + name
+}
+
+func setKey(vs *asserts.ValidationSet) string {
+	return ValidationSetKey(vs.AccountID(), vs.Name())
+}
+
+// ValidationSetsError describes how installed snaps fail to satisfy a
+// group of validation sets. Each map goes from snap names to the keys
+// of the sets with the violated constraint.
+type ValidationSetsError struct {
+	// Missing are required snaps that are not installed.
+	Missing map[string][]string
+	// Invalid are installed snaps that are marked invalid.
+	Invalid map[string][]string
+	// WrongRevision are installed snaps not at the required revision.
+	WrongRevision map[string][]string
+}
+
+func describeViolations(kind string, m map[string][]string) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	l := make([]string, len(names))
+	for i, name := range names {
+		l[i] = fmt.Sprintf("%s (%s)", name, strings.Join(m[name], ", "))
+	}
+	return fmt.Sprintf("\n- %s: %s", kind, strings.Join(l, ", "))
+}
+
+func (e *ValidationSetsError) Error() string {
+	msg := "validation sets are not satisfied:"
+	if len(e.Missing) != 0 {
+		msg += describeViolations("missing required snaps", e.Missing)
+	}
+	if len(e.Invalid) != 0 {
+		msg += describeViolations("invalid snaps", e.Invalid)
+	}
+	if len(e.WrongRevision) != 0 {
+		msg += describeViolations("snaps at the wrong revision", e.WrongRevision)
+	}
+	return msg
+}
+
+func addViolation(m *map[string][]string, name, key string) {
+	if *m == nil {
+		*m = make(map[string][]string)
+	}
+	(*m)[name] = append((*m)[name], key)
+}
+
+// CheckInstalledSnaps checks that the installed snaps, given as a map
+// from their names to their current revisions, satisfy all the given
+// validation sets. It returns a *ValidationSetsError otherwise.
+func CheckInstalledSnaps(vsets []*asserts.ValidationSet, installed map[string]snap.Revision) error {
+	verr := &ValidationSetsError{}
+	for _, vs := range vsets {
+		key := setKey(vs)
+		for _, sn := range vs.Snaps() {
+			rev, ok := installed[sn.Name]
+			switch {
+			case !ok:
+				if sn.Presence == asserts.PresenceRequired {
+					addViolation(&verr.Missing, sn.Name, key)
+				}
+			case sn.Presence == asserts.PresenceInvalid:
+				addViolation(&verr.Invalid, sn.Name, key)
+			case sn.Revision != 0 && rev != snap.R(sn.Revision):
+				addViolation(&verr.WrongRevision, sn.Name, key)
+			}
+		}
+	}
+	if verr.Missing == nil && verr.Invalid == nil && verr.WrongRevision == nil {
+		return nil
+	}
+	return verr
+}
+
+// CheckSnapInstall checks that installing or refreshing the named snap
+// to the given revision respects the validation sets. An unset
+// revision stands for a local unasserted revision.
+func CheckSnapInstall(vsets []*asserts.ValidationSet, name string, revision snap.Revision) error {
+	var invalid []string
+	var required []string
+	requiredRev := 0
+	for _, vs := range vsets {
+		for _, sn := range vs.Snaps() {
+			if sn.Name != name {
+				continue
+			}
+			switch {
+			case sn.Presence == asserts.PresenceInvalid:
+				invalid = append(invalid, setKey(vs))
+			case sn.Revision != 0 && revision != snap.R(sn.Revision):
+				required = append(required, setKey(vs))
+				requiredRev = sn.Revision
+			}
+		}
+	}
+	if len(invalid) != 0 {
+		return fmt.Errorf("snap %q is invalid according to validation sets: %s", name, strings.Join(invalid, ", "))
+	}
+	if len(required) != 0 {
+		revStr := "local revision"
+		if !revision.Unset() {
+			revStr = fmt.Sprintf("revision %s", revision)
+		}
+		return fmt.Errorf("snap %q %s is not the revision %d required by validation sets: %s", name, revStr, requiredRev, strings.Join(required, ", "))
+	}
+	return nil
+}
+
+// CheckSnapRemove checks that removing the named snap respects the
+// validation sets.
+func CheckSnapRemove(vsets []*asserts.ValidationSet, name string) error {
+	var required []string
+	for _, vs := range vsets {
+		for _, sn := range vs.Snaps() {
+			if sn.Name == name && sn.Presence == asserts.PresenceRequired {
+				required = append(required, setKey(vs))
+			}
+		}
+	}
+	if len(required) != 0 {
+		return fmt.Errorf("snap %q is required by validation sets: %s", name, strings.Join(required, ", "))
+	}
+	return nil
+}
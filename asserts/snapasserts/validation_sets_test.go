@@ -0,0 +1,141 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapasserts_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/snap"
+)
+
+type validationSetsSuite struct {
+	storeSigning *assertstest.StoreStack
+}
+
+var _ = Suite(&validationSetsSuite{})
+
+func (s *validationSetsSuite) SetUpTest(c *C) {
+	rootPrivKey, _ := assertstest.GenerateKey(1024)
+	storePrivKey, _ := assertstest.GenerateKey(752)
+	s.storeSigning = assertstest.NewStoreStack("can0nical", rootPrivKey, storePrivKey)
+}
+
+func (s *validationSetsSuite) mockValidationSet(c *C, name string, snaps ...interface{}) *asserts.ValidationSet {
+	a, err := s.storeSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"series":     "16",
+		"account-id": "can0nical",
+		"name":       name,
+		"sequence":   "1",
+		"snaps":      snaps,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func snapEntry(name, presence, revision string) map[string]interface{} {
+	m := map[string]interface{}{
+		"name":     name,
+		"id":       name + "-id",
+		"presence": presence,
+	}
+	if revision != "" {
+		m["revision"] = revision
+	}
+	return m
+}
+
+func (s *validationSetsSuite) TestValidationSetKey(c *C) {
+	c.Check(snapasserts.ValidationSetKey("acme", "base"), Equals, "acme/base")
+}
+
+func (s *validationSetsSuite) TestCheckInstalledSnaps(c *C) {
+	vs1 := s.mockValidationSet(c, "one",
+		snapEntry("foo", "required", "10"),
+		snapEntry("bar", "optional", ""),
+		snapEntry("baz", "invalid", ""),
+	)
+	vs2 := s.mockValidationSet(c, "two",
+		snapEntry("foo", "required", ""),
+		snapEntry("quux", "required", ""),
+	)
+	vsets := []*asserts.ValidationSet{vs1, vs2}
+
+	err := snapasserts.CheckInstalledSnaps(vsets, map[string]snap.Revision{
+		"foo":  snap.R(10),
+		"quux": snap.R(1),
+	})
+	c.Check(err, IsNil)
+
+	err = snapasserts.CheckInstalledSnaps(vsets, map[string]snap.Revision{
+		"foo": snap.R(11),
+		"bar": snap.R(2),
+		"baz": snap.R(3),
+	})
+	c.Assert(err, FitsTypeOf, &snapasserts.ValidationSetsError{})
+	verr := err.(*snapasserts.ValidationSetsError)
+	c.Check(verr.Missing, DeepEquals, map[string][]string{"quux": {"can0nical/two"}})
+	c.Check(verr.Invalid, DeepEquals, map[string][]string{"baz": {"can0nical/one"}})
+	c.Check(verr.WrongRevision, DeepEquals, map[string][]string{"foo": {"can0nical/one"}})
+	c.Check(err, ErrorMatches, `validation sets are not satisfied:
+- missing required snaps: quux \(can0nical/two\)
+- invalid snaps: baz \(can0nical/one\)
+- snaps at the wrong revision: foo \(can0nical/one\)`)
+}
+
+func (s *validationSetsSuite) TestCheckSnapInstall(c *C) {
+	vsets := []*asserts.ValidationSet{
+		s.mockValidationSet(c, "one",
+			snapEntry("foo", "required", "10"),
+			snapEntry("baz", "invalid", ""),
+		),
+		s.mockValidationSet(c, "two",
+			snapEntry("foo", "optional", "10"),
+		),
+	}
+
+	c.Check(snapasserts.CheckSnapInstall(vsets, "foo", snap.R(10)), IsNil)
+	c.Check(snapasserts.CheckSnapInstall(vsets, "other", snap.R(1)), IsNil)
+	c.Check(snapasserts.CheckSnapInstall(vsets, "foo", snap.R(11)), ErrorMatches,
+		`snap "foo" revision 11 is not the revision 10 required by validation sets: can0nical/one, can0nical/two`)
+	c.Check(snapasserts.CheckSnapInstall(vsets, "foo", snap.R(0)), ErrorMatches,
+		`snap "foo" local revision is not the revision 10 required by validation sets: can0nical/one, can0nical/two`)
+	c.Check(snapasserts.CheckSnapInstall(vsets, "baz", snap.R(1)), ErrorMatches,
+		`snap "baz" is invalid according to validation sets: can0nical/one`)
+}
+
+func (s *validationSetsSuite) TestCheckSnapRemove(c *C) {
+	vsets := []*asserts.ValidationSet{
+		s.mockValidationSet(c, "one",
+			snapEntry("foo", "required", "10"),
+			snapEntry("bar", "optional", ""),
+		),
+	}
+
+	c.Check(snapasserts.CheckSnapRemove(vsets, "bar"), IsNil)
+	c.Check(snapasserts.CheckSnapRemove(vsets, "other"), IsNil)
+	c.Check(snapasserts.CheckSnapRemove(vsets, "foo"), ErrorMatches,
+		`snap "foo" is required by validation sets: can0nical/one`)
+}
@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Store holds a store assertion, which describes a brand store that
+// devices can be pointed to by their model.
+type Store struct {
+	assertionBase
+
+	url            *url.URL
+	friendlyStores []string
+	timestamp      time.Time
+}
+
+// Store returns the identifier of the store, as referenced by models.
+func (store *Store) Store() string {
+	return store.HeaderString("store")
+}
+
+// OperatorID returns the account id of the operator of the store.
+func (store *Store) OperatorID() string {
+	return store.HeaderString("operator-id")
+}
+
+// URL returns the URL of the store API, or nil if the default store
+// location should be used.
+func (store *Store) URL() *url.URL {
+	return store.url
+}
+
+// FriendlyStores returns the identifiers of the stores whose snaps
+// are also visible through this store.
+func (store *Store) FriendlyStores() []string {
+	return store.friendlyStores
+}
+
+// Timestamp returns the time when the store assertion was issued.
+func (store *Store) Timestamp() time.Time {
+	return store.timestamp
+}
+
+func (store *Store) checkConsistency(db RODatabase, acck *AccountKey) error {
+	// devices are pointed to the store, it must come from a trusted authority
+	if !db.IsTrustedAccount(store.AuthorityID()) {
+		return fmt.Errorf("store assertion %q is not signed by a directly trusted authority: %s", store.Store(), store.AuthorityID())
+	}
+	_, err := db.Find(AccountType, map[string]string{
+		"account-id": store.OperatorID(),
+	})
+	if err == ErrNotFound {
+		return fmt.Errorf("store assertion %q does not have a matching account assertion for the operator %q", store.Store(), store.OperatorID())
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// sanity
+var _ consistencyChecker = (*Store)(nil)
+
+// Prerequisites returns references to this store's prerequisite assertions.
+func (store *Store) Prerequisites() []*Ref {
+	return []*Ref{
+		{Type: AccountType, PrimaryKey: []string{store.OperatorID()}},
+	}
+}
+
+func checkStoreURL(headers map[string]interface{}) (*url.URL, error) {
+	s, err := checkOptionalString(headers, "url")
+	if err != nil || s == "" {
+		return nil, err
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf(`"url" header must be a valid URL: %s`, s)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf(`"url" header scheme must be "https" or "http": %s`, s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf(`"url" header must have a host: %s`, s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf(`"url" header must not have a query or fragment: %s`, s)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf(`"url" header must not contain user info: %s`, s)
+	}
+	return u, nil
+}
+
+func assembleStore(assert assertionBase) (Assertion, error) {
+	_, err := checkNotEmptyString(assert.headers, "operator-id")
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := checkStoreURL(assert.headers)
+	if err != nil {
+		return nil, err
+	}
+
+	friendlyStores, err := checkStringList(assert.headers, "friendly-stores")
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := checkRFC3339Date(assert.headers, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		assertionBase:  assert,
+		url:            u,
+		friendlyStores: friendlyStores,
+		timestamp:      timestamp,
+	}, nil
+}
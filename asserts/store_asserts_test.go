@@ -0,0 +1,147 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+)
+
+type storeSuite struct {
+	ts     time.Time
+	tsLine string
+}
+
+var _ = Suite(&storeSuite{})
+
+func (ss *storeSuite) SetUpSuite(c *C) {
+	ss.ts = time.Now().Truncate(time.Second).UTC()
+	ss.tsLine = "timestamp: " + ss.ts.Format(time.RFC3339) + "\n"
+}
+
+func (ss *storeSuite) makeValidEncoded() string {
+	return "type: store\n" +
+		"authority-id: canonical\n" +
+		"store: brand-store\n" +
+		"operator-id: op-id1\n" +
+		"url: https://store.example.com/\n" +
+		"friendly-stores:\n  - other-store\n" +
+		ss.tsLine +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+}
+
+func (ss *storeSuite) TestDecodeOK(c *C) {
+	a, err := asserts.Decode([]byte(ss.makeValidEncoded()))
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.StoreType)
+	store := a.(*asserts.Store)
+	c.Check(store.AuthorityID(), Equals, "canonical")
+	c.Check(store.Store(), Equals, "brand-store")
+	c.Check(store.OperatorID(), Equals, "op-id1")
+	c.Check(store.URL().String(), Equals, "https://store.example.com/")
+	c.Check(store.FriendlyStores(), DeepEquals, []string{"other-store"})
+	c.Check(store.Timestamp(), Equals, ss.ts)
+	c.Check(store.Prerequisites(), DeepEquals, []*asserts.Ref{
+		{Type: asserts.AccountType, PrimaryKey: []string{"op-id1"}},
+	})
+}
+
+func (ss *storeSuite) TestDecodeOptional(c *C) {
+	encoded := ss.makeValidEncoded()
+	encoded = strings.Replace(encoded, "url: https://store.example.com/\n", "", 1)
+	encoded = strings.Replace(encoded, "friendly-stores:\n  - other-store\n", "", 1)
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	store := a.(*asserts.Store)
+	c.Check(store.URL(), IsNil)
+	c.Check(store.FriendlyStores(), HasLen, 0)
+}
+
+const storeErrPrefix = "assertion store: "
+
+func (ss *storeSuite) TestDecodeInvalid(c *C) {
+	encoded := ss.makeValidEncoded()
+
+	invalidTests := []struct{ original, invalid, expectedErr string }{
+		{"store: brand-store\n", "", `"store" header is mandatory`},
+		{"operator-id: op-id1\n", "", `"operator-id" header is mandatory`},
+		{"url: https://store.example.com/\n", "url:\n  - foo\n", `"url" header must be a string`},
+		{"url: https://store.example.com/\n", "url: ftp://store.example.com/\n", `"url" header scheme must be "https" or "http": ftp://store.example.com/`},
+		{"url: https://store.example.com/\n", "url: https:///path\n", `"url" header must have a host: https:///path`},
+		{"url: https://store.example.com/\n", "url: https://store.example.com/?q=1\n", `"url" header must not have a query or fragment: .*`},
+		{"url: https://store.example.com/\n", "url: https://user@store.example.com/\n", `"url" header must not contain user info: .*`},
+		{"url: https://store.example.com/\n", "url: ://foo\n", `"url" header must be a valid URL: ://foo`},
+		{"friendly-stores:\n  - other-store\n", "friendly-stores: other-store\n", `"friendly-stores" header must be a list of strings`},
+		{ss.tsLine, "", `"timestamp" header is mandatory`},
+	}
+
+	for _, test := range invalidTests {
+		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
+		_, err := asserts.Decode([]byte(invalid))
+		c.Check(err, ErrorMatches, storeErrPrefix+test.expectedErr)
+	}
+}
+
+func (ss *storeSuite) TestCheck(c *C) {
+	storeDB, db := makeStoreAndCheckDB(c)
+
+	operator := assertstest.NewAccount(storeDB, "op", map[string]interface{}{
+		"account-id": "op-id1",
+	}, "")
+
+	headers := map[string]interface{}{
+		"store":       "brand-store",
+		"operator-id": "op-id1",
+		"url":         "https://store.example.com/",
+		"timestamp":   time.Now().Format(time.RFC3339),
+	}
+	store, err := storeDB.Sign(asserts.StoreType, headers, nil, "")
+	c.Assert(err, IsNil)
+
+	err = db.Check(store)
+	c.Check(err, ErrorMatches, `store assertion "brand-store" does not have a matching account assertion for the operator "op-id1"`)
+
+	c.Assert(db.Add(operator), IsNil)
+	err = db.Check(store)
+	c.Check(err, IsNil)
+}
+
+func (ss *storeSuite) TestCheckUntrustedAuthority(c *C) {
+	storeDB, db := makeStoreAndCheckDB(c)
+	brandDB := setup3rdPartySigning(c, "brand", storeDB, db)
+
+	headers := map[string]interface{}{
+		"store":       "brand-store",
+		"operator-id": "brand",
+		"timestamp":   time.Now().Format(time.RFC3339),
+	}
+	store, err := brandDB.Sign(asserts.StoreType, headers, nil, "")
+	c.Assert(err, IsNil)
+
+	err = db.Check(store)
+	c.Check(err, ErrorMatches, `store assertion "brand-store" is not signed by a directly trusted authority: brand`)
+}
@@ -0,0 +1,136 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// Structured is a representation of an assertion meant to be rendered
+// as JSON or YAML for tooling. It cannot be turned back into a
+// verifiable assertion, use Encode for that.
+type Structured struct {
+	Type string `json:"type" yaml:"type"`
+	// Headers holds the complete headers, with lists and maps as such
+	// and the integer and boolean headers known for the type converted.
+	Headers map[string]interface{} `json:"headers" yaml:"headers"`
+	// Body holds the base64 encoded body, if any.
+	Body      string `json:"body,omitempty" yaml:"body,omitempty"`
+	SignKeyID string `json:"sign-key-sha3-384" yaml:"sign-key-sha3-384"`
+	// Signature holds the signature as found in the encoded assertion.
+	Signature string `json:"signature" yaml:"signature"`
+}
+
+// commonTypedHeaders maps the headers that are not plain strings in
+// any assertion type to their type.
+var commonTypedHeaders = map[string]string{
+	"revision":    "int",
+	"body-length": "int",
+}
+
+// typedHeaders maps, per assertion type, the paths of the headers that
+// are not plain strings to their type. Paths are made of the map keys
+// leading to a header separated by "/", lists are walked through
+// transparently.
+var typedHeaders = map[string]map[string]string{
+	"repair": {
+		"repair-id": "int",
+		"disabled":  "bool",
+	},
+	"snap-build": {
+		"snap-size": "int",
+	},
+	"snap-revision": {
+		"snap-size":     "int",
+		"snap-revision": "int",
+	},
+	"validation": {
+		"approved-snap-revision": "int",
+		"revoked":                "bool",
+	},
+	"validation-set": {
+		"sequence":       "int",
+		"snaps/revision": "int",
+	},
+}
+
+func typedValue(v interface{}, path string, types map[string]string) interface{} {
+	switch x := v.(type) {
+	case string:
+		switch types[path] {
+		case "int":
+			if n, err := strconv.ParseInt(x, 10, 64); err == nil {
+				return n
+			}
+		case "bool":
+			if b, err := strconv.ParseBool(x); err == nil {
+				return b
+			}
+		}
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, elem := range x {
+			l[i] = typedValue(elem, path, types)
+		}
+		return l
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, elem := range x {
+			m[k] = typedValue(elem, path+"/"+k, types)
+		}
+		return m
+	}
+	return v
+}
+
+func typedHeaderValues(assertType *AssertionType, headers map[string]interface{}) map[string]interface{} {
+	types := make(map[string]string, len(commonTypedHeaders))
+	for name, typ := range commonTypedHeaders {
+		types[name] = typ
+	}
+	for path, typ := range typedHeaders[assertType.Name] {
+		types[path] = typ
+	}
+	typed := make(map[string]interface{}, len(headers))
+	for k, v := range headers {
+		typed[k] = typedValue(v, k, types)
+	}
+	return typed
+}
+
+// ToStructured returns the structured representation of the assertion.
+// Only the integer and boolean headers known for the assertion type,
+// including nested ones, are converted, all others are left as
+// strings as in the encoded assertion.
+func ToStructured(assert Assertion) *Structured {
+	_, signature := assert.Signature()
+	s := &Structured{
+		Type:      assert.Type().Name,
+		Headers:   typedHeaderValues(assert.Type(), assert.Headers()),
+		SignKeyID: assert.SignKeyID(),
+		Signature: strings.TrimSpace(string(signature)),
+	}
+	if body := assert.Body(); len(body) != 0 {
+		s.Body = base64.StdEncoding.EncodeToString(body)
+	}
+	return s
+}
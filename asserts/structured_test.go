@@ -0,0 +1,150 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type structuredSuite struct{}
+
+var _ = Suite(&structuredSuite{})
+
+func (ss *structuredSuite) TestToStructured(c *C) {
+	encoded := "type: test-only\n" +
+		"authority-id: auth-id1\n" +
+		"primary-key: abc\n" +
+		"list:\n  - one\n  - two\n" +
+		"map:\n  k: v\n" +
+		"body-length: 4\n" +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"body" +
+		"\n\n" +
+		"AXNpZw=="
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+
+	s := asserts.ToStructured(a)
+	c.Check(s, DeepEquals, &asserts.Structured{
+		Type: "test-only",
+		Headers: map[string]interface{}{
+			"type":              "test-only",
+			"authority-id":      "auth-id1",
+			"primary-key":       "abc",
+			"list":              []interface{}{"one", "two"},
+			"map":               map[string]interface{}{"k": "v"},
+			"body-length":       int64(4),
+			"sign-key-sha3-384": "Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij",
+		},
+		Body:      "Ym9keQ==",
+		SignKeyID: "Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij",
+		Signature: "AXNpZw==",
+	})
+
+	b, err := json.Marshal(s)
+	c.Assert(err, IsNil)
+	var m map[string]interface{}
+	c.Assert(json.Unmarshal(b, &m), IsNil)
+	c.Check(m["body"], Equals, "Ym9keQ==")
+	c.Check(m["headers"].(map[string]interface{})["list"], DeepEquals, []interface{}{"one", "two"})
+	c.Check(m["headers"].(map[string]interface{})["body-length"], Equals, float64(4))
+}
+
+func (ss *structuredSuite) TestToStructuredTypedHeaders(c *C) {
+	encoded := "type: test-only\n" +
+		"authority-id: auth-id1\n" +
+		"primary-key: 123\n" +
+		"revision: 2\n" +
+		"revoked: true\n" +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+
+	headers := asserts.ToStructured(a).Headers
+	// only the headers known for the type are converted
+	c.Check(headers["primary-key"], Equals, "123")
+	c.Check(headers["revision"], Equals, int64(2))
+	c.Check(headers["revoked"], Equals, "true")
+}
+
+func (ss *structuredSuite) TestToStructuredNestedTypedHeaders(c *C) {
+	encoded := "type: validation-set\n" +
+		"authority-id: dev-id1\n" +
+		"series: 16\n" +
+		"account-id: dev-id1\n" +
+		"name: base-set\n" +
+		"sequence: 2\n" +
+		"snaps:\n" +
+		"  -\n" +
+		"    name: foo\n" +
+		"    id: snap-id-1\n" +
+		"    revision: 10\n" +
+		"  -\n" +
+		"    name: 42\n" +
+		"    id: snap-id-2\n" +
+		"    presence: optional\n" +
+		"timestamp: 2016-10-01T12:00:00Z\n" +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+
+	headers := asserts.ToStructured(a).Headers
+	c.Check(headers["series"], Equals, "16")
+	c.Check(headers["sequence"], Equals, int64(2))
+	c.Check(headers["snaps"], DeepEquals, []interface{}{
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "snap-id-1",
+			"revision": int64(10),
+		},
+		map[string]interface{}{
+			"name":     "42",
+			"id":       "snap-id-2",
+			"presence": "optional",
+		},
+	})
+}
+
+func (ss *structuredSuite) TestToStructuredNoBody(c *C) {
+	encoded := "type: test-only\n" +
+		"authority-id: auth-id1\n" +
+		"primary-key: abc\n" +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+
+	b, err := json.Marshal(asserts.ToStructured(a))
+	c.Assert(err, IsNil)
+	var m map[string]interface{}
+	c.Assert(json.Unmarshal(b, &m), IsNil)
+	_, ok := m["body"]
+	c.Check(ok, Equals, false)
+}
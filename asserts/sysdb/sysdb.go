@@ -26,7 +26,7 @@ import (
 )
 
 func openDatabaseAt(path string, cfg *asserts.DatabaseConfig) (*asserts.Database, error) {
-	bs, err := asserts.OpenFSBackstore(path)
+	bs, err := asserts.OpenIndexedBackstore(path)
 	if err != nil {
 		return nil, err
 	}
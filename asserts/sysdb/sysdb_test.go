@@ -127,7 +127,7 @@ func (sdbs *sysDBSuite) TestOpenSysDatabaseExtras(c *C) {
 func (sdbs *sysDBSuite) TestOpenSysDatabaseBackstoreOpenFail(c *C) {
 	// make it not world-writeable
 	oldUmask := syscall.Umask(0)
-	os.MkdirAll(filepath.Join(dirs.SnapAssertsDBDir, "asserts-v0"), 0777)
+	os.MkdirAll(filepath.Join(dirs.SnapAssertsDBDir, "asserts-v1"), 0777)
 	syscall.Umask(oldUmask)
 
 	db, err := sysdb.Open()
@@ -0,0 +1,215 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Presence represents the presence constraint of a snap in a validation set.
+type Presence string
+
+const (
+	// PresenceRequired means the snap must be installed.
+	PresenceRequired Presence = "required"
+	// PresenceOptional means the snap can be installed or not.
+	PresenceOptional Presence = "optional"
+	// PresenceInvalid means the snap must not be installed.
+	PresenceInvalid Presence = "invalid"
+)
+
+// ValidationSetSnap holds the details about a snap constrained by a
+// validation-set assertion.
+type ValidationSetSnap struct {
+	Name     string
+	SnapID   string
+	Presence Presence
+	// Revision is the required revision of the snap, 0 if any revision
+	// is fine.
+	Revision int
+}
+
+// ValidationSet holds a validation-set assertion, listing snaps that
+// must be present at a given revision, may be present or must not be
+// present on a system tracking the set.
+type ValidationSet struct {
+	assertionBase
+	sequence  int
+	snaps     []*ValidationSetSnap
+	timestamp time.Time
+}
+
+// Series returns the series for which the validation set holds.
+func (vs *ValidationSet) Series() string {
+	return vs.HeaderString("series")
+}
+
+// AccountID returns the identifier of the account that issued the validation set.
+func (vs *ValidationSet) AccountID() string {
+	return vs.HeaderString("account-id")
+}
+
+// Name returns the name of the validation set within the account.
+func (vs *ValidationSet) Name() string {
+	return vs.HeaderString("name")
+}
+
+// Sequence returns the sequence number of this version of the validation set.
+func (vs *ValidationSet) Sequence() int {
+	return vs.sequence
+}
+
+// Snaps returns the snaps constrained by the validation set.
+func (vs *ValidationSet) Snaps() []*ValidationSetSnap {
+	return vs.snaps
+}
+
+// Timestamp returns the time when the validation set was issued.
+func (vs *ValidationSet) Timestamp() time.Time {
+	return vs.timestamp
+}
+
+// Prerequisites returns references to this validation set's prerequisite assertions.
+func (vs *ValidationSet) Prerequisites() []*Ref {
+	return []*Ref{
+		{Type: AccountType, PrimaryKey: []string{vs.AccountID()}},
+	}
+}
+
+var validValidationSetName = regexp.MustCompile("^[a-z0-9](?:-?[a-z0-9])*$")
+
+func checkValidationSetSnap(snap interface{}) (*ValidationSetSnap, error) {
+	m, ok := snap.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(`"snaps" header must be a list of maps`)
+	}
+
+	name, err := checkNotEmptyStringWhat(m, "name", "of snap")
+	if err != nil {
+		return nil, err
+	}
+	what := fmt.Sprintf("of snap %q", name)
+
+	snapID, err := checkNotEmptyStringWhat(m, "id", what)
+	if err != nil {
+		return nil, err
+	}
+
+	presence := PresenceRequired
+	if v, ok := m["presence"]; ok {
+		s, _ := v.(string)
+		switch p := Presence(s); p {
+		case PresenceRequired, PresenceOptional, PresenceInvalid:
+			presence = p
+		default:
+			return nil, fmt.Errorf(`"presence" %s must be one of required, optional or invalid: %v`, what, v)
+		}
+	}
+
+	revision := 0
+	if v, ok := m["revision"]; ok {
+		s, _ := v.(string)
+		revision, err = strconv.Atoi(s)
+		if err != nil || revision < 1 {
+			return nil, fmt.Errorf(`"revision" %s must be >=1: %v`, what, v)
+		}
+		if presence == PresenceInvalid {
+			return nil, fmt.Errorf(`"revision" %s cannot be specified for an invalid snap`, what)
+		}
+	}
+
+	return &ValidationSetSnap{
+		Name:     name,
+		SnapID:   snapID,
+		Presence: presence,
+		Revision: revision,
+	}, nil
+}
+
+func checkNotEmptyStringWhat(m map[string]interface{}, name, what string) (string, error) {
+	v, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("%q %s is mandatory", name, what)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%q %s must be a string", name, what)
+	}
+	if s == "" {
+		return "", fmt.Errorf("%q %s should not be empty", name, what)
+	}
+	return s, nil
+}
+
+func assembleValidationSet(assert assertionBase) (Assertion, error) {
+	accountID, err := checkNotEmptyString(assert.headers, "account-id")
+	if err != nil {
+		return nil, err
+	}
+	if accountID != assert.AuthorityID() {
+		return nil, fmt.Errorf("authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: %q != %q", assert.AuthorityID(), accountID)
+	}
+
+	_, err = checkStringMatches(assert.headers, "name", validValidationSetName)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence, err := checkInt(assert.headers, "sequence")
+	if err != nil {
+		return nil, err
+	}
+	if sequence < 1 {
+		return nil, fmt.Errorf(`"sequence" header must be >=1: %d`, sequence)
+	}
+
+	snapList, ok := assert.headers["snaps"].([]interface{})
+	if !ok || len(snapList) == 0 {
+		return nil, fmt.Errorf(`"snaps" header must be a non-empty list of maps`)
+	}
+	snaps := make([]*ValidationSetSnap, 0, len(snapList))
+	seen := make(map[string]bool, len(snapList))
+	for _, v := range snapList {
+		snap, err := checkValidationSetSnap(v)
+		if err != nil {
+			return nil, err
+		}
+		if seen[snap.Name] {
+			return nil, fmt.Errorf("cannot list the same snap %q multiple times", snap.Name)
+		}
+		seen[snap.Name] = true
+		snaps = append(snaps, snap)
+	}
+
+	timestamp, err := checkRFC3339Date(assert.headers, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValidationSet{
+		assertionBase: assert,
+		sequence:      sequence,
+		snaps:         snaps,
+		timestamp:     timestamp,
+	}, nil
+}
@@ -0,0 +1,166 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type validationSetSuite struct {
+	ts     time.Time
+	tsLine string
+}
+
+var _ = Suite(&validationSetSuite{})
+
+func (vss *validationSetSuite) SetUpSuite(c *C) {
+	vss.ts = time.Now().Truncate(time.Second).UTC()
+	vss.tsLine = "timestamp: " + vss.ts.Format(time.RFC3339) + "\n"
+}
+
+const validationSetSnaps = `snaps:
+  -
+    name: foo
+    id: snap-id-1
+    presence: required
+    revision: 10
+  -
+    name: bar
+    id: snap-id-2
+    presence: optional
+  -
+    name: baz
+    id: snap-id-3
+    presence: invalid
+  -
+    name: quux
+    id: snap-id-4
+`
+
+func (vss *validationSetSuite) makeValidEncoded() string {
+	return "type: validation-set\n" +
+		"authority-id: dev-id1\n" +
+		"series: 16\n" +
+		"account-id: dev-id1\n" +
+		"name: base-set\n" +
+		"sequence: 2\n" +
+		validationSetSnaps +
+		vss.tsLine +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+}
+
+func (vss *validationSetSuite) TestDecodeOK(c *C) {
+	encoded := vss.makeValidEncoded()
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.ValidationSetType)
+	vs := a.(*asserts.ValidationSet)
+	c.Check(vs.AuthorityID(), Equals, "dev-id1")
+	c.Check(vs.Timestamp(), Equals, vss.ts)
+	c.Check(vs.Series(), Equals, "16")
+	c.Check(vs.AccountID(), Equals, "dev-id1")
+	c.Check(vs.Name(), Equals, "base-set")
+	c.Check(vs.Sequence(), Equals, 2)
+	c.Check(vs.Snaps(), DeepEquals, []*asserts.ValidationSetSnap{
+		{Name: "foo", SnapID: "snap-id-1", Presence: asserts.PresenceRequired, Revision: 10},
+		{Name: "bar", SnapID: "snap-id-2", Presence: asserts.PresenceOptional},
+		{Name: "baz", SnapID: "snap-id-3", Presence: asserts.PresenceInvalid},
+		{Name: "quux", SnapID: "snap-id-4", Presence: asserts.PresenceRequired},
+	})
+}
+
+const (
+	validationSetErrPrefix = "assertion validation-set: "
+)
+
+func (vss *validationSetSuite) TestDecodeInvalid(c *C) {
+	encoded := vss.makeValidEncoded()
+
+	invalidTests := []struct{ original, invalid, expectedErr string }{
+		{"account-id: dev-id1\n", "", `"account-id" header is mandatory`},
+		{"account-id: dev-id1\n", "account-id: other\n", `authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: "dev-id1" != "other"`},
+		{"name: base-set\n", "", `"name" header is mandatory`},
+		{"name: base-set\n", "name: Base_Set\n", `"name" header contains invalid characters: "Base_Set"`},
+		{"sequence: 2\n", "", `"sequence" header is mandatory`},
+		{"sequence: 2\n", "sequence: x\n", `"sequence" header is not an integer: x`},
+		{"sequence: 2\n", "sequence: 0\n", `"sequence" header must be >=1: 0`},
+		{validationSetSnaps, "", `"snaps" header must be a non-empty list of maps`},
+		{validationSetSnaps, "snaps: foo\n", `"snaps" header must be a non-empty list of maps`},
+		{validationSetSnaps, "snaps:\n  - foo\n", `"snaps" header must be a list of maps`},
+		{"    name: foo\n", "", `"name" of snap is mandatory`},
+		{"    id: snap-id-1\n", "", `"id" of snap "foo" is mandatory`},
+		{"    presence: required\n", "    presence: maybe\n", `"presence" of snap "foo" must be one of required, optional or invalid: maybe`},
+		{"    revision: 10\n", "    revision: 0\n", `"revision" of snap "foo" must be >=1: 0`},
+		{"    presence: invalid\n", "    presence: invalid\n    revision: 1\n", `"revision" of snap "baz" cannot be specified for an invalid snap`},
+		{"    name: bar\n", "    name: foo\n", `cannot list the same snap "foo" multiple times`},
+		{vss.tsLine, "", `"timestamp" header is mandatory`},
+	}
+
+	for _, test := range invalidTests {
+		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
+		_, err := asserts.Decode([]byte(invalid))
+		c.Check(err, ErrorMatches, validationSetErrPrefix+test.expectedErr)
+	}
+}
+
+func (vss *validationSetSuite) TestValidationSetCheck(c *C) {
+	storeDB, db := makeStoreAndCheckDB(c)
+	devDB := setup3rdPartySigning(c, "dev-id1", storeDB, db)
+
+	headers := map[string]interface{}{
+		"series":     "16",
+		"account-id": "dev-id1",
+		"name":       "base-set",
+		"sequence":   "1",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "foo",
+				"id":       "snap-id-1",
+				"revision": "10",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	vs, err := devDB.Sign(asserts.ValidationSetType, headers, nil, "")
+	c.Assert(err, IsNil)
+
+	err = db.Check(vs)
+	c.Assert(err, IsNil)
+}
+
+func (vss *validationSetSuite) TestPrerequisites(c *C) {
+	encoded := vss.makeValidEncoded()
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+
+	prereqs := a.Prerequisites()
+	c.Assert(prereqs, HasLen, 1)
+	c.Check(prereqs[0], DeepEquals, &asserts.Ref{
+		Type:       asserts.AccountType,
+		PrimaryKey: []string{"dev-id1"},
+	})
+}
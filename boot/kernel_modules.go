@@ -0,0 +1,328 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/timeout"
+)
+
+// kernelModulesConf returns the modules-load.d file listing the
+// modules of the kernel snap.
+func kernelModulesConf() string {
+	return filepath.Join(dirs.SnapKModModulesDir, "snap-kernel.conf")
+}
+
+// UpdateKernelModulesAndFirmware sets up the system to load the kernel
+// modules and use the firmware directories the given kernel snap
+// declares, replacing what any other revision of the kernel had set up.
+// It is to be called only once s is the booted kernel, for a kernel the
+// bootloader fell back from never to get used with them. The firmware
+// directories get mounted from s and the modules loaded right away.
+//
+// All the mount units and the modules list are written before any of
+// them gets used, and on error they are put back as they were and the
+// previous setup gets reloaded, so the system is never left with a mix
+// of revisions.
+func UpdateKernelModulesAndFirmware(s *snap.Info) error {
+	if release.OnClassic {
+		return nil
+	}
+	if s.Type != snap.TypeKernel {
+		return nil
+	}
+
+	kernelInfo, err := snap.ReadKernelInfo(s)
+	if err != nil {
+		return err
+	}
+
+	saved := make(savedFiles)
+	fw, err := writeFirmwareMounts(s, kernelInfo.Firmware, saved)
+	if err != nil {
+		saved.restore()
+		return fmt.Errorf("cannot setup firmware of snap %q: %v", s.Name(), err)
+	}
+	modulesChanged, err := writeKernelModulesConf(kernelInfo.Modules, saved)
+	if err != nil {
+		saved.restore()
+		return fmt.Errorf("cannot setup kernel modules of snap %q: %v", s.Name(), err)
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, &progress.NullProgress{})
+	if err := fw.activate(sysd); err != nil {
+		fw.rollback(sysd, saved, modulesChanged)
+		return fmt.Errorf("cannot setup firmware of snap %q: %v", s.Name(), err)
+	}
+	// the modules can need the firmware
+	if modulesChanged && !release.Preseeding {
+		if err := sysd.Restart("systemd-modules-load.service", unitRestartTimeout); err != nil {
+			fw.rollback(sysd, saved, modulesChanged)
+			return fmt.Errorf("cannot load kernel modules of snap %q: %v", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+var unitRestartTimeout = time.Duration(timeout.DefaultTimeout)
+
+type savedFile struct {
+	content []byte
+	existed bool
+}
+
+// savedFiles keeps what files contained before they got rewritten or
+// removed, so they can be put back.
+type savedFiles map[string]savedFile
+
+func (sf savedFiles) save(path string) error {
+	if _, ok := sf[path]; ok {
+		return nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		sf[path] = savedFile{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sf[path] = savedFile{content: content, existed: true}
+	return nil
+}
+
+func (sf savedFiles) restore() {
+	for path, saved := range sf {
+		var err error
+		if saved.existed {
+			err = osutil.AtomicWriteFile(path, saved.content, 0644, 0)
+		} else {
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			logger.Noticef("cannot restore %q: %v", path, err)
+		}
+	}
+}
+
+// writeKernelModulesConf lists modules to be loaded, returning whether
+// there are modules to load that were not listed before.
+func writeKernelModulesConf(modules []string, saved savedFiles) (changed bool, err error) {
+	conf := kernelModulesConf()
+	if err := saved.save(conf); err != nil {
+		return false, err
+	}
+	if len(modules) == 0 {
+		if err := os.Remove(conf); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	if err := os.MkdirAll(dirs.SnapKModModulesDir, 0755); err != nil {
+		return false, err
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString("# This file is automatically generated.\n")
+	for _, module := range modules {
+		buffer.WriteString(module)
+		buffer.WriteByte('\n')
+	}
+	if bytes.Equal(saved[conf].content, buffer.Bytes()) {
+		return false, nil
+	}
+	if err := osutil.AtomicWriteFile(conf, buffer.Bytes(), 0644, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// firmwareMounts are the firmware mount units that changed when
+// switching to another kernel revision.
+type firmwareMounts struct {
+	// added units mount directories that were not mounted before
+	added []string
+	// moved units mount directories from another revision than before
+	moved []string
+	// dropped units were removed as their directories are not
+	// declared anymore
+	dropped []string
+}
+
+// writeFirmwareMounts rewrites the mount units of the firmware
+// directories to point to the given kernel revision, without using
+// them yet. The units of directories it does not declare anymore are
+// left to activate to drop.
+func writeFirmwareMounts(s *snap.Info, firmware []string, saved savedFiles) (*firmwareMounts, error) {
+	firmwareDir := dirs.StripRootDir(dirs.FirmwareDir)
+	existing, err := filepath.Glob(filepath.Join(dirs.SnapServicesDir, systemd.EscapeUnitNamePath(firmwareDir)+"-*.mount"))
+	if err != nil {
+		return nil, err
+	}
+	fw := &firmwareMounts{}
+	if len(firmware) == 0 && len(existing) == 0 {
+		return fw, nil
+	}
+
+	// check everything before writing anything
+	for _, dir := range firmware {
+		if !osutil.IsDirectory(filepath.Join(s.MountDir(), "firmware", dir)) {
+			return nil, fmt.Errorf("firmware directory %q is not a directory in the snap", dir)
+		}
+	}
+
+	if err := os.MkdirAll(dirs.SnapServicesDir, 0755); err != nil {
+		return nil, err
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, &progress.NullProgress{})
+	keep := make(map[string]bool, len(firmware))
+	for _, dir := range firmware {
+		what := filepath.Join(s.MountDir(), "firmware", dir)
+		where := filepath.Join(firmwareDir, dir)
+		path := systemd.MountUnitPath(where, "mount")
+		if err := saved.save(path); err != nil {
+			return nil, err
+		}
+		unit, err := sysd.WriteMountUnitFile(s.Name(), dirs.StripRootDir(what), where, "bind")
+		if err != nil {
+			return nil, err
+		}
+		keep[unit] = true
+		previous := saved[path]
+		if !previous.existed {
+			fw.added = append(fw.added, unit)
+			continue
+		}
+		current, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(previous.content, current) {
+			fw.moved = append(fw.moved, unit)
+		}
+	}
+	for _, path := range existing {
+		if unit := filepath.Base(path); !keep[unit] {
+			if err := saved.save(path); err != nil {
+				return nil, err
+			}
+			fw.dropped = append(fw.dropped, unit)
+		}
+	}
+	return fw, nil
+}
+
+// activate drops the units not needed anymore, and mounts what the
+// written units point to.
+func (fw *firmwareMounts) activate(sysd systemd.Systemd) error {
+	// what is not declared anymore stays mounted until the next
+	// reboot
+	for _, unit := range fw.dropped {
+		if err := sysd.Disable(unit); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(dirs.SnapServicesDir, unit)); err != nil {
+			return err
+		}
+	}
+
+	if release.Preseeding {
+		// the systemd of the image is not running yet
+		for _, unit := range fw.added {
+			if err := sysd.Enable(unit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(fw.added)+len(fw.moved)+len(fw.dropped) == 0 {
+		return nil
+	}
+	if err := sysd.DaemonReload(); err != nil {
+		return err
+	}
+	for _, unit := range fw.added {
+		if err := sysd.Enable(unit); err != nil {
+			return err
+		}
+		if err := sysd.Start(unit); err != nil {
+			return err
+		}
+	}
+	// remount from the new revision what was mounted from another one
+	for _, unit := range fw.moved {
+		if err := sysd.Restart(unit, unitRestartTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback puts back the saved files and goes back to using them, as
+// far as it can.
+func (fw *firmwareMounts) rollback(sysd systemd.Systemd, saved savedFiles, modulesChanged bool) {
+	undo := func(err error) {
+		if err != nil {
+			logger.Noticef("cannot undo the switch of kernel modules and firmware: %v", err)
+		}
+	}
+
+	if !release.Preseeding {
+		for _, unit := range fw.added {
+			undo(sysd.Stop(unit, unitRestartTimeout))
+		}
+	}
+	for _, unit := range fw.added {
+		undo(sysd.Disable(unit))
+	}
+	saved.restore()
+	for _, unit := range fw.dropped {
+		undo(sysd.Enable(unit))
+	}
+	if release.Preseeding {
+		return
+	}
+
+	undo(sysd.DaemonReload())
+	for _, unit := range fw.moved {
+		undo(sysd.Restart(unit, unitRestartTimeout))
+	}
+	if modulesChanged {
+		undo(sysd.Restart("systemd-modules-load.service", unitRestartTimeout))
+	}
+}
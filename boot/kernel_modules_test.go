@@ -0,0 +1,244 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+)
+
+type kernelModulesSuite struct {
+	restoreClassic func()
+	prevctlCmd     func(...string) ([]byte, error)
+	sysdCalls      [][]string
+}
+
+var _ = Suite(&kernelModulesSuite{})
+
+func (s *kernelModulesSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.restoreClassic = release.MockOnClassic(false)
+
+	s.sysdCalls = nil
+	s.prevctlCmd = systemd.SystemctlCmd
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		s.sysdCalls = append(s.sysdCalls, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+}
+
+func (s *kernelModulesSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("")
+	s.restoreClassic()
+	systemd.SystemctlCmd = s.prevctlCmd
+}
+
+func readFile(c *C, path string) string {
+	content, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	return string(content)
+}
+
+func (s *kernelModulesSuite) mockKernel(c *C, rev int, kernelYaml string, firmware ...string) *snap.Info {
+	info := snaptest.MockSnap(c, packageKernel, &snap.SideInfo{Revision: snap.R(rev)})
+	err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "kernel.yaml"), []byte(kernelYaml), 0644)
+	c.Assert(err, IsNil)
+	for _, dir := range firmware {
+		err := os.MkdirAll(filepath.Join(info.MountDir(), "firmware", dir), 0755)
+		c.Assert(err, IsNil)
+	}
+	return info
+}
+
+func (s *kernelModulesSuite) TestUpdateKernelModulesAndFirmware(c *C) {
+	info := s.mockKernel(c, 1, `
+modules: [snd-hda-intel, btusb]
+firmware: [brcm, ti-connectivity]
+`, "brcm", "ti-connectivity")
+
+	err := boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+
+	conf := filepath.Join(dirs.SnapKModModulesDir, "snap-kernel.conf")
+	c.Check(readFile(c, conf), Equals, "# This file is automatically generated.\nsnd-hda-intel\nbtusb\n")
+
+	brcmUnit := filepath.Join(dirs.SnapServicesDir, "lib-firmware-brcm.mount")
+	tiUnit := filepath.Join(dirs.SnapServicesDir, "lib-firmware-ti\\x2dconnectivity.mount")
+	c.Check(strings.Contains(readFile(c, brcmUnit), "What=/snap/ubuntu-kernel/1/firmware/brcm\nWhere=/lib/firmware/brcm\nType=none\nOptions=bind\n"), Equals, true)
+	c.Check(osutil.FileExists(tiUnit), Equals, true)
+	c.Check(s.sysdCalls, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"--root", dirs.GlobalRootDir, "enable", "lib-firmware-brcm.mount"},
+		{"start", "lib-firmware-brcm.mount"},
+		{"--root", dirs.GlobalRootDir, "enable", "lib-firmware-ti\\x2dconnectivity.mount"},
+		{"start", "lib-firmware-ti\\x2dconnectivity.mount"},
+		{"stop", "systemd-modules-load.service"},
+		{"show", "--property=ActiveState", "systemd-modules-load.service"},
+		{"start", "systemd-modules-load.service"},
+	})
+
+	// the next revision drops a module and a firmware directory
+	s.sysdCalls = nil
+	info = s.mockKernel(c, 2, `
+modules: [btusb]
+firmware: [brcm]
+`, "brcm")
+
+	err = boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+
+	c.Check(readFile(c, conf), Equals, "# This file is automatically generated.\nbtusb\n")
+	c.Check(strings.Contains(readFile(c, brcmUnit), "What=/snap/ubuntu-kernel/2/firmware/brcm\n"), Equals, true)
+	c.Check(osutil.FileExists(tiUnit), Equals, false)
+	// the firmware is remounted from the new revision
+	c.Check(s.sysdCalls, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "disable", "lib-firmware-ti\\x2dconnectivity.mount"},
+		{"daemon-reload"},
+		{"stop", "lib-firmware-brcm.mount"},
+		{"show", "--property=ActiveState", "lib-firmware-brcm.mount"},
+		{"start", "lib-firmware-brcm.mount"},
+		{"stop", "systemd-modules-load.service"},
+		{"show", "--property=ActiveState", "systemd-modules-load.service"},
+		{"start", "systemd-modules-load.service"},
+	})
+
+	// nothing to do when nothing changed
+	s.sysdCalls = nil
+	err = boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdCalls, HasLen, 0)
+}
+
+func (s *kernelModulesSuite) TestUpdateKernelModulesAndFirmwareRollback(c *C) {
+	info := s.mockKernel(c, 1, `
+modules: [snd-hda-intel]
+firmware: [brcm, ti-connectivity]
+`, "brcm", "ti-connectivity")
+	err := boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+
+	conf := filepath.Join(dirs.SnapKModModulesDir, "snap-kernel.conf")
+	brcmUnit := filepath.Join(dirs.SnapServicesDir, "lib-firmware-brcm.mount")
+	tiUnit := filepath.Join(dirs.SnapServicesDir, "lib-firmware-ti\\x2dconnectivity.mount")
+	iwlUnit := filepath.Join(dirs.SnapServicesDir, "lib-firmware-iwlwifi.mount")
+	oldBrcm := readFile(c, brcmUnit)
+	oldTi := readFile(c, tiUnit)
+
+	s.sysdCalls = nil
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		s.sysdCalls = append(s.sysdCalls, cmd)
+		if len(cmd) == 2 && cmd[0] == "start" && cmd[1] == "lib-firmware-iwlwifi.mount" {
+			return nil, errors.New("boom")
+		}
+		return []byte("ActiveState=inactive\n"), nil
+	}
+	info = s.mockKernel(c, 2, `
+modules: [btusb]
+firmware: [brcm, iwlwifi]
+`, "brcm", "iwlwifi")
+
+	err = boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, ErrorMatches, `cannot setup firmware of snap "ubuntu-kernel": boom`)
+
+	// everything is back to the previous revision
+	c.Check(readFile(c, conf), Equals, "# This file is automatically generated.\nsnd-hda-intel\n")
+	c.Check(readFile(c, brcmUnit), Equals, oldBrcm)
+	c.Check(readFile(c, tiUnit), Equals, oldTi)
+	c.Check(osutil.FileExists(iwlUnit), Equals, false)
+	c.Check(s.sysdCalls, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "disable", "lib-firmware-ti\\x2dconnectivity.mount"},
+		{"daemon-reload"},
+		{"--root", dirs.GlobalRootDir, "enable", "lib-firmware-iwlwifi.mount"},
+		{"start", "lib-firmware-iwlwifi.mount"},
+		// rollback
+		{"stop", "lib-firmware-iwlwifi.mount"},
+		{"show", "--property=ActiveState", "lib-firmware-iwlwifi.mount"},
+		{"--root", dirs.GlobalRootDir, "disable", "lib-firmware-iwlwifi.mount"},
+		{"--root", dirs.GlobalRootDir, "enable", "lib-firmware-ti\\x2dconnectivity.mount"},
+		{"daemon-reload"},
+		{"stop", "lib-firmware-brcm.mount"},
+		{"show", "--property=ActiveState", "lib-firmware-brcm.mount"},
+		{"start", "lib-firmware-brcm.mount"},
+		{"stop", "systemd-modules-load.service"},
+		{"show", "--property=ActiveState", "systemd-modules-load.service"},
+		{"start", "systemd-modules-load.service"},
+	})
+}
+
+func (s *kernelModulesSuite) TestUpdateKernelModulesAndFirmwareNoMetadata(c *C) {
+	conf := filepath.Join(dirs.SnapKModModulesDir, "snap-kernel.conf")
+	err := os.MkdirAll(dirs.SnapKModModulesDir, 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(conf, []byte("old\n"), 0644)
+	c.Assert(err, IsNil)
+
+	info := snaptest.MockSnap(c, packageKernel, &snap.SideInfo{Revision: snap.R(1)})
+	err = boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+
+	c.Check(osutil.FileExists(conf), Equals, false)
+	c.Check(s.sysdCalls, HasLen, 0)
+}
+
+func (s *kernelModulesSuite) TestUpdateKernelModulesAndFirmwareMissingFirmwareDir(c *C) {
+	info := s.mockKernel(c, 1, "firmware: [brcm]\n")
+
+	err := boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, ErrorMatches, `cannot setup firmware of snap "ubuntu-kernel": firmware directory "brcm" is not a directory in the snap`)
+	c.Check(s.sysdCalls, HasLen, 0)
+}
+
+func (s *kernelModulesSuite) TestUpdateKernelModulesAndFirmwarePreseeding(c *C) {
+	restore := release.MockPreseeding(true)
+	defer restore()
+
+	info := s.mockKernel(c, 1, "firmware: [brcm]\n", "brcm")
+
+	err := boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdCalls, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "lib-firmware-brcm.mount"},
+	})
+}
+
+func (s *kernelModulesSuite) TestUpdateKernelModulesAndFirmwareNotOnClassic(c *C) {
+	restore := release.MockOnClassic(true)
+	defer restore()
+
+	info := s.mockKernel(c, 1, "modules: [btusb]\nfirmware: [brcm]\n", "brcm")
+
+	err := boot.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapKModModulesDir, "snap-kernel.conf")), Equals, false)
+	c.Check(s.sysdCalls, HasLen, 0)
+}
@@ -20,6 +20,7 @@
 package boot
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -172,3 +173,45 @@ func KernelOrOsRebootRequired(s *snap.Info) bool {
 
 	return false
 }
+
+// ErrBootPending is returned by CheckBooted while the system has not yet
+// booted, or not yet confirmed booting, the OS or kernel snap.
+var ErrBootPending = errors.New("boot of new kernel or core not yet confirmed")
+
+// CheckBooted returns whether the given OS or kernel snap, scheduled
+// with SetNextBoot, was booted successfully. It returns false if the
+// bootloader fell back to the previous one instead, and ErrBootPending
+// while the outcome is not yet known.
+func CheckBooted(s *snap.Info) (bool, error) {
+	var goodBoot string
+	switch s.Type {
+	case snap.TypeKernel:
+		goodBoot = "snap_kernel"
+	case snap.TypeOS:
+		goodBoot = "snap_core"
+	default:
+		return false, fmt.Errorf("cannot check boot of snap %q of type %q", s.Name(), s.Type)
+	}
+
+	bootloader, err := partition.FindBootloader()
+	if err != nil {
+		return false, fmt.Errorf("cannot check boot: %s", err)
+	}
+
+	// snap_mode goes from "" -> "try" -> "trying" -> "", it is
+	// reset by the bootloader when falling back and by
+	// MarkBootSuccessful otherwise
+	mode, err := bootloader.GetBootVar("snap_mode")
+	if err != nil {
+		return false, err
+	}
+	if mode != "" {
+		return false, ErrBootPending
+	}
+	goodBootVer, err := bootloader.GetBootVar(goodBoot)
+	if err != nil {
+		return false, err
+	}
+
+	return goodBootVer == filepath.Base(s.MountFile()), nil
+}
@@ -204,3 +204,35 @@ func (s *kernelOSSuite) TestSetNextBootForKernel(c *C) {
 	s.bootloader.BootVars["snap_kernel"] = "krnl_42.snap"
 	c.Check(boot.KernelOrOsRebootRequired(info), Equals, false)
 }
+
+func (s *kernelOSSuite) TestCheckBooted(c *C) {
+	info := &snap.Info{}
+	info.Type = snap.TypeKernel
+	info.RealName = "krnl"
+	info.Revision = snap.R(42)
+
+	for _, t := range []struct {
+		mode, kernel string
+		booted       bool
+		err          error
+	}{
+		// reboot not happened yet
+		{"try", "krnl_40.snap", false, boot.ErrBootPending},
+		// booted but not yet marked successful
+		{"trying", "krnl_40.snap", false, boot.ErrBootPending},
+		// marked successful
+		{"", "krnl_42.snap", true, nil},
+		// bootloader fell back
+		{"", "krnl_40.snap", false, nil},
+	} {
+		s.bootloader.BootVars["snap_mode"] = t.mode
+		s.bootloader.BootVars["snap_kernel"] = t.kernel
+		booted, err := boot.CheckBooted(info)
+		c.Check(err, Equals, t.err)
+		c.Check(booted, Equals, t.booted)
+	}
+
+	info.Type = snap.TypeApp
+	_, err := boot.CheckBooted(info)
+	c.Check(err, ErrorMatches, `cannot check boot of snap "krnl" of type "app"`)
+}
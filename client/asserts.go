@@ -35,16 +35,44 @@ import (
 // verified with a known public key and the assertion consistent with
 // and its prerequisite in the database.
 func (client *Client) Ack(b []byte) error {
-	var rsp interface{}
-	if _, err := client.doSync("POST", "/v2/assertions", nil, nil, bytes.NewReader(b), &rsp); err != nil {
-		return fmt.Errorf("cannot assert: %v", err)
+	_, err := client.AckStream(bytes.NewReader(b))
+	return err
+}
+
+// AssertionRef identifies an assertion by its type and primary key.
+type AssertionRef struct {
+	Type       string   `json:"type"`
+	PrimaryKey []string `json:"primary-key"`
+}
+
+// AckStream tries to add a stream of assertions, in any order, to the
+// system assertion database, like Ack. It returns references to the
+// assertions that were effectively added, in the order they were added.
+func (client *Client) AckStream(r io.Reader) ([]*AssertionRef, error) {
+	var rsp struct {
+		Added []*AssertionRef `json:"added"`
+	}
+	if _, err := client.doSync("POST", "/v2/assertions", nil, nil, r, &rsp); err != nil {
+		return nil, fmt.Errorf("cannot assert: %v", err)
 	}
 
-	return nil
+	return rsp.Added, nil
 }
 
 // Known queries assertions with type assertTypeName and matching assertion headers.
 func (client *Client) Known(assertTypeName string, headers map[string]string) ([]asserts.Assertion, error) {
+	return client.known(assertTypeName, headers, false)
+}
+
+// KnownWithPrerequisites is like Known but it also returns the
+// prerequisites of the found assertions and the account-keys signing
+// them, ordered such that the result can be added as is to another
+// system.
+func (client *Client) KnownWithPrerequisites(assertTypeName string, headers map[string]string) ([]asserts.Assertion, error) {
+	return client.known(assertTypeName, headers, true)
+}
+
+func (client *Client) known(assertTypeName string, headers map[string]string, withPrereqs bool) ([]asserts.Assertion, error) {
 	path := fmt.Sprintf("/v2/assertions/%s", assertTypeName)
 	q := url.Values{}
 
@@ -53,6 +81,9 @@ func (client *Client) Known(assertTypeName string, headers map[string]string) ([
 			q.Set(k, v)
 		}
 	}
+	if withPrereqs {
+		q.Set("export-prerequisites", "true")
+	}
 
 	response, err := client.raw("GET", path, q, nil, nil)
 	if err != nil {
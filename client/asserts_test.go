@@ -24,10 +24,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/client"
 )
 
 func (cs *clientSuite) TestClientAssert(c *C) {
@@ -45,6 +47,27 @@ func (cs *clientSuite) TestClientAssert(c *C) {
 	c.Check(cs.req.URL.Path, Equals, "/v2/assertions")
 }
 
+func (cs *clientSuite) TestClientAckStream(c *C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {"added": [
+			{"type": "account-key", "primary-key": ["key-id"]},
+			{"type": "account", "primary-key": ["acct-id"]}
+		]}
+	}`
+	added, err := cs.cli.AckStream(strings.NewReader("Assertions."))
+	c.Assert(err, IsNil)
+	c.Check(added, DeepEquals, []*client.AssertionRef{
+		{Type: "account-key", PrimaryKey: []string{"key-id"}},
+		{Type: "account", PrimaryKey: []string{"acct-id"}},
+	})
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, "Assertions.")
+	c.Check(cs.req.Method, Equals, "POST")
+	c.Check(cs.req.URL.Path, Equals, "/v2/assertions")
+}
+
 func (cs *clientSuite) TestClientAssertsCallsEndpoint(c *C) {
 	_, _ = cs.cli.Known("snap-revision", nil)
 	c.Check(cs.req.Method, Equals, "GET")
@@ -65,6 +88,19 @@ func (cs *clientSuite) TestClientAssertsCallsEndpointWithFilter(c *C) {
 	})
 }
 
+func (cs *clientSuite) TestClientAssertsWithPrerequisitesCallsEndpoint(c *C) {
+	_, _ = cs.cli.KnownWithPrerequisites("snap-revision", map[string]string{
+		"snap-id": "snap-id-1",
+	})
+	u, err := url.ParseRequestURI(cs.req.URL.String())
+	c.Assert(err, IsNil)
+	c.Check(u.Path, Equals, "/v2/assertions/snap-revision")
+	c.Check(u.Query(), DeepEquals, url.Values{
+		"snap-id":              []string{"snap-id-1"},
+		"export-prerequisites": []string{"true"},
+	})
+}
+
 func (cs *clientSuite) TestClientAssertsHttpError(c *C) {
 	cs.err = errors.New("fail")
 	_, err := cs.cli.Known("snap-build", nil)
@@ -296,6 +296,7 @@ const (
 	ErrorKindLoginRequired     = "login-required"
 	ErrorKindTermsNotAccepted  = "terms-not-accepted"
 	ErrorKindNoPaymentMethods  = "no-payment-methods"
+	ErrorKindStoreUnavailable  = "store-unavailable"
 )
 
 // IsTwoFactorError returns whether the given error is due to problems
@@ -0,0 +1,58 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+type modelAction struct {
+	Action   string `json:"action"`
+	NewModel string `json:"new-model,omitempty"`
+}
+
+// Reregister asks the device to generate a new device key and obtain a new
+// serial with it. If newModel is not empty it is the encoded model assertion
+// the device should be registered for instead of its current one.
+func (client *Client) Reregister(newModel []byte) (changeID string, err error) {
+	b, err := json.Marshal(&modelAction{
+		Action:   "reregister",
+		NewModel: string(newModel),
+	})
+	if err != nil {
+		return "", err
+	}
+	return client.doAsync("POST", "/v2/model", nil, nil, bytes.NewReader(b))
+}
+
+// Remodel asks the device to move to the model of the given encoded
+// model assertion, installing the snaps it newly requires and
+// registering the device again for it.
+func (client *Client) Remodel(newModel []byte) (changeID string, err error) {
+	b, err := json.Marshal(&modelAction{
+		Action:   "remodel",
+		NewModel: string(newModel),
+	})
+	if err != nil {
+		return "", err
+	}
+	return client.doAsync("POST", "/v2/model", nil, nil, bytes.NewReader(b))
+}
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/snapcore/snapd/snap"
@@ -52,10 +53,21 @@ type Snap struct {
 	Broken        string        `json:"broken"`
 
 	Prices map[string]float64 `json:"prices"`
+
+	// TrackingChannel is the channel the snap follows on refresh,
+	// which might not be the one the current revision came from.
+	TrackingChannel string `json:"tracking-channel"`
+	// Channels is what the store has in each of the snap's channels.
+	Channels map[string]*snap.ChannelSnapInfo `json:"channels,omitempty"`
+
+	InstalledRevisions []snap.Revision `json:"installed-revisions,omitempty"`
+	LicenseAgreement   string          `json:"license-agreement,omitempty"`
+	LicenseVersion     string          `json:"license-version,omitempty"`
 }
 
 type AppInfo struct {
-	Name string `json:"name"`
+	Name   string `json:"name"`
+	Daemon string `json:"daemon,omitempty"`
 }
 
 // Statuses and types a snap may have.
@@ -75,18 +87,36 @@ const (
 )
 
 type ResultInfo struct {
-	SuggestedCurrency string `json:"suggested-currency"`
+	SuggestedCurrency string  `json:"suggested-currency"`
+	Paging            *Paging `json:"paging,omitempty"`
+}
+
+// Paging tells which page of results a find returned, out of how many.
+type Paging struct {
+	Page  int `json:"page"`
+	Pages int `json:"pages"`
 }
 
 // FindOptions supports exactly one of the following options:
 // - Refresh: only return snaps that are refreshable
 // - Private: return snaps that are private
 // - Query: only return snaps that match the query string
+// Section and Publisher can be combined with Private and Query to only
+// return snaps from the given store section or publisher, Confinement
+// and Architecture select the kind of snaps to return and Page and
+// PageSize the page of results.
 type FindOptions struct {
 	Refresh bool
 	Private bool
 	Prefix  bool
 	Query   string
+
+	Section      string
+	Publisher    string
+	Confinement  string
+	Architecture string
+	Page         int
+	PageSize     int
 }
 
 var ErrNoSnapsInstalled = errors.New("no snaps installed")
@@ -132,9 +162,27 @@ func (client *Client) Find(opts *FindOptions) ([]*Snap, *ResultInfo, error) {
 	q := url.Values{}
 	if opts.Prefix {
 		q.Set("name", opts.Query+"*")
-	} else {
+	} else if opts.Query != "" || (opts.Section == "" && opts.Publisher == "") {
 		q.Set("q", opts.Query)
 	}
+	if opts.Section != "" {
+		q.Set("section", opts.Section)
+	}
+	if opts.Publisher != "" {
+		q.Set("publisher", opts.Publisher)
+	}
+	if opts.Confinement != "" {
+		q.Set("confinement", opts.Confinement)
+	}
+	if opts.Architecture != "" {
+		q.Set("architecture", opts.Architecture)
+	}
+	if opts.Page > 0 {
+		q.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PageSize > 0 {
+		q.Set("size", strconv.Itoa(opts.PageSize))
+	}
 	switch {
 	case opts.Refresh && opts.Private:
 		return nil, nil, fmt.Errorf("cannot specify refresh and private together")
@@ -147,6 +195,16 @@ func (client *Client) Find(opts *FindOptions) ([]*Snap, *ResultInfo, error) {
 	return client.snapsFromPath("/v2/find", q)
 }
 
+// Sections returns the list of sections of the store.
+func (client *Client) Sections() ([]string, error) {
+	var sections []string
+	_, err := client.doSync("GET", "/v2/sections", nil, nil, nil, &sections)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get snap sections: %s", err)
+	}
+	return sections, nil
+}
+
 func (client *Client) FindOne(name string) (*Snap, *ResultInfo, error) {
 	q := url.Values{}
 	q.Set("name", name)
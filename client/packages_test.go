@@ -20,6 +20,7 @@
 package client_test
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"time"
@@ -27,6 +28,7 @@ import (
 	"gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/snap"
 )
 
 func (cs *clientSuite) TestClientSnapsCallsEndpoint(c *check.C) {
@@ -57,6 +59,72 @@ func (cs *clientSuite) TestClientFindPrivateSetsQuery(c *check.C) {
 	c.Check(cs.req.URL.Query().Get("select"), check.Equals, "private")
 }
 
+func (cs *clientSuite) TestClientFindSectionSetsQuery(c *check.C) {
+	_, _, _ = cs.cli.Find(&client.FindOptions{
+		Section: "games",
+	})
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/find")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"section": []string{"games"},
+	})
+
+	_, _, _ = cs.cli.Find(&client.FindOptions{
+		Query:   "foo",
+		Section: "games",
+	})
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"q": []string{"foo"}, "section": []string{"games"},
+	})
+}
+
+func (cs *clientSuite) TestClientFindFiltersSetQuery(c *check.C) {
+	_, _, _ = cs.cli.Find(&client.FindOptions{
+		Publisher:    "canonical",
+		Confinement:  client.DevmodeConfinement,
+		Architecture: "armhf",
+		Page:         2,
+		PageSize:     20,
+	})
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/find")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"publisher":    []string{"canonical"},
+		"confinement":  []string{"devmode"},
+		"architecture": []string{"armhf"},
+		"page":         []string{"2"},
+		"size":         []string{"20"},
+	})
+}
+
+func (cs *clientSuite) TestClientFindPaging(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [{"name": "foo"}],
+		"paging": {"page": 2, "pages": 5}
+	}`
+	snaps, ri, err := cs.cli.Find(&client.FindOptions{Query: "foo", Page: 2})
+	c.Assert(err, check.IsNil)
+	c.Check(snaps, check.HasLen, 1)
+	c.Check(ri.Paging, check.DeepEquals, &client.Paging{Page: 2, Pages: 5})
+}
+
+func (cs *clientSuite) TestClientSections(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": ["featured", "games"]
+	}`
+	sections, err := cs.cli.Sections()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/sections")
+	c.Check(sections, check.DeepEquals, []string{"featured", "games"})
+}
+
+func (cs *clientSuite) TestClientSectionsErrors(c *check.C) {
+	cs.err = errors.New("foo")
+	_, err := cs.cli.Sections()
+	c.Check(err, check.ErrorMatches, "cannot get snap sections: .*foo")
+}
+
 func (cs *clientSuite) TestClientSnapsInvalidSnapsJSON(c *check.C) {
 	cs.rsp = `{
 		"type": "sync",
@@ -164,7 +232,13 @@ func (cs *clientSuite) TestClientSnap(c *check.C) {
 			"confinement": "strict",
 			"private": true,
 			"devmode": true,
-			"trymode": true
+			"trymode": true,
+			"channel": "stable",
+			"tracking-channel": "beta",
+			"apps": [{"name": "svc", "daemon": "simple"}],
+			"installed-revisions": ["1", "2"],
+			"license-agreement": "explicit",
+			"license-version": "2"
 		}
 	}`
 	pkg, _, err := cs.cli.Snap(pkgName)
@@ -188,5 +262,13 @@ func (cs *clientSuite) TestClientSnap(c *check.C) {
 		Private:       true,
 		DevMode:       true,
 		TryMode:       true,
+
+		Channel:         "stable",
+		TrackingChannel: "beta",
+
+		Apps:               []client.AppInfo{{Name: "svc", Daemon: "simple"}},
+		InstalledRevisions: []snap.Revision{snap.R(1), snap.R(2)},
+		LicenseAgreement:   "explicit",
+		LicenseVersion:     "2",
 	})
 }
@@ -87,6 +87,12 @@ func (client *Client) Disable(name string, options *SnapOptions) (changeID strin
 	return client.doSnapAction("disable", name, options)
 }
 
+// Switch makes the snap with the given name track the given channel,
+// without refreshing it.
+func (client *Client) Switch(name string, options *SnapOptions) (changeID string, err error) {
+	return client.doSnapAction("switch", name, options)
+}
+
 // Revert rolls the snap back to the previous on-disk state
 func (client *Client) Revert(name string, options *SnapOptions) (changeID string, err error) {
 	return client.doSnapAction("revert", name, options)
@@ -0,0 +1,72 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ValidationSet holds how a validation set is tracked on the system.
+type ValidationSet struct {
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	PinnedAt  int    `json:"pinned-at,omitempty"`
+	Sequence  int    `json:"sequence"`
+	Valid     bool   `json:"valid"`
+}
+
+// ValidationSetAction describes an action on a validation set.
+type ValidationSetAction struct {
+	// Action is one of "monitor", "enforce" or "forget".
+	Action    string `json:"action"`
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	// Sequence pins the validation set to the given sequence, 0
+	// means the latest known one.
+	Sequence int `json:"sequence,omitempty"`
+}
+
+// ValidationSets lists the validation sets tracked on the system.
+func (client *Client) ValidationSets() ([]*ValidationSet, error) {
+	var vsets []*ValidationSet
+	_, err := client.doSync("GET", "/v2/validation-sets", nil, nil, nil, &vsets)
+	if err != nil {
+		return nil, err
+	}
+	return vsets, nil
+}
+
+// ApplyValidationSet starts tracking, changes how or stops tracking a
+// validation set, returning how it is tracked afterwards (nil when
+// forgotten).
+func (client *Client) ApplyValidationSet(action *ValidationSetAction) (*ValidationSet, error) {
+	b, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+	var vset *ValidationSet
+	_, err = client.doSync("POST", "/v2/validation-sets", nil, nil, bytes.NewReader(b), &vset)
+	if err != nil {
+		return nil, err
+	}
+	return vset, nil
+}
@@ -0,0 +1,91 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientValidationSets(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [{"account-id": "acme", "name": "base", "mode": "enforce", "pinned-at": 2, "sequence": 2, "valid": true}]
+	}`
+	vsets, err := cs.cli.ValidationSets()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets")
+	c.Check(vsets, check.DeepEquals, []*client.ValidationSet{{
+		AccountID: "acme",
+		Name:      "base",
+		Mode:      "enforce",
+		PinnedAt:  2,
+		Sequence:  2,
+		Valid:     true,
+	}})
+}
+
+func (cs *clientSuite) TestClientApplyValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"account-id": "acme", "name": "base", "mode": "monitor", "sequence": 3, "valid": false}
+	}`
+	vset, err := cs.cli.ApplyValidationSet(&client.ValidationSetAction{
+		Action:    "monitor",
+		AccountID: "acme",
+		Name:      "base",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]interface{}{
+		"action":     "monitor",
+		"account-id": "acme",
+		"name":       "base",
+	})
+	c.Check(vset, check.DeepEquals, &client.ValidationSet{
+		AccountID: "acme",
+		Name:      "base",
+		Mode:      "monitor",
+		Sequence:  3,
+	})
+}
+
+func (cs *clientSuite) TestClientApplyValidationSetError(c *check.C) {
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "cannot enforce validation set acme/base: validation sets are not satisfied"}
+	}`
+	_, err := cs.cli.ApplyValidationSet(&client.ValidationSetAction{
+		Action:    "enforce",
+		AccountID: "acme",
+		Name:      "base",
+	})
+	c.Assert(err, check.ErrorMatches, "cannot enforce validation set acme/base: .*")
+}
@@ -0,0 +1,88 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// snap-repair runs independently of snapd, so that repairs can be
+// delivered even when snapd itself or the refresh flow is broken.
+
+var (
+	Stdout io.Writer = os.Stdout
+	Stderr io.Writer = os.Stderr
+)
+
+type cmdRun struct{}
+
+func (c *cmdRun) Execute(args []string) error {
+	run, err := NewRunner()
+	if err != nil {
+		return err
+	}
+	return run.Run()
+}
+
+type cmdList struct{}
+
+func (c *cmdList) Execute(args []string) error {
+	run, err := NewRunner()
+	if err != nil {
+		return err
+	}
+	repairs := run.Repairs()
+	if len(repairs) == 0 {
+		fmt.Fprintf(Stderr, "no repairs yet\n")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(Stdout, 5, 3, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "Repair\tRev\tStatus\tSummary\n")
+	for _, rs := range repairs {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", rs, rs.Revision, rs.Status, rs.Summary)
+	}
+	return nil
+}
+
+func parser() *flags.Parser {
+	parser := flags.NewParser(&struct{}{}, flags.HelpFlag|flags.PassDoubleDash)
+	parser.AddCommand("run", "Fetch and run repairs", "Fetch the repairs not seen yet and run the ones that apply to this device.", &cmdRun{})
+	parser.AddCommand("list", "List repairs", "List the repairs considered on this device and their outcome.", &cmdList{})
+	return parser
+}
+
+func run(args []string) error {
+	_, err := parser().ParseArgs(args)
+	return err
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
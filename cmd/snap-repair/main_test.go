@@ -0,0 +1,92 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+)
+
+// Hook up check.v1 into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type baseRepairSuite struct {
+	stdout *bytes.Buffer
+	stderr *bytes.Buffer
+}
+
+func (s *baseRepairSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.stdout = bytes.NewBuffer(nil)
+	s.stderr = bytes.NewBuffer(nil)
+	Stdout = s.stdout
+	Stderr = s.stderr
+}
+
+func (s *baseRepairSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("/")
+	Stdout = os.Stdout
+	Stderr = os.Stderr
+}
+
+type mainSuite struct {
+	baseRepairSuite
+}
+
+var _ = Suite(&mainSuite{})
+
+func (s *mainSuite) TestListNoRepairs(c *C) {
+	err := run([]string{"list"})
+	c.Assert(err, IsNil)
+	c.Check(s.stdout.String(), Equals, "")
+	c.Check(s.stderr.String(), Equals, "no repairs yet\n")
+}
+
+func (s *mainSuite) TestList(c *C) {
+	err := os.MkdirAll(dirs.SnapRepairDir, 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(dirs.SnapRepairStateFile, []byte(`{"sequences": {
+"canonical": [{"brand-id": "canonical", "repair-id": 1, "revision": 0, "summary": "generic fix", "status": "skipped"}],
+"acme": [
+ {"brand-id": "acme", "repair-id": 1, "revision": 2, "summary": "fix the frobinator", "status": "done"},
+ {"brand-id": "acme", "repair-id": 2, "revision": 0, "summary": "fix the rest", "status": "failed"}
+]}}`), 0644)
+	c.Assert(err, IsNil)
+
+	err = run([]string{"list"})
+	c.Assert(err, IsNil)
+	c.Check(s.stdout.String(), Equals, `Repair       Rev  Status   Summary
+acme-1       2    done     fix the frobinator
+acme-2       0    failed   fix the rest
+canonical-1  0    skipped  generic fix
+`)
+	c.Check(s.stderr.String(), Equals, "")
+}
+
+func (s *mainSuite) TestUnknownCommand(c *C) {
+	err := run([]string{"frob"})
+	c.Check(err, ErrorMatches, `Unknown command .frob.*`)
+}
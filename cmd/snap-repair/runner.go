@@ -0,0 +1,314 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/snapcore/snapd/arch"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/sysdb"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/store"
+)
+
+// RepairStatus is the outcome of considering a repair on this device.
+type RepairStatus string
+
+const (
+	// RepairDone means the repair script ran successfully.
+	RepairDone RepairStatus = "done"
+	// RepairFailed means the repair script ran and failed.
+	RepairFailed RepairStatus = "failed"
+	// RepairSkipped means the repair does not apply to this device
+	// or was disabled.
+	RepairSkipped RepairStatus = "skipped"
+)
+
+// RepairState records what happened with a repair on this device.
+type RepairState struct {
+	BrandID  string       `json:"brand-id"`
+	RepairID int          `json:"repair-id"`
+	Revision int          `json:"revision"`
+	Summary  string       `json:"summary"`
+	Status   RepairStatus `json:"status"`
+}
+
+// String returns the brand-id-repair-id identifier of the repair.
+func (rs *RepairState) String() string {
+	return fmt.Sprintf("%s-%d", rs.BrandID, rs.RepairID)
+}
+
+type repairsState struct {
+	// Sequences holds the considered repairs by brand, ordered by id.
+	Sequences map[string][]*RepairState `json:"sequences"`
+}
+
+// repairStore is the subset of the store the runner uses.
+type repairStore interface {
+	Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error)
+}
+
+var newStore = func() repairStore {
+	return store.New(nil, nil)
+}
+
+// repairTimeout is how long a repair script is allowed to run.
+var repairTimeout = 30 * time.Minute
+
+// genericBrandID is the brand whose repairs are considered for all devices.
+var genericBrandID = "canonical"
+
+// Runner fetches the repairs that apply to the device, verifies and
+// runs them, recording their outcome.
+type Runner struct {
+	store repairStore
+	state repairsState
+
+	brandID string
+	model   string
+}
+
+// NewRunner returns a Runner for this device, reading the previous
+// outcomes.
+func NewRunner() (*Runner, error) {
+	run := &Runner{store: newStore()}
+	if err := run.readState(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (run *Runner) readState() error {
+	r, err := os.Open(dirs.SnapRepairStateFile)
+	if os.IsNotExist(err) {
+		run.state.Sequences = make(map[string][]*RepairState)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(&run.state); err != nil {
+		return fmt.Errorf("cannot read repairs state: %v", err)
+	}
+	if run.state.Sequences == nil {
+		run.state.Sequences = make(map[string][]*RepairState)
+	}
+	return nil
+}
+
+func (run *Runner) writeState() error {
+	if err := os.MkdirAll(dirs.SnapRepairDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(&run.state)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(dirs.SnapRepairStateFile, data, 0644, 0)
+}
+
+// readDevice finds out the brand and model of the device from the
+// snapd state, without going through snapd itself.
+func (run *Runner) readDevice() error {
+	r, err := os.Open(dirs.SnapStateFile)
+	if err != nil {
+		return fmt.Errorf("cannot read the device identity: %v", err)
+	}
+	defer r.Close()
+	var st struct {
+		Data struct {
+			Auth struct {
+				Device *auth.DeviceState `json:"device"`
+			} `json:"auth"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r).Decode(&st); err != nil {
+		return fmt.Errorf("cannot read the device identity: %v", err)
+	}
+	device := st.Data.Auth.Device
+	if device == nil || device.Brand == "" || device.Model == "" {
+		return fmt.Errorf("cannot find the device identity, the device is not yet seeded or registered")
+	}
+	run.brandID = device.Brand
+	run.model = device.Model
+	return nil
+}
+
+// Repairs returns the recorded repair outcomes, ordered by brand and id.
+func (run *Runner) Repairs() []*RepairState {
+	brands := make([]string, 0, len(run.state.Sequences))
+	for brandID := range run.state.Sequences {
+		brands = append(brands, brandID)
+	}
+	sort.Strings(brands)
+	var res []*RepairState
+	for _, brandID := range brands {
+		res = append(res, run.state.Sequences[brandID]...)
+	}
+	return res
+}
+
+func (run *Runner) brands() []string {
+	if run.brandID == genericBrandID {
+		return []string{genericBrandID}
+	}
+	return []string{genericBrandID, run.brandID}
+}
+
+// Run fetches and considers the repairs not seen yet, running the ones
+// that apply to the device.
+func (run *Runner) Run() error {
+	if err := run.readDevice(); err != nil {
+		return err
+	}
+	for _, brandID := range run.brands() {
+		if err := run.runSequence(brandID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (run *Runner) runSequence(brandID string) error {
+	for {
+		seq := run.state.Sequences[brandID]
+		nextID := 1
+		if len(seq) > 0 {
+			nextID = seq[len(seq)-1].RepairID + 1
+		}
+		repair, err := run.fetch(brandID, nextID)
+		if _, ok := err.(*store.AssertionNotFoundError); ok {
+			// nothing more for now
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		status := RepairSkipped
+		if !repair.Disabled() && repair.Applies(release.Series, arch.UbuntuArchitecture(), run.brandID, run.model) {
+			status = run.runScript(repair)
+		}
+		run.state.Sequences[brandID] = append(seq, &RepairState{
+			BrandID:  brandID,
+			RepairID: nextID,
+			Revision: repair.Revision(),
+			Summary:  repair.Summary(),
+			Status:   status,
+		})
+		if err := run.writeState(); err != nil {
+			return err
+		}
+	}
+}
+
+// fetch retrieves the given repair and verifies it together with its
+// prerequisites against the trusted assertions.
+func (run *Runner) fetch(brandID string, repairID int) (*asserts.Repair, error) {
+	a, err := run.store.Assertion(asserts.RepairType, []string{brandID, strconv.Itoa(repairID)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	repair, ok := a.(*asserts.Repair)
+	if !ok {
+		return nil, fmt.Errorf("internal error: expected a repair assertion, got %T", a)
+	}
+
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   sysdb.Trusted(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		return run.store.Assertion(ref.Type, ref.PrimaryKey, nil)
+	}
+	f := asserts.NewFetcher(db, retrieve, db.Add)
+	if err := f.Save(repair); err != nil {
+		return nil, fmt.Errorf("cannot verify repair %s-%d: %v", brandID, repairID, err)
+	}
+	return repair, nil
+}
+
+// runScript runs the script of the repair in its own run directory,
+// keeping the script and its output there.
+func (run *Runner) runScript(repair *asserts.Repair) RepairStatus {
+	rundir := filepath.Join(dirs.SnapRepairRunDir, repair.BrandID(), strconv.Itoa(repair.RepairID()))
+	base := filepath.Join(rundir, fmt.Sprintf("r%d", repair.Revision()))
+	if err := os.MkdirAll(rundir, 0700); err != nil {
+		fmt.Fprintf(Stderr, "cannot prepare repair %s-%d: %v\n", repair.BrandID(), repair.RepairID(), err)
+		return RepairFailed
+	}
+	script := base + ".script"
+	if err := ioutil.WriteFile(script, repair.Body(), 0700); err != nil {
+		fmt.Fprintf(Stderr, "cannot prepare repair %s-%d: %v\n", repair.BrandID(), repair.RepairID(), err)
+		return RepairFailed
+	}
+
+	cmd := exec.Command(script)
+	cmd.Dir = rundir
+	cmd.Env = append(os.Environ(), "SNAP_REPAIR_RUN_DIR="+rundir)
+	output, err := runWithTimeout(cmd, repairTimeout)
+	if werr := ioutil.WriteFile(base+".output", output, 0600); werr != nil {
+		fmt.Fprintf(Stderr, "cannot save output of repair %s-%d: %v\n", repair.BrandID(), repair.RepairID(), werr)
+	}
+	if err != nil {
+		fmt.Fprintf(Stderr, "repair %s-%d failed: %v\n", repair.BrandID(), repair.RepairID(), err)
+		return RepairFailed
+	}
+	return RepairDone
+}
+
+// runWithTimeout runs cmd collecting its combined output, killing it
+// if it does not finish within timeout.
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	// run in its own process group so that the whole of it can be killed
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	timer := time.AfterFunc(timeout, func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err := cmd.Wait()
+	if !timer.Stop() {
+		// the timer fired and killed the process
+		err = fmt.Errorf("timed out after %v", timeout)
+	}
+	return buf.Bytes(), err
+}
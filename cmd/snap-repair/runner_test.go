@@ -0,0 +1,264 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/arch"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/sysdb"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/store"
+)
+
+type fakeStore struct {
+	db       *asserts.Database
+	requests []string
+}
+
+func (sto *fakeStore) Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error) {
+	ref := &asserts.Ref{Type: assertType, PrimaryKey: primaryKey}
+	sto.requests = append(sto.requests, ref.Unique())
+	a, err := ref.Resolve(sto.db.Find)
+	if err == asserts.ErrNotFound {
+		return nil, &store.AssertionNotFoundError{Ref: ref}
+	}
+	return a, err
+}
+
+type runnerSuite struct {
+	baseRepairSuite
+
+	storeSigning *assertstest.StoreStack
+	brandSigning *assertstest.SigningDB
+	sto          *fakeStore
+
+	restore []func()
+}
+
+var _ = Suite(&runnerSuite{})
+
+func (s *runnerSuite) SetUpTest(c *C) {
+	s.baseRepairSuite.SetUpTest(c)
+
+	rootPrivKey, _ := assertstest.GenerateKey(752)
+	storePrivKey, _ := assertstest.GenerateKey(752)
+	s.storeSigning = assertstest.NewStoreStack("can0nical", rootPrivKey, storePrivKey)
+	s.restore = append(s.restore, sysdb.InjectTrusted(s.storeSigning.Trusted))
+	oldGenericBrandID := genericBrandID
+	genericBrandID = "can0nical"
+	s.restore = append(s.restore, func() { genericBrandID = oldGenericBrandID })
+
+	brandAcct := assertstest.NewAccount(s.storeSigning, "acme", map[string]interface{}{
+		"account-id": "acme",
+	}, "")
+	brandPrivKey, _ := assertstest.GenerateKey(752)
+	brandAccKey := assertstest.NewAccountKey(s.storeSigning, brandAcct, nil, brandPrivKey.PublicKey(), "")
+	c.Assert(s.storeSigning.Add(brandAcct), IsNil)
+	c.Assert(s.storeSigning.Add(brandAccKey), IsNil)
+	s.brandSigning = assertstest.NewSigningDB("acme", brandPrivKey)
+
+	s.sto = &fakeStore{db: s.storeSigning.Database}
+	oldNewStore := newStore
+	newStore = func() repairStore { return s.sto }
+	s.restore = append(s.restore, func() { newStore = oldNewStore })
+
+	s.mockDevice(c, "acme", "frobinator")
+}
+
+func (s *runnerSuite) TearDownTest(c *C) {
+	for i := len(s.restore) - 1; i >= 0; i-- {
+		s.restore[i]()
+	}
+	s.restore = nil
+	s.baseRepairSuite.TearDownTest(c)
+}
+
+func (s *runnerSuite) mockDevice(c *C, brandID, model string) {
+	err := os.MkdirAll(filepath.Dir(dirs.SnapStateFile), 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(dirs.SnapStateFile, []byte(fmt.Sprintf(`{"data": {"auth": {"device": {"brand": %q, "model": %q}}}}`, brandID, model)), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *runnerSuite) addRepair(c *C, signing *assertstest.SigningDB, repairID int, script string, extra map[string]interface{}) {
+	headers := map[string]interface{}{
+		"brand-id":  signing.AuthorityID,
+		"repair-id": strconv.Itoa(repairID),
+		"summary":   fmt.Sprintf("repair %d", repairID),
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	for k, v := range extra {
+		headers[k] = v
+	}
+	repair, err := signing.Sign(asserts.RepairType, headers, []byte(script), "")
+	c.Assert(err, IsNil)
+	err = s.storeSigning.Add(repair)
+	c.Assert(err, IsNil)
+}
+
+func (s *runnerSuite) repairs(c *C) []*RepairState {
+	run, err := NewRunner()
+	c.Assert(err, IsNil)
+	return run.Repairs()
+}
+
+func (s *runnerSuite) TestRunAppliesRepairs(c *C) {
+	s.addRepair(c, s.brandSigning, 1, "#!/bin/sh\necho fixed > $SNAP_REPAIR_RUN_DIR/fixed\necho done\n", nil)
+	s.addRepair(c, s.brandSigning, 2, "#!/bin/sh\necho broken\nexit 1\n", nil)
+	s.addRepair(c, s.brandSigning, 3, "#!/bin/sh\nexit 1\n", map[string]interface{}{
+		"models": []interface{}{"acme/other-model"},
+	})
+	s.addRepair(c, s.brandSigning, 4, "#!/bin/sh\nexit 1\n", map[string]interface{}{
+		"disabled": "true",
+	})
+	s.addRepair(c, s.storeSigning.SigningDB, 1, "#!/bin/sh\nexit 0\n", map[string]interface{}{
+		"architectures": []interface{}{arch.UbuntuArchitecture()},
+	})
+
+	run, err := NewRunner()
+	c.Assert(err, IsNil)
+	err = run.Run()
+	c.Assert(err, IsNil)
+
+	c.Check(s.repairs(c), DeepEquals, []*RepairState{
+		{BrandID: "acme", RepairID: 1, Summary: "repair 1", Status: RepairDone},
+		{BrandID: "acme", RepairID: 2, Summary: "repair 2", Status: RepairFailed},
+		{BrandID: "acme", RepairID: 3, Summary: "repair 3", Status: RepairSkipped},
+		{BrandID: "acme", RepairID: 4, Summary: "repair 4", Status: RepairSkipped},
+		{BrandID: "can0nical", RepairID: 1, Summary: "repair 1", Status: RepairDone},
+	})
+
+	rundir := filepath.Join(dirs.SnapRepairRunDir, "acme", "1")
+	fixed, err := ioutil.ReadFile(filepath.Join(rundir, "fixed"))
+	c.Assert(err, IsNil)
+	c.Check(string(fixed), Equals, "fixed\n")
+	output, err := ioutil.ReadFile(filepath.Join(rundir, "r0.output"))
+	c.Assert(err, IsNil)
+	c.Check(string(output), Equals, "done\n")
+	output, err = ioutil.ReadFile(filepath.Join(dirs.SnapRepairRunDir, "acme", "2", "r0.output"))
+	c.Assert(err, IsNil)
+	c.Check(string(output), Equals, "broken\n")
+	c.Check(s.stderr.String(), Matches, `repair acme-2 failed: exit status 1\n`)
+
+	// skipped ones are not run
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapRepairRunDir, "acme", "3")), Equals, false)
+}
+
+func (s *runnerSuite) TestRunOnlyOnce(c *C) {
+	s.addRepair(c, s.brandSigning, 1, "#!/bin/sh\necho run >> $SNAP_REPAIR_RUN_DIR/runs\n", nil)
+
+	run, err := NewRunner()
+	c.Assert(err, IsNil)
+	c.Assert(run.Run(), IsNil)
+
+	s.sto.requests = nil
+	run, err = NewRunner()
+	c.Assert(err, IsNil)
+	c.Assert(run.Run(), IsNil)
+
+	// only the next repairs were asked for
+	c.Check(s.sto.requests, DeepEquals, []string{
+		"repair/can0nical/1",
+		"repair/acme/2",
+	})
+	runs, err := ioutil.ReadFile(filepath.Join(dirs.SnapRepairRunDir, "acme", "1", "runs"))
+	c.Assert(err, IsNil)
+	c.Check(string(runs), Equals, "run\n")
+}
+
+func (s *runnerSuite) TestRunUnverifiedRepair(c *C) {
+	// signed by a key the store does not know about
+	otherPrivKey, _ := assertstest.GenerateKey(752)
+	otherSigning := assertstest.NewSigningDB("acme", otherPrivKey)
+	repair, err := otherSigning.Sign(asserts.RepairType, map[string]interface{}{
+		"brand-id":  "acme",
+		"repair-id": "1",
+		"summary":   "rogue",
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, []byte("#!/bin/sh\ntouch $SNAP_REPAIR_RUN_DIR/rogue\n"), "")
+	c.Assert(err, IsNil)
+	sto := &fakeStore{db: s.storeSigning.Database}
+	newStore = func() repairStore {
+		return &rogueStore{fakeStore: sto, repair: repair}
+	}
+
+	run, err := NewRunner()
+	c.Assert(err, IsNil)
+	err = run.Run()
+	c.Check(err, ErrorMatches, `cannot verify repair acme-1: .*`)
+	c.Check(s.repairs(c), HasLen, 0)
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapRepairRunDir, "acme", "1", "rogue")), Equals, false)
+}
+
+type rogueStore struct {
+	*fakeStore
+	repair asserts.Assertion
+}
+
+func (sto *rogueStore) Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error) {
+	if assertType == asserts.RepairType && primaryKey[0] == "acme" && primaryKey[1] == "1" {
+		return sto.repair, nil
+	}
+	return sto.fakeStore.Assertion(assertType, primaryKey, user)
+}
+
+func (s *runnerSuite) TestRunNoDevice(c *C) {
+	err := os.Remove(dirs.SnapStateFile)
+	c.Assert(err, IsNil)
+
+	run, err := NewRunner()
+	c.Assert(err, IsNil)
+	err = run.Run()
+	c.Check(err, ErrorMatches, `cannot read the device identity: .*`)
+
+	err = ioutil.WriteFile(dirs.SnapStateFile, []byte(`{"data": {}}`), 0644)
+	c.Assert(err, IsNil)
+	err = run.Run()
+	c.Check(err, ErrorMatches, `cannot find the device identity, the device is not yet seeded or registered`)
+}
+
+func (s *runnerSuite) TestRunTimeout(c *C) {
+	oldTimeout := repairTimeout
+	repairTimeout = 100 * time.Millisecond
+	defer func() { repairTimeout = oldTimeout }()
+
+	s.addRepair(c, s.brandSigning, 1, "#!/bin/sh\nsleep 10\n", nil)
+
+	run, err := NewRunner()
+	c.Assert(err, IsNil)
+	c.Assert(run.Run(), IsNil)
+
+	c.Check(s.repairs(c), DeepEquals, []*RepairState{
+		{BrandID: "acme", RepairID: 1, Summary: "repair 1", Status: RepairFailed},
+	})
+	c.Check(s.stderr.String(), Equals, "repair acme-1 failed: timed out after 100ms\n")
+}
@@ -20,17 +20,26 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/i18n"
 
 	"github.com/jessevdk/go-flags"
 )
 
 type cmdAck struct {
+	Dir        string `long:"dir"`
 	AckOptions struct {
 		AssertionFile string
-	} `positional-args:"true" required:"true"`
+	} `positional-args:"true"`
 }
 
 var shortAckHelp = i18n.G("Adds an assertion to the system")
@@ -43,12 +52,18 @@ will replace.
 To succeed the assertion must be valid, its signature verified with a known
 public key and the assertion consistent with and its prerequisite in the
 database.
+
+With --dir all the assertions in the files of the given directory are added
+together, in an order that satisfies their prerequisites, and the added
+assertions are reported.
 `)
 
 func init() {
 	addCommand("ack", shortAckHelp, longAckHelp, func() flags.Commander {
 		return &cmdAck{}
-	}, nil, []argDesc{{
+	}, map[string]string{
+		"dir": i18n.G("Add all the assertions in the files of the given directory"),
+	}, []argDesc{{
 		name: i18n.G("<assertion file>"),
 		desc: i18n.G("Assertion file"),
 	}})
@@ -60,6 +75,14 @@ func (x *cmdAck) Execute(args []string) error {
 	}
 
 	assertFile := x.AckOptions.AssertionFile
+	switch {
+	case x.Dir != "" && assertFile != "":
+		return fmt.Errorf(i18n.G("cannot use --dir together with an assertion file"))
+	case x.Dir != "":
+		return ackDir(x.Dir)
+	case assertFile == "":
+		return fmt.Errorf(i18n.G("the required argument `<assertion file>` was not provided"))
+	}
 
 	assertData, err := ioutil.ReadFile(assertFile)
 	if err != nil {
@@ -68,3 +91,61 @@ func (x *cmdAck) Execute(args []string) error {
 
 	return Client().Ack(assertData)
 }
+
+// ackDir adds all the assertions found in the regular files of dir as
+// one stream, reporting what was added.
+func ackDir(dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	enc := asserts.NewEncoder(&buf)
+	for _, name := range names {
+		if err := encodeAssertionsFrom(enc, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	added, err := Client().AckStream(&buf)
+	if err != nil {
+		return err
+	}
+	if len(added) == 0 {
+		fmt.Fprintln(Stdout, i18n.G("No new assertions were added."))
+		return nil
+	}
+	for _, ref := range added {
+		fmt.Fprintf(Stdout, i18n.G("Added %s %s\n"), ref.Type, strings.Join(ref.PrimaryKey, "/"))
+	}
+	return nil
+}
+
+func encodeAssertionsFrom(enc *asserts.Encoder, fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf(i18n.G("cannot read assertion from %q: %v"), fname, err)
+		}
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestAckDir(c *check.C) {
+	rootPrivKey, _ := assertstest.GenerateKey(752)
+	storePrivKey, _ := assertstest.GenerateKey(752)
+	storeSigning := assertstest.NewStoreStack("canonical", rootPrivKey, storePrivKey)
+	acct := assertstest.NewAccount(storeSigning, "developer1", nil, "")
+
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "2-account"), asserts.Encode(acct), 0644), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "1-account-key"), asserts.Encode(storeSigning.StoreAccountKey("")), 0644), check.IsNil)
+	// directories are ignored
+	c.Assert(os.Mkdir(filepath.Join(dir, "sub"), 0755), check.IsNil)
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/assertions")
+			dec := asserts.NewDecoder(r.Body)
+			var types []string
+			for {
+				a, err := dec.Decode()
+				if err != nil {
+					break
+				}
+				types = append(types, a.Type().Name)
+			}
+			c.Check(types, check.DeepEquals, []string{"account-key", "account"})
+			fmt.Fprintf(w, `{"type": "sync", "result": {"added": [{"type": "account", "primary-key": [%q]}]}}`, acct.AccountID())
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+
+	rest, err := snap.Parser().ParseArgs([]string{"ack", "--dir", dir})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf("Added account %s\n", acct.AccountID()))
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestAckDirNothingAdded(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": {"added": []}}`)
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"ack", "--dir", c.MkDir()})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "No new assertions were added.\n")
+}
+
+func (s *SnapSuite) TestAckDirInvalid(c *check.C) {
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "junk"), []byte("junk"), 0644), check.IsNil)
+
+	_, err := snap.Parser().ParseArgs([]string{"ack", "--dir", dir})
+	c.Assert(err, check.ErrorMatches, `cannot read assertion from ".*/junk": .*`)
+}
+
+func (s *SnapSuite) TestAckDirAndFile(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"ack", "--dir", c.MkDir(), "some-file"})
+	c.Assert(err, check.ErrorMatches, `cannot use --dir together with an assertion file`)
+
+	_, err = snap.Parser().ParseArgs([]string{"ack"})
+	c.Assert(err, check.ErrorMatches, "the required argument `<assertion file>` was not provided")
+}
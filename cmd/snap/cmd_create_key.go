@@ -62,6 +62,15 @@ func (x *cmdCreateKey) Execute(args []string) error {
 		return fmt.Errorf(i18n.G("key name %q is not valid; only ASCII letters, digits, and hyphens are allowed"), keyName)
 	}
 
+	manager, err := getKeypairManager()
+	if err != nil {
+		return err
+	}
+	if extMgr, ok := manager.(*asserts.ExternalKeypairManager); ok {
+		// the helper takes care of protecting the key
+		return extMgr.Generate(keyName)
+	}
+
 	fmt.Fprint(Stdout, i18n.G("Passphrase: "))
 	passphrase, err := terminal.ReadPassword(0)
 	fmt.Fprint(Stdout, "\n")
@@ -81,6 +90,5 @@ func (x *cmdCreateKey) Execute(args []string) error {
 		return err
 	}
 
-	manager := asserts.NewGPGKeypairManager()
-	return manager.Generate(string(passphrase), keyName)
+	return manager.(*asserts.GPGKeypairManager).Generate(string(passphrase), keyName)
 }
@@ -0,0 +1,54 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/boot"
+)
+
+type cmdValidateSeed struct {
+	Positionals struct {
+		SeedDir string `positional-arg-name:"<seed-dir>"`
+	} `positional-args:"true" required:"true"`
+}
+
+var shortValidateSeedHelp = i18n.G("Validate a seed directory")
+var longValidateSeedHelp = i18n.G(`
+The validate-seed command checks the seed.yaml and the assertions in the
+given seed directory the way the first boot would use them, and reports
+all the problems found at once.
+`)
+
+func init() {
+	addDebugCommand("validate-seed", shortValidateSeedHelp, longValidateSeedHelp, func() flags.Commander {
+		return &cmdValidateSeed{}
+	})
+}
+
+func (x *cmdValidateSeed) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	return boot.ValidateSeed(x.Positionals.SeedDir)
+}
@@ -0,0 +1,53 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestValidateSeedReportsProblems(c *check.C) {
+	seedDir := c.MkDir()
+	err := os.MkdirAll(filepath.Join(seedDir, "assertions"), 0755)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(seedDir, "seed.yaml"), []byte(`
+snaps:
+ - name: local
+   unasserted: true
+   file: local_1.0_all.snap
+`), 0644)
+	c.Assert(err, check.IsNil)
+
+	_, err = snap.Parser().ParseArgs([]string{"debug", "validate-seed", seedDir})
+	c.Assert(err, check.ErrorMatches, `cannot validate seed:
+- need a model assertion
+- cannot find snap "local" file ".*/local_1.0_all.snap"`)
+}
+
+func (s *SnapSuite) TestValidateSeedNoSeedYaml(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"debug", "validate-seed", c.MkDir()})
+	c.Assert(err, check.ErrorMatches, `cannot read seed yaml: .*/seed.yaml`)
+}
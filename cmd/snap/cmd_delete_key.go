@@ -22,7 +22,6 @@ package main
 import (
 	"github.com/jessevdk/go-flags"
 
-	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/i18n"
 )
 
@@ -50,6 +49,9 @@ func (x *cmdDeleteKey) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
-	manager := asserts.NewGPGKeypairManager()
+	manager, err := getKeypairManager()
+	if err != nil {
+		return err
+	}
 	return manager.Delete(x.Positional.KeyName)
 }
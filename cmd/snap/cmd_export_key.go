@@ -61,7 +61,10 @@ func (x *cmdExportKey) Execute(args []string) error {
 		keyName = "default"
 	}
 
-	manager := asserts.NewGPGKeypairManager()
+	manager, err := getKeypairManager()
+	if err != nil {
+		return err
+	}
 	if x.Account != "" {
 		privKey, err := manager.GetByName(keyName)
 		if err != nil {
@@ -32,6 +32,9 @@ import (
 var shortFindHelp = i18n.G("Finds packages to install")
 var longFindHelp = i18n.G(`
 The find command queries the store for available packages.
+
+With the --section option the search is restricted to the given store
+section; when no section name is given the available sections are listed.
 `)
 
 func getPrice(prices map[string]float64, currency string) (float64, string, error) {
@@ -84,8 +87,13 @@ func getPriceString(prices map[string]float64, suggestedCurrency, status string)
 	return formatPrice(price, currency)
 }
 
+// showAllSections is the value the --section option takes when it is
+// given without a section name.
+const showAllSections = "show-all-sections-please"
+
 type cmdFind struct {
-	Private    bool `long:"private"`
+	Private    bool   `long:"private"`
+	Section    string `long:"section" optional:"true" optional-value:"show-all-sections-please"`
 	Positional struct {
 		Query string
 	} `positional-args:"yes"`
@@ -96,6 +104,7 @@ func init() {
 		return &cmdFind{}
 	}, map[string]string{
 		"private": i18n.G("Search private snaps"),
+		"section": i18n.G("Restrict the search to a given section"),
 	}, []argDesc{{name: i18n.G("<query>")}})
 }
 
@@ -104,16 +113,34 @@ func (x *cmdFind) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
-	if x.Positional.Query == "" {
+	if x.Section == showAllSections {
+		return showSections()
+	}
+
+	if x.Positional.Query == "" && x.Section == "" {
 		return errors.New(i18n.G("you need to specify a query. Try \"snap find hello-world\"."))
 	}
 
 	return findSnaps(&client.FindOptions{
 		Private: x.Private,
+		Section: x.Section,
 		Query:   x.Positional.Query,
 	})
 }
 
+func showSections() error {
+	sections, err := Client().Sections()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(Stdout, i18n.G("No section specified. Available sections:"))
+	for _, sec := range sections {
+		fmt.Fprintf(Stdout, " * %s\n", sec)
+	}
+	return nil
+}
+
 func findSnaps(opts *client.FindOptions) error {
 	cli := Client()
 	snaps, resInfo, err := cli.Find(opts)
@@ -122,6 +149,10 @@ func findSnaps(opts *client.FindOptions) error {
 	}
 
 	if len(snaps) == 0 {
+		if opts.Query == "" {
+			// TRANSLATORS: the %q is the (quoted) name of the section the user entered
+			return fmt.Errorf(i18n.G("no snaps found in section %q"), opts.Section)
+		}
 		// TRANSLATORS: the %q is the (quoted) query the user entered
 		return fmt.Errorf(i18n.G("no snaps found for %q"), opts.Query)
 	}
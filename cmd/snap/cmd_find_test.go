@@ -309,3 +309,64 @@ hello +2.10 +canonical +bought +GNU Hello, the "hello world" snap
 `)
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+func (s *SnapSuite) TestFindSection(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/find")
+			q := r.URL.Query()
+			c.Check(q.Get("section"), check.Equals, "games")
+			_, ok := q["q"]
+			c.Check(ok, check.Equals, false)
+			fmt.Fprint(w, findHelloJSON)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser().ParseArgs([]string{"find", "--section=games"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `Name +Version +Developer +Notes +Summary
+hello +2.10 +canonical +- +GNU Hello, the "hello world" snap
+hello-huge +1.0 +noise +- +a really big snap
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestFindSectionNothingFound(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/find")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "status": "OK", "result": []}`)
+	})
+	_, err := snap.Parser().ParseArgs([]string{"find", "--section=empty"})
+	c.Assert(err, check.ErrorMatches, `no snaps found in section "empty"`)
+}
+
+func (s *SnapSuite) TestFindListSections(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/sections")
+			fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "status": "OK", "result": ["featured", "games"]}`)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser().ParseArgs([]string{"find", "--section"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `No section specified. Available sections:
+ * featured
+ * games
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
@@ -0,0 +1,420 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/snap"
+
+	"github.com/jessevdk/go-flags"
+)
+
+var shortInfoHelp = i18n.G("Show detailed information about a snap")
+var longInfoHelp = i18n.G(`
+The info command shows detailed information about a snap, be it by name
+or by path: its apps and services, its plugs and slots, what is
+installed, which channel it is tracking, and what the store has in each
+of its channels.
+`)
+
+type infoCmd struct {
+	JSON       bool `long:"json"`
+	YAML       bool `long:"yaml"`
+	Positional struct {
+		Snap string `positional-arg-name:"<snap>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func init() {
+	addCommand("info", shortInfoHelp, longInfoHelp, func() flags.Commander { return &infoCmd{} },
+		map[string]string{
+			"json": i18n.G("Show the information as JSON"),
+			"yaml": i18n.G("Show the information as YAML"),
+		}, nil)
+}
+
+// infoService is a service of a snap, as shown by info.
+type infoService struct {
+	Name   string `json:"name" yaml:"name"`
+	Daemon string `json:"daemon" yaml:"daemon"`
+}
+
+// infoPlugOrSlot is a plug or slot of a snap, as shown by info.
+type infoPlugOrSlot struct {
+	Name        string   `json:"name" yaml:"name"`
+	Interface   string   `json:"interface" yaml:"interface"`
+	Connections []string `json:"connections,omitempty" yaml:"connections,omitempty"`
+}
+
+// infoInstalled is what is installed of a snap, as shown by info.
+type infoInstalled struct {
+	Version   string          `json:"version" yaml:"version"`
+	Revision  snap.Revision   `json:"revision" yaml:"revision"`
+	Channel   string          `json:"channel,omitempty" yaml:"channel,omitempty"`
+	Revisions []snap.Revision `json:"revisions,omitempty" yaml:"revisions,omitempty"`
+}
+
+// infoOutput is everything info shows about a snap, in any format.
+type infoOutput struct {
+	Name             string                           `json:"name" yaml:"name"`
+	Summary          string                           `json:"summary" yaml:"summary"`
+	Developer        string                           `json:"developer,omitempty" yaml:"developer,omitempty"`
+	Type             string                           `json:"type,omitempty" yaml:"type,omitempty"`
+	LicenseAgreement string                           `json:"license-agreement,omitempty" yaml:"license-agreement,omitempty"`
+	LicenseVersion   string                           `json:"license-version,omitempty" yaml:"license-version,omitempty"`
+	Description      string                           `json:"description,omitempty" yaml:"description,omitempty"`
+	Path             string                           `json:"path,omitempty" yaml:"path,omitempty"`
+	Version          string                           `json:"version,omitempty" yaml:"version,omitempty"`
+	Commands         []string                         `json:"commands,omitempty" yaml:"commands,omitempty"`
+	Services         []infoService                    `json:"services,omitempty" yaml:"services,omitempty"`
+	Plugs            []infoPlugOrSlot                 `json:"plugs,omitempty" yaml:"plugs,omitempty"`
+	Slots            []infoPlugOrSlot                 `json:"slots,omitempty" yaml:"slots,omitempty"`
+	Tracking         string                           `json:"tracking,omitempty" yaml:"tracking,omitempty"`
+	Installed        *infoInstalled                   `json:"installed,omitempty" yaml:"installed,omitempty"`
+	Channels         map[string]*snap.ChannelSnapInfo `json:"channels,omitempty" yaml:"channels,omitempty"`
+}
+
+// knownChannels are the channels in the order in which they are shown
+// when present, before any other ones.
+var knownChannels = []string{"stable", "candidate", "beta", "edge"}
+
+func isKnownChannel(ch string) bool {
+	for _, known := range knownChannels {
+		if ch == known {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedChannels returns the names of the given channels, known ones
+// first in order of stability and then any others by name.
+func sortedChannels(channels map[string]*snap.ChannelSnapInfo) []string {
+	names := make([]string, 0, len(channels))
+	for _, ch := range knownChannels {
+		if _, ok := channels[ch]; ok {
+			names = append(names, ch)
+		}
+	}
+	var others []string
+	for ch := range channels {
+		if !isKnownChannel(ch) {
+			others = append(others, ch)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// commandName returns the name an app of a snap is invoked as.
+func commandName(snapName, appName string) string {
+	if snapName == appName {
+		return appName
+	}
+	return fmt.Sprintf("%s.%s", snapName, appName)
+}
+
+// isSnapPath tells whether the argument to info looks like the path
+// of a snap file or directory rather than the name of a snap.
+func isSnapPath(name string) bool {
+	return strings.Contains(name, "/") || strings.HasSuffix(name, ".snap")
+}
+
+type appsByName []client.AppInfo
+
+func (a appsByName) Len() int           { return len(a) }
+func (a appsByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a appsByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+type plugsOrSlotsByName []infoPlugOrSlot
+
+func (a plugsOrSlotsByName) Len() int           { return len(a) }
+func (a plugsOrSlotsByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a plugsOrSlotsByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// addApps fills in the commands and services, sorted by name.
+func (out *infoOutput) addApps(apps []client.AppInfo) {
+	sort.Sort(appsByName(apps))
+	for _, app := range apps {
+		if app.Daemon != "" {
+			out.Services = append(out.Services, infoService{
+				Name:   commandName(out.Name, app.Name),
+				Daemon: app.Daemon,
+			})
+			continue
+		}
+		out.Commands = append(out.Commands, commandName(out.Name, app.Name))
+	}
+}
+
+// fromFile fills in the output from the snap file or directory at path.
+func (out *infoOutput) fromFile(path string) error {
+	snapf, err := snap.Open(path)
+	if err != nil {
+		return err
+	}
+	info, err := snap.ReadInfoFromSnapFile(snapf, nil)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	out.Name = info.Name()
+	out.Summary = info.Summary()
+	out.Description = info.Description()
+	out.Type = string(info.Type)
+	out.LicenseAgreement = info.LicenseAgreement
+	out.LicenseVersion = info.LicenseVersion
+	out.Path = absPath
+	out.Version = info.Version
+
+	apps := make([]client.AppInfo, 0, len(info.Apps))
+	for _, app := range info.Apps {
+		apps = append(apps, client.AppInfo{Name: app.Name, Daemon: app.Daemon})
+	}
+	out.addApps(apps)
+
+	for _, plug := range info.Plugs {
+		out.Plugs = append(out.Plugs, infoPlugOrSlot{Name: plug.Name, Interface: plug.Interface})
+	}
+	for _, slot := range info.Slots {
+		out.Slots = append(out.Slots, infoPlugOrSlot{Name: slot.Name, Interface: slot.Interface})
+	}
+	sort.Sort(plugsOrSlotsByName(out.Plugs))
+	sort.Sort(plugsOrSlotsByName(out.Slots))
+
+	return nil
+}
+
+// fromLocal fills in the output from the installed snap and its
+// interface connections.
+func (out *infoOutput) fromLocal(cli *client.Client, local *client.Snap) error {
+	out.Name = local.Name
+	out.Summary = local.Summary
+	out.Description = local.Description
+	out.Developer = local.Developer
+	out.Type = local.Type
+	out.LicenseAgreement = local.LicenseAgreement
+	out.LicenseVersion = local.LicenseVersion
+	out.Tracking = local.TrackingChannel
+	out.Installed = &infoInstalled{
+		Version:   local.Version,
+		Revision:  local.Revision,
+		Channel:   local.Channel,
+		Revisions: local.InstalledRevisions,
+	}
+	out.addApps(local.Apps)
+
+	ifaces, err := cli.Interfaces()
+	if err != nil {
+		return err
+	}
+	for _, plug := range ifaces.Plugs {
+		if plug.Snap != local.Name {
+			continue
+		}
+		p := infoPlugOrSlot{Name: plug.Name, Interface: plug.Interface}
+		for _, ref := range plug.Connections {
+			p.Connections = append(p.Connections, fmt.Sprintf("%s:%s", ref.Snap, ref.Name))
+		}
+		out.Plugs = append(out.Plugs, p)
+	}
+	for _, slot := range ifaces.Slots {
+		if slot.Snap != local.Name {
+			continue
+		}
+		s := infoPlugOrSlot{Name: slot.Name, Interface: slot.Interface}
+		for _, ref := range slot.Connections {
+			s.Connections = append(s.Connections, fmt.Sprintf("%s:%s", ref.Snap, ref.Name))
+		}
+		out.Slots = append(out.Slots, s)
+	}
+
+	return nil
+}
+
+// fromRemote fills in from the store details whatever is still missing.
+func (out *infoOutput) fromRemote(remote *client.Snap) {
+	if out.Name == "" {
+		out.Name = remote.Name
+		out.Summary = remote.Summary
+		out.Description = remote.Description
+		out.Developer = remote.Developer
+		out.Type = remote.Type
+	}
+	out.Channels = remote.Channels
+}
+
+func (x *infoCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if x.JSON && x.YAML {
+		return fmt.Errorf(i18n.G("cannot use --json and --yaml together"))
+	}
+
+	cli := Client()
+	name := x.Positional.Snap
+	var out infoOutput
+
+	if isSnapPath(name) {
+		if err := out.fromFile(name); err != nil {
+			return err
+		}
+		// the store might know about it too
+		if remote, _, err := cli.FindOne(out.Name); err == nil {
+			out.fromRemote(remote)
+		}
+	} else {
+		local, _, localErr := cli.Snap(name)
+		if localErr == nil {
+			if err := out.fromLocal(cli, local); err != nil {
+				return err
+			}
+		}
+		remote, _, remoteErr := cli.FindOne(name)
+		if localErr != nil && remoteErr != nil {
+			// TRANSLATORS: the %q is the snap name
+			return fmt.Errorf(i18n.G("no snap found for %q"), name)
+		}
+		if remoteErr == nil {
+			out.fromRemote(remote)
+		}
+	}
+
+	switch {
+	case x.JSON:
+		b, err := json.MarshalIndent(&out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "%s\n", b)
+	case x.YAML:
+		b, err := yaml.Marshal(&out)
+		if err != nil {
+			return err
+		}
+		Stdout.Write(b)
+	default:
+		printInfo(&out)
+	}
+
+	return nil
+}
+
+func printPlugsOrSlots(w *tabwriter.Writer, header string, items []infoPlugOrSlot) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintln(w, header)
+	for _, item := range items {
+		connections := ""
+		if len(item.Connections) > 0 {
+			connections = " -> " + strings.Join(item.Connections, ", ")
+		}
+		fmt.Fprintf(w, "  %s:\t%s%s\n", item.Name, item.Interface, connections)
+	}
+}
+
+// printInfo shows the output in its human readable form.
+func printInfo(out *infoOutput) {
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "name:\t%s\n", out.Name)
+	fmt.Fprintf(w, "summary:\t%q\n", out.Summary)
+	if out.Developer != "" {
+		fmt.Fprintf(w, "developer:\t%s\n", out.Developer)
+	}
+	if out.Type != "" {
+		fmt.Fprintf(w, "type:\t%s\n", out.Type)
+	}
+	if out.LicenseAgreement != "" {
+		fmt.Fprintf(w, "license-agreement:\t%s\n", out.LicenseAgreement)
+	}
+	if out.LicenseVersion != "" {
+		fmt.Fprintf(w, "license-version:\t%s\n", out.LicenseVersion)
+	}
+	if out.Path != "" {
+		fmt.Fprintf(w, "path:\t%q\n", out.Path)
+		fmt.Fprintf(w, "version:\t%s\n", out.Version)
+	}
+	if out.Tracking != "" {
+		fmt.Fprintf(w, "tracking:\t%s\n", out.Tracking)
+	}
+	if inst := out.Installed; inst != nil {
+		installed := fmt.Sprintf("%s (%s)", inst.Version, inst.Revision)
+		if inst.Channel != "" {
+			// TRANSLATORS: the first %s is the version and revision, the second the channel it came from
+			installed = fmt.Sprintf(i18n.G("%s from %s"), installed, inst.Channel)
+		}
+		fmt.Fprintf(w, "installed:\t%s\n", installed)
+		if len(inst.Revisions) > 1 {
+			revs := make([]string, len(inst.Revisions))
+			for i, rev := range inst.Revisions {
+				revs[i] = rev.String()
+			}
+			fmt.Fprintf(w, "revisions:\t%s\n", strings.Join(revs, ", "))
+		}
+	}
+
+	if desc := strings.TrimSpace(out.Description); desc != "" {
+		fmt.Fprintln(w, "description: |")
+		for _, line := range strings.Split(desc, "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	if len(out.Commands) > 0 {
+		fmt.Fprintln(w, "commands:")
+		for _, cmd := range out.Commands {
+			fmt.Fprintf(w, "  - %s\n", cmd)
+		}
+	}
+	if len(out.Services) > 0 {
+		fmt.Fprintln(w, "services:")
+		for _, svc := range out.Services {
+			fmt.Fprintf(w, "  %s:\t%s\n", svc.Name, svc.Daemon)
+		}
+	}
+	printPlugsOrSlots(w, "plugs:", out.Plugs)
+	printPlugsOrSlots(w, "slots:", out.Slots)
+
+	if len(out.Channels) > 0 {
+		fmt.Fprintln(w, "channels:")
+		for _, ch := range sortedChannels(out.Channels) {
+			m := out.Channels[ch]
+			fmt.Fprintf(w, "  %s:\t%s (%s)\n", ch, m.Version, m.Revision)
+		}
+	}
+}
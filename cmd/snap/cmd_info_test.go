@@ -0,0 +1,294 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+const mockInfoJSONLocal = `
+{
+  "type": "sync",
+  "status-code": 200,
+  "status": "OK",
+  "result": {
+    "apps": [{"name": "universe"}, {"name": "hello"}, {"name": "svc", "daemon": "simple"}],
+    "channel": "stable",
+    "description": "GNU hello prints a friendly greeting.\nThis is part of the snapcraft tour.",
+    "developer": "canonical",
+    "installed-revisions": ["1", "2"],
+    "license-agreement": "explicit",
+    "license-version": "2",
+    "name": "hello",
+    "revision": "2",
+    "status": "active",
+    "summary": "GNU Hello, the \"hello world\" snap",
+    "tracking-channel": "beta",
+    "type": "app",
+    "version": "2.10"
+  }
+}
+`
+
+const mockInfoJSONInterfaces = `
+{
+  "type": "sync",
+  "status-code": 200,
+  "status": "OK",
+  "result": {
+    "plugs": [
+      {"snap": "hello", "plug": "network", "interface": "network", "connections": [{"snap": "core", "slot": "network"}]},
+      {"snap": "other", "plug": "home", "interface": "home"}
+    ],
+    "slots": [
+      {"snap": "hello", "slot": "greeting", "interface": "content"}
+    ]
+  }
+}
+`
+
+const mockInfoJSONRemote = `
+{
+  "type": "sync",
+  "status-code": 200,
+  "status": "OK",
+  "result": [
+    {
+      "channel": "stable",
+      "channels": {
+        "edge": {"channel": "edge", "revision": "3", "version": "2.11~pre1"},
+        "stable": {"channel": "stable", "revision": "1", "version": "2.10"},
+        "beta": {"channel": "beta", "revision": "2", "version": "2.11"},
+        "other": {"channel": "other", "revision": "4", "version": "2.12"}
+      },
+      "description": "GNU hello prints a friendly greeting.",
+      "developer": "canonical",
+      "name": "hello",
+      "revision": "1",
+      "status": "available",
+      "summary": "GNU Hello, the \"hello world\" snap",
+      "type": "app",
+      "version": "2.10"
+    }
+  ],
+  "sources": [
+    "store"
+  ]
+}
+`
+
+const mockInfoJSONNotFound = `{"type": "error", "result": {"message": "not found"}, "status-code": 404}`
+
+// infoServer answers the requests info does, with installed telling
+// whether the snap is installed and inStore whether the store has it.
+func infoServer(c *check.C, installed, inStore bool) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		switch r.URL.Path {
+		case "/v2/snaps/hello":
+			if !installed {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, mockInfoJSONNotFound)
+				return
+			}
+			fmt.Fprint(w, mockInfoJSONLocal)
+		case "/v2/interfaces":
+			c.Check(installed, check.Equals, true)
+			fmt.Fprint(w, mockInfoJSONInterfaces)
+		case "/v2/find":
+			c.Check(r.URL.Query().Get("name"), check.Equals, "hello")
+			if !inStore {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, mockInfoJSONNotFound)
+				return
+			}
+			fmt.Fprint(w, mockInfoJSONRemote)
+		default:
+			c.Fatalf("unexpected request to %q", r.URL.Path)
+		}
+	}
+}
+
+func (s *SnapSuite) TestInfo(c *check.C) {
+	s.RedirectClientToTestServer(infoServer(c, true, true))
+	rest, err := snap.Parser().ParseArgs([]string{"info", "hello"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `name:               hello
+summary:            "GNU Hello, the \"hello world\" snap"
+developer:          canonical
+type:               app
+license-agreement:  explicit
+license-version:    2
+tracking:           beta
+installed:          2.10 (2) from stable
+revisions:          1, 2
+description: |
+  GNU hello prints a friendly greeting.
+  This is part of the snapcraft tour.
+commands:
+  - hello
+  - hello.universe
+services:
+  hello.svc:  simple
+plugs:
+  network:  network -> core:network
+slots:
+  greeting:  content
+channels:
+  stable:  2.10 (1)
+  beta:    2.11 (2)
+  edge:    2.11~pre1 (3)
+  other:   2.12 (4)
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestInfoNotInstalled(c *check.C) {
+	s.RedirectClientToTestServer(infoServer(c, false, true))
+	_, err := snap.Parser().ParseArgs([]string{"info", "hello"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `name:       hello
+summary:    "GNU Hello, the \"hello world\" snap"
+developer:  canonical
+type:       app
+description: |
+  GNU hello prints a friendly greeting.
+channels:
+  stable:  2.10 (1)
+  beta:    2.11 (2)
+  edge:    2.11~pre1 (3)
+  other:   2.12 (4)
+`)
+}
+
+func (s *SnapSuite) TestInfoNotInStore(c *check.C) {
+	s.RedirectClientToTestServer(infoServer(c, true, false))
+	_, err := snap.Parser().ParseArgs([]string{"info", "hello"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Matches, `(?ms)name: +hello\n.*installed: +2.10 \(2\) from stable\n.*`)
+	c.Check(s.Stdout(), check.Not(check.Matches), `(?ms).*channels:.*`)
+}
+
+func (s *SnapSuite) TestInfoNotFound(c *check.C) {
+	s.RedirectClientToTestServer(infoServer(c, false, false))
+	_, err := snap.Parser().ParseArgs([]string{"info", "hello"})
+	c.Assert(err, check.ErrorMatches, `no snap found for "hello"`)
+}
+
+func (s *SnapSuite) TestInfoJSON(c *check.C) {
+	s.RedirectClientToTestServer(infoServer(c, true, true))
+	_, err := snap.Parser().ParseArgs([]string{"info", "--json", "hello"})
+	c.Assert(err, check.IsNil)
+
+	var out map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(s.Stdout()), &out), check.IsNil)
+	c.Check(out["name"], check.Equals, "hello")
+	c.Check(out["tracking"], check.Equals, "beta")
+	c.Check(out["commands"], check.DeepEquals, []interface{}{"hello", "hello.universe"})
+	c.Check(out["services"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"name": "hello.svc", "daemon": "simple"},
+	})
+	c.Check(out["installed"], check.DeepEquals, map[string]interface{}{
+		"version":   "2.10",
+		"revision":  "2",
+		"channel":   "stable",
+		"revisions": []interface{}{"1", "2"},
+	})
+	c.Check(out["channels"], check.HasLen, 4)
+}
+
+func (s *SnapSuite) TestInfoYAML(c *check.C) {
+	s.RedirectClientToTestServer(infoServer(c, true, true))
+	_, err := snap.Parser().ParseArgs([]string{"info", "--yaml", "hello"})
+	c.Assert(err, check.IsNil)
+
+	var out map[string]interface{}
+	c.Assert(yaml.Unmarshal([]byte(s.Stdout()), &out), check.IsNil)
+	c.Check(out["name"], check.Equals, "hello")
+	c.Check(out["license-agreement"], check.Equals, "explicit")
+	c.Check(out["plugs"], check.DeepEquals, []interface{}{
+		map[interface{}]interface{}{"name": "network", "interface": "network", "connections": []interface{}{"core:network"}},
+	})
+}
+
+func (s *SnapSuite) TestInfoJSONAndYAML(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"info", "--json", "--yaml", "hello"})
+	c.Assert(err, check.ErrorMatches, `cannot use --json and --yaml together`)
+}
+
+func (s *SnapSuite) TestInfoPath(c *check.C) {
+	s.RedirectClientToTestServer(infoServer(c, false, true))
+
+	snapDir := filepath.Join(c.MkDir(), "hello")
+	c.Assert(os.MkdirAll(filepath.Join(snapDir, "meta"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(snapDir, "meta", "snap.yaml"), []byte(`name: hello
+version: 2.12
+summary: local hello
+apps:
+  hello:
+    command: bin/hello
+  svc:
+    command: bin/svc
+    daemon: forking
+plugs:
+  network:
+slots:
+  greeting:
+    interface: content
+`), 0644), check.IsNil)
+
+	_, err := snap.Parser().ParseArgs([]string{"info", snapDir})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf(`name:     hello
+summary:  "local hello"
+type:     app
+path:     %q
+version:  2.12
+commands:
+  - hello
+services:
+  hello.svc:  forking
+plugs:
+  network:  network
+slots:
+  greeting:  content
+channels:
+  stable:  2.10 (1)
+  beta:    2.11 (2)
+  edge:    2.11~pre1 (3)
+  other:   2.12 (4)
+`, snapDir))
+}
+
+func (s *SnapSuite) TestInfoPathNotASnap(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"info", filepath.Join(c.MkDir(), "nothere.snap")})
+	c.Assert(err, check.ErrorMatches, `cannot open snap: .*`)
+}
@@ -23,7 +23,6 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/i18n"
 
 	"github.com/jessevdk/go-flags"
@@ -61,22 +60,24 @@ func (x *cmdKeys) Execute(args []string) error {
 	}
 	keys := []Key{}
 
-	manager := asserts.NewGPGKeypairManager()
-	display := func(privk asserts.PrivateKey, fpr string, uid string) error {
+	manager, err := getKeypairManager()
+	if err != nil {
+		return err
+	}
+	infos, err := manager.List()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
 		key := Key{
-			Name:     uid,
-			Sha3_384: privk.PublicKey().ID(),
+			Name:     info.Name,
+			Sha3_384: info.ID,
 		}
 		if x.JSON {
 			keys = append(keys, key)
 		} else {
 			fmt.Fprintf(w, "%s\t%s\n", key.Name, key.Sha3_384)
 		}
-		return nil
-	}
-	err := manager.Walk(display)
-	if err != nil {
-		return err
 	}
 	if x.JSON {
 		obj, err := json.Marshal(keys)
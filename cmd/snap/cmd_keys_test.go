@@ -20,6 +20,10 @@
 package main_test
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -28,6 +32,7 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/asserts"
 	snap "github.com/snapcore/snapd/cmd/snap"
 )
 
@@ -125,3 +130,67 @@ func (s *SnapKeysSuite) TestKeysJSONEmpty(c *C) {
 	c.Check(s.Stdout(), Equals, "[]\n")
 	c.Check(s.Stderr(), Equals, "")
 }
+
+var fakeExtKeyMgr = `#!/bin/sh
+req=$(cat)
+echo "$req" >> %[1]s/requests
+case "$req" in
+*'"op":"features"'*)
+  echo '{"signing": ["RSA-PKCS"], "public-keys": ["DER"]}'
+  ;;
+*'"op":"key-names"'*)
+  echo '{"key-names": ["ext-key"]}'
+  ;;
+*'"op":"public-key"'*)
+  echo '{"public-key": "%[2]s"}'
+  ;;
+*'"op":"generate"'*)
+  echo '{}'
+  ;;
+*)
+  echo '{"error": "unsupported"}'
+  ;;
+esac
+`
+
+func (s *SnapKeysSuite) mockExtKeyMgr(c *C) (dir, keyID string) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, IsNil)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	c.Assert(err, IsNil)
+
+	dir = c.MkDir()
+	keyMgr := filepath.Join(dir, "keymgr")
+	err = ioutil.WriteFile(keyMgr, []byte(fmt.Sprintf(fakeExtKeyMgr, dir, base64.StdEncoding.EncodeToString(der))), 0755)
+	c.Assert(err, IsNil)
+	os.Setenv("SNAPD_EXT_KEYMGR", keyMgr)
+	return dir, asserts.RSAPublicKey(&rsaKey.PublicKey).ID()
+}
+
+func (s *SnapKeysSuite) TestKeysExternal(c *C) {
+	_, keyID := s.mockExtKeyMgr(c)
+	defer os.Unsetenv("SNAPD_EXT_KEYMGR")
+
+	rest, err := snap.Parser().ParseArgs([]string{"keys"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Matches, fmt.Sprintf(`Name +SHA3-384
+ext-key +%s
+`, keyID))
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapKeysSuite) TestCreateKeyExternal(c *C) {
+	dir, _ := s.mockExtKeyMgr(c)
+	defer os.Unsetenv("SNAPD_EXT_KEYMGR")
+
+	rest, err := snap.Parser().ParseArgs([]string{"create-key", "new-key"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+
+	requests, err := ioutil.ReadFile(filepath.Join(dir, "requests"))
+	c.Assert(err, IsNil)
+	c.Check(string(requests), Matches, `(?s).*"op":"generate","key-name":"new-key".*`)
+	// no passphrase prompt
+	c.Check(s.Stdout(), Equals, "")
+}
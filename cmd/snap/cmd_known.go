@@ -20,9 +20,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
+	"gopkg.in/yaml.v2"
+
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/overlord/auth"
@@ -37,7 +40,9 @@ type cmdKnown struct {
 		HeaderFilters  []string `required:"0"`
 	} `positional-args:"true" required:"true"`
 
-	Remote bool `long:"remote"`
+	Remote              bool   `long:"remote"`
+	ExportPrerequisites bool   `long:"export-prerequisites"`
+	Format              string `long:"format" choice:"assertion" choice:"json" choice:"yaml" default:"assertion"`
 }
 
 var shortKnownHelp = i18n.G("Shows known assertions of the provided type")
@@ -45,12 +50,24 @@ var longKnownHelp = i18n.G(`
 The known command shows known assertions of the provided type.
 If header=value pairs are provided after the assertion type, the assertions
 shown must also have the specified headers matching the provided values.
+
+With --export-prerequisites the assertions are preceded by their
+prerequisites and the account-keys signing them, producing a
+self-contained stream that can be imported as is with snap ack.
+
+With --format=json or --format=yaml the assertions are shown as a list of
+their headers, base64 encoded body and signature details, for use by
+tooling; that representation cannot be imported back.
 `)
 
 func init() {
 	addCommand("known", shortKnownHelp, longKnownHelp, func() flags.Commander {
 		return &cmdKnown{}
-	}, nil, []argDesc{
+	}, map[string]string{
+		"remote":               i18n.G("Query the store for the assertion, via snapd if possible"),
+		"export-prerequisites": i18n.G("Include the prerequisites and signing keys of the assertions, in dependency order"),
+		"format":               i18n.G("Show the assertions in the given format, one of assertion, json or yaml"),
+	}, []argDesc{
 		{
 			name: i18n.G("<assertion type>"),
 			desc: i18n.G("Assertion type name"),
@@ -110,15 +127,25 @@ func (x *cmdKnown) Execute(args []string) error {
 
 	var assertions []asserts.Assertion
 	var err error
-	if x.Remote {
+	switch {
+	case x.Remote && x.ExportPrerequisites:
+		return fmt.Errorf(i18n.G("cannot use --export-prerequisites with --remote"))
+	case x.Remote:
 		assertions, err = downloadAssertion(x.KnownOptions.AssertTypeName, headers)
-	} else {
+	case x.ExportPrerequisites:
+		assertions, err = Client().KnownWithPrerequisites(x.KnownOptions.AssertTypeName, headers)
+	default:
 		assertions, err = Client().Known(x.KnownOptions.AssertTypeName, headers)
 	}
 	if err != nil {
 		return err
 	}
 
+	switch x.Format {
+	case "json", "yaml":
+		return showStructured(x.Format, assertions)
+	}
+
 	enc := asserts.NewEncoder(Stdout)
 	for _, a := range assertions {
 		enc.Encode(a)
@@ -126,3 +153,24 @@ func (x *cmdKnown) Execute(args []string) error {
 
 	return nil
 }
+
+func showStructured(format string, assertions []asserts.Assertion) error {
+	structured := make([]*asserts.Structured, len(assertions))
+	for i, a := range assertions {
+		structured[i] = asserts.ToStructured(a)
+	}
+
+	var b []byte
+	var err error
+	if format == "json" {
+		b, err = json.MarshalIndent(structured, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(structured)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = Stdout.Write(b)
+	return err
+}
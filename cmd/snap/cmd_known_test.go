@@ -20,12 +20,14 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 
 	"gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
 
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/store"
@@ -88,3 +90,74 @@ func (s *SnapSuite) TestKnownRemoteMissingPrimaryKey(c *check.C) {
 	_, err := snap.Parser().ParseArgs([]string{"known", "--remote", "model", "series=16", "brand-id=canonical"})
 	c.Assert(err, check.ErrorMatches, `missing primary header "model" to query remote assertion`)
 }
+
+func (s *SnapSuite) TestKnownExportPrerequisites(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/assertions/model")
+			c.Check(r.URL.Query().Get("export-prerequisites"), check.Equals, "true")
+			c.Check(r.URL.Query().Get("model"), check.Equals, "pi99")
+			w.Header().Set("X-Ubuntu-Assertions-Count", "0")
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+
+	rest, err := snap.Parser().ParseArgs([]string{"known", "--export-prerequisites", "model", "model=pi99"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestKnownExportPrerequisitesRemote(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"known", "--remote", "--export-prerequisites", "model", "series=16", "brand-id=canonical", "model=pi99"})
+	c.Assert(err, check.ErrorMatches, `cannot use --export-prerequisites with --remote`)
+}
+
+func (s *SnapSuite) mockKnownModel(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/assertions/model")
+		w.Header().Set("X-Ubuntu-Assertions-Count", "1")
+		fmt.Fprint(w, mockModelAssertion)
+	})
+}
+
+func (s *SnapSuite) TestKnownFormatJSON(c *check.C) {
+	s.mockKnownModel(c)
+
+	_, err := snap.Parser().ParseArgs([]string{"known", "--format=json", "model"})
+	c.Assert(err, check.IsNil)
+	var out []map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(s.Stdout()), &out), check.IsNil)
+	c.Assert(out, check.HasLen, 1)
+	c.Check(out[0]["type"], check.Equals, "model")
+	c.Check(out[0]["sign-key-sha3-384"], check.Equals, "9tydnLa6MTJ-jaQTFUXEwHl1yRx7ZS4K5cyFDhYDcPzhS7uyEkDxdUjg9g08BtNn")
+	c.Check(out[0]["signature"], check.Equals, "AcLorsomethingthatlooksvaguelylikeasignature==")
+	headers := out[0]["headers"].(map[string]interface{})
+	c.Check(headers["model"], check.Equals, "pi99")
+	c.Check(headers["architecture"], check.Equals, "armhf")
+	_, ok := out[0]["body"]
+	c.Check(ok, check.Equals, false)
+}
+
+func (s *SnapSuite) TestKnownFormatYAML(c *check.C) {
+	s.mockKnownModel(c)
+
+	_, err := snap.Parser().ParseArgs([]string{"known", "--format=yaml", "model"})
+	c.Assert(err, check.IsNil)
+	var out []map[string]interface{}
+	c.Assert(yaml.Unmarshal([]byte(s.Stdout()), &out), check.IsNil)
+	c.Assert(out, check.HasLen, 1)
+	c.Check(out[0]["type"], check.Equals, "model")
+	c.Check(out[0]["headers"].(map[interface{}]interface{})["gadget"], check.Equals, "pi99")
+}
+
+func (s *SnapSuite) TestKnownFormatInvalid(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"known", "--format=xml", "model"})
+	c.Assert(err, check.ErrorMatches, `Invalid value .xml. for option .*`)
+}
@@ -36,6 +36,11 @@ type cmdPrepareImage struct {
 
 	ExtraSnaps []string `long:"extra-snaps"`
 	Channel    string   `long:"channel"`
+	ImageFile  string   `long:"image-file"`
+
+	Manifest     string `long:"manifest"`
+	FromManifest string `long:"from-manifest"`
+	Preseed      bool   `long:"preseed"`
 }
 
 func init() {
@@ -45,8 +50,12 @@ func init() {
 		func() flags.Commander {
 			return &cmdPrepareImage{}
 		}, map[string]string{
-			"extra-snaps": "Extra snaps to be installed",
-			"channel":     "The channel to use",
+			"extra-snaps":   "Extra snaps to be installed",
+			"channel":       "The channel to use",
+			"image-file":    "Also write a disk image laid out according to the gadget to the given file",
+			"manifest":      "Where to write the seed.manifest, by default next to the image root in the output directory",
+			"from-manifest": "Seed exactly the snaps and assertions listed in the seed.manifest of a previous run",
+			"preseed":       "Run the first boot seeding ahead of time, up to what needs the booted device (needs root)",
 		}, []argDesc{
 			{
 				name: i18n.G("<model-assertion>"),
@@ -60,6 +69,10 @@ func init() {
 }
 
 func (x *cmdPrepareImage) Execute(args []string) error {
+	manifestFile := x.Manifest
+	if manifestFile == "" {
+		manifestFile = filepath.Join(x.Positional.Rootdir, "seed.manifest")
+	}
 	opts := &image.Options{
 		ModelFile: x.Positional.ModelAssertionFn,
 
@@ -67,6 +80,11 @@ func (x *cmdPrepareImage) Execute(args []string) error {
 		GadgetUnpackDir: filepath.Join(x.Positional.Rootdir, "gadget"),
 		Channel:         x.Channel,
 		Snaps:           x.ExtraSnaps,
+		ImageFile:       x.ImageFile,
+
+		ManifestFile:     manifestFile,
+		FromManifestFile: x.FromManifest,
+		Preseed:          x.Preseed,
 	}
 
 	return image.Prepare(opts)
@@ -0,0 +1,74 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/snapcore/snapd/i18n"
+
+	"github.com/jessevdk/go-flags"
+)
+
+type cmdRemodel struct {
+	Positionals struct {
+		ModelFile string `required:"true"`
+	} `positional-args:"true" required:"true"`
+}
+
+var shortRemodelHelp = i18n.G("Changes the model of the device")
+var longRemodelHelp = i18n.G(`
+The remodel command moves the device to the model of the given model
+assertion, which must be of the same brand as the current one.
+
+The snaps newly required by the model are installed, switching to its kernel
+if it is a different one, and the device is registered again for the new
+model. If any of this fails all of it is undone.
+`)
+
+func init() {
+	addCommand("remodel", shortRemodelHelp, longRemodelHelp, func() flags.Commander {
+		return &cmdRemodel{}
+	}, nil, []argDesc{{
+		name: i18n.G("<new model assertion file>"),
+		desc: i18n.G("Model assertion of the new model"),
+	}})
+}
+
+func (x *cmdRemodel) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	newModel, err := ioutil.ReadFile(x.Positionals.ModelFile)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot read model assertion: %v"), err)
+	}
+
+	cli := Client()
+	id, err := cli.Remodel(newModel)
+	if err != nil {
+		return err
+	}
+
+	_, err = wait(cli, id)
+	return err
+}
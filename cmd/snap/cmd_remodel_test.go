@@ -0,0 +1,52 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestRemodel(c *C) {
+	modelFile := filepath.Join(c.MkDir(), "model")
+	c.Assert(ioutil.WriteFile(modelFile, []byte("type: model\n"), 0644), IsNil)
+
+	s.mockModelServer(c, map[string]interface{}{
+		"action":    "remodel",
+		"new-model": "type: model\n",
+	})
+	rest, err := Parser().ParseArgs([]string{"remodel", modelFile})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+}
+
+func (s *SnapSuite) TestRemodelMissingArg(c *C) {
+	_, err := Parser().ParseArgs([]string{"remodel"})
+	c.Assert(err, ErrorMatches, "the required argument `<new model assertion file>` was not provided")
+}
+
+func (s *SnapSuite) TestRemodelModelFileMissing(c *C) {
+	_, err := Parser().ParseArgs([]string{"remodel", filepath.Join(c.MkDir(), "missing")})
+	c.Assert(err, ErrorMatches, `cannot read model assertion: .*no such file or directory`)
+}
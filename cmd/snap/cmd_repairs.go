@@ -0,0 +1,55 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdRepairs struct{}
+
+var shortRepairsHelp = i18n.G("Lists the repairs considered on this device")
+var longRepairsHelp = i18n.G(`
+The repairs command lists the repair assertions fetched for this device,
+with their revision and whether they were run successfully, failed or were
+skipped as not applying to the device.
+`)
+
+func init() {
+	addCommand("repairs", shortRepairsHelp, longRepairsHelp, func() flags.Commander {
+		return &cmdRepairs{}
+	}, nil, nil)
+}
+
+func (x *cmdRepairs) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	// repairs are handled by snap-repair, independently of snapd
+	cmd := filepath.Join(dirs.LibExecDir, "snap-repair")
+	return syscallExec(cmd, []string{cmd, "list"}, os.Environ())
+}
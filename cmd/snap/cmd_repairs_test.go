@@ -0,0 +1,46 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestRepairs(c *check.C) {
+	var execArgs []string
+	restore := snap.MockSyscallExec(func(arg0 string, args []string, envv []string) error {
+		c.Check(arg0, check.Equals, "/usr/lib/snapd/snap-repair")
+		execArgs = args
+		return nil
+	})
+	defer restore()
+
+	rest, err := snap.Parser().ParseArgs([]string{"repairs"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(execArgs, check.DeepEquals, []string{"/usr/lib/snapd/snap-repair", "list"})
+}
+
+func (s *SnapSuite) TestRepairsExtraArgs(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"repairs", "foo"})
+	c.Check(err, check.ErrorMatches, "too many arguments for command")
+}
@@ -0,0 +1,79 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/snapcore/snapd/i18n"
+
+	"github.com/jessevdk/go-flags"
+)
+
+type cmdReregister struct {
+	Positionals struct {
+		ModelFile string
+	} `positional-args:"true"`
+}
+
+var shortReregisterHelp = i18n.G("Registers the device again with a new key")
+var longReregisterHelp = i18n.G(`
+The reregister command generates a new device key and requests a new serial
+for it from the serial service, replacing the current device identity once the
+new serial is obtained.
+
+If a file with a model assertion is given the device is registered for that
+model instead of its current one. If the serial service rejects the request
+the device keeps its current identity.
+`)
+
+func init() {
+	addCommand("reregister", shortReregisterHelp, longReregisterHelp, func() flags.Commander {
+		return &cmdReregister{}
+	}, nil, []argDesc{{
+		name: i18n.G("<model assertion file>"),
+		desc: i18n.G("Model assertion to register for instead of the current one"),
+	}})
+}
+
+func (x *cmdReregister) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var newModel []byte
+	if x.Positionals.ModelFile != "" {
+		var err error
+		newModel, err = ioutil.ReadFile(x.Positionals.ModelFile)
+		if err != nil {
+			return fmt.Errorf(i18n.G("cannot read model assertion: %v"), err)
+		}
+	}
+
+	cli := Client()
+	id, err := cli.Reregister(newModel)
+	if err != nil {
+		return err
+	}
+
+	_, err = wait(cli, id)
+	return err
+}
@@ -0,0 +1,74 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) mockModelServer(c *C, expectedBody map[string]interface{}) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/model":
+			c.Check(r.Method, Equals, "POST")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, expectedBody)
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "zzz"}`)
+		case "/v2/changes/zzz":
+			c.Check(r.Method, Equals, "GET")
+			fmt.Fprintln(w, `{"type":"sync", "result":{"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	})
+}
+
+func (s *SnapSuite) TestReregister(c *C) {
+	s.mockModelServer(c, map[string]interface{}{
+		"action": "reregister",
+	})
+	rest, err := Parser().ParseArgs([]string{"reregister"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+}
+
+func (s *SnapSuite) TestReregisterNewModel(c *C) {
+	modelFile := filepath.Join(c.MkDir(), "model")
+	c.Assert(ioutil.WriteFile(modelFile, []byte("type: model\n"), 0644), IsNil)
+
+	s.mockModelServer(c, map[string]interface{}{
+		"action":    "reregister",
+		"new-model": "type: model\n",
+	})
+	rest, err := Parser().ParseArgs([]string{"reregister", modelFile})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+}
+
+func (s *SnapSuite) TestReregisterModelFileMissing(c *C) {
+	_, err := Parser().ParseArgs([]string{"reregister", filepath.Join(c.MkDir(), "missing")})
+	c.Assert(err, ErrorMatches, `cannot read model assertion: .*no such file or directory`)
+}
@@ -73,8 +73,11 @@ func (x *cmdSignBuild) Execute(args []string) error {
 		return err
 	}
 
-	gkm := asserts.NewGPGKeypairManager()
-	privKey, err := gkm.GetByName(x.KeyName)
+	keypairMgr, err := getKeypairManager()
+	if err != nil {
+		return err
+	}
+	privKey, err := keypairMgr.GetByName(x.KeyName)
 	if err != nil {
 		// TRANSLATORS: %q is the key name, %v the error message
 		return fmt.Errorf(i18n.G("cannot use %q key: %v"), x.KeyName, err)
@@ -94,7 +97,7 @@ func (x *cmdSignBuild) Execute(args []string) error {
 	}
 
 	adb, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
-		KeypairManager: gkm,
+		KeypairManager: keypairMgr,
 	})
 	if err != nil {
 		return fmt.Errorf(i18n.G("cannot open the assertions database: %v"), err)
@@ -712,6 +712,48 @@ func (x *cmdRevert) Execute(args []string) error {
 	return nil
 }
 
+type cmdSwitch struct {
+	channelMixin
+
+	Positional struct {
+		Snap string `positional-arg-name:"<snap>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var shortSwitchHelp = i18n.G("Switches snap to a different channel")
+var longSwitchHelp = i18n.G(`
+The switch command switches the given snap to a different channel without
+doing a refresh. The new channel is used the next time the snap is refreshed.
+`)
+
+func (x *cmdSwitch) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	if err := x.setChannelFromCommandline(); err != nil {
+		return err
+	}
+	if x.Channel == "" {
+		return fmt.Errorf(i18n.G("missing --channel=<channel-name> parameter"))
+	}
+
+	cli := Client()
+	name := x.Positional.Snap
+	changeID, err := cli.Switch(name, &client.SnapOptions{Channel: x.Channel})
+	if err != nil {
+		return err
+	}
+
+	if _, err := wait(cli, changeID); err != nil {
+		return err
+	}
+
+	// TRANSLATORS: the first %q is the snap name, the second the channel name
+	fmt.Fprintf(Stdout, i18n.G("%q switched to the %q channel\n"), name, x.Channel)
+	return nil
+}
+
 func init() {
 	addCommand("remove", shortRemoveHelp, longRemoveHelp, func() flags.Commander { return &cmdRemove{} },
 		map[string]string{"revision": i18n.G("Remove only the given revision")}, nil)
@@ -732,4 +774,5 @@ func init() {
 	addCommand("revert", shortRevertHelp, longRevertHelp, func() flags.Commander { return &cmdRevert{} }, modeDescs.also(map[string]string{
 		"revision": "Revert to the given revision",
 	}), nil)
+	addCommand("switch", shortSwitchHelp, longSwitchHelp, func() flags.Commander { return &cmdSwitch{} }, channelDescs, nil)
 }
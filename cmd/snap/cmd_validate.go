@@ -0,0 +1,182 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+
+	"github.com/jessevdk/go-flags"
+)
+
+type cmdValidate struct {
+	Monitor    bool `long:"monitor"`
+	Enforce    bool `long:"enforce"`
+	Forget     bool `long:"forget"`
+	Positional struct {
+		ValidationSet string `positional-arg-name:"<validation-set>"`
+	} `positional-args:"yes"`
+}
+
+var shortValidateHelp = i18n.G("Lists or applies validation sets")
+var longValidateHelp = i18n.G(`
+The validate command lists the validation sets tracked by the system, with
+whether the installed snaps satisfy them, or applies a validation set given
+as <account-id>/<name>, optionally pinned to a sequence with =<sequence>.
+
+In monitor mode the system only reports whether the validation set is
+satisfied. In enforce mode installing, refreshing or removing snaps in a way
+that breaks the validation set is refused, and the validation set can only be
+enforced if the installed snaps satisfy it.
+`)
+
+func init() {
+	addCommand("validate", shortValidateHelp, longValidateHelp, func() flags.Commander {
+		return &cmdValidate{}
+	}, map[string]string{
+		"monitor": i18n.G("Monitor the given validation set"),
+		"enforce": i18n.G("Enforce the given validation set"),
+		"forget":  i18n.G("Stop tracking the given validation set"),
+	}, []argDesc{{
+		name: i18n.G("<validation-set>"),
+		desc: i18n.G("Validation set as <account-id>/<name>[=<sequence>]"),
+	}})
+}
+
+// parseValidationSet parses <account-id>/<name>[=<sequence>].
+func parseValidationSet(arg string) (accountID, name string, sequence int, err error) {
+	errPrefix := func() string {
+		return fmt.Sprintf(i18n.G("cannot parse validation set %q"), arg)
+	}
+	if i := strings.Index(arg, "="); i >= 0 {
+		sequence, err = strconv.Atoi(arg[i+1:])
+		if err != nil || sequence < 1 {
+			return "", "", 0, fmt.Errorf(i18n.G("%s: invalid sequence"), errPrefix())
+		}
+		arg = arg[:i]
+	}
+	parts := strings.Split(arg, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", 0, fmt.Errorf(i18n.G("%s: expected <account-id>/<name>"), errPrefix())
+	}
+	return parts[0], parts[1], sequence, nil
+}
+
+func validationSetStatus(vset *client.ValidationSet) string {
+	if vset.Valid {
+		return i18n.G("valid")
+	}
+	return i18n.G("invalid")
+}
+
+func (x *cmdValidate) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	action := ""
+	n := 0
+	for _, opt := range []struct {
+		set    bool
+		action string
+	}{{x.Monitor, "monitor"}, {x.Enforce, "enforce"}, {x.Forget, "forget"}} {
+		if opt.set {
+			action = opt.action
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New(i18n.G("cannot use --monitor, --enforce and --forget together"))
+	}
+
+	if x.Positional.ValidationSet == "" {
+		if action != "" {
+			return errors.New(i18n.G("missing validation set argument"))
+		}
+		return x.list()
+	}
+
+	accountID, name, sequence, err := parseValidationSet(x.Positional.ValidationSet)
+	if err != nil {
+		return err
+	}
+
+	cli := Client()
+	if action == "" {
+		// show the status of the given validation set
+		if sequence != 0 {
+			return errors.New(i18n.G("cannot specify a sequence without --monitor or --enforce"))
+		}
+		vsets, err := cli.ValidationSets()
+		if err != nil {
+			return err
+		}
+		for _, vset := range vsets {
+			if vset.AccountID == accountID && vset.Name == name {
+				fmt.Fprintln(Stdout, validationSetStatus(vset))
+				return nil
+			}
+		}
+		return fmt.Errorf(i18n.G("validation set %s/%s is not tracked"), accountID, name)
+	}
+
+	vset, err := cli.ApplyValidationSet(&client.ValidationSetAction{
+		Action:    action,
+		AccountID: accountID,
+		Name:      name,
+		Sequence:  sequence,
+	})
+	if err != nil {
+		return err
+	}
+	if action == "monitor" {
+		fmt.Fprintln(Stdout, validationSetStatus(vset))
+	}
+	return nil
+}
+
+func (x *cmdValidate) list() error {
+	vsets, err := Client().ValidationSets()
+	if err != nil {
+		return err
+	}
+	if len(vsets) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No validation sets are tracked yet."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Validation\tMode\tSeq\tPinned\tStatus"))
+	for _, vset := range vsets {
+		pinned := "-"
+		if vset.PinnedAt != 0 {
+			pinned = strconv.Itoa(vset.PinnedAt)
+		}
+		fmt.Fprintf(w, "%s/%s\t%s\t%d\t%s\t%s\n", vset.AccountID, vset.Name, vset.Mode, vset.Sequence, pinned, validationSetStatus(vset))
+	}
+	return nil
+}
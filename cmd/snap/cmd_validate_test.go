@@ -0,0 +1,163 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+const mockValidationSetsJSON = `{
+	"type": "sync",
+	"status-code": 200,
+	"result": [
+		{"account-id": "acme", "name": "base", "mode": "enforce", "pinned-at": 2, "sequence": 2, "valid": true},
+		{"account-id": "acme", "name": "extra", "mode": "monitor", "sequence": 5, "valid": false}
+	]
+}`
+
+func (s *SnapSuite) TestValidateList(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets")
+		fmt.Fprint(w, mockValidationSetsJSON)
+		n++
+	})
+
+	rest, err := snap.Parser().ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `Validation  Mode     Seq  Pinned  Status
+acme/base   enforce  2    2       valid
+acme/extra  monitor  5    -       invalid
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestValidateListNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No validation sets are tracked yet.\n")
+}
+
+func (s *SnapSuite) TestValidateStatus(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		fmt.Fprint(w, mockValidationSetsJSON)
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "acme/extra"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "invalid\n")
+
+	_, err = snap.Parser().ParseArgs([]string{"validate", "acme/other"})
+	c.Assert(err, check.ErrorMatches, "validation set acme/other is not tracked")
+}
+
+func (s *SnapSuite) TestValidateMonitor(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":     "monitor",
+			"account-id": "acme",
+			"name":       "base",
+			"sequence":   3.0,
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "acme", "name": "base", "mode": "monitor", "pinned-at": 3, "sequence": 3, "valid": true}}`)
+		n++
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "--monitor", "acme/base=3"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "valid\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestValidateEnforce(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":     "enforce",
+			"account-id": "acme",
+			"name":       "base",
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "acme", "name": "base", "mode": "enforce", "sequence": 3, "valid": true}}`)
+		n++
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "--enforce", "acme/base"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestValidateForget(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":     "forget",
+			"account-id": "acme",
+			"name":       "base",
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": null}`)
+		n++
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "--forget", "acme/base"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestValidateUnhappy(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"validate", "--monitor", "--enforce", "acme/base"}, "cannot use --monitor, --enforce and --forget together"},
+		{[]string{"validate", "--enforce"}, "missing validation set argument"},
+		{[]string{"validate", "--enforce", "acme"}, `cannot parse validation set "acme": expected <account-id>/<name>`},
+		{[]string{"validate", "--enforce", "acme/base/x"}, `cannot parse validation set "acme/base/x": expected <account-id>/<name>`},
+		{[]string{"validate", "--enforce", "acme/base=x"}, `cannot parse validation set "acme/base=x": invalid sequence`},
+		{[]string{"validate", "--enforce", "acme/base=0"}, `cannot parse validation set "acme/base=0": invalid sequence`},
+		{[]string{"validate", "acme/base=1"}, "cannot specify a sequence without --monitor or --enforce"},
+	} {
+		_, err := snap.Parser().ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
@@ -0,0 +1,46 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"os"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+// KeypairManager is the common interface of the keypair managers the
+// key handling commands can work with.
+type KeypairManager interface {
+	asserts.KeypairManager
+
+	GetByName(keyName string) (asserts.PrivateKey, error)
+	Export(keyName string) ([]byte, error)
+	List() ([]asserts.KeyInfo, error)
+	Delete(keyName string) error
+}
+
+// getKeypairManager returns the external keypair manager driven by the
+// helper pointed to by SNAPD_EXT_KEYMGR if set, otherwise the GPG one.
+func getKeypairManager() (KeypairManager, error) {
+	if keyMgrPath := os.Getenv("SNAPD_EXT_KEYMGR"); keyMgrPath != "" {
+		return asserts.NewExternalKeypairManager(keyMgrPath)
+	}
+	return asserts.NewGPGKeypairManager(), nil
+}
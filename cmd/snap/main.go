@@ -74,6 +74,9 @@ var commands []*cmdInfo
 // experimentalCommands holds information about all experimental commands.
 var experimentalCommands []*cmdInfo
 
+// debugCommands holds information about all debug commands.
+var debugCommands []*cmdInfo
+
 // addCommand replaces parser.addCommand() in a way that is compatible with
 // re-constructing a pristine parser.
 func addCommand(name, shortHelp, longHelp string, builder func() flags.Commander, optDescs map[string]string, argDescs []argDesc) *cmdInfo {
@@ -103,6 +106,20 @@ func addExperimentalCommand(name, shortHelp, longHelp string, builder func() fla
 	return info
 }
 
+// addDebugCommand replaces parser.addCommand() in a way that is
+// compatible with re-constructing a pristine parser. It is meant for
+// adding debug commands.
+func addDebugCommand(name, shortHelp, longHelp string, builder func() flags.Commander) *cmdInfo {
+	info := &cmdInfo{
+		name:      name,
+		shortHelp: shortHelp,
+		longHelp:  longHelp,
+		builder:   builder,
+	}
+	debugCommands = append(debugCommands, info)
+	return info
+}
+
 type parserSetter interface {
 	setParser(*flags.Parser)
 }
@@ -224,6 +241,20 @@ The snap tool interacts with the snapd daemon to control the snappy software pla
 		}
 		cmd.Hidden = c.hidden
 	}
+	// Add the debug command
+	debugCommand, err := parser.AddCommand("debug", shortDebugHelp, longDebugHelp, &cmdDebug{})
+	if err != nil {
+		logger.Panicf("cannot add command %q: %v", "debug", err)
+	}
+	debugCommand.Hidden = true
+	// Add all the sub-commands of the debug command
+	for _, c := range debugCommands {
+		cmd, err := debugCommand.AddCommand(c.name, c.shortHelp, strings.TrimSpace(c.longHelp), c.builder())
+		if err != nil {
+			logger.Panicf("cannot add debug command %q: %v", c.name, err)
+		}
+		cmd.Hidden = c.hidden
+	}
 	return parser
 }
 
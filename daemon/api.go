@@ -28,9 +28,11 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -67,12 +69,15 @@ var api = []*Command{
 	logoutCmd,
 	appIconCmd,
 	findCmd,
+	sectionsCmd,
 	snapsCmd,
 	snapCmd,
 	snapConfCmd,
 	interfacesCmd,
 	assertsCmd,
 	assertsFindManyCmd,
+	validationSetsCmd,
+	modelCmd,
 	eventsCmd,
 	stateChangeCmd,
 	stateChangesCmd,
@@ -119,6 +124,12 @@ var (
 		GET:    searchStore,
 	}
 
+	sectionsCmd = &Command{
+		Path:   "/v2/sections",
+		UserOK: true,
+		GET:    getSections,
+	}
+
 	snapsCmd = &Command{
 		Path:   "/v2/snaps",
 		UserOK: true,
@@ -158,6 +169,20 @@ var (
 		GET:    assertsFindMany,
 	}
 
+	validationSetsCmd = &Command{
+		Path:   "/v2/validation-sets",
+		UserOK: true,
+		GET:    listValidationSets,
+		POST:   applyValidationSet,
+	}
+
+	modelCmd = &Command{
+		Path:   "/v2/model",
+		UserOK: true,
+		GET:    getModel,
+		POST:   postModel,
+	}
+
 	eventsCmd = &Command{
 		Path: "/v2/events",
 		GET:  getEvents,
@@ -461,11 +486,34 @@ func searchStore(c *Command, r *http.Request, user *auth.UserState) Response {
 		}
 	}
 
+	page, err := intParam(query, "page")
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+	pageSize, err := intParam(query, "size")
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+
+	confinement := snap.ConfinementType(query.Get("confinement"))
+	switch confinement {
+	case "", snap.StrictConfinement, snap.DevmodeConfinement:
+		// pass
+	default:
+		return BadRequest("invalid value for \"confinement\": %q", confinement)
+	}
+
 	theStore := getStore(c)
-	found, err := theStore.Find(&store.Search{
-		Query:   q,
-		Private: private,
-		Prefix:  prefix,
+	found, paging, err := theStore.Find(&store.Search{
+		Query:        q,
+		Private:      private,
+		Prefix:       prefix,
+		Section:      query.Get("section"),
+		Publisher:    query.Get("publisher"),
+		Confinement:  confinement,
+		Architecture: query.Get("architecture"),
+		Page:         page,
+		PageSize:     pageSize,
 	}, user)
 	switch err {
 	case nil:
@@ -474,6 +522,8 @@ func searchStore(c *Command, r *http.Request, user *auth.UserState) Response {
 		return BadRequest("%v", err)
 	case store.ErrUnauthenticated:
 		return Unauthorized(err.Error())
+	case store.ErrStoreUnavailable:
+		return StoreUnavailable("%v", err)
 	default:
 		return InternalError("%v", err)
 	}
@@ -482,10 +532,40 @@ func searchStore(c *Command, r *http.Request, user *auth.UserState) Response {
 		SuggestedCurrency: theStore.SuggestedCurrency(),
 		Sources:           []string{"store"},
 	}
+	if paging != nil {
+		meta.Paging = &Paging{Page: paging.Page, Pages: paging.Pages}
+	}
 
 	return sendStorePackages(route, meta, found)
 }
 
+// intParam returns the value of the given non-negative integer query
+// parameter, or 0 if it is not set.
+func intParam(query url.Values, name string) (int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value for %q: %q", name, v)
+	}
+	return n, nil
+}
+
+func getSections(c *Command, r *http.Request, user *auth.UserState) Response {
+	theStore := getStore(c)
+	sections, err := theStore.Sections(user)
+	if err == store.ErrStoreUnavailable {
+		return StoreUnavailable("%v", err)
+	}
+	if err != nil {
+		return InternalError("%v", err)
+	}
+
+	return SyncResponse(sections, &Meta{Sources: []string{"store"}})
+}
+
 func findOne(c *Command, r *http.Request, user *auth.UserState, name string) Response {
 	if err := snap.ValidateName(name); err != nil {
 		return BadRequest(err.Error())
@@ -493,6 +573,9 @@ func findOne(c *Command, r *http.Request, user *auth.UserState, name string) Res
 
 	theStore := getStore(c)
 	snapInfo, err := theStore.Snap(name, "", false, snap.R(0), user)
+	if err == store.ErrStoreUnavailable {
+		return StoreUnavailable("%v", err)
+	}
 	if err != nil {
 		return InternalError("%v", err)
 	}
@@ -658,11 +741,15 @@ var (
 	snapstateRefreshCandidates = snapstate.RefreshCandidates
 	snapstateTryPath           = snapstate.TryPath
 	snapstateUpdate            = snapstate.Update
+	snapstateSwitch            = snapstate.Switch
 	snapstateUpdateMany        = snapstate.UpdateMany
 	snapstateInstallMany       = snapstate.InstallMany
 	snapstateRemoveMany        = snapstate.RemoveMany
 
 	assertstateRefreshSnapDeclarations = assertstate.RefreshSnapDeclarations
+
+	devicestateReregister = devicestate.Reregister
+	devicestateRemodel    = devicestate.Remodel
 )
 
 func ensureStateSoonImpl(st *state.State) {
@@ -914,6 +1001,22 @@ func snapDisable(inst *snapInstruction, st *state.State) (string, []*state.TaskS
 	return msg, []*state.TaskSet{ts}, nil
 }
 
+func snapSwitch(inst *snapInstruction, st *state.State) (string, []*state.TaskSet, error) {
+	if !inst.Revision.Unset() {
+		return "", nil, errors.New("switch takes no revision")
+	}
+	if inst.DevMode || inst.JailMode {
+		return "", nil, errors.New("switch takes no confinement options")
+	}
+	ts, err := snapstateSwitch(st, inst.Snaps[0], inst.Channel)
+	if err != nil {
+		return "", nil, err
+	}
+
+	msg := fmt.Sprintf(i18n.G("Switch %q snap to %q channel"), inst.Snaps[0], inst.Channel)
+	return msg, []*state.TaskSet{ts}, nil
+}
+
 type snapActionFunc func(*snapInstruction, *state.State) (string, []*state.TaskSet, error)
 
 var snapInstructionDispTable = map[string]snapActionFunc{
@@ -923,6 +1026,7 @@ var snapInstructionDispTable = map[string]snapActionFunc{
 	"revert":  snapRevert,
 	"enable":  snapEnable,
 	"disable": snapDisable,
+	"switch":  snapSwitch,
 }
 
 func (inst *snapInstruction) dispatch() snapActionFunc {
@@ -961,6 +1065,9 @@ func postSnap(c *Command, r *http.Request, user *auth.UserState) Response {
 	}
 
 	msg, tsets, err := impl(&inst, state)
+	if err == store.ErrStoreUnavailable {
+		return StoreUnavailable("cannot %s %q: %v", inst.Action, inst.Snaps[0], err)
+	}
 	if err != nil {
 		return BadRequest("cannot %s %q: %v", inst.Action, inst.Snaps[0], err)
 	}
@@ -1424,11 +1531,21 @@ func doAssert(c *Command, r *http.Request, user *auth.UserState) Response {
 	if err := batch.Commit(state); err != nil {
 		return BadRequest("assert failed: %v", err)
 	}
-	// TODO: what more info do we want to return on success?
-	return &resp{
-		Type:   ResponseTypeSync,
-		Status: http.StatusOK,
+
+	committed := batch.Committed()
+	added := make([]assertRefJSON, len(committed))
+	for i, ref := range committed {
+		added[i] = assertRefJSON{
+			Type:       ref.Type.Name,
+			PrimaryKey: ref.PrimaryKey,
+		}
 	}
+	return SyncResponse(map[string]interface{}{"added": added}, nil)
+}
+
+type assertRefJSON struct {
+	Type       string   `json:"type"`
+	PrimaryKey []string `json:"primary-key"`
 }
 
 func assertsFindMany(c *Command, r *http.Request, user *auth.UserState) Response {
@@ -1439,7 +1556,13 @@ func assertsFindMany(c *Command, r *http.Request, user *auth.UserState) Response
 	}
 	headers := map[string]string{}
 	q := r.URL.Query()
+	exportPrereqs := false
 	for k := range q {
+		if k == "export-prerequisites" {
+			// not a header, asks for a self-contained stream
+			exportPrereqs = q.Get(k) == "true"
+			continue
+		}
 		headers[k] = q.Get(k)
 	}
 
@@ -1449,14 +1572,155 @@ func assertsFindMany(c *Command, r *http.Request, user *auth.UserState) Response
 	state.Unlock()
 
 	assertions, err := db.FindMany(assertType, headers)
-	if err == asserts.ErrNotFound {
-		return AssertResponse(nil, true)
-	} else if err != nil {
+	if err != nil && err != asserts.ErrNotFound {
 		return InternalError("searching assertions failed: %v", err)
 	}
+	if exportPrereqs && len(assertions) != 0 {
+		assertions, err = asserts.WithPrerequisites(db, assertions)
+		if err != nil {
+			return InternalError("cannot export assertions with their prerequisites: %v", err)
+		}
+	}
+	if acceptsJSON(r) {
+		structured := make([]*asserts.Structured, len(assertions))
+		for i, a := range assertions {
+			structured[i] = asserts.ToStructured(a)
+		}
+		return SyncResponse(structured, nil)
+	}
 	return AssertResponse(assertions, true)
 }
 
+// acceptsJSON returns whether the client asked explicitly for JSON
+// rather than the default representation.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+type validationSetResult struct {
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	PinnedAt  int    `json:"pinned-at,omitempty"`
+	Sequence  int    `json:"sequence"`
+	Valid     bool   `json:"valid"`
+}
+
+func validationSetResultFor(st *state.State, vst *assertstate.ValidationSetTracking, installed map[string]snap.Revision) (*validationSetResult, error) {
+	vs, err := assertstate.ValidationSetAssertion(st, vst)
+	if err != nil {
+		return nil, err
+	}
+	valid := snapasserts.CheckInstalledSnaps([]*asserts.ValidationSet{vs}, installed) == nil
+	return &validationSetResult{
+		AccountID: vst.AccountID,
+		Name:      vst.Name,
+		Mode:      string(vst.Mode),
+		PinnedAt:  vst.PinnedAt,
+		Sequence:  vst.Current,
+		Valid:     valid,
+	}, nil
+}
+
+func listValidationSets(c *Command, r *http.Request, user *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	vsets, err := assertstate.ValidationSets(st)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	installed, err := assertstate.InstalledSnaps(st)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+
+	keys := make([]string, 0, len(vsets))
+	for key := range vsets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	results := make([]*validationSetResult, len(keys))
+	for i, key := range keys {
+		results[i], err = validationSetResultFor(st, vsets[key], installed)
+		if err != nil {
+			return InternalError("%v", err)
+		}
+	}
+
+	return SyncResponse(results, nil)
+}
+
+type validationSetAction struct {
+	Action    string `json:"action"`
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	Sequence  int    `json:"sequence,omitempty"`
+}
+
+func applyValidationSet(c *Command, r *http.Request, user *auth.UserState) Response {
+	var action validationSetAction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&action); err != nil {
+		return BadRequest("cannot decode request body into validation set action: %v", err)
+	}
+	if action.AccountID == "" || action.Name == "" {
+		return BadRequest("validation set account-id and name must be specified")
+	}
+	if action.Sequence < 0 {
+		return BadRequest("invalid validation set sequence: %d", action.Sequence)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var mode assertstate.ValidationSetMode
+	switch action.Action {
+	case "monitor":
+		mode = assertstate.MonitorMode
+	case "enforce":
+		mode = assertstate.EnforceMode
+	case "forget":
+		if err := assertstate.ForgetValidationSet(st, action.AccountID, action.Name); err != nil {
+			return BadRequest("%v", err)
+		}
+		return SyncResponse(nil, nil)
+	default:
+		return BadRequest("unknown validation set action %q", action.Action)
+	}
+
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+	vst, err := assertstate.ApplyValidationSet(st, action.AccountID, action.Name, action.Sequence, mode, userID)
+	if err == store.ErrStoreUnavailable {
+		return StoreUnavailable("%v", err)
+	}
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+
+	installed, err := assertstate.InstalledSnaps(st)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	result, err := validationSetResultFor(st, vst, installed)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	return SyncResponse(result, nil)
+}
+
 func getEvents(c *Command, r *http.Request, user *auth.UserState) Response {
 	return EventResponse(c.d.hub)
 }
@@ -1835,6 +2099,8 @@ func readyToBuy(c *Command, r *http.Request, user *auth.UserState) Response {
 		return InternalError("%v", err)
 	case store.ErrInvalidCredentials:
 		return Unauthorized(err.Error())
+	case store.ErrStoreUnavailable:
+		return StoreUnavailable("%v", err)
 	case store.ErrTOSNotAccepted:
 		return SyncResponse(&resp{
 			Type: ResponseTypeError,
@@ -1890,3 +2156,90 @@ func runSnapctl(c *Command, r *http.Request, user *auth.UserState) Response {
 
 	return SyncResponse(result, nil)
 }
+
+func getModel(c *Command, r *http.Request, user *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	model, err := devicestate.Model(st)
+	if err == state.ErrNoState {
+		return NotFound("no model assertion yet")
+	}
+	if err != nil {
+		return InternalError("cannot get model assertion: %v", err)
+	}
+
+	return AssertResponse([]asserts.Assertion{model}, false)
+}
+
+type modelAction struct {
+	Action   string `json:"action"`
+	NewModel string `json:"new-model"`
+}
+
+func postModel(c *Command, r *http.Request, user *auth.UserState) Response {
+	var a modelAction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&a); err != nil {
+		return BadRequest("cannot decode request body into a model action: %v", err)
+	}
+	if a.Action != "reregister" && a.Action != "remodel" {
+		return BadRequest("unsupported model action: %q", a.Action)
+	}
+	if a.Action == "remodel" && a.NewModel == "" {
+		return BadRequest("cannot remodel without a new model assertion")
+	}
+
+	var newModel *asserts.Model
+	if a.NewModel != "" {
+		as, err := asserts.Decode([]byte(a.NewModel))
+		if err != nil {
+			return BadRequest("cannot decode new model assertion: %v", err)
+		}
+		var ok bool
+		newModel, ok = as.(*asserts.Model)
+		if !ok {
+			return BadRequest("new model is not a model assertion but %q", as.Type().Name)
+		}
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var tss []*state.TaskSet
+	var summary string
+	switch a.Action {
+	case "reregister":
+		ts, err := devicestateReregister(st, newModel)
+		if err != nil {
+			return BadRequest("%v", err)
+		}
+		tss = []*state.TaskSet{ts}
+		summary = "Reregister device"
+		if newModel != nil {
+			summary = fmt.Sprintf("Reregister device for model %s/%s", newModel.BrandID(), newModel.Model())
+		}
+	case "remodel":
+		var err error
+		var userID int
+		if user != nil {
+			userID = user.ID
+		}
+		tss, err = devicestateRemodel(st, newModel, userID)
+		if err != nil {
+			return BadRequest("%v", err)
+		}
+		summary = fmt.Sprintf("Remodel device to %s/%s", newModel.BrandID(), newModel.Model())
+	}
+
+	chg := st.NewChange(a.Action, summary)
+	for _, ts := range tss {
+		chg.AddAll(ts)
+	}
+
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
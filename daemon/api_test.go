@@ -50,6 +50,7 @@ import (
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/configstate"
+	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
@@ -66,6 +67,8 @@ type apiSuite struct {
 	err               error
 	vars              map[string]string
 	storeSearch       store.Search
+	paging            *store.Paging
+	sections          []string
 	suggestedCurrency string
 	d                 *Daemon
 	user              *auth.UserState
@@ -88,11 +91,17 @@ func (s *apiSuite) Snap(name, channel string, devmode bool, revision snap.Revisi
 	return nil, s.err
 }
 
-func (s *apiSuite) Find(search *store.Search, user *auth.UserState) ([]*snap.Info, error) {
+func (s *apiSuite) Find(search *store.Search, user *auth.UserState) ([]*snap.Info, *store.Paging, error) {
 	s.storeSearch = *search
 	s.user = user
 
-	return s.rsnaps, s.err
+	return s.rsnaps, s.paging, s.err
+}
+
+func (s *apiSuite) Sections(user *auth.UserState) ([]string, error) {
+	s.user = user
+
+	return s.sections, s.err
 }
 
 func (s *apiSuite) ListRefresh(snaps []*store.RefreshCandidate, user *auth.UserState) ([]*snap.Info, error) {
@@ -110,6 +119,10 @@ func (s *apiSuite) Download(string, *snap.DownloadInfo, progress.Meter, *auth.Us
 	panic("Download not expected to be called")
 }
 
+func (s *apiSuite) SetDownloadRateLimit(int64) {
+	panic("SetDownloadRateLimit not expected to be called")
+}
+
 func (s *apiSuite) Buy(options *store.BuyOptions, user *auth.UserState) (*store.BuyResult, error) {
 	s.buyOptions = options
 	s.user = user
@@ -156,6 +169,8 @@ func (s *apiSuite) SetUpTest(c *check.C) {
 	s.rsnaps = nil
 	s.suggestedCurrency = ""
 	s.storeSearch = store.Search{}
+	s.paging = nil
+	s.sections = nil
 	s.err = nil
 	s.vars = nil
 	s.user = nil
@@ -178,9 +193,12 @@ func (s *apiSuite) TearDownTest(c *check.C) {
 	snapstateInstall = snapstate.Install
 	snapstateGet = snapstate.Get
 	snapstateInstallPath = snapstate.InstallPath
+	snapstateSwitch = snapstate.Switch
 	assertstateRefreshSnapDeclarations = assertstate.RefreshSnapDeclarations
 	unsafeReadSnapInfo = unsafeReadSnapInfoImpl
 	ensureStateSoon = ensureStateSoonImpl
+	devicestateReregister = devicestate.Reregister
+	devicestateRemodel = devicestate.Remodel
 	dirs.SetRootDir("")
 }
 
@@ -240,6 +258,7 @@ version: %s
 		snapst.Active = active
 		snapst.Sequence = append(snapst.Sequence, &snapInfo.SideInfo)
 		snapst.Current = snapInfo.SideInfo.Revision
+		snapst.Channel = "stable"
 
 		snapstate.Set(st, name, &snapst)
 	}
@@ -305,6 +324,9 @@ func (s *apiSuite) TestSnapInfoOneIntegration(c *check.C) {
 			"trymode":     false,
 			"apps":        []appJSON{},
 			"broken":      "",
+
+			"tracking-channel":    "stable",
+			"installed-revisions": []snap.Revision{snap.R(5), snap.R(10)},
 		},
 		Meta: meta,
 	}
@@ -312,6 +334,55 @@ func (s *apiSuite) TestSnapInfoOneIntegration(c *check.C) {
 	c.Check(rsp.Result, check.DeepEquals, expected.Result)
 }
 
+func (s *apiSuite) TestSnapInfoLicenseAndServices(c *check.C) {
+	d := s.daemon(c)
+	s.vars = map[string]string{"name": "baz"}
+
+	s.mkInstalledInState(c, d, "baz", "bar", "v1", snap.R(10), true, `license-agreement: explicit
+license-version: "2"
+apps:
+  svc:
+    command: bin/svc
+    daemon: simple
+`)
+
+	req, err := http.NewRequest("GET", "/v2/snaps/baz", nil)
+	c.Assert(err, check.IsNil)
+	rsp, ok := getSnapInfo(snapCmd, req, nil).(*resp)
+	c.Assert(ok, check.Equals, true)
+
+	m := rsp.Result.(map[string]interface{})
+	c.Check(m["license-agreement"], check.Equals, "explicit")
+	c.Check(m["license-version"], check.Equals, "2")
+	c.Check(m["apps"], check.DeepEquals, []appJSON{{Name: "svc", Daemon: "simple"}})
+	c.Check(m["installed-revisions"], check.DeepEquals, []snap.Revision{snap.R(10)})
+}
+
+func (s *apiSuite) TestSnapInfoTrackingChannel(c *check.C) {
+	d := s.daemon(c)
+	s.vars = map[string]string{"name": "foo"}
+
+	s.mkInstalledInState(c, d, "foo", "bar", "v1", snap.R(10), true, "")
+
+	// switch to tracking beta, without refreshing from it
+	st := d.overlord.State()
+	st.Lock()
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(st, "foo", &snapst), check.IsNil)
+	snapst.Channel = "beta"
+	snapstate.Set(st, "foo", &snapst)
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/snaps/foo", nil)
+	c.Assert(err, check.IsNil)
+	rsp, ok := getSnapInfo(snapCmd, req, nil).(*resp)
+	c.Assert(ok, check.Equals, true)
+
+	m := rsp.Result.(map[string]interface{})
+	c.Check(m["tracking-channel"], check.Equals, "beta")
+	c.Check(m["channel"], check.Equals, "stable")
+}
+
 func (s *apiSuite) TestSnapInfoWithAuth(c *check.C) {
 	state := snapCmd.d.overlord.State()
 	state.Lock()
@@ -398,6 +469,7 @@ func (s *apiSuite) TestListIncludesAll(c *check.C) {
 		"snapInstructionDispTable",
 		"snapstateInstall",
 		"snapstateUpdate",
+		"snapstateSwitch",
 		"snapstateInstallPath",
 		"snapstateTryPath",
 		"snapstateGet",
@@ -406,6 +478,8 @@ func (s *apiSuite) TestListIncludesAll(c *check.C) {
 		"snapstateRemoveMany",
 		"snapstateRefreshCandidates",
 		"assertstateRefreshSnapDeclarations",
+		"devicestateReregister",
+		"devicestateRemodel",
 		"unsafeReadSnapInfo",
 		"osutilAddUser",
 		"storeUserInfo",
@@ -956,6 +1030,148 @@ func (s *apiSuite) TestFindPrefix(c *check.C) {
 	c.Check(s.storeSearch, check.DeepEquals, store.Search{Query: "foo", Prefix: true})
 }
 
+func (s *apiSuite) TestFindFilters(c *check.C) {
+	s.daemon(c)
+
+	s.rsnaps = []*snap.Info{}
+
+	req, err := http.NewRequest("GET", "/v2/find?q=foo&section=games&publisher=canonical&confinement=devmode&architecture=armhf&page=2&size=20", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := searchStore(findCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+
+	c.Check(s.storeSearch, check.DeepEquals, store.Search{
+		Query:        "foo",
+		Section:      "games",
+		Publisher:    "canonical",
+		Confinement:  snap.DevmodeConfinement,
+		Architecture: "armhf",
+		Page:         2,
+		PageSize:     20,
+	})
+}
+
+func (s *apiSuite) TestFindPaging(c *check.C) {
+	s.daemon(c)
+
+	s.rsnaps = []*snap.Info{}
+	s.paging = &store.Paging{Page: 2, Pages: 5}
+
+	req, err := http.NewRequest("GET", "/v2/find?q=foo&page=2", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := searchStore(findCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Paging, check.DeepEquals, &Paging{Page: 2, Pages: 5})
+}
+
+func (s *apiSuite) TestFindBadConfinement(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/find?q=foo&confinement=classic", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := searchStore(findCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `invalid value for "confinement": "classic"`)
+}
+
+func (s *apiSuite) TestFindSectionOnly(c *check.C) {
+	s.daemon(c)
+
+	s.rsnaps = []*snap.Info{}
+
+	req, err := http.NewRequest("GET", "/v2/find?section=featured", nil)
+	c.Assert(err, check.IsNil)
+
+	_ = searchStore(findCmd, req, nil).(*resp)
+
+	c.Check(s.storeSearch, check.DeepEquals, store.Search{Section: "featured"})
+}
+
+func (s *apiSuite) TestFindBadPage(c *check.C) {
+	for _, q := range []string{"page=x", "page=-1", "size=x"} {
+		req, err := http.NewRequest("GET", "/v2/find?q=foo&"+q, nil)
+		c.Assert(err, check.IsNil)
+
+		rsp := searchStore(findCmd, req, nil).(*resp)
+		c.Check(rsp.Type, check.Equals, ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, `invalid value for "(page|size)": .*`)
+	}
+}
+
+func (s *apiSuite) TestSections(c *check.C) {
+	s.daemon(c)
+
+	s.sections = []string{"featured", "games"}
+
+	req, err := http.NewRequest("GET", "/v2/sections", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getSections(sectionsCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, []string{"featured", "games"})
+	c.Check(rsp.Sources, check.DeepEquals, []string{"store"})
+}
+
+func (s *apiSuite) TestSectionsError(c *check.C) {
+	s.daemon(c)
+
+	s.err = errors.New("store is down")
+
+	req, err := http.NewRequest("GET", "/v2/sections", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getSections(sectionsCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, http.StatusInternalServerError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "store is down")
+}
+
+func (s *apiSuite) TestSectionsStoreUnavailable(c *check.C) {
+	s.daemon(c)
+
+	s.err = store.ErrStoreUnavailable
+
+	req, err := http.NewRequest("GET", "/v2/sections", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getSections(sectionsCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, http.StatusServiceUnavailable)
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindStoreUnavailable)
+}
+
+func (s *apiSuite) TestFindStoreUnavailable(c *check.C) {
+	s.daemon(c)
+
+	s.err = store.ErrStoreUnavailable
+
+	req, err := http.NewRequest("GET", "/v2/find?q=hi", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := searchStore(findCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, http.StatusServiceUnavailable)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "store is unavailable")
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindStoreUnavailable)
+}
+
+func (s *apiSuite) TestFindOneStoreUnavailable(c *check.C) {
+	s.daemon(c)
+
+	s.err = store.ErrStoreUnavailable
+
+	req, err := http.NewRequest("GET", "/v2/find?name=foo", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := searchStore(findCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, http.StatusServiceUnavailable)
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindStoreUnavailable)
+}
+
 func (s *apiSuite) TestFindOne(c *check.C) {
 	s.daemon(c)
 
@@ -979,6 +1195,48 @@ func (s *apiSuite) TestFindOne(c *check.C) {
 	c.Check(snaps[0]["name"], check.Equals, "store")
 }
 
+func (s *apiSuite) TestFindOneChannels(c *check.C) {
+	s.daemon(c)
+
+	s.rsnaps = []*snap.Info{{
+		SideInfo: snap.SideInfo{
+			RealName:  "store",
+			Developer: "foo",
+		},
+		Channels: map[string]*snap.ChannelSnapInfo{
+			"stable": {Channel: "stable", Revision: snap.R(1), Version: "1.0"},
+			"edge":   {Channel: "edge", Revision: snap.R(2), Version: "1.1"},
+		},
+	}}
+	s.mockSnap(c, "name: store\nversion: 1.0")
+
+	req, err := http.NewRequest("GET", "/v2/find?name=store", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := searchStore(findCmd, req, nil).(*resp)
+
+	snaps := snapList(rsp.Result)
+	c.Assert(snaps, check.HasLen, 1)
+	c.Check(snaps[0]["channels"], check.DeepEquals, map[string]interface{}{
+		"stable": map[string]interface{}{
+			"channel":     "stable",
+			"revision":    "1",
+			"version":     "1.0",
+			"epoch":       "",
+			"confinement": "",
+			"size":        float64(0),
+		},
+		"edge": map[string]interface{}{
+			"channel":     "edge",
+			"revision":    "2",
+			"version":     "1.1",
+			"epoch":       "",
+			"confinement": "",
+			"size":        float64(0),
+		},
+	})
+}
+
 func (s *apiSuite) TestFindRefreshNotQ(c *check.C) {
 	req, err := http.NewRequest("GET", "/v2/find?select=refresh&q=foo", nil)
 	c.Assert(err, check.IsNil)
@@ -1364,6 +1622,7 @@ func (s *apiSuite) TestPostSnapDispatch(c *check.C) {
 		{"revert", snapRevert},
 		{"enable", snapEnable},
 		{"disable", snapDisable},
+		{"switch", snapSwitch},
 		{"xyzzy", nil},
 	}
 
@@ -2088,6 +2347,55 @@ func (s *apiSuite) TestRefresh(c *check.C) {
 	c.Check(summary, check.Equals, `Refresh "some-snap" snap`)
 }
 
+func (s *apiSuite) TestSwitch(c *check.C) {
+	var calledName, calledChannel string
+	snapstateSwitch = func(s *state.State, name, channel string) (*state.TaskSet, error) {
+		calledName = name
+		calledChannel = channel
+
+		t := s.NewTask("fake-switch", "Doing a fake switch")
+		return state.NewTaskSet(t), nil
+	}
+
+	d := s.daemon(c)
+	inst := &snapInstruction{
+		Action:  "switch",
+		Snaps:   []string{"some-snap"},
+		Channel: "beta",
+	}
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	summary, tss, err := inst.dispatch()(inst, st)
+	c.Assert(err, check.IsNil)
+
+	c.Check(tss, check.HasLen, 1)
+	c.Check(calledName, check.Equals, "some-snap")
+	c.Check(calledChannel, check.Equals, "beta")
+	c.Check(summary, check.Equals, `Switch "some-snap" snap to "beta" channel`)
+}
+
+func (s *apiSuite) TestSwitchBadOptions(c *check.C) {
+	snapstateSwitch = func(s *state.State, name, channel string) (*state.TaskSet, error) {
+		c.Fatalf("switch should not be called")
+		return nil, nil
+	}
+
+	d := s.daemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	inst := &snapInstruction{Action: "switch", Snaps: []string{"some-snap"}, Channel: "beta", Revision: snap.R(7)}
+	_, _, err := inst.dispatch()(inst, st)
+	c.Check(err, check.ErrorMatches, "switch takes no revision")
+
+	inst = &snapInstruction{Action: "switch", Snaps: []string{"some-snap"}, Channel: "beta", DevMode: true}
+	_, _, err = inst.dispatch()(inst, st)
+	c.Check(err, check.ErrorMatches, "switch takes no confinement options")
+}
+
 func (s *apiSuite) TestRefreshDevMode(c *check.C) {
 	calledFlags := snapstate.Flags(42)
 	calledUserID := 0
@@ -3092,6 +3400,12 @@ func (s *apiSuite) TestAssertStreamOK(c *check.C) {
 	// Verify (external)
 	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
 	c.Check(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.DeepEquals, map[string]interface{}{
+		"added": []assertRefJSON{
+			{Type: "account-key", PrimaryKey: []string{s.storeSigning.StoreAccountKey("").PublicKeyID()}},
+			{Type: "account", PrimaryKey: []string{acct.AccountID()}},
+		},
+	})
 	// Verify (internal)
 	st.Lock()
 	defer st.Unlock()
@@ -3227,6 +3541,77 @@ func (s *apiSuite) TestAssertsFindManyNoResults(c *check.C) {
 	c.Check(err, check.Equals, io.EOF)
 }
 
+func (s *apiSuite) TestAssertsFindManyExportPrerequisites(c *check.C) {
+	// Setup
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	// add store key
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	acct := assertstest.NewAccount(s.storeSigning, "developer1", nil, "")
+	assertAdd(st, acct)
+
+	// Execute
+	req, err := http.NewRequest("GET", "/v2/assertions/account?username=developer1&export-prerequisites=true", nil)
+	c.Assert(err, check.IsNil)
+	s.vars = map[string]string{"assertType": "account"}
+	rec := httptest.NewRecorder()
+	assertsFindManyCmd.GET(assertsFindManyCmd, req, nil).ServeHTTP(rec, req)
+	// Verify
+	c.Check(rec.Code, check.Equals, http.StatusOK, check.Commentf("body %q", rec.Body))
+	c.Check(rec.HeaderMap.Get("X-Ubuntu-Assertions-Count"), check.Equals, "2")
+	dec := asserts.NewDecoder(rec.Body)
+	// the signing key comes first, the trusted assertions are left out
+	a1, err := dec.Decode()
+	c.Assert(err, check.IsNil)
+	c.Check(a1.Type(), check.Equals, asserts.AccountKeyType)
+	c.Check(a1.(*asserts.AccountKey).PublicKeyID(), check.Equals, s.storeSigning.KeyID)
+	a2, err := dec.Decode()
+	c.Assert(err, check.IsNil)
+	c.Check(a2.Type(), check.Equals, asserts.AccountType)
+	c.Check(a2.(*asserts.Account).AccountID(), check.Equals, acct.AccountID())
+	_, err = dec.Decode()
+	c.Check(err, check.Equals, io.EOF)
+}
+
+func (s *apiSuite) TestAssertsFindManyJSON(c *check.C) {
+	// Setup
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	acct := assertstest.NewAccount(s.storeSigning, "developer1", nil, "")
+	assertAdd(st, acct)
+
+	// Execute
+	req, err := http.NewRequest("GET", "/v2/assertions/account?username=developer1", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Accept", "application/json")
+	s.vars = map[string]string{"assertType": "account"}
+	rsp := assertsFindManyCmd.GET(assertsFindManyCmd, req, nil).(*resp)
+	// Verify
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Status, check.Equals, http.StatusOK)
+	structured := rsp.Result.([]*asserts.Structured)
+	c.Assert(structured, check.HasLen, 1)
+	c.Check(structured[0], check.DeepEquals, asserts.ToStructured(acct))
+	c.Check(structured[0].Headers["username"], check.Equals, "developer1")
+}
+
+func (s *apiSuite) TestAssertsFindManyJSONNone(c *check.C) {
+	s.daemon(c)
+
+	req, err := http.NewRequest("GET", "/v2/assertions/account?username=developer1", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Accept", "text/plain, application/json; q=0.9")
+	s.vars = map[string]string{"assertType": "account"}
+	rsp := assertsFindManyCmd.GET(assertsFindManyCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.DeepEquals, []*asserts.Structured{})
+}
+
 func (s *apiSuite) TestAssertsInvalidType(c *check.C) {
 	// Execute
 	req, err := http.NewRequest("POST", "/v2/assertions/foo", nil)
@@ -3239,6 +3624,329 @@ func (s *apiSuite) TestAssertsInvalidType(c *check.C) {
 	c.Check(rec.Body.String(), testutil.Contains, "invalid assert type")
 }
 
+func (s *apiSuite) mockModel(c *check.C, modelName string) *asserts.Model {
+	a, err := s.storeSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "can0nical",
+		"model":        modelName,
+		"gadget":       "gadget",
+		"kernel":       "kernel",
+		"architecture": "amd64",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	return a.(*asserts.Model)
+}
+
+func (s *apiSuite) TestGetModel(c *check.C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	model := s.mockModel(c, "pc")
+	assertAdd(st, model)
+	st.Lock()
+	auth.SetDevice(st, &auth.DeviceState{Brand: "can0nical", Model: "pc"})
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/model", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	modelCmd.GET(modelCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, http.StatusOK, check.Commentf("body %q", rec.Body))
+	c.Check(rec.HeaderMap.Get("X-Ubuntu-Assertions-Count"), check.Equals, "1")
+	a, err := asserts.Decode(rec.Body.Bytes())
+	c.Assert(err, check.IsNil)
+	c.Check(a.(*asserts.Model).Model(), check.Equals, "pc")
+}
+
+func (s *apiSuite) TestGetModelNoModel(c *check.C) {
+	s.daemon(c)
+
+	req, err := http.NewRequest("GET", "/v2/model", nil)
+	c.Assert(err, check.IsNil)
+	rsp := modelCmd.GET(modelCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusNotFound)
+}
+
+func (s *apiSuite) TestPostModelReregister(c *check.C) {
+	d := s.daemon(c)
+
+	soon := 0
+	ensureStateSoon = func(st *state.State) {
+		soon++
+	}
+	var gotModel *asserts.Model
+	devicestateReregister = func(st *state.State, newModel *asserts.Model) (*state.TaskSet, error) {
+		gotModel = newModel
+		t := st.NewTask("fake-reregister", "...")
+		return state.NewTaskSet(t), nil
+	}
+
+	req, err := http.NewRequest("POST", "/v2/model", strings.NewReader(`{"action": "reregister"}`))
+	c.Assert(err, check.IsNil)
+	rsp := modelCmd.POST(modelCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync, check.Commentf("%v", rsp.Result))
+	c.Check(gotModel, check.IsNil)
+	c.Check(soon, check.Equals, 1)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "reregister")
+	c.Check(chg.Summary(), check.Equals, "Reregister device")
+	c.Check(chg.Tasks(), check.HasLen, 1)
+}
+
+func (s *apiSuite) TestPostModelReregisterNewModel(c *check.C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	model := s.mockModel(c, "pc2")
+
+	ensureStateSoon = func(st *state.State) {}
+	var gotModel *asserts.Model
+	devicestateReregister = func(st *state.State, newModel *asserts.Model) (*state.TaskSet, error) {
+		gotModel = newModel
+		return state.NewTaskSet(st.NewTask("fake-reregister", "...")), nil
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"action":    "reregister",
+		"new-model": string(asserts.Encode(model)),
+	})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/v2/model", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	rsp := modelCmd.POST(modelCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync, check.Commentf("%v", rsp.Result))
+	c.Assert(gotModel, check.NotNil)
+	c.Check(gotModel.Model(), check.Equals, "pc2")
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Change(rsp.Change).Summary(), check.Equals, "Reregister device for model can0nical/pc2")
+}
+
+func (s *apiSuite) TestPostModelRemodel(c *check.C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	model := s.mockModel(c, "pc2")
+
+	ensureStateSoon = func(st *state.State) {}
+	var gotModel *asserts.Model
+	var gotUserID int
+	devicestateRemodel = func(st *state.State, newModel *asserts.Model, userID int) ([]*state.TaskSet, error) {
+		gotModel = newModel
+		gotUserID = userID
+		ts1 := state.NewTaskSet(st.NewTask("fake-install-snap", "..."))
+		ts2 := state.NewTaskSet(st.NewTask("fake-reregister", "..."))
+		return []*state.TaskSet{ts1, ts2}, nil
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"action":    "remodel",
+		"new-model": string(asserts.Encode(model)),
+	})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/v2/model", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	rsp := modelCmd.POST(modelCmd, req, &auth.UserState{ID: 42}).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync, check.Commentf("%v", rsp.Result))
+	c.Assert(gotModel, check.NotNil)
+	c.Check(gotModel.Model(), check.Equals, "pc2")
+	c.Check(gotUserID, check.Equals, 42)
+
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "remodel")
+	c.Check(chg.Summary(), check.Equals, "Remodel device to can0nical/pc2")
+	c.Check(chg.Tasks(), check.HasLen, 2)
+}
+
+func (s *apiSuite) TestPostModelRejectedNotAdded(c *check.C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	model := s.mockModel(c, "pc2")
+
+	body, err := json.Marshal(map[string]string{
+		"action":    "reregister",
+		"new-model": string(asserts.Encode(model)),
+	})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/v2/model", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	rsp := modelCmd.POST(modelCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+
+	st.Lock()
+	defer st.Unlock()
+	// the model of a rejected request is not added
+	_, err = assertstate.DB(st).Find(asserts.ModelType, map[string]string{
+		"series":   "16",
+		"brand-id": "can0nical",
+		"model":    "pc2",
+	})
+	c.Check(err, check.Equals, asserts.ErrNotFound)
+}
+
+func (s *apiSuite) TestPostModelErrors(c *check.C) {
+	s.daemon(c)
+	devicestateReregister = func(st *state.State, newModel *asserts.Model) (*state.TaskSet, error) {
+		return nil, fmt.Errorf("cannot reregister a device that is not registered yet")
+	}
+
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`{`, `cannot decode request body into a model action: .*`},
+		{`{"action": "frobnicate"}`, `unsupported model action: "frobnicate"`},
+		{`{"action": "reregister", "new-model": "junk"}`, `cannot decode new model assertion: .*`},
+		{`{"action": "remodel"}`, `cannot remodel without a new model assertion`},
+		{`{"action": "reregister"}`, `cannot reregister a device that is not registered yet`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/model", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+		rsp := modelCmd.POST(modelCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, t.err)
+	}
+}
+
+func (s *apiSuite) mockValidationSet(c *check.C, d *Daemon) {
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	devPrivKey, _ := assertstest.GenerateKey(752)
+	acct := assertstest.NewAccount(s.storeSigning, "developer1", map[string]interface{}{
+		"account-id": "developer1-id",
+	}, "")
+	assertAdd(st, acct)
+	assertAdd(st, assertstest.NewAccountKey(s.storeSigning, acct, nil, devPrivKey.PublicKey(), ""))
+
+	devSigning := assertstest.NewSigningDB("developer1-id", devPrivKey)
+	vs, err := devSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"series":     "16",
+		"account-id": "developer1-id",
+		"name":       "base-set",
+		"sequence":   "3",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "foo",
+				"id":       "foo-id",
+				"revision": "10",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	assertAdd(st, vs)
+}
+
+func (s *apiSuite) TestValidationSets(c *check.C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	s.mockValidationSet(c, d)
+
+	req, err := http.NewRequest("GET", "/v2/validation-sets", nil)
+	c.Assert(err, check.IsNil)
+	rsp := listValidationSets(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.HasLen, 0)
+
+	buf := bytes.NewBufferString(`{"action": "monitor", "account-id": "developer1-id", "name": "base-set"}`)
+	req, err = http.NewRequest("POST", "/v2/validation-sets", buf)
+	c.Assert(err, check.IsNil)
+	rsp = applyValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, &validationSetResult{
+		AccountID: "developer1-id",
+		Name:      "base-set",
+		Mode:      "monitor",
+		Sequence:  3,
+		Valid:     false,
+	})
+
+	s.mkInstalledInState(c, d, "foo", "bar", "v1", snap.R(10), true, "")
+
+	req, err = http.NewRequest("GET", "/v2/validation-sets", nil)
+	c.Assert(err, check.IsNil)
+	rsp = listValidationSets(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, []*validationSetResult{{
+		AccountID: "developer1-id",
+		Name:      "base-set",
+		Mode:      "monitor",
+		Sequence:  3,
+		Valid:     true,
+	}})
+
+	buf = bytes.NewBufferString(`{"action": "forget", "account-id": "developer1-id", "name": "base-set"}`)
+	req, err = http.NewRequest("POST", "/v2/validation-sets", buf)
+	c.Assert(err, check.IsNil)
+	rsp = applyValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	st := d.overlord.State()
+	st.Lock()
+	vsets, err := assertstate.ValidationSets(st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(vsets, check.HasLen, 0)
+}
+
+func (s *apiSuite) TestValidationSetsEnforceUnsatisfied(c *check.C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+	d := s.daemon(c)
+	s.mockValidationSet(c, d)
+
+	buf := bytes.NewBufferString(`{"action": "enforce", "account-id": "developer1-id", "name": "base-set"}`)
+	req, err := http.NewRequest("POST", "/v2/validation-sets", buf)
+	c.Assert(err, check.IsNil)
+	rsp := applyValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot enforce validation set developer1-id/base-set: validation sets are not satisfied:
+- missing required snaps: foo \(developer1-id/base-set\)`)
+}
+
+func (s *apiSuite) TestValidationSetsBadRequests(c *check.C) {
+	s.daemon(c)
+
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`}`, `cannot decode request body into validation set action: .*`},
+		{`{"action": "monitor"}`, `validation set account-id and name must be specified`},
+		{`{"action": "monitor", "account-id": "acme", "name": "set", "sequence": -1}`, `invalid validation set sequence: -1`},
+		{`{"action": "frobnicate", "account-id": "acme", "name": "set"}`, `unknown validation set action "frobnicate"`},
+		{`{"action": "forget", "account-id": "acme", "name": "set"}`, `validation set acme/set is not tracked`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/validation-sets", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+		rsp := applyValidationSet(validationSetsCmd, req, nil).(*resp)
+		c.Check(rsp.Type, check.Equals, ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, t.err)
+	}
+}
+
 func (s *apiSuite) TestGetEvents(c *check.C) {
 	d := s.daemon(c)
 	eventsCmd.d = d
@@ -126,6 +126,7 @@ const (
 	errorKindInvalidAuthData   = errorKind("invalid-auth-data")
 	errorKindTermsNotAccepted  = errorKind("terms-not-accepted")
 	errorKindNoPaymentMethods  = errorKind("no-payment-methods")
+	errorKindStoreUnavailable  = errorKind("store-unavailable")
 )
 
 type errorValue interface{}
@@ -170,8 +171,11 @@ func makeErrorResponder(status int) errorResponder {
 		res := &errorResult{
 			Message: fmt.Sprintf(format, v...),
 		}
-		if status == http.StatusUnauthorized {
+		switch status {
+		case http.StatusUnauthorized:
 			res.Kind = errorKindLoginRequired
+		case http.StatusServiceUnavailable:
+			res.Kind = errorKindStoreUnavailable
 		}
 		return &resp{
 			Type:   ResponseTypeError,
@@ -252,12 +256,13 @@ type errorResponder func(string, ...interface{}) Response
 
 // standard error responses
 var (
-	Unauthorized   = makeErrorResponder(http.StatusUnauthorized)
-	NotFound       = makeErrorResponder(http.StatusNotFound)
-	BadRequest     = makeErrorResponder(http.StatusBadRequest)
-	BadMethod      = makeErrorResponder(http.StatusMethodNotAllowed)
-	InternalError  = makeErrorResponder(http.StatusInternalServerError)
-	NotImplemented = makeErrorResponder(http.StatusNotImplemented)
-	Forbidden      = makeErrorResponder(http.StatusForbidden)
-	Conflict       = makeErrorResponder(http.StatusConflict)
+	Unauthorized     = makeErrorResponder(http.StatusUnauthorized)
+	NotFound         = makeErrorResponder(http.StatusNotFound)
+	BadRequest       = makeErrorResponder(http.StatusBadRequest)
+	BadMethod        = makeErrorResponder(http.StatusMethodNotAllowed)
+	InternalError    = makeErrorResponder(http.StatusInternalServerError)
+	NotImplemented   = makeErrorResponder(http.StatusNotImplemented)
+	Forbidden        = makeErrorResponder(http.StatusForbidden)
+	Conflict         = makeErrorResponder(http.StatusConflict)
+	StoreUnavailable = makeErrorResponder(http.StatusServiceUnavailable)
 )
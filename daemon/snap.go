@@ -110,7 +110,8 @@ func allLocalSnapInfos(st *state.State) ([]aboutSnap, error) {
 
 // appJSON contains the json for snap.AppInfo
 type appJSON struct {
-	Name string `json:"name"`
+	Name   string `json:"name"`
+	Daemon string `json:"daemon,omitempty"`
 }
 
 // screenshotJSON contains the json for snap.ScreenshotInfo
@@ -129,31 +130,48 @@ func mapLocal(localSnap *snap.Info, snapst *snapstate.SnapState) map[string]inte
 	apps := make([]appJSON, 0, len(localSnap.Apps))
 	for _, app := range localSnap.Apps {
 		apps = append(apps, appJSON{
-			Name: app.Name,
+			Name:   app.Name,
+			Daemon: app.Daemon,
 		})
 	}
 
-	return map[string]interface{}{
-		"description":    localSnap.Description(),
-		"developer":      localSnap.Developer,
-		"icon":           snapIcon(localSnap),
-		"id":             localSnap.SnapID,
-		"install-date":   snapDate(localSnap),
-		"installed-size": localSnap.Size,
-		"name":           localSnap.Name(),
-		"revision":       localSnap.Revision,
-		"status":         status,
-		"summary":        localSnap.Summary(),
-		"type":           string(localSnap.Type),
-		"version":        localSnap.Version,
-		"channel":        localSnap.Channel,
-		"confinement":    localSnap.Confinement,
-		"devmode":        snapst.DevMode(),
-		"trymode":        snapst.TryMode(),
-		"private":        localSnap.Private,
-		"apps":           apps,
-		"broken":         localSnap.Broken,
+	revisions := make([]snap.Revision, len(snapst.Sequence))
+	for i, si := range snapst.Sequence {
+		revisions[i] = si.Revision
 	}
+
+	result := map[string]interface{}{
+		"description":      localSnap.Description(),
+		"developer":        localSnap.Developer,
+		"icon":             snapIcon(localSnap),
+		"id":               localSnap.SnapID,
+		"install-date":     snapDate(localSnap),
+		"installed-size":   localSnap.Size,
+		"name":             localSnap.Name(),
+		"revision":         localSnap.Revision,
+		"status":           status,
+		"summary":          localSnap.Summary(),
+		"type":             string(localSnap.Type),
+		"version":          localSnap.Version,
+		"channel":          localSnap.Channel,
+		"tracking-channel": snapst.Channel,
+		"confinement":      localSnap.Confinement,
+		"devmode":          snapst.DevMode(),
+		"trymode":          snapst.TryMode(),
+		"private":          localSnap.Private,
+		"apps":             apps,
+		"broken":           localSnap.Broken,
+
+		"installed-revisions": revisions,
+	}
+
+	if localSnap.LicenseAgreement != "" {
+		result["license-agreement"] = localSnap.LicenseAgreement
+	}
+	if localSnap.LicenseVersion != "" {
+		result["license-version"] = localSnap.LicenseVersion
+	}
+	return result
 }
 
 func mapRemote(remoteSnap *snap.Info) map[string]interface{} {
@@ -200,5 +218,9 @@ func mapRemote(remoteSnap *snap.Info) map[string]interface{} {
 	if len(remoteSnap.Prices) > 0 {
 		result["prices"] = remoteSnap.Prices
 	}
+
+	if len(remoteSnap.Channels) > 0 {
+		result["channels"] = remoteSnap.Channels
+	}
 	return result
 }
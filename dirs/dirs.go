@@ -41,14 +41,16 @@ var (
 	SnapMountPolicyDir        string
 	SnapUdevRulesDir          string
 	SnapKModModulesDir        string
+	FirmwareDir               string
 	LocaleDir                 string
 	SnapMetaDir               string
 	SnapdSocket               string
 	SnapSocket                string
 	SnapRunNsDir              string
 
-	SnapSeedDir   string
-	SnapDeviceDir string
+	SnapSeedDir         string
+	SnapDeviceDir       string
+	SnapGadgetBackupDir string
 
 	SnapAssertsDBDir      string
 	SnapTrustedAccountKey string
@@ -56,6 +58,10 @@ var (
 	SnapStateFile      string
 	SnapFirstBootStamp string
 
+	SnapRepairDir       string
+	SnapRepairStateFile string
+	SnapRepairRunDir    string
+
 	SnapBinariesDir     string
 	SnapServicesDir     string
 	SnapDesktopFilesDir string
@@ -124,8 +130,13 @@ func SetRootDir(rootdir string) {
 
 	SnapStateFile = filepath.Join(rootdir, snappyDir, "state.json")
 
+	SnapRepairDir = filepath.Join(rootdir, snappyDir, "repair")
+	SnapRepairStateFile = filepath.Join(SnapRepairDir, "repair.json")
+	SnapRepairRunDir = filepath.Join(SnapRepairDir, "run")
+
 	SnapSeedDir = filepath.Join(rootdir, snappyDir, "seed")
 	SnapDeviceDir = filepath.Join(rootdir, snappyDir, "device")
+	SnapGadgetBackupDir = filepath.Join(rootdir, snappyDir, "gadget-backup")
 
 	// NOTE: if you change stampFile, update the condition in
 	// snapd.firstboot.service to match
@@ -140,6 +151,7 @@ func SetRootDir(rootdir string) {
 	SnapUdevRulesDir = filepath.Join(rootdir, "/etc/udev/rules.d")
 
 	SnapKModModulesDir = filepath.Join(rootdir, "/etc/modules-load.d/")
+	FirmwareDir = filepath.Join(rootdir, "/lib/firmware")
 
 	LocaleDir = filepath.Join(rootdir, "/usr/share/locale")
 	ClassicDir = filepath.Join(rootdir, "/writable/classic")
@@ -0,0 +1,85 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+)
+
+// partitionForLabel returns the device node of the partition holding
+// the filesystem with the given label.
+func partitionForLabel(label string) (string, error) {
+	part, err := filepath.EvalSymlinks(filepath.Join(dirs.GlobalRootDir, "/dev/disk/by-label", label))
+	if err != nil {
+		return "", fmt.Errorf("cannot find partition with filesystem label %q: %v", label, err)
+	}
+	return part, nil
+}
+
+// diskForPartition returns the device node of the disk the given
+// partition is on.
+func diskForPartition(part string) (string, error) {
+	sys, err := filepath.EvalSymlinks(filepath.Join(dirs.GlobalRootDir, "/sys/class/block", filepath.Base(part)))
+	if err != nil {
+		return "", fmt.Errorf("cannot find disk of partition %q: %v", part, err)
+	}
+	// partitions are listed under their disk in sysfs
+	return filepath.Join(filepath.Dir(part), filepath.Base(filepath.Dir(sys))), nil
+}
+
+// mountPointFor returns where the given partition is mounted.
+func mountPointFor(part string) (string, error) {
+	f, err := os.Open(filepath.Join(dirs.GlobalRootDir, "/proc/self/mountinfo"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	source := dirs.StripRootDir(part)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || len(fields) < sep+3 {
+			continue
+		}
+		if fields[sep+2] == source {
+			mountPoint := strings.Replace(fields[4], `\040`, " ", -1)
+			return filepath.Join(dirs.GlobalRootDir, mountPoint), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("cannot find mount point of %q", source)
+}
@@ -0,0 +1,202 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package gadget implements the handling of the volumes described by
+// the gadget snap: their layout on disk and the update of their
+// content.
+package gadget
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/snap"
+)
+
+const (
+	// SectorSize is the size of the sectors partitions are aligned to.
+	SectorSize = 512
+
+	// MBRCodeSize is how much of the MBR can be used for bootloader
+	// code.
+	MBRCodeSize = 440
+
+	// structures without an explicit offset start by default after
+	// the first MiB, leaving room for the partition table and
+	// bootloader code
+	defaultStructureOffset = 1024 * 1024
+
+	// sectors used by the protective MBR, the primary GPT header and
+	// the partition entries at the start of the disk
+	gptHeadSectors = 34
+	// sectors used by the backup partition entries and GPT header at
+	// the end of the disk
+	gptTailSectors = 33
+)
+
+// LaidOutStructure is a structure of a gadget volume placed at its
+// position on the disk.
+type LaidOutStructure struct {
+	snap.Structure
+	// StartOffset is the position of the structure on the disk.
+	StartOffset int64
+	// Partition is the number of the partition table entry for the
+	// structure, 0 if it has none.
+	Partition int
+}
+
+// Name returns how to refer to the structure in messages.
+func (s *LaidOutStructure) Name() string {
+	if s.Label != "" {
+		return fmt.Sprintf("%q", s.Label)
+	}
+	return fmt.Sprintf("at offset %d", s.StartOffset)
+}
+
+// IsPartition returns whether the structure gets an entry in the
+// partition table.
+func IsPartition(s *snap.Structure) bool {
+	return s.Type != "mbr" && s.Type != "bare"
+}
+
+// VolumeSchema returns the partitioning schema of the volume, gpt if
+// not specified.
+func VolumeSchema(vol *snap.Volume) string {
+	if vol.Schema == "" {
+		return "gpt"
+	}
+	return vol.Schema
+}
+
+// LayoutVolume places the structures of vol on the disk, returning
+// them together with the size the disk needs to have.
+func LayoutVolume(vol *snap.Volume) ([]LaidOutStructure, int64, error) {
+	schema := VolumeSchema(vol)
+	if schema != "mbr" && schema != "gpt" {
+		return nil, 0, fmt.Errorf("cannot lay out volume with unsupported schema %q", schema)
+	}
+
+	laidOut := make([]LaidOutStructure, len(vol.Structure))
+	cursor := int64(0)
+	partitions := 0
+	for i, s := range vol.Structure {
+		ls := LaidOutStructure{Structure: s, StartOffset: s.Offset}
+		if s.Type != "mbr" && s.Offset == 0 {
+			ls.StartOffset = cursor
+			if ls.StartOffset < defaultStructureOffset {
+				ls.StartOffset = defaultStructureOffset
+			}
+		}
+		if s.Size <= 0 {
+			return nil, 0, fmt.Errorf("cannot lay out structure %s: size must be set", ls.Name())
+		}
+		if s.Type == "mbr" {
+			if s.Offset != 0 || s.Size > MBRCodeSize {
+				return nil, 0, fmt.Errorf("cannot lay out structure %s: mbr structures must be at offset 0 and at most %d bytes", ls.Name(), MBRCodeSize)
+			}
+		}
+		if IsPartition(&s) {
+			partitions++
+			ls.Partition = partitions
+			if ls.StartOffset%SectorSize != 0 || s.Size%SectorSize != 0 {
+				return nil, 0, fmt.Errorf("cannot lay out structure %s: partitions must be aligned to %d byte sectors", ls.Name(), SectorSize)
+			}
+			if schema == "mbr" && partitions > 4 {
+				return nil, 0, fmt.Errorf("cannot lay out structure %s: at most 4 partitions are supported with the mbr schema", ls.Name())
+			}
+			if schema == "gpt" && ls.StartOffset < gptHeadSectors*SectorSize {
+				return nil, 0, fmt.Errorf("cannot lay out structure %s: it overlaps with the partition table", ls.Name())
+			}
+			if _, err := PartitionType(schema, s.Type); err != nil {
+				return nil, 0, fmt.Errorf("cannot lay out structure %s: %v", ls.Name(), err)
+			}
+		}
+		switch s.Filesystem {
+		case "", "ext4", "vfat":
+		default:
+			return nil, 0, fmt.Errorf("cannot lay out structure %s: unsupported filesystem %q", ls.Name(), s.Filesystem)
+		}
+		laidOut[i] = ls
+		cursor = ls.StartOffset + s.Size
+	}
+
+	sorted := make([]LaidOutStructure, len(laidOut))
+	copy(sorted, laidOut)
+	sort.Sort(byStartOffset(sorted))
+	end := int64(0)
+	for i, s := range sorted {
+		if i > 0 {
+			prev := sorted[i-1]
+			if s.StartOffset < prev.StartOffset+prev.Size {
+				return nil, 0, fmt.Errorf("cannot lay out structure %s: it overlaps with structure %s", s.Name(), prev.Name())
+			}
+		}
+		end = s.StartOffset + s.Size
+	}
+
+	size := (end + SectorSize - 1) / SectorSize * SectorSize
+	if schema == "gpt" {
+		size += gptTailSectors * SectorSize
+	}
+	return laidOut, size, nil
+}
+
+type byStartOffset []LaidOutStructure
+
+func (b byStartOffset) Len() int           { return len(b) }
+func (b byStartOffset) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byStartOffset) Less(i, j int) bool { return b[i].StartOffset < b[j].StartOffset }
+
+var guidRegexp = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// PartitionType returns the encoded partition type for the given
+// schema out of a structure type, which is either a MBR type in hex,
+// a GPT type GUID or both separated by a comma.
+func PartitionType(schema, typ string) ([]byte, error) {
+	mbrType, gptType := typ, typ
+	if comma := strings.IndexRune(typ, ','); comma >= 0 {
+		mbrType, gptType = typ[:comma], typ[comma+1:]
+	}
+	if schema == "mbr" {
+		t, err := strconv.ParseUint(mbrType, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mbr partition type %q", mbrType)
+		}
+		return []byte{byte(t)}, nil
+	}
+	if !guidRegexp.MatchString(gptType) {
+		return nil, fmt.Errorf("invalid gpt partition type %q", gptType)
+	}
+	return encodeGUID(gptType), nil
+}
+
+// encodeGUID encodes a textual GUID in the mixed endianness used on disk.
+func encodeGUID(guid string) []byte {
+	b, _ := hex.DecodeString(strings.Replace(guid, "-", "", -1))
+	for _, r := range [][2]int{{0, 4}, {4, 6}, {6, 8}} {
+		for i, j := r[0], r[1]-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+	}
+	return b
+}
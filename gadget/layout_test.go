@@ -0,0 +1,95 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/snap"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type layoutSuite struct{}
+
+var _ = Suite(&layoutSuite{})
+
+func (s *layoutSuite) TestLayoutVolumeDefaults(c *C) {
+	structures, size, err := gadget.LayoutVolume(&snap.Volume{
+		Structure: []snap.Structure{
+			{Type: "mbr", Size: 440},
+			{Type: "0FC63DAF-8483-4772-8E79-3D69D8477DE4", Size: 4096},
+			{Type: "bare", Size: 1000},
+			{Type: "0FC63DAF-8483-4772-8E79-3D69D8477DE4", Size: 8192, Offset: 2 * 1024 * 1024},
+		},
+	})
+	c.Assert(err, IsNil)
+	var starts []int64
+	var partitions []int
+	for _, s := range structures {
+		starts = append(starts, s.StartOffset)
+		partitions = append(partitions, s.Partition)
+	}
+	c.Check(starts, DeepEquals, []int64{0, 1024 * 1024, 1024*1024 + 4096, 2 * 1024 * 1024})
+	c.Check(partitions, DeepEquals, []int{0, 1, 0, 2})
+	// with the gpt backup entries and header at the end
+	c.Check(size, Equals, int64(2*1024*1024+8192+33*512))
+}
+
+func (s *layoutSuite) TestLayoutVolumeErrors(c *C) {
+	const linux = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+	for _, t := range []struct {
+		vol snap.Volume
+		err string
+	}{
+		{snap.Volume{Schema: "apm"}, `cannot lay out volume with unsupported schema "apm"`},
+		{snap.Volume{Structure: []snap.Structure{{Label: "foo", Type: linux}}}, `cannot lay out structure "foo": size must be set`},
+		{snap.Volume{Structure: []snap.Structure{{Type: "mbr", Size: 512}}}, `cannot lay out structure at offset 0: mbr structures must be at offset 0 and at most 440 bytes`},
+		{snap.Volume{Structure: []snap.Structure{{Label: "foo", Type: linux, Size: 1000}}}, `cannot lay out structure "foo": partitions must be aligned to 512 byte sectors`},
+		{snap.Volume{Structure: []snap.Structure{{Label: "foo", Type: linux, Size: 512, Offset: 1024}}}, `cannot lay out structure "foo": it overlaps with the partition table`},
+		{snap.Volume{Structure: []snap.Structure{{Label: "foo", Type: "83", Size: 512}}}, `cannot lay out structure "foo": invalid gpt partition type "83"`},
+		{snap.Volume{Schema: "mbr", Structure: []snap.Structure{{Label: "foo", Type: linux, Size: 512}}}, `cannot lay out structure "foo": invalid mbr partition type .*`},
+		{snap.Volume{Structure: []snap.Structure{{Label: "foo", Type: linux, Size: 512, Filesystem: "btrfs"}}}, `cannot lay out structure "foo": unsupported filesystem "btrfs"`},
+		{snap.Volume{Structure: []snap.Structure{
+			{Label: "foo", Type: linux, Size: 4096},
+			{Label: "bar", Type: linux, Size: 512, Offset: 1024*1024 + 512},
+		}}, `cannot lay out structure "bar": it overlaps with structure "foo"`},
+		{snap.Volume{Schema: "mbr", Structure: []snap.Structure{
+			{Type: "83", Size: 512}, {Type: "83", Size: 512}, {Type: "83", Size: 512},
+			{Type: "83", Size: 512}, {Label: "fifth", Type: "83", Size: 512},
+		}}, `cannot lay out structure "fifth": at most 4 partitions are supported with the mbr schema`},
+	} {
+		_, _, err := gadget.LayoutVolume(&t.vol)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *layoutSuite) TestPartitionType(c *C) {
+	typ, err := gadget.PartitionType("mbr", "0C,C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+	c.Assert(err, IsNil)
+	c.Check(typ, DeepEquals, []byte{0x0c})
+
+	typ, err = gadget.PartitionType("gpt", "0C,C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+	c.Assert(err, IsNil)
+	c.Check(typ, DeepEquals, []byte{0x28, 0x73, 0x2a, 0xc1, 0x1f, 0xf8, 0xd2, 0x11, 0xba, 0x4b, 0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b})
+}
@@ -0,0 +1,81 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// offsetWriteSize is the size of what WriteOffset writes.
+const offsetWriteSize = 4
+
+// WriteOffset writes at the given position of the disk the offset, in
+// sectors, of something placed on it, as needed by some bootloaders
+// to find their stages.
+func WriteOffset(w io.WriterAt, at, offset int64) error {
+	var b [offsetWriteSize]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(offset/SectorSize))
+	_, err := w.WriteAt(b[:], at)
+	return err
+}
+
+// WriteRawContent writes the image content of the gadget unpacked or
+// mounted in gadgetDir for the structure s, which has no filesystem,
+// at its place on the disk.
+func WriteRawContent(w io.WriterAt, gadgetDir string, s *LaidOutStructure) error {
+	cursor := s.StartOffset
+	for _, c := range s.Content {
+		if c.Image == "" {
+			return fmt.Errorf("cannot write structure %s: only image content is supported without a filesystem", s.Name())
+		}
+		offset := cursor
+		if c.Offset != 0 {
+			offset = s.StartOffset + c.Offset
+		}
+		data, err := ioutil.ReadFile(filepath.Join(gadgetDir, c.Image))
+		if err != nil {
+			return fmt.Errorf("cannot write structure %s: %v", s.Name(), err)
+		}
+		size := int64(len(data))
+		if c.Size != 0 {
+			if size > c.Size {
+				return fmt.Errorf("cannot write structure %s: image %q is larger than its declared size %d", s.Name(), c.Image, c.Size)
+			}
+			size = c.Size
+		}
+		if offset+size > s.StartOffset+s.Size {
+			return fmt.Errorf("cannot write structure %s: image %q does not fit", s.Name(), c.Image)
+		}
+		if _, err := w.WriteAt(data, offset); err != nil {
+			return err
+		}
+		if c.OffsetWrite != 0 {
+			if err := WriteOffset(w, c.OffsetWrite, offset); err != nil {
+				return err
+			}
+		}
+		cursor = offset + size
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// updateOp records a change done by Update, for Rollback to undo it.
+type updateOp struct {
+	// Device and Offset are where a raw structure was written.
+	Device string `json:"device,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	// Path is the file replaced in the filesystem of a structure.
+	Path string `json:"path,omitempty"`
+	// Backup is the file in the backup directory with the replaced
+	// content, empty if there was none.
+	Backup string `json:"backup,omitempty"`
+}
+
+const (
+	journalName = "journal.json"
+	// completeName marks the journal of an update that went through,
+	// kept only for Rollback to undo it on request.
+	completeName = "complete"
+)
+
+type updater struct {
+	backupDir string
+	ops       []updateOp
+}
+
+func (u *updater) backupName() string {
+	return fmt.Sprintf("%d.backup", len(u.ops))
+}
+
+func (u *updater) record(op updateOp) error {
+	u.ops = append(u.ops, op)
+	b, err := json.Marshal(u.ops)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(filepath.Join(u.backupDir, journalName), b, 0600, 0)
+}
+
+// Update writes to the device the content of the volumes of the gadget
+// mounted in newDir that differs from the one of the gadget mounted in
+// oldDir, keeping what it replaces in backupDir. The volumes must be
+// laid out the same by both. Whatever was written is restored if
+// Update fails midway, or by the next Update if it was interrupted.
+func Update(oldDir, newDir, backupDir string) error {
+	oldInfo, err := snap.ReadGadgetInfoFromDir(oldDir)
+	if err != nil {
+		return err
+	}
+	newInfo, err := snap.ReadGadgetInfoFromDir(newDir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(newInfo.Volumes))
+	for name := range newInfo.Volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	oldLaidOut := make(map[string][]LaidOutStructure)
+	newLaidOut := make(map[string][]LaidOutStructure)
+	if len(oldInfo.Volumes) != len(newInfo.Volumes) {
+		return fmt.Errorf("cannot update gadget assets: number of volumes changed")
+	}
+	for _, name := range names {
+		oldVol, ok := oldInfo.Volumes[name]
+		if !ok {
+			return fmt.Errorf("cannot update gadget assets: volume %q is new", name)
+		}
+		newVol := newInfo.Volumes[name]
+		oldLaidOut[name], newLaidOut[name], err = layOutCompatible(&oldVol, &newVol)
+		if err != nil {
+			return fmt.Errorf("cannot update gadget assets: volume %q: %v", name, err)
+		}
+	}
+
+	// the backups of an interrupted update are the only copy left
+	// of what it replaced, restore it before taking new ones
+	if !osutil.FileExists(filepath.Join(backupDir, completeName)) {
+		if err := Rollback(backupDir); err != nil {
+			return fmt.Errorf("cannot roll back interrupted gadget assets update: %v", err)
+		}
+	}
+	if err := os.RemoveAll(backupDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
+		return err
+	}
+
+	u := &updater{backupDir: backupDir}
+	for _, name := range names {
+		for i := range newLaidOut[name] {
+			oldS, newS := &oldLaidOut[name][i], &newLaidOut[name][i]
+			if newS.Filesystem == "" {
+				err = u.updateRaw(oldDir, newDir, oldS, newS, newLaidOut[name])
+			} else {
+				err = u.updateFilesystem(oldDir, newDir, oldS, newS)
+			}
+			if err != nil {
+				if rerr := Rollback(backupDir); rerr != nil {
+					return fmt.Errorf("cannot update gadget assets: %v (and cannot roll back: %v)", err, rerr)
+				}
+				return fmt.Errorf("cannot update gadget assets: %v", err)
+			}
+		}
+	}
+	return osutil.AtomicWriteFile(filepath.Join(backupDir, completeName), nil, 0600, 0)
+}
+
+// layOutCompatible lays out both volumes, checking that nothing that
+// would need repartitioning the device changed.
+func layOutCompatible(oldVol, newVol *snap.Volume) (oldLaidOut, newLaidOut []LaidOutStructure, err error) {
+	if VolumeSchema(oldVol) != VolumeSchema(newVol) {
+		return nil, nil, fmt.Errorf("cannot change schema")
+	}
+	if oldVol.Bootloader != newVol.Bootloader {
+		return nil, nil, fmt.Errorf("cannot change bootloader")
+	}
+	oldLaidOut, _, err = LayoutVolume(oldVol)
+	if err != nil {
+		return nil, nil, err
+	}
+	newLaidOut, _, err = LayoutVolume(newVol)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(oldLaidOut) != len(newLaidOut) {
+		return nil, nil, fmt.Errorf("cannot change the number of structures")
+	}
+	for i := range newLaidOut {
+		o, n := &oldLaidOut[i], &newLaidOut[i]
+		if o.StartOffset != n.StartOffset || o.Size != n.Size || o.Type != n.Type || o.ID != n.ID ||
+			o.Filesystem != n.Filesystem || o.Label != n.Label || o.OffsetWrite != n.OffsetWrite {
+			return nil, nil, fmt.Errorf("cannot change the layout of structure %s", o.Name())
+		}
+	}
+	return oldLaidOut, newLaidOut, nil
+}
+
+func sameRawContent(oldDir, newDir string, oldS, newS *LaidOutStructure) (bool, error) {
+	if !reflect.DeepEqual(oldS.Content, newS.Content) {
+		return false, nil
+	}
+	for _, c := range newS.Content {
+		oldData, err := ioutil.ReadFile(filepath.Join(oldDir, c.Image))
+		if err != nil {
+			return false, err
+		}
+		newData, err := ioutil.ReadFile(filepath.Join(newDir, c.Image))
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(oldData, newData) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// volumeDisk returns the disk holding the given laid out volume, found
+// through the partitions with labelled filesystems.
+func volumeDisk(structures []LaidOutStructure) (string, error) {
+	for _, s := range structures {
+		if s.Label != "" && s.Filesystem != "" {
+			part, err := partitionForLabel(s.Label)
+			if err != nil {
+				return "", err
+			}
+			return diskForPartition(part)
+		}
+	}
+	return "", fmt.Errorf("cannot find disk of volume without labelled filesystems")
+}
+
+func (u *updater) updateRaw(oldDir, newDir string, oldS, newS *LaidOutStructure, structures []LaidOutStructure) error {
+	same, err := sameRawContent(oldDir, newDir, oldS, newS)
+	if err != nil {
+		return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+	}
+	if same {
+		return nil
+	}
+
+	disk, err := volumeDisk(structures)
+	if err != nil {
+		return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+	}
+	f, err := os.OpenFile(disk, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+	}
+	defer f.Close()
+
+	if err := u.backupRaw(f, disk, newS.StartOffset, newS.Size); err != nil {
+		return fmt.Errorf("cannot back up structure %s: %v", newS.Name(), err)
+	}
+	// the offsets of the content can be written outside of the
+	// structure, usually in the MBR
+	for _, c := range newS.Content {
+		if c.OffsetWrite == 0 {
+			continue
+		}
+		if err := u.backupRaw(f, disk, c.OffsetWrite, offsetWriteSize); err != nil {
+			return fmt.Errorf("cannot back up offset of %q of structure %s: %v", c.Image, newS.Name(), err)
+		}
+	}
+
+	if err := WriteRawContent(f, newDir, newS); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// backupRaw keeps and records the size bytes at offset of disk, open
+// as f, before they get overwritten.
+func (u *updater) backupRaw(f *os.File, disk string, offset, size int64) error {
+	backup := u.backupName()
+	previous := make([]byte, size)
+	if _, err := f.ReadAt(previous, offset); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(u.backupDir, backup), previous, 0600); err != nil {
+		return err
+	}
+	return u.record(updateOp{Device: disk, Offset: offset, Backup: backup})
+}
+
+// contentFiles returns the files of the gadget content c, by their
+// destination relative to the root of the filesystem. A source ending
+// in a slash has its content copied rather than itself, a target
+// ending in a slash is the directory to copy into.
+func contentFiles(gadgetDir string, c *snap.Content) (map[string]string, error) {
+	src := filepath.Join(gadgetDir, c.Source)
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	dst := c.Target
+	if c.Target == "" || strings.HasSuffix(c.Target, "/") {
+		if !fi.IsDir() || !strings.HasSuffix(c.Source, "/") {
+			dst = filepath.Join(dst, filepath.Base(src))
+		}
+	}
+
+	files := make(map[string]string)
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.Clean(filepath.Join("/", dst, rel))] = path
+		return nil
+	})
+	return files, err
+}
+
+// gadgetFiles returns the files of all the content of the structure,
+// by their destination.
+func gadgetFiles(gadgetDir string, s *LaidOutStructure) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, c := range s.Content {
+		cfiles, err := contentFiles(gadgetDir, &c)
+		if err != nil {
+			return nil, err
+		}
+		for dst, src := range cfiles {
+			files[dst] = src
+		}
+	}
+	return files, nil
+}
+
+func (u *updater) updateFilesystem(oldDir, newDir string, oldS, newS *LaidOutStructure) error {
+	oldFiles, err := gadgetFiles(oldDir, oldS)
+	if err != nil {
+		return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+	}
+	newFiles, err := gadgetFiles(newDir, newS)
+	if err != nil {
+		return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+	}
+
+	// only the files the new gadget changed get written
+	var dsts []string
+	for dst, src := range newFiles {
+		if oldSrc, ok := oldFiles[dst]; ok {
+			same, err := sameFile(src, oldSrc)
+			if err != nil {
+				return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+			}
+			if same {
+				continue
+			}
+		}
+		dsts = append(dsts, dst)
+	}
+	if len(dsts) == 0 {
+		return nil
+	}
+	sort.Strings(dsts)
+
+	if newS.Label == "" {
+		return fmt.Errorf("cannot update structure %s: cannot find its filesystem without a label", newS.Name())
+	}
+	part, err := partitionForLabel(newS.Label)
+	if err != nil {
+		return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+	}
+	mountPoint, err := mountPointFor(part)
+	if err != nil {
+		return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+	}
+	for _, dst := range dsts {
+		if err := u.updateFile(newFiles[dst], filepath.Join(mountPoint, dst)); err != nil {
+			return fmt.Errorf("cannot update structure %s: %v", newS.Name(), err)
+		}
+	}
+	return nil
+}
+
+func sameFile(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	var ba, bb [4096]byte
+	for {
+		na, erra := io.ReadFull(fa, ba[:])
+		nb, errb := io.ReadFull(fb, bb[:])
+		if !bytes.Equal(ba[:na], bb[:nb]) {
+			return false, nil
+		}
+		if erra == io.EOF || erra == io.ErrUnexpectedEOF {
+			return errb == erra, nil
+		}
+		if erra != nil {
+			return false, erra
+		}
+		if errb != nil {
+			return false, errb
+		}
+	}
+}
+
+func (u *updater) updateFile(src, dst string) error {
+	same, err := sameFile(src, dst)
+	if err != nil || same {
+		return err
+	}
+
+	op := updateOp{Path: dst}
+	if osutil.FileExists(dst) {
+		op.Backup = u.backupName()
+		if err := osutil.CopyFile(dst, filepath.Join(u.backupDir, op.Backup), osutil.CopyFlagDefault); err != nil {
+			return err
+		}
+	}
+	if err := u.record(op); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return osutil.CopyFile(src, dst, osutil.CopyFlagOverwrite|osutil.CopyFlagSync)
+}
+
+// Rollback restores what Update replaced as kept in backupDir, in
+// reverse order.
+func Rollback(backupDir string) error {
+	b, err := ioutil.ReadFile(filepath.Join(backupDir, journalName))
+	if os.IsNotExist(err) {
+		// nothing was replaced
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ops []updateOp
+	if err := json.Unmarshal(b, &ops); err != nil {
+		return fmt.Errorf("cannot read gadget update journal: %v", err)
+	}
+
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		switch {
+		case op.Device != "":
+			previous, err := ioutil.ReadFile(filepath.Join(backupDir, op.Backup))
+			if err != nil {
+				return err
+			}
+			f, err := os.OpenFile(op.Device, os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			_, err = f.WriteAt(previous, op.Offset)
+			if err == nil {
+				err = f.Sync()
+			}
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case op.Backup != "":
+			if err := osutil.CopyFile(filepath.Join(backupDir, op.Backup), op.Path, osutil.CopyFlagOverwrite|osutil.CopyFlagSync); err != nil {
+				return err
+			}
+		default:
+			if err := os.Remove(op.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if err := os.Remove(filepath.Join(backupDir, journalName)); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(backupDir, completeName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package gadget_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/osutil"
+)
+
+type updateSuite struct {
+	root      string
+	oldDir    string
+	newDir    string
+	backupDir string
+	disk      string
+}
+
+var _ = Suite(&updateSuite{})
+
+const updateGadgetYaml = `
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - type: mbr
+        size: 440
+        content:
+          - image: pc-boot.img
+      - type: DA,21686148-6449-6E6F-744E-656564454649
+        size: 1048576
+        content:
+          - image: pc-core.img
+      - label: system-boot
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+        size: 1048576
+        content:
+          - source: grubx64.efi
+            target: EFI/boot/
+          - source: grub/
+            target: EFI/ubuntu/
+`
+
+func writeFile(c *C, p, content string) {
+	c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(p, []byte(content), 0644), IsNil)
+}
+
+func (s *updateSuite) SetUpTest(c *C) {
+	s.root = c.MkDir()
+	dirs.SetRootDir(s.root)
+
+	tmp := c.MkDir()
+	s.oldDir = filepath.Join(tmp, "old")
+	s.newDir = filepath.Join(tmp, "new")
+	s.backupDir = filepath.Join(tmp, "backup")
+
+	for _, dir := range []string{s.oldDir, s.newDir} {
+		writeFile(c, filepath.Join(dir, "meta/gadget.yaml"), updateGadgetYaml)
+		writeFile(c, filepath.Join(dir, "pc-boot.img"), "OLDBOOT")
+		writeFile(c, filepath.Join(dir, "pc-core.img"), "CORE")
+		writeFile(c, filepath.Join(dir, "grubx64.efi"), "old-grub")
+		writeFile(c, filepath.Join(dir, "grub/grub.cfg"), "grub-cfg")
+	}
+
+	// the disk, with the system-boot partition mounted at /boot/efi
+	s.disk = filepath.Join(s.root, "/dev/sda")
+	writeFile(c, s.disk, "")
+	c.Assert(os.Truncate(s.disk, 4*1024*1024), IsNil)
+	f, err := os.OpenFile(s.disk, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteAt([]byte("OLDBOOT"), 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteAt([]byte("CORE"), 1024*1024)
+	c.Assert(err, IsNil)
+	f.Close()
+	writeFile(c, filepath.Join(s.root, "/dev/sda3"), "")
+	c.Assert(os.MkdirAll(filepath.Join(s.root, "/dev/disk/by-label"), 0755), IsNil)
+	c.Assert(os.Symlink("../../sda3", filepath.Join(s.root, "/dev/disk/by-label/system-boot")), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(s.root, "/sys/devices/pci0000:00/block/sda/sda3"), 0755), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(s.root, "/sys/class/block"), 0755), IsNil)
+	c.Assert(os.Symlink("../../devices/pci0000:00/block/sda/sda3", filepath.Join(s.root, "/sys/class/block/sda3")), IsNil)
+	writeFile(c, filepath.Join(s.root, "/proc/self/mountinfo"), `
+22 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda4 rw
+45 22 8:3 / /boot/efi rw,relatime shared:27 - vfat /dev/sda3 rw
+`)
+	writeFile(c, filepath.Join(s.root, "/boot/efi/EFI/boot/grubx64.efi"), "old-grub")
+	writeFile(c, filepath.Join(s.root, "/boot/efi/EFI/ubuntu/grub.cfg"), "grub-cfg")
+}
+
+func (s *updateSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("/")
+}
+
+func (s *updateSuite) readDisk(c *C, offset int64, n int) string {
+	f, err := os.Open(s.disk)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	b := make([]byte, n)
+	_, err = f.ReadAt(b, offset)
+	c.Assert(err, IsNil)
+	return string(b)
+}
+
+func (s *updateSuite) readFile(c *C, p string) string {
+	b, err := ioutil.ReadFile(filepath.Join(s.root, p))
+	c.Assert(err, IsNil)
+	return string(b)
+}
+
+func (s *updateSuite) TestUpdateAndRollback(c *C) {
+	writeFile(c, filepath.Join(s.newDir, "pc-boot.img"), "NEWBOOT")
+	writeFile(c, filepath.Join(s.newDir, "grubx64.efi"), "new-grub")
+	writeFile(c, filepath.Join(s.newDir, "grub/fonts/unicode.pf2"), "font")
+
+	err := gadget.Update(s.oldDir, s.newDir, s.backupDir)
+	c.Assert(err, IsNil)
+
+	c.Check(s.readDisk(c, 0, 7), Equals, "NEWBOOT")
+	c.Check(s.readDisk(c, 1024*1024, 4), Equals, "CORE")
+	c.Check(s.readFile(c, "/boot/efi/EFI/boot/grubx64.efi"), Equals, "new-grub")
+	c.Check(s.readFile(c, "/boot/efi/EFI/ubuntu/grub.cfg"), Equals, "grub-cfg")
+	c.Check(s.readFile(c, "/boot/efi/EFI/ubuntu/fonts/unicode.pf2"), Equals, "font")
+
+	err = gadget.Rollback(s.backupDir)
+	c.Assert(err, IsNil)
+
+	c.Check(s.readDisk(c, 0, 7), Equals, "OLDBOOT")
+	c.Check(s.readFile(c, "/boot/efi/EFI/boot/grubx64.efi"), Equals, "old-grub")
+	c.Check(osutil.FileExists(filepath.Join(s.root, "/boot/efi/EFI/ubuntu/fonts/unicode.pf2")), Equals, false)
+
+	// rolling back again does nothing
+	c.Check(gadget.Rollback(s.backupDir), IsNil)
+}
+
+func (s *updateSuite) TestUpdateNothingChanged(c *C) {
+	// no disk or filesystem to find
+	c.Assert(os.RemoveAll(filepath.Join(s.root, "/dev/disk")), IsNil)
+
+	err := gadget.Update(s.oldDir, s.newDir, s.backupDir)
+	c.Assert(err, IsNil)
+	c.Check(gadget.Rollback(s.backupDir), IsNil)
+	c.Check(s.readDisk(c, 0, 7), Equals, "OLDBOOT")
+}
+
+func (s *updateSuite) TestUpdateFailureRollsBack(c *C) {
+	writeFile(c, filepath.Join(s.newDir, "pc-boot.img"), "NEWBOOT")
+	writeFile(c, filepath.Join(s.newDir, "grubx64.efi"), "new-grub")
+	// the filesystem is not mounted
+	writeFile(c, filepath.Join(s.root, "/proc/self/mountinfo"), "")
+
+	err := gadget.Update(s.oldDir, s.newDir, s.backupDir)
+	c.Assert(err, ErrorMatches, `cannot update gadget assets: cannot update structure "system-boot": cannot find mount point of "/dev/sda3"`)
+
+	// the raw structure written before was restored
+	c.Check(s.readDisk(c, 0, 7), Equals, "OLDBOOT")
+	c.Check(s.readFile(c, "/boot/efi/EFI/boot/grubx64.efi"), Equals, "old-grub")
+}
+
+func (s *updateSuite) TestUpdateAfterInterruptedUpdate(c *C) {
+	writeFile(c, filepath.Join(s.newDir, "pc-boot.img"), "NEWBOOT")
+	writeFile(c, filepath.Join(s.newDir, "grubx64.efi"), "new-grub")
+
+	err := gadget.Update(s.oldDir, s.newDir, s.backupDir)
+	c.Assert(err, IsNil)
+	// as if interrupted before finishing
+	c.Assert(os.Remove(filepath.Join(s.backupDir, "complete")), IsNil)
+
+	err = gadget.Update(s.oldDir, s.newDir, s.backupDir)
+	c.Assert(err, IsNil)
+	c.Check(s.readDisk(c, 0, 7), Equals, "NEWBOOT")
+	c.Check(s.readFile(c, "/boot/efi/EFI/boot/grubx64.efi"), Equals, "new-grub")
+
+	// the backups are still of the original content
+	c.Assert(gadget.Rollback(s.backupDir), IsNil)
+	c.Check(s.readDisk(c, 0, 7), Equals, "OLDBOOT")
+	c.Check(s.readFile(c, "/boot/efi/EFI/boot/grubx64.efi"), Equals, "old-grub")
+}
+
+func (s *updateSuite) TestUpdateAfterCompletedUpdate(c *C) {
+	writeFile(c, filepath.Join(s.newDir, "pc-boot.img"), "NEWBOOT")
+	err := gadget.Update(s.oldDir, s.newDir, s.backupDir)
+	c.Assert(err, IsNil)
+
+	// updating further leaves the completed update alone
+	newerDir := filepath.Join(filepath.Dir(s.newDir), "newer")
+	writeFile(c, filepath.Join(newerDir, "meta/gadget.yaml"), updateGadgetYaml)
+	writeFile(c, filepath.Join(newerDir, "pc-boot.img"), "NEWERBT")
+	writeFile(c, filepath.Join(newerDir, "pc-core.img"), "CORE")
+	writeFile(c, filepath.Join(newerDir, "grubx64.efi"), "old-grub")
+	writeFile(c, filepath.Join(newerDir, "grub/grub.cfg"), "grub-cfg")
+	err = gadget.Update(s.newDir, newerDir, s.backupDir)
+	c.Assert(err, IsNil)
+	c.Check(s.readDisk(c, 0, 7), Equals, "NEWERBT")
+
+	c.Assert(gadget.Rollback(s.backupDir), IsNil)
+	c.Check(s.readDisk(c, 0, 7), Equals, "NEWBOOT")
+}
+
+func (s *updateSuite) TestUpdateAndRollbackOffsetWrite(c *C) {
+	gadgetYaml := strings.Replace(updateGadgetYaml, "- image: pc-core.img", "- image: pc-core.img\n            offset-write: 92", 1)
+	writeFile(c, filepath.Join(s.oldDir, "meta/gadget.yaml"), gadgetYaml)
+	writeFile(c, filepath.Join(s.newDir, "meta/gadget.yaml"), gadgetYaml)
+	writeFile(c, filepath.Join(s.newDir, "pc-core.img"), "NEWCORE")
+	f, err := os.OpenFile(s.disk, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteAt([]byte("PTR!"), 92)
+	c.Assert(err, IsNil)
+	f.Close()
+
+	err = gadget.Update(s.oldDir, s.newDir, s.backupDir)
+	c.Assert(err, IsNil)
+	c.Check(s.readDisk(c, 1024*1024, 7), Equals, "NEWCORE")
+	// the offset of the core image, in sectors
+	c.Check(s.readDisk(c, 92, 4), Equals, "\x00\x08\x00\x00")
+	// the MBR itself was not updated
+	c.Check(s.readDisk(c, 0, 7), Equals, "OLDBOOT")
+
+	c.Assert(gadget.Rollback(s.backupDir), IsNil)
+	c.Check(s.readDisk(c, 1024*1024, 7), Equals, "CORE\x00\x00\x00")
+	c.Check(s.readDisk(c, 92, 4), Equals, "PTR!")
+}
+
+func (s *updateSuite) TestUpdateIncompatibleLayout(c *C) {
+	for _, t := range []struct {
+		from, to string
+		err      string
+	}{
+		{"size: 440", "size: 400", `cannot update gadget assets: volume "pc": cannot change the layout of structure at offset 0`},
+		{"filesystem: vfat", "filesystem: ext4", `cannot update gadget assets: volume "pc": cannot change the layout of structure "system-boot"`},
+		{"bootloader: grub", "bootloader: u-boot", `cannot update gadget assets: volume "pc": cannot change bootloader`},
+		{"    bootloader: grub", "    schema: mbr\n    bootloader: grub", `cannot update gadget assets: volume "pc": cannot change schema`},
+		{"  pc:", "  other:", `cannot update gadget assets: volume "other" is new`},
+	} {
+		writeFile(c, filepath.Join(s.newDir, "meta/gadget.yaml"), strings.Replace(updateGadgetYaml, t.from, t.to, 1))
+		err := gadget.Update(s.oldDir, s.newDir, s.backupDir)
+		c.Check(err, ErrorMatches, t.err)
+	}
+	// nothing was touched
+	c.Check(s.readDisk(c, 0, 7), Equals, "OLDBOOT")
+}
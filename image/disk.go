@@ -0,0 +1,379 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+const (
+	gptEntries    = 128
+	gptEntrySize  = 128
+	gptHeaderSize = 92
+	// sectors used by the GPT entries
+	gptEntriesSectors = gptEntries * gptEntrySize / gadget.SectorSize
+	// sectors used by the protective MBR, the primary GPT header and
+	// the partition entries at the start of the disk
+	gptHeadSectors = 2 + gptEntriesSectors
+	// sectors used by the backup partition entries and GPT header at
+	// the end of the disk
+	gptTailSectors = gptEntriesSectors + 1
+)
+
+var randRead = rand.Read
+
+func randomGUID() ([]byte, error) {
+	guid := make([]byte, 16)
+	if _, err := randRead(guid); err != nil {
+		return nil, err
+	}
+	// version 4, variant 1
+	guid[7] = guid[7]&0x0f | 0x40
+	guid[8] = guid[8]&0x3f | 0x80
+	return guid, nil
+}
+
+func writeMBRPartitionTable(f *os.File, structures []gadget.LaidOutStructure) error {
+	var table [gadget.SectorSize - gadget.MBRCodeSize]byte
+	if _, err := randRead(table[:4]); err != nil {
+		return err
+	}
+	for _, s := range structures {
+		if s.Partition == 0 {
+			continue
+		}
+		typ, err := gadget.PartitionType("mbr", s.Type)
+		if err != nil {
+			return err
+		}
+		entry := table[6+16*(s.Partition-1):]
+		if s.Label == "system-boot" {
+			entry[0] = 0x80
+		}
+		// CHS addressing is not used
+		copy(entry[1:4], []byte{0xfe, 0xff, 0xff})
+		entry[4] = typ[0]
+		copy(entry[5:8], []byte{0xfe, 0xff, 0xff})
+		binary.LittleEndian.PutUint32(entry[8:], uint32(s.StartOffset/gadget.SectorSize))
+		binary.LittleEndian.PutUint32(entry[12:], uint32(s.Size/gadget.SectorSize))
+	}
+	table[len(table)-2], table[len(table)-1] = 0x55, 0xaa
+	_, err := f.WriteAt(table[:], gadget.MBRCodeSize)
+	return err
+}
+
+func writeGPTPartitionTable(f *os.File, structures []gadget.LaidOutStructure, size int64) error {
+	sectors := uint64(size / gadget.SectorSize)
+
+	// protective MBR, leaving the bootloader code alone
+	var pmbr [gadget.SectorSize - gadget.MBRCodeSize]byte
+	entry := pmbr[6:]
+	copy(entry[1:4], []byte{0x00, 0x02, 0x00})
+	entry[4] = 0xee
+	copy(entry[5:8], []byte{0xff, 0xff, 0xff})
+	binary.LittleEndian.PutUint32(entry[8:], 1)
+	protected := sectors - 1
+	if protected > 0xffffffff {
+		protected = 0xffffffff
+	}
+	binary.LittleEndian.PutUint32(entry[12:], uint32(protected))
+	pmbr[len(pmbr)-2], pmbr[len(pmbr)-1] = 0x55, 0xaa
+	if _, err := f.WriteAt(pmbr[:], gadget.MBRCodeSize); err != nil {
+		return err
+	}
+
+	entries := make([]byte, gptEntries*gptEntrySize)
+	for _, s := range structures {
+		if s.Partition == 0 {
+			continue
+		}
+		typ, err := gadget.PartitionType("gpt", s.Type)
+		if err != nil {
+			return err
+		}
+		unique, err := randomGUID()
+		if err != nil {
+			return err
+		}
+		entry := entries[gptEntrySize*(s.Partition-1):]
+		copy(entry[0:16], typ)
+		copy(entry[16:32], unique)
+		binary.LittleEndian.PutUint64(entry[32:], uint64(s.StartOffset/gadget.SectorSize))
+		binary.LittleEndian.PutUint64(entry[40:], uint64((s.StartOffset+s.Size)/gadget.SectorSize-1))
+		name := utf16.Encode([]rune(s.Label))
+		for i := 0; i < len(name) && i < 36; i++ {
+			binary.LittleEndian.PutUint16(entry[56+2*i:], name[i])
+		}
+	}
+	entriesCRC := crc32.ChecksumIEEE(entries)
+
+	diskGUID, err := randomGUID()
+	if err != nil {
+		return err
+	}
+	header := func(lba, alternateLBA, entriesLBA uint64) []byte {
+		h := make([]byte, gadget.SectorSize)
+		copy(h[0:8], "EFI PART")
+		binary.LittleEndian.PutUint32(h[8:], 0x00010000)
+		binary.LittleEndian.PutUint32(h[12:], gptHeaderSize)
+		binary.LittleEndian.PutUint64(h[24:], lba)
+		binary.LittleEndian.PutUint64(h[32:], alternateLBA)
+		binary.LittleEndian.PutUint64(h[40:], gptHeadSectors)
+		binary.LittleEndian.PutUint64(h[48:], sectors-gptTailSectors-1)
+		copy(h[56:72], diskGUID)
+		binary.LittleEndian.PutUint64(h[72:], entriesLBA)
+		binary.LittleEndian.PutUint32(h[80:], gptEntries)
+		binary.LittleEndian.PutUint32(h[84:], gptEntrySize)
+		binary.LittleEndian.PutUint32(h[88:], entriesCRC)
+		binary.LittleEndian.PutUint32(h[16:], crc32.ChecksumIEEE(h[:gptHeaderSize]))
+		return h
+	}
+
+	lastLBA := sectors - 1
+	for _, w := range []struct {
+		data []byte
+		lba  uint64
+	}{
+		{header(1, lastLBA, 2), 1},
+		{entries, 2},
+		{entries, lastLBA - gptEntriesSectors},
+		{header(lastLBA, 1, lastLBA-gptEntriesSectors), lastLBA},
+	} {
+		if _, err := f.WriteAt(w.data, int64(w.lba)*gadget.SectorSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyContent copies the gadget content source into the target path
+// under dir. A source ending in a slash has its content copied rather
+// than itself, a target ending in a slash is the directory to copy into.
+func copyContent(gadgetDir, dir string, c *snap.Content) error {
+	src := filepath.Join(gadgetDir, c.Source)
+	if strings.HasSuffix(c.Source, "/") {
+		src += "/."
+	}
+	dst := filepath.Join(dir, c.Target)
+	if c.Target == "" || strings.HasSuffix(c.Target, "/") {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		dst += "/"
+	} else if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return runCommand("cp", "-a", src, dst)
+}
+
+// populateFilesystemContent puts in dir the content of a structure
+// with a filesystem: the declared gadget content, and for the
+// system-boot and writable structures respectively the bootloader
+// files and the system data prepared in rootDir.
+func populateFilesystemContent(gadgetDir, rootDir, bootloader, dir string, s *gadget.LaidOutStructure) error {
+	for _, c := range s.Content {
+		if c.Source == "" {
+			return fmt.Errorf("cannot write structure %s: only source content is supported with a filesystem", s.Name())
+		}
+		if err := copyContent(gadgetDir, dir, &c); err != nil {
+			return fmt.Errorf("cannot write structure %s: %v", s.Name(), err)
+		}
+	}
+
+	var extra []snap.Content
+	switch s.Label {
+	case "system-boot":
+		switch bootloader {
+		case "grub":
+			extra = append(extra, snap.Content{Source: "boot/grub/", Target: "EFI/ubuntu/"})
+		case "u-boot":
+			extra = append(extra, snap.Content{Source: "boot/uboot/", Target: "/"})
+		case "systemd-boot":
+			extra = append(extra, snap.Content{Source: "boot/efi/", Target: "/"})
+		}
+	case "writable":
+		entries, err := ioutil.ReadDir(rootDir)
+		if err != nil {
+			return fmt.Errorf("cannot write structure %s: %v", s.Name(), err)
+		}
+		for _, entry := range entries {
+			if entry.Name() == "boot" {
+				continue
+			}
+			extra = append(extra, snap.Content{Source: entry.Name(), Target: "system-data/"})
+		}
+	}
+	for _, c := range extra {
+		if !osutil.FileExists(filepath.Join(rootDir, c.Source)) {
+			continue
+		}
+		if err := copyContent(rootDir, dir, &c); err != nil {
+			return fmt.Errorf("cannot write structure %s: %v", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+// mkfs creates in the file img, of the given size, a filesystem of
+// the given type and label holding the content of contentDir.
+var mkfs = mkfsImpl
+
+func mkfsImpl(typ, img, label, contentDir string, size int64) error {
+	if err := os.Truncate(img, size); err != nil {
+		return err
+	}
+	switch typ {
+	case "ext4":
+		return runCommand("mkfs.ext4", "-q", "-F", "-L", label, "-d", contentDir, img)
+	case "vfat":
+		if err := runCommand("mkfs.vfat", "-n", strings.ToUpper(label), img); err != nil {
+			return err
+		}
+		entries, err := ioutil.ReadDir(contentDir)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+		cmd := []string{"mcopy", "-s", "-i", img}
+		for _, entry := range entries {
+			cmd = append(cmd, filepath.Join(contentDir, entry.Name()))
+		}
+		return runCommand(append(cmd, "::")...)
+	}
+	return fmt.Errorf("cannot create unsupported filesystem %q", typ)
+}
+
+func writeFilesystem(f *os.File, gadgetDir, rootDir, bootloader string, s *gadget.LaidOutStructure) error {
+	tmpDir, err := ioutil.TempDir("", "snap-image-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	contentDir := filepath.Join(tmpDir, "content")
+	if err := os.Mkdir(contentDir, 0755); err != nil {
+		return err
+	}
+	if err := populateFilesystemContent(gadgetDir, rootDir, bootloader, contentDir, s); err != nil {
+		return err
+	}
+
+	img := filepath.Join(tmpDir, "fs.img")
+	if err := ioutil.WriteFile(img, nil, 0644); err != nil {
+		return err
+	}
+	if err := mkfs(s.Filesystem, img, s.Label, contentDir, s.Size); err != nil {
+		return fmt.Errorf("cannot create filesystem for structure %s: %v", s.Name(), err)
+	}
+
+	fs, err := os.Open(img)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	fi, err := fs.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() > s.Size {
+		return fmt.Errorf("cannot write structure %s: filesystem is larger than the structure", s.Name())
+	}
+	if _, err := f.Seek(s.StartOffset, 0); err != nil {
+		return err
+	}
+	_, err = io.Copy(f, fs)
+	return err
+}
+
+// writeDiskImage writes to imageFile a disk image with the volume
+// described by the gadget unpacked in gadgetDir: the partition table
+// of the volume schema, the raw images of the structures without a
+// filesystem and filesystems for the others. Besides their declared
+// content the system-boot and writable structures get the bootloader
+// files and the system data prepared in rootDir.
+func writeDiskImage(gadgetDir, rootDir, imageFile string) error {
+	gadgetInfo, err := snap.ReadGadgetInfoFromDir(gadgetDir)
+	if err != nil {
+		return err
+	}
+	if len(gadgetInfo.Volumes) != 1 {
+		return fmt.Errorf("cannot write a disk image for a gadget with %d volumes", len(gadgetInfo.Volumes))
+	}
+	var vol *snap.Volume
+	for _, v := range gadgetInfo.Volumes {
+		vol = &v
+	}
+
+	structures, size, err := gadget.LayoutVolume(vol)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(imageFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create disk image: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("cannot create disk image: %v", err)
+	}
+
+	for i := range structures {
+		s := &structures[i]
+		if s.Filesystem == "" {
+			err = gadget.WriteRawContent(f, gadgetDir, s)
+		} else {
+			err = writeFilesystem(f, gadgetDir, rootDir, vol.Bootloader, s)
+		}
+		if err != nil {
+			return err
+		}
+		if s.OffsetWrite != 0 {
+			if err := gadget.WriteOffset(f, s.OffsetWrite, s.StartOffset); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the partition table goes last, not to be clobbered by the
+	// bootloader code in the mbr structure
+	if gadget.VolumeSchema(vol) == "mbr" {
+		err = writeMBRPartitionTable(f, structures)
+	} else {
+		err = writeGPTPartitionTable(f, structures, size)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write partition table: %v", err)
+	}
+
+	return f.Sync()
+}
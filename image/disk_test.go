@@ -0,0 +1,343 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/image"
+)
+
+type diskSuite struct {
+	gadgetDir string
+	rootDir   string
+	imageFile string
+
+	mkfsCalls []string
+}
+
+var _ = Suite(&diskSuite{})
+
+func (s *diskSuite) SetUpTest(c *C) {
+	tmp := c.MkDir()
+	s.gadgetDir = filepath.Join(tmp, "gadget")
+	s.rootDir = filepath.Join(tmp, "image")
+	s.imageFile = filepath.Join(tmp, "disk.img")
+	s.mkfsCalls = nil
+
+	c.Assert(os.MkdirAll(filepath.Join(s.gadgetDir, "meta"), 0755), IsNil)
+	s.writeFile(c, s.gadgetDir, "pc-boot.img", "BOOTCODE")
+	s.writeFile(c, s.gadgetDir, "pc-core.img", "CORESTAGE")
+	s.writeFile(c, s.gadgetDir, "grubx64.efi", "grub-efi")
+
+	s.writeFile(c, s.rootDir, "boot/grub/grub.cfg", "grub-cfg")
+	s.writeFile(c, s.rootDir, "var/lib/snapd/seed/seed.yaml", "seed")
+}
+
+func (s *diskSuite) writeFile(c *C, dir, name, content string) {
+	p := filepath.Join(dir, name)
+	c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(p, []byte(content), 0644), IsNil)
+}
+
+func (s *diskSuite) writeGadgetYaml(c *C, gadgetYaml string) {
+	s.writeFile(c, s.gadgetDir, "meta/gadget.yaml", gadgetYaml)
+}
+
+// mockMkfs records the files it would put in the filesystem and writes
+// a marker describing it instead.
+func (s *diskSuite) mockMkfs(c *C) func() {
+	return image.MockMkfs(func(typ, img, label, contentDir string, size int64) error {
+		var files []string
+		err := filepath.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(contentDir, path)
+				files = append(files, rel)
+			}
+			return err
+		})
+		c.Assert(err, IsNil)
+		sort.Strings(files)
+		call := fmt.Sprintf("%s:%s:%d:%s", typ, label, size, strings.Join(files, ","))
+		s.mkfsCalls = append(s.mkfsCalls, call)
+		return ioutil.WriteFile(img, []byte(call), 0644)
+	})
+}
+
+func (s *diskSuite) readAt(c *C, offset int64, n int) []byte {
+	f, err := os.Open(s.imageFile)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	b := make([]byte, n)
+	_, err = f.ReadAt(b, offset)
+	c.Assert(err, IsNil)
+	return b
+}
+
+const pcGadgetYaml = `
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - type: mbr
+        size: 440
+        content:
+          - image: pc-boot.img
+      - type: DA,21686148-6449-6E6F-744E-656564454649
+        size: 1048576
+        offset: 1048576
+        offset-write: 92
+        content:
+          - image: pc-core.img
+            offset-write: 96
+      - label: system-boot
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+        size: 2097152
+        content:
+          - source: grubx64.efi
+            target: EFI/boot/
+      - label: writable
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        filesystem: ext4
+        size: 4194304
+`
+
+func (s *diskSuite) TestWriteDiskImageGPT(c *C) {
+	defer s.mockMkfs(c)()
+	s.writeGadgetYaml(c, pcGadgetYaml)
+
+	err := image.WriteDiskImage(s.gadgetDir, s.rootDir, s.imageFile)
+	c.Assert(err, IsNil)
+
+	fi, err := os.Stat(s.imageFile)
+	c.Assert(err, IsNil)
+	const end = 1024*1024 + 1024*1024 + 2097152 + 4194304
+	c.Check(fi.Size(), Equals, int64(end+33*512))
+	sectors := uint64(fi.Size() / 512)
+
+	// bootloader code and stages, and where to find them
+	c.Check(string(s.readAt(c, 0, 8)), Equals, "BOOTCODE")
+	c.Check(string(s.readAt(c, 1024*1024, 9)), Equals, "CORESTAGE")
+	c.Check(binary.LittleEndian.Uint32(s.readAt(c, 92, 4)), Equals, uint32(2048))
+	c.Check(binary.LittleEndian.Uint32(s.readAt(c, 96, 4)), Equals, uint32(2048))
+
+	// the filesystems with their content
+	c.Check(s.mkfsCalls, DeepEquals, []string{
+		"vfat:system-boot:2097152:EFI/boot/grubx64.efi,EFI/ubuntu/grub.cfg",
+		"ext4:writable:4194304:system-data/var/lib/snapd/seed/seed.yaml",
+	})
+	c.Check(string(s.readAt(c, 2*1024*1024, len(s.mkfsCalls[0]))), Equals, s.mkfsCalls[0])
+	c.Check(string(s.readAt(c, 2*1024*1024+2097152, len(s.mkfsCalls[1]))), Equals, s.mkfsCalls[1])
+
+	// protective MBR
+	mbr := s.readAt(c, 0, 512)
+	c.Check(mbr[446+4], Equals, byte(0xee))
+	c.Check(binary.LittleEndian.Uint32(mbr[446+8:]), Equals, uint32(1))
+	c.Check(mbr[510:], DeepEquals, []byte{0x55, 0xaa})
+
+	checkHeader := func(lba, alternateLBA, entriesLBA uint64) {
+		h := s.readAt(c, int64(lba)*512, 92)
+		c.Check(string(h[0:8]), Equals, "EFI PART")
+		crc := binary.LittleEndian.Uint32(h[16:])
+		copy(h[16:20], []byte{0, 0, 0, 0})
+		c.Check(crc32.ChecksumIEEE(h), Equals, crc)
+		c.Check(binary.LittleEndian.Uint64(h[24:]), Equals, lba)
+		c.Check(binary.LittleEndian.Uint64(h[32:]), Equals, alternateLBA)
+		c.Check(binary.LittleEndian.Uint64(h[40:]), Equals, uint64(34))
+		c.Check(binary.LittleEndian.Uint64(h[48:]), Equals, sectors-34)
+		c.Check(binary.LittleEndian.Uint64(h[72:]), Equals, entriesLBA)
+
+		entries := s.readAt(c, int64(entriesLBA)*512, 128*128)
+		c.Check(crc32.ChecksumIEEE(entries), Equals, binary.LittleEndian.Uint32(h[88:]))
+	}
+	checkHeader(1, sectors-1, 2)
+	checkHeader(sectors-1, 1, sectors-33)
+
+	entries := s.readAt(c, 2*512, 128*128)
+	for i, t := range []struct {
+		typ         []byte
+		first, last uint64
+		name        string
+	}{
+		// BIOS boot partition
+		{[]byte{0x48, 0x61, 0x68, 0x21, 0x49, 0x64, 0x6f, 0x6e, 0x74, 0x4e, 0x65, 0x65, 0x64, 0x45, 0x46, 0x49}, 2048, 4095, ""},
+		// EFI system partition
+		{[]byte{0x28, 0x73, 0x2a, 0xc1, 0x1f, 0xf8, 0xd2, 0x11, 0xba, 0x4b, 0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b}, 4096, 8191, "system-boot"},
+		{[]byte{0xaf, 0x3d, 0xc6, 0x0f, 0x83, 0x84, 0x72, 0x47, 0x8e, 0x79, 0x3d, 0x69, 0xd8, 0x47, 0x7d, 0xe4}, 8192, 16383, "writable"},
+	} {
+		entry := entries[128*i:]
+		c.Check(entry[0:16], DeepEquals, t.typ)
+		c.Check(entry[16:32], Not(DeepEquals), make([]byte, 16))
+		c.Check(binary.LittleEndian.Uint64(entry[32:]), Equals, t.first)
+		c.Check(binary.LittleEndian.Uint64(entry[40:]), Equals, t.last)
+		name := bytes.Replace(entry[56:56+2*len(t.name)], []byte{0}, nil, -1)
+		c.Check(string(name), Equals, t.name)
+	}
+	c.Check(entries[128*3:], DeepEquals, make([]byte, 128*125))
+}
+
+func (s *diskSuite) TestWriteDiskImageMBR(c *C) {
+	defer s.mockMkfs(c)()
+	s.writeGadgetYaml(c, `
+volumes:
+  pi:
+    schema: mbr
+    bootloader: u-boot
+    structure:
+      - label: system-boot
+        type: 0C
+        filesystem: vfat
+        size: 1048576
+      - label: writable
+        type: 83
+        filesystem: ext4
+        size: 2097152
+`)
+	s.writeFile(c, s.rootDir, "boot/uboot/uboot.env", "env")
+
+	err := image.WriteDiskImage(s.gadgetDir, s.rootDir, s.imageFile)
+	c.Assert(err, IsNil)
+
+	fi, err := os.Stat(s.imageFile)
+	c.Assert(err, IsNil)
+	c.Check(fi.Size(), Equals, int64(1024*1024+1048576+2097152))
+
+	c.Check(s.mkfsCalls, DeepEquals, []string{
+		"vfat:system-boot:1048576:uboot.env",
+		"ext4:writable:2097152:system-data/var/lib/snapd/seed/seed.yaml",
+	})
+
+	mbr := s.readAt(c, 0, 512)
+	c.Check(mbr[510:], DeepEquals, []byte{0x55, 0xaa})
+	for i, t := range []struct {
+		bootable byte
+		typ      byte
+		start    uint32
+		sectors  uint32
+	}{
+		{0x80, 0x0c, 2048, 2048},
+		{0x00, 0x83, 4096, 4096},
+	} {
+		entry := mbr[446+16*i:]
+		c.Check(entry[0], Equals, t.bootable)
+		c.Check(entry[4], Equals, t.typ)
+		c.Check(binary.LittleEndian.Uint32(entry[8:]), Equals, t.start)
+		c.Check(binary.LittleEndian.Uint32(entry[12:]), Equals, t.sectors)
+	}
+	c.Check(mbr[446+32:510], DeepEquals, make([]byte, 32))
+}
+
+func (s *diskSuite) TestWriteDiskImageErrors(c *C) {
+	defer s.mockMkfs(c)()
+
+	for _, t := range []struct {
+		gadgetYaml string
+		err        string
+	}{
+		{`
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - type: bare
+        size: 4
+        content:
+          - image: pc-core.img
+`, `cannot write structure at offset 1048576: image "pc-core.img" does not fit`},
+		{`
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - type: bare
+        size: 4096
+        content:
+          - image: pc-core.img
+            size: 4
+`, `cannot write structure at offset 1048576: image "pc-core.img" is larger than its declared size 4`},
+		{`
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - type: bare
+        size: 4096
+        content:
+          - source: grubx64.efi
+            target: /
+`, `cannot write structure at offset 1048576: only image content is supported without a filesystem`},
+		{`
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - label: system-boot
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        filesystem: vfat
+        size: 4096
+        content:
+          - image: pc-core.img
+`, `cannot write structure "system-boot": only source content is supported with a filesystem`},
+	} {
+		s.writeGadgetYaml(c, t.gadgetYaml)
+		err := image.WriteDiskImage(s.gadgetDir, s.rootDir, s.imageFile)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *diskSuite) TestWriteDiskImageRealExt4(c *C) {
+	for _, tool := range []string{"mkfs.ext4", "debugfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			c.Skip(fmt.Sprintf("%s not available", tool))
+		}
+	}
+	s.writeGadgetYaml(c, `
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - label: writable
+        type: 0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        filesystem: ext4
+        size: 4194304
+`)
+
+	err := image.WriteDiskImage(s.gadgetDir, s.rootDir, s.imageFile)
+	c.Assert(err, IsNil)
+
+	// extract the filesystem to look into it
+	fs := filepath.Join(c.MkDir(), "writable.img")
+	c.Assert(ioutil.WriteFile(fs, s.readAt(c, 1024*1024, 4194304), 0644), IsNil)
+	output, err := exec.Command("debugfs", "-R", "cat /system-data/var/lib/snapd/seed/seed.yaml", fs).Output()
+	c.Assert(err, IsNil)
+	c.Check(string(output), Equals, "seed")
+}
@@ -24,4 +24,22 @@ var (
 	DecodeModelAssertion = decodeModelAssertion
 	DownloadUnpackGadget = downloadUnpackGadget
 	BootstrapToRootDir   = bootstrapToRootDir
+	WriteDiskImage       = writeDiskImage
+	PreseedImage         = preseedImage
 )
+
+func MockMkfs(f func(typ, img, label, contentDir string, size int64) error) (restore func()) {
+	old := mkfs
+	mkfs = f
+	return func() {
+		mkfs = old
+	}
+}
+
+func MockRandRead(f func([]byte) (int, error)) (restore func()) {
+	old := randRead
+	randRead = f
+	return func() {
+		randRead = old
+	}
+}
@@ -50,6 +50,19 @@ type Options struct {
 	Channel         string
 	ModelFile       string
 	GadgetUnpackDir string
+	// ImageFile if set is where to write a disk image laid out
+	// according to the volume of the gadget.
+	ImageFile string
+	// ManifestFile if set is where to write the manifest of the
+	// seeded snaps and assertions, outside of RootDir not to ship
+	// it in the image.
+	ManifestFile string
+	// FromManifestFile if set is a manifest written by a previous
+	// run, to seed exactly the snaps and assertions it lists.
+	FromManifestFile string
+	// Preseed if set runs the first boot seeding of the image ahead
+	// of time, up to what needs the booted device.
+	Preseed bool
 }
 
 type localInfos struct {
@@ -120,13 +133,34 @@ func Prepare(opts *Options) error {
 		return err
 	}
 
+	var from *Manifest
+	if opts.FromManifestFile != "" {
+		from, err = ReadManifest(opts.FromManifestFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	sto := makeStore(model)
 
-	if err := downloadUnpackGadget(sto, model, opts, local); err != nil {
+	if err := downloadUnpackGadget(sto, model, opts, local, from); err != nil {
 		return err
 	}
 
-	return bootstrapToRootDir(sto, model, opts, local)
+	if err := bootstrapToRootDir(sto, model, opts, local, from); err != nil {
+		return err
+	}
+
+	if opts.Preseed {
+		if err := preseedImage(opts.RootDir); err != nil {
+			return err
+		}
+	}
+
+	if opts.ImageFile != "" {
+		return writeDiskImage(opts.GadgetUnpackDir, opts.RootDir, opts.ImageFile)
+	}
+	return nil
 }
 
 // these are postponed, not implemented or abandoned, not finalized,
@@ -159,7 +193,7 @@ func decodeModelAssertion(opts *Options) (*asserts.Model, error) {
 	return modela, nil
 }
 
-func downloadUnpackGadget(sto Store, model *asserts.Model, opts *Options, local *localInfos) error {
+func downloadUnpackGadget(sto Store, model *asserts.Model, opts *Options, local *localInfos, from *Manifest) error {
 	if err := os.MkdirAll(opts.GadgetUnpackDir, 0755); err != nil {
 		return fmt.Errorf("cannot create gadget unpack dir %q: %s", opts.GadgetUnpackDir, err)
 	}
@@ -168,7 +202,7 @@ func downloadUnpackGadget(sto Store, model *asserts.Model, opts *Options, local
 		TargetDir: opts.GadgetUnpackDir,
 		Channel:   opts.Channel,
 	}
-	snapFn, _, err := acquireSnap(sto, model.Gadget(), dlOpts, local)
+	snapFn, _, err := acquireSnap(sto, model.Gadget(), dlOpts, local, from)
 	if err != nil {
 		return err
 	}
@@ -178,17 +212,43 @@ func downloadUnpackGadget(sto Store, model *asserts.Model, opts *Options, local
 	return snap.Unpack("*", opts.GadgetUnpackDir)
 }
 
-func acquireSnap(sto Store, name string, dlOpts *DownloadOptions, local *localInfos) (downloadedSnap string, info *snap.Info, err error) {
-	if info := local.Info(name); info != nil {
+// acquireSnap copies the local snap or downloads the store snap with
+// the given name, at the revision listed in the from manifest if set.
+func acquireSnap(sto Store, name string, dlOpts *DownloadOptions, local *localInfos, from *Manifest) (downloadedSnap string, info *snap.Info, err error) {
+	revision := snap.R(0)
+	var pinned *ManifestSnap
+	if from != nil {
+		pinned = from.Snap(name)
+		if pinned == nil {
+			return "", nil, fmt.Errorf("cannot reproduce image: snap %q is not listed in the manifest", name)
+		}
+		revision = pinned.Revision
+	}
+
+	if info = local.Info(name); info != nil {
 		// local snap to install (unasserted only for now)
 		p := local.Path(name)
-		dst, err := copyLocalSnapFile(p, dlOpts.TargetDir, info)
-		if err != nil {
-			return "", nil, err
+		downloadedSnap, err = copyLocalSnapFile(p, dlOpts.TargetDir, info)
+	} else {
+		if revision.Local() {
+			return "", nil, fmt.Errorf("cannot reproduce image: snap %q was a local snap, it must be given again", name)
 		}
-		return dst, info, nil
+		downloadedSnap, info, err = DownloadSnap(sto, name, revision, dlOpts)
+	}
+	if err != nil || pinned == nil {
+		return downloadedSnap, info, err
 	}
-	return DownloadSnap(sto, name, snap.R(0), dlOpts)
+
+	sha3_384, _, err := asserts.SnapFileSHA3_384(downloadedSnap)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.Revision != pinned.Revision || sha3_384 != pinned.Sha3_384 {
+		return "", nil, fmt.Errorf("cannot reproduce image: obtained snap %q revision %s with sha3-384 %s, manifest lists revision %s with sha3-384 %s", name, info.Revision, sha3_384, pinned.Revision, pinned.Sha3_384)
+	}
+	// asking for a revision sidesteps the channel
+	info.Channel = pinned.Channel
+	return downloadedSnap, info, nil
 }
 
 type addingFetcher struct {
@@ -207,10 +267,34 @@ func makeFetcher(sto Store, dlOpts *DownloadOptions, db *asserts.Database) *addi
 
 }
 
+func isAssertionNotFound(err error) bool {
+	if _, ok := err.(*store.AssertionNotFoundError); ok {
+		return true
+	}
+	return err == asserts.ErrNotFound
+}
+
 // one and only core snap for now
 const defaultCore = "ubuntu-core"
 
-func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *localInfos) error {
+// insideDir returns whether path is dir or below it.
+func insideDir(dir, path string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *localInfos, from *Manifest) error {
 	// FIXME: try to avoid doing this
 	if opts.RootDir != "" {
 		dirs.SetRootDir(opts.RootDir)
@@ -221,6 +305,9 @@ func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *l
 	if osutil.FileExists(dirs.SnapStateFile) {
 		return fmt.Errorf("cannot bootstrap over existing system")
 	}
+	if opts.ManifestFile != "" && insideDir(opts.RootDir, opts.ManifestFile) {
+		return fmt.Errorf("cannot write seed manifest %q inside the image root dir", opts.ManifestFile)
+	}
 
 	// TODO: developer database in home or use snapd (but need
 	// a bit more API there, potential issues when crossing stores/series)
@@ -242,6 +329,14 @@ func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *l
 		}
 	}
 
+	if model.Store() != "" {
+		// the brand store the model points to, if described by a store assertion
+		ref := &asserts.Ref{Type: asserts.StoreType, PrimaryKey: []string{model.Store()}}
+		if err := f.Fetch(ref); err != nil && !isAssertionNotFound(err) {
+			return fmt.Errorf("cannot fetch and check the store assertion for %q: %v", model.Store(), err)
+		}
+	}
+
 	// put snaps in place
 	if err := os.MkdirAll(dirs.SnapBlobDir, 0755); err != nil {
 		return err
@@ -275,6 +370,7 @@ func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *l
 	seen := make(map[string]bool)
 	downloadedSnapsInfo := map[string]*snap.Info{}
 	var seedYaml snap.Seed
+	var manifest Manifest
 	for _, snapName := range snaps {
 		name := local.Name(snapName)
 		if seen[name] {
@@ -288,7 +384,7 @@ func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *l
 			fmt.Fprintf(Stdout, "Fetching %s\n", snapName)
 		}
 
-		fn, info, err := acquireSnap(sto, name, dlOpts, local)
+		fn, info, err := acquireSnap(sto, name, dlOpts, local, from)
 		if err != nil {
 			return err
 		}
@@ -327,6 +423,28 @@ func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *l
 			// no assertions for this snap were put in the seed
 			Unasserted: info.SnapID == "",
 		})
+
+		sha3_384, _, err := asserts.SnapFileSHA3_384(fn)
+		if err != nil {
+			return err
+		}
+		manifest.Snaps = append(manifest.Snaps, &ManifestSnap{
+			Name:     info.Name(),
+			Revision: info.Revision,
+			Sha3_384: sha3_384,
+			Channel:  info.Channel,
+		})
+	}
+
+	if from != nil {
+		for _, sn := range from.Snaps {
+			if !seen[sn.Name] {
+				return fmt.Errorf("cannot reproduce image: snap %q listed in the manifest was not seeded", sn.Name)
+			}
+		}
+		if err := from.checkAssertions(db); err != nil {
+			return err
+		}
 	}
 
 	for _, aRef := range f.addedRefs {
@@ -345,6 +463,7 @@ func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *l
 		if err != nil {
 			return err
 		}
+		manifest.addAssertion(a)
 	}
 
 	// TODO: add the refs as an assertions list of maps section to seed.yaml
@@ -354,6 +473,12 @@ func bootstrapToRootDir(sto Store, model *asserts.Model, opts *Options, local *l
 		return fmt.Errorf("cannot write seed.yaml: %s", err)
 	}
 
+	if opts.ManifestFile != "" {
+		if err := manifest.Write(opts.ManifestFile); err != nil {
+			return fmt.Errorf("cannot write manifest: %s", err)
+		}
+	}
+
 	// now do the bootloader stuff
 	if err := partition.InstallBootConfig(opts.GadgetUnpackDir); err != nil {
 		return err
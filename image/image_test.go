@@ -268,7 +268,7 @@ func (s *imageSuite) TestHappyDecodeModelAssertion(c *C) {
 }
 
 func (s *imageSuite) TestMissingGadgetUnpackDir(c *C) {
-	err := image.DownloadUnpackGadget(s, s.model, &image.Options{}, nil)
+	err := image.DownloadUnpackGadget(s, s.model, &image.Options{}, nil, nil)
 	c.Assert(err, ErrorMatches, `cannot create gadget unpack dir "": mkdir : no such file or directory`)
 }
 
@@ -297,7 +297,7 @@ func (s *imageSuite) TestDownloadUnpackGadget(c *C) {
 	local, err := image.LocalSnaps(opts)
 	c.Assert(err, IsNil)
 
-	err = image.DownloadUnpackGadget(s, s.model, opts, local)
+	err = image.DownloadUnpackGadget(s, s.model, opts, local, nil)
 	c.Assert(err, IsNil)
 
 	// verify the right data got unpacked
@@ -335,6 +335,99 @@ func (s *imageSuite) setupSnaps(c *C, gadgetUnpackDir string) {
 	s.addSystemSnapAssertions(c, "required-snap1")
 }
 
+func (s *imageSuite) TestBootstrapToRootDirBrandStore(c *C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	model, err := s.brandSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"authority-id": "my-brand",
+		"brand-id":     "my-brand",
+		"model":        "my-model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+		"store":        "my-brand-store",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	operator := assertstest.NewAccount(s.storeSigning, "operator", nil, "")
+	c.Assert(s.storeSigning.Add(operator), IsNil)
+	storeAs, err := s.storeSigning.Sign(asserts.StoreType, map[string]interface{}{
+		"store":       "my-brand-store",
+		"operator-id": operator.AccountID(),
+		"url":         "https://my-brand-store.example.com/",
+		"timestamp":   time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(s.storeSigning.Add(storeAs), IsNil)
+
+	rootdir := filepath.Join(c.MkDir(), "imageroot")
+	gadgetUnpackDir := filepath.Join(c.MkDir(), "gadget")
+	s.setupSnaps(c, gadgetUnpackDir)
+
+	c1 := testutil.MockCommand(c, "mount", "")
+	defer c1.Restore()
+	c2 := testutil.MockCommand(c, "umount", "")
+	defer c2.Restore()
+
+	opts := &image.Options{
+		RootDir:         rootdir,
+		GadgetUnpackDir: gadgetUnpackDir,
+	}
+	local, err := image.LocalSnaps(opts)
+	c.Assert(err, IsNil)
+
+	err = image.BootstrapToRootDir(s, model.(*asserts.Model), opts, local, nil)
+	c.Assert(err, IsNil)
+
+	// the store assertion and its operator account are in the seed
+	for _, fn := range []string{"my-brand-store.store", operator.AccountID() + ".account"} {
+		p := filepath.Join(rootdir, "var/lib/snapd/seed/assertions", fn)
+		c.Check(osutil.FileExists(p), Equals, true)
+	}
+}
+
+func (s *imageSuite) TestBootstrapToRootDirBrandStoreNoAssertion(c *C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	model, err := s.brandSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"authority-id": "my-brand",
+		"brand-id":     "my-brand",
+		"model":        "my-model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+		"store":        "my-brand-store",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	rootdir := filepath.Join(c.MkDir(), "imageroot")
+	gadgetUnpackDir := filepath.Join(c.MkDir(), "gadget")
+	s.setupSnaps(c, gadgetUnpackDir)
+
+	c1 := testutil.MockCommand(c, "mount", "")
+	defer c1.Restore()
+	c2 := testutil.MockCommand(c, "umount", "")
+	defer c2.Restore()
+
+	opts := &image.Options{
+		RootDir:         rootdir,
+		GadgetUnpackDir: gadgetUnpackDir,
+	}
+	local, err := image.LocalSnaps(opts)
+	c.Assert(err, IsNil)
+
+	// a store without a store assertion is fine
+	err = image.BootstrapToRootDir(s, model.(*asserts.Model), opts, local, nil)
+	c.Assert(err, IsNil)
+	c.Check(osutil.FileExists(filepath.Join(rootdir, "var/lib/snapd/seed/assertions", "my-brand-store.store")), Equals, false)
+}
+
 func (s *imageSuite) TestBootstrapToRootDir(c *C) {
 	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
 	defer restore()
@@ -359,7 +452,7 @@ func (s *imageSuite) TestBootstrapToRootDir(c *C) {
 	local, err := image.LocalSnaps(opts)
 	c.Assert(err, IsNil)
 
-	err = image.BootstrapToRootDir(s, s.model, opts, local)
+	err = image.BootstrapToRootDir(s, s.model, opts, local, nil)
 	c.Assert(err, IsNil)
 
 	// check seed yaml
@@ -418,6 +511,136 @@ func (s *imageSuite) TestBootstrapToRootDir(c *C) {
 	c.Check(cv, Equals, "ubuntu-core_3.snap")
 }
 
+// bootstrapWithManifest runs bootstrapToRootDir over the snaps from
+// setupSnaps, writing the manifest to manifestFn if set and reproducing
+// from the manifest built by mkFrom out of the seeded snaps if set.
+func (s *imageSuite) bootstrapWithManifest(c *C, manifestFn string, mkFrom func(seeded []*image.ManifestSnap) *image.Manifest) ([]*image.ManifestSnap, error) {
+	rootdir := filepath.Join(c.MkDir(), "imageroot")
+	gadgetUnpackDir := filepath.Join(c.MkDir(), "gadget")
+
+	s.setupSnaps(c, gadgetUnpackDir)
+
+	var seeded []*image.ManifestSnap
+	for _, name := range []string{"ubuntu-core", "pc-kernel", "pc", "required-snap1"} {
+		sha3_384, _, err := asserts.SnapFileSHA3_384(s.downloadedSnaps[name])
+		c.Assert(err, IsNil)
+		seeded = append(seeded, &image.ManifestSnap{
+			Name:     name,
+			Revision: s.storeSnapInfo[name].Revision,
+			Sha3_384: sha3_384,
+		})
+	}
+	var from *image.Manifest
+	if mkFrom != nil {
+		from = mkFrom(seeded)
+	}
+
+	// mock the mount cmds (for the extract kernel assets stuff)
+	c1 := testutil.MockCommand(c, "mount", "")
+	defer c1.Restore()
+	c2 := testutil.MockCommand(c, "umount", "")
+	defer c2.Restore()
+
+	opts := &image.Options{
+		RootDir:         rootdir,
+		GadgetUnpackDir: gadgetUnpackDir,
+		ManifestFile:    manifestFn,
+	}
+	local, err := image.LocalSnaps(opts)
+	c.Assert(err, IsNil)
+
+	return seeded, image.BootstrapToRootDir(s, s.model, opts, local, from)
+}
+
+func (s *imageSuite) TestBootstrapToRootDirWritesManifest(c *C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	manifestFn := filepath.Join(c.MkDir(), "seed.manifest")
+	seeded, err := s.bootstrapWithManifest(c, manifestFn, nil)
+	c.Assert(err, IsNil)
+
+	m, err := image.ReadManifest(manifestFn)
+	c.Assert(err, IsNil)
+	c.Check(m.Snaps, DeepEquals, seeded)
+
+	brandPubKey, err := s.brandSigning.PublicKey("")
+	c.Assert(err, IsNil)
+	c.Check(m.Assertions, testutil.DeepContains, &image.ManifestAssertion{
+		Type:       "model",
+		PrimaryKey: []string{"16", "my-brand", "my-model"},
+	})
+	c.Check(m.Assertions, testutil.DeepContains, &image.ManifestAssertion{
+		Type:       "account-key",
+		PrimaryKey: []string{brandPubKey.ID()},
+	})
+	c.Check(m.Assertions, testutil.DeepContains, &image.ManifestAssertion{
+		Type:       "snap-declaration",
+		PrimaryKey: []string{"16", "pc-kernel-Id"},
+	})
+}
+
+func (s *imageSuite) TestBootstrapToRootDirManifestInsideRootDir(c *C) {
+	rootdir := filepath.Join(c.MkDir(), "imageroot")
+	opts := &image.Options{
+		RootDir:      rootdir,
+		ManifestFile: filepath.Join(rootdir, "seed.manifest"),
+	}
+	err := image.BootstrapToRootDir(s, s.model, opts, nil, nil)
+	c.Check(err, ErrorMatches, `cannot write seed manifest ".*/imageroot/seed.manifest" inside the image root dir`)
+}
+
+func (s *imageSuite) TestBootstrapToRootDirFromManifest(c *C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	_, err := s.bootstrapWithManifest(c, "", func(seeded []*image.ManifestSnap) *image.Manifest {
+		return &image.Manifest{
+			Snaps: seeded,
+			Assertions: []*image.ManifestAssertion{
+				{Type: "model", PrimaryKey: []string{"16", "my-brand", "my-model"}},
+			},
+		}
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *imageSuite) TestBootstrapToRootDirFromManifestMismatch(c *C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	_, err := s.bootstrapWithManifest(c, "", func(seeded []*image.ManifestSnap) *image.Manifest {
+		seeded[1].Sha3_384 = "other"
+		return &image.Manifest{Snaps: seeded}
+	})
+	c.Assert(err, ErrorMatches, `cannot reproduce image: obtained snap "pc-kernel" revision 2 with sha3-384 .*, manifest lists revision 2 with sha3-384 other`)
+}
+
+func (s *imageSuite) TestBootstrapToRootDirFromManifestNotListed(c *C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	_, err := s.bootstrapWithManifest(c, "", func(seeded []*image.ManifestSnap) *image.Manifest {
+		return &image.Manifest{Snaps: seeded[:3]}
+	})
+	c.Assert(err, ErrorMatches, `cannot reproduce image: snap "required-snap1" is not listed in the manifest`)
+}
+
+func (s *imageSuite) TestBootstrapToRootDirFromManifestAssertionRevision(c *C) {
+	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
+	defer restore()
+
+	_, err := s.bootstrapWithManifest(c, "", func(seeded []*image.ManifestSnap) *image.Manifest {
+		return &image.Manifest{
+			Snaps: seeded,
+			Assertions: []*image.ManifestAssertion{
+				{Type: "model", PrimaryKey: []string{"16", "my-brand", "my-model"}, Revision: 3},
+			},
+		}
+	})
+	c.Assert(err, ErrorMatches, `cannot reproduce image: obtained assertion .* at revision 0, manifest lists revision 3`)
+}
+
 func (s *imageSuite) TestBootstrapToRootDirLocalCore(c *C) {
 	restore := sysdb.InjectTrusted(s.storeSigning.Trusted)
 	defer restore()
@@ -446,7 +669,7 @@ func (s *imageSuite) TestBootstrapToRootDirLocalCore(c *C) {
 	local, err := image.LocalSnaps(opts)
 	c.Assert(err, IsNil)
 
-	err = image.BootstrapToRootDir(s, s.model, opts, local)
+	err = image.BootstrapToRootDir(s, s.model, opts, local, nil)
 	c.Assert(err, IsNil)
 
 	// check seed yaml
@@ -565,7 +788,7 @@ func (s *imageSuite) TestBootstrapToRootDirDevmodeSnap(c *C) {
 	local, err := image.LocalSnaps(opts)
 	c.Assert(err, IsNil)
 
-	err = image.BootstrapToRootDir(s, s.model, opts, local)
+	err = image.BootstrapToRootDir(s, s.model, opts, local, nil)
 	c.Assert(err, IsNil)
 
 	// check seed yaml
@@ -0,0 +1,129 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// ManifestSnap records a snap seeded into an image.
+type ManifestSnap struct {
+	Name     string        `yaml:"name"`
+	Revision snap.Revision `yaml:"revision"`
+	Sha3_384 string        `yaml:"sha3-384"`
+	Channel  string        `yaml:"channel,omitempty"`
+}
+
+// ManifestAssertion records an assertion seeded into an image.
+type ManifestAssertion struct {
+	Type       string   `yaml:"type"`
+	PrimaryKey []string `yaml:"primary-key"`
+	Revision   int      `yaml:"revision"`
+}
+
+// Manifest records what was seeded into an image, so that the exact
+// same image can be prepared again from it.
+type Manifest struct {
+	Snaps      []*ManifestSnap      `yaml:"snaps"`
+	Assertions []*ManifestAssertion `yaml:"assertions,omitempty"`
+}
+
+// ReadManifest reads a manifest written by Manifest.Write.
+func ReadManifest(fn string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %v", err)
+	}
+
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest %q: %v", fn, err)
+	}
+
+	seen := make(map[string]bool, len(m.Snaps))
+	for _, sn := range m.Snaps {
+		if sn.Name == "" || sn.Sha3_384 == "" || sn.Revision.Unset() {
+			return nil, fmt.Errorf("invalid manifest %q: snaps need a name, a revision and a sha3-384", fn)
+		}
+		if seen[sn.Name] {
+			return nil, fmt.Errorf("invalid manifest %q: snap %q listed more than once", fn, sn.Name)
+		}
+		seen[sn.Name] = true
+	}
+	for _, a := range m.Assertions {
+		if asserts.Type(a.Type) == nil {
+			return nil, fmt.Errorf("invalid manifest %q: unknown assertion type %q", fn, a.Type)
+		}
+	}
+
+	return &m, nil
+}
+
+// Write writes the manifest to the given file.
+func (m *Manifest) Write(fn string) error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(fn, data, 0644, 0)
+}
+
+// Snap returns what the manifest lists for the snap with the given
+// name, or nil.
+func (m *Manifest) Snap(name string) *ManifestSnap {
+	for _, sn := range m.Snaps {
+		if sn.Name == name {
+			return sn
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) addAssertion(a asserts.Assertion) {
+	ref := a.Ref()
+	m.Assertions = append(m.Assertions, &ManifestAssertion{
+		Type:       ref.Type.Name,
+		PrimaryKey: ref.PrimaryKey,
+		Revision:   a.Revision(),
+	})
+}
+
+// checkAssertions checks that all the assertions listed in the manifest
+// were obtained at the listed revisions.
+func (m *Manifest) checkAssertions(db asserts.RODatabase) error {
+	for _, ma := range m.Assertions {
+		ref := &asserts.Ref{Type: asserts.Type(ma.Type), PrimaryKey: ma.PrimaryKey}
+		a, err := ref.Resolve(db.Find)
+		if err != nil {
+			return fmt.Errorf("cannot reproduce image: cannot obtain assertion %v listed in the manifest", ref)
+		}
+		if a.Revision() != ma.Revision {
+			return fmt.Errorf("cannot reproduce image: obtained assertion %v at revision %d, manifest lists revision %d", ref, a.Revision(), ma.Revision)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/image"
+	"github.com/snapcore/snapd/snap"
+)
+
+type manifestSuite struct{}
+
+var _ = Suite(&manifestSuite{})
+
+func (s *manifestSuite) TestWriteReadManifest(c *C) {
+	fn := filepath.Join(c.MkDir(), "seed.manifest")
+	m := &image.Manifest{
+		Snaps: []*image.ManifestSnap{
+			{Name: "core", Revision: snap.R(3), Sha3_384: "sha3-core", Channel: "stable"},
+			{Name: "local-snap", Revision: snap.R(-1), Sha3_384: "sha3-local"},
+		},
+		Assertions: []*image.ManifestAssertion{
+			{Type: "model", PrimaryKey: []string{"16", "my-brand", "my-model"}, Revision: 2},
+		},
+	}
+	err := m.Write(fn)
+	c.Assert(err, IsNil)
+
+	data, err := ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `snaps:
+- name: core
+  revision: "3"
+  sha3-384: sha3-core
+  channel: stable
+- name: local-snap
+  revision: x1
+  sha3-384: sha3-local
+assertions:
+- type: model
+  primary-key:
+  - "16"
+  - my-brand
+  - my-model
+  revision: 2
+`)
+
+	m2, err := image.ReadManifest(fn)
+	c.Assert(err, IsNil)
+	c.Check(m2, DeepEquals, m)
+	c.Check(m2.Snap("core"), DeepEquals, m.Snaps[0])
+	c.Check(m2.Snap("other"), IsNil)
+}
+
+func (s *manifestSuite) TestReadManifestErrors(c *C) {
+	fn := filepath.Join(c.MkDir(), "seed.manifest")
+
+	_, err := image.ReadManifest(fn)
+	c.Check(err, ErrorMatches, `cannot read manifest: .*`)
+
+	for _, t := range []struct {
+		manifest, err string
+	}{
+		{"snaps: [", `cannot parse manifest .*`},
+		{"snaps:\n- name: core\n  sha3-384: x\n", `invalid manifest .*: snaps need a name, a revision and a sha3-384`},
+		{"snaps:\n- name: core\n  revision: 1\n", `invalid manifest .*: snaps need a name, a revision and a sha3-384`},
+		{"snaps:\n- name: core\n  revision: 1\n  sha3-384: x\n- name: core\n  revision: 2\n  sha3-384: y\n", `invalid manifest .*: snap "core" listed more than once`},
+		{"snaps: []\nassertions:\n- type: foo\n  primary-key: [a]\n  revision: 0\n", `invalid manifest .*: unknown assertion type "foo"`},
+	} {
+		err := ioutil.WriteFile(fn, []byte(t.manifest), 0644)
+		c.Assert(err, IsNil)
+		_, err = image.ReadManifest(fn)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
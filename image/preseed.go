@@ -0,0 +1,118 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// preseedWritablePaths are the writable paths of the image the first
+// boot seeding changes, bind mounted over the core snap to make up
+// the root to preseed in.
+var preseedWritablePaths = []string{
+	"etc/modules-load.d",
+	"etc/systemd/system",
+	"etc/udev/rules.d",
+	"snap",
+	"var/cache/apparmor",
+	"var/lib/snapd",
+	"var/snap",
+}
+
+// preseedHostPaths are bind mounted from the host, for mounting the
+// snaps and compiling their security profiles.
+var preseedHostPaths = []string{"dev", "proc", "sys"}
+
+// preseedImage runs the first boot seeding of the image with its root
+// at rootDir ahead of time. It runs "snap preseed" of the core snap of
+// the image, chrooted into the core snap with the writable paths of
+// the image, so that the snapd, apparmor_parser and policy of the
+// image are used rather than the ones of the host.
+func preseedImage(rootDir string) (err error) {
+	seedDir := filepath.Join(rootDir, "var/lib/snapd/seed")
+	seed, err := snap.ReadSeedYaml(filepath.Join(seedDir, "seed.yaml"))
+	if err != nil {
+		return err
+	}
+	var coreFile string
+	for _, sn := range seed.Snaps {
+		if sn.Name == defaultCore {
+			coreFile = filepath.Join(seedDir, "snaps", sn.File)
+			break
+		}
+	}
+	if coreFile == "" {
+		return fmt.Errorf("cannot preseed: no %q snap in the seed", defaultCore)
+	}
+
+	chrootDir, err := ioutil.TempDir("", "snap-preseed-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(chrootDir)
+
+	var mounted []string
+	defer func() {
+		for i := len(mounted) - 1; i >= 0; i-- {
+			output, uerr := exec.Command("umount", mounted[i]).CombinedOutput()
+			if uerr != nil && err == nil {
+				err = fmt.Errorf("cannot preseed: cannot unmount %q: %v", mounted[i], osutil.OutputErr(output, uerr))
+			}
+		}
+	}()
+	mount := func(args ...string) error {
+		target := args[len(args)-1]
+		if output, err := exec.Command("mount", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("cannot preseed: cannot mount %q: %v", target, osutil.OutputErr(output, err))
+		}
+		mounted = append(mounted, target)
+		return nil
+	}
+
+	if err := mount("-t", "squashfs", "-o", "ro", coreFile, chrootDir); err != nil {
+		return err
+	}
+	for _, p := range preseedWritablePaths {
+		src := filepath.Join(rootDir, p)
+		if err := os.MkdirAll(src, 0755); err != nil {
+			return err
+		}
+		if err := mount("--bind", src, filepath.Join(chrootDir, p)); err != nil {
+			return err
+		}
+	}
+	for _, p := range preseedHostPaths {
+		if err := mount("--bind", "/"+p, filepath.Join(chrootDir, p)); err != nil {
+			return err
+		}
+	}
+
+	if output, err := exec.Command("chroot", chrootDir, "/usr/bin/snap", "preseed").CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot preseed: %v", osutil.OutputErr(output, err))
+	}
+	return nil
+}
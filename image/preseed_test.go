@@ -0,0 +1,119 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/image"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type preseedSuite struct {
+	rootDir string
+}
+
+var _ = Suite(&preseedSuite{})
+
+func (s *preseedSuite) SetUpTest(c *C) {
+	s.rootDir = c.MkDir()
+	seed := &snap.Seed{
+		Snaps: []*snap.SeedSnap{
+			{Name: "ubuntu-core", File: "ubuntu-core_3.snap"},
+			{Name: "pc-kernel", File: "pc-kernel_2.snap"},
+		},
+	}
+	seedDir := filepath.Join(s.rootDir, "var/lib/snapd/seed")
+	c.Assert(os.MkdirAll(seedDir, 0755), IsNil)
+	c.Assert(seed.Write(filepath.Join(seedDir, "seed.yaml")), IsNil)
+}
+
+func (s *preseedSuite) TestPreseedImage(c *C) {
+	mount := testutil.MockCommand(c, "mount", "")
+	defer mount.Restore()
+	umount := testutil.MockCommand(c, "umount", "")
+	defer umount.Restore()
+	chroot := testutil.MockCommand(c, "chroot", "")
+	defer chroot.Restore()
+
+	err := image.PreseedImage(s.rootDir)
+	c.Assert(err, IsNil)
+
+	calls := mount.Calls()
+	c.Assert(calls, HasLen, 11)
+	chrootDir := calls[0][len(calls[0])-1]
+	c.Check(calls, DeepEquals, [][]string{
+		{"mount", "-t", "squashfs", "-o", "ro", filepath.Join(s.rootDir, "var/lib/snapd/seed/snaps/ubuntu-core_3.snap"), chrootDir},
+		{"mount", "--bind", filepath.Join(s.rootDir, "etc/modules-load.d"), filepath.Join(chrootDir, "etc/modules-load.d")},
+		{"mount", "--bind", filepath.Join(s.rootDir, "etc/systemd/system"), filepath.Join(chrootDir, "etc/systemd/system")},
+		{"mount", "--bind", filepath.Join(s.rootDir, "etc/udev/rules.d"), filepath.Join(chrootDir, "etc/udev/rules.d")},
+		{"mount", "--bind", filepath.Join(s.rootDir, "snap"), filepath.Join(chrootDir, "snap")},
+		{"mount", "--bind", filepath.Join(s.rootDir, "var/cache/apparmor"), filepath.Join(chrootDir, "var/cache/apparmor")},
+		{"mount", "--bind", filepath.Join(s.rootDir, "var/lib/snapd"), filepath.Join(chrootDir, "var/lib/snapd")},
+		{"mount", "--bind", filepath.Join(s.rootDir, "var/snap"), filepath.Join(chrootDir, "var/snap")},
+		{"mount", "--bind", "/dev", filepath.Join(chrootDir, "dev")},
+		{"mount", "--bind", "/proc", filepath.Join(chrootDir, "proc")},
+		{"mount", "--bind", "/sys", filepath.Join(chrootDir, "sys")},
+	})
+	c.Check(chroot.Calls(), DeepEquals, [][]string{
+		{"chroot", chrootDir, "/usr/bin/snap", "preseed"},
+	})
+
+	// everything is unmounted again, in reverse order
+	var unmounted [][]string
+	for i := len(calls) - 1; i >= 0; i-- {
+		unmounted = append(unmounted, []string{"umount", calls[i][len(calls[i])-1]})
+	}
+	c.Check(umount.Calls(), DeepEquals, unmounted)
+	c.Check(osutil.FileExists(chrootDir), Equals, false)
+	// the writable paths of the image were created
+	c.Check(osutil.IsDirectory(filepath.Join(s.rootDir, "var/cache/apparmor")), Equals, true)
+}
+
+func (s *preseedSuite) TestPreseedImageFailure(c *C) {
+	mount := testutil.MockCommand(c, "mount", "")
+	defer mount.Restore()
+	umount := testutil.MockCommand(c, "umount", "")
+	defer umount.Restore()
+	chroot := testutil.MockCommand(c, "chroot", "echo 'error: unknown command'; exit 1")
+	defer chroot.Restore()
+
+	err := image.PreseedImage(s.rootDir)
+	c.Assert(err, ErrorMatches, `cannot preseed: error: unknown command`)
+	// everything is unmounted nevertheless
+	c.Check(umount.Calls(), HasLen, len(mount.Calls()))
+}
+
+func (s *preseedSuite) TestPreseedImageNoCore(c *C) {
+	seed := &snap.Seed{
+		Snaps: []*snap.SeedSnap{
+			{Name: "pc-kernel", File: "pc-kernel_2.snap"},
+		},
+	}
+	c.Assert(seed.Write(filepath.Join(s.rootDir, "var/lib/snapd/seed/seed.yaml")), IsNil)
+
+	err := image.PreseedImage(s.rootDir)
+	c.Assert(err, ErrorMatches, `cannot preseed: no "ubuntu-core" snap in the seed`)
+}
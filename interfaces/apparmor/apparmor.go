@@ -34,16 +34,22 @@ import (
 	"strings"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/release"
 )
 
 // LoadProfile loads an apparmor profile from the given file.
 //
 // If no such profile was previously loaded then it is simply added to the kernel.
 // If there was a profile with the same name before, that profile is replaced.
+// While preseeding an image the profile is only compiled into the cache.
 func LoadProfile(fname string) error {
+	load := "--replace"
+	if release.Preseeding {
+		load = "--skip-kernel-load"
+	}
 	// Use no-expr-simplify since expr-simplify is actually slower on armhf (LP: #1383858)
 	output, err := exec.Command(
-		"apparmor_parser", "--replace", "--write-cache", "-O",
+		"apparmor_parser", load, "--write-cache", "-O",
 		"no-expr-simplify", fmt.Sprintf("--cache-loc=%s", dirs.AppArmorCacheDir),
 		fname).CombinedOutput()
 	if err != nil {
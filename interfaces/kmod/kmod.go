@@ -24,6 +24,7 @@ import (
 	"os/exec"
 
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/release"
 )
 
 func LoadModule(module string) error {
@@ -35,7 +36,12 @@ func LoadModule(module string) error {
 
 // loadModules loads given list of modules via modprobe.
 // Any error from modprobe interrupts loading of subsequent modules and returns the error.
+// Nothing is loaded while preseeding an image, the modules are loaded
+// from /etc/modules-load.d when the image boots.
 func loadModules(modules []string) error {
+	if release.Preseeding {
+		return nil
+	}
 	for _, mod := range modules {
 		if err := LoadModule(mod); err != nil {
 			return err
@@ -22,13 +22,21 @@ package udev
 import (
 	"fmt"
 	"os/exec"
+
+	"github.com/snapcore/snapd/release"
 )
 
 // ReloadRules runs two commands that reload udev rule database.
 //
 // The commands are: udevadm control --reload-rules
 //                   udevadm trigger
+//
+// Nothing is reloaded while preseeding an image, udev reads the rules
+// when the image boots.
 func ReloadRules() error {
+	if release.Preseeding {
+		return nil
+	}
 	output, err := exec.Command("udevadm", "control", "--reload-rules").CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("cannot reload udev rules: %s\nudev output:\n%s", err, string(output))
@@ -0,0 +1,203 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+)
+
+// accountKeysRefreshInterval is how often the account-keys that signed
+// the assertions of the installed snaps are refetched.
+const accountKeysRefreshInterval = 24 * time.Hour
+
+var timeNow = time.Now
+
+// installedSnapAssertions returns the snap-revision and
+// snap-declaration assertions present in the system database for the
+// current revisions of the installed snaps, by snap name.
+func installedSnapAssertions(s *state.State) (map[string][]asserts.Assertion, error) {
+	snapStates, err := snapstate.All(s)
+	if err != nil {
+		return nil, err
+	}
+	db := DB(s)
+	res := make(map[string][]asserts.Assertion)
+	for name, snapst := range snapStates {
+		si := snapst.CurrentSideInfo()
+		if si == nil || si.SnapID == "" {
+			continue
+		}
+		snapRevs, err := db.FindMany(asserts.SnapRevisionType, map[string]string{
+			"snap-id":       si.SnapID,
+			"snap-revision": si.Revision.String(),
+		})
+		if err == asserts.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[name] = append(res[name], snapRevs[0])
+		snapDecl, err := db.Find(asserts.SnapDeclarationType, map[string]string{
+			"series":  release.Series,
+			"snap-id": si.SnapID,
+		})
+		if err == nil {
+			res[name] = append(res[name], snapDecl)
+		} else if err != asserts.ErrNotFound {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// RefreshAccountKeys refetches the account-key assertions for the keys
+// that signed the snap-revision and snap-declaration assertions of the
+// installed snaps, picking up their new revisions, revocations included.
+func RefreshAccountKeys(s *state.State, userID int) error {
+	installed, err := installedSnapAssertions(s)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var keyIDs []string
+	for _, as := range installed {
+		for _, a := range as {
+			if keyID := a.SignKeyID(); !seen[keyID] {
+				seen[keyID] = true
+				keyIDs = append(keyIDs, keyID)
+			}
+		}
+	}
+	if len(keyIDs) == 0 {
+		return nil
+	}
+	sort.Strings(keyIDs)
+
+	fetching := func(f asserts.Fetcher) error {
+		for _, keyID := range keyIDs {
+			ref := &asserts.Ref{
+				Type:       asserts.AccountKeyType,
+				PrimaryKey: []string{keyID},
+			}
+			if err := f.Fetch(ref); err != nil {
+				return fmt.Errorf("cannot refresh account-key %q: %v", keyID, err)
+			}
+		}
+		return nil
+	}
+	return doFetch(s, userID, fetching)
+}
+
+// RevokedSnaps returns the names of the installed snaps whose current
+// revision assertions were signed with a key that has since been revoked.
+func RevokedSnaps(s *state.State) ([]string, error) {
+	installed, err := installedSnapAssertions(s)
+	if err != nil {
+		return nil, err
+	}
+	db := DB(s)
+	var revoked []string
+	for name, as := range installed {
+		for _, a := range as {
+			if err := snapasserts.CheckSigningKeyNotRevoked(a, db); err != nil {
+				revoked = append(revoked, name)
+				break
+			}
+		}
+	}
+	sort.Strings(revoked)
+	return revoked, nil
+}
+
+// ensureAccountKeysRefreshed sets up a change to refetch the account-keys
+// used by the installed snaps if the last refresh is old enough.
+func (m *AssertManager) ensureAccountKeysRefreshed() error {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	var last time.Time
+	err := m.state.Get("last-account-keys-refresh", &last)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	now := timeNow()
+	if now.Sub(last) < accountKeysRefreshInterval {
+		return nil
+	}
+
+	for _, chg := range m.state.Changes() {
+		if chg.Kind() == "refresh-account-keys" && !chg.Status().Ready() {
+			// change already in motion
+			return nil
+		}
+	}
+
+	installed, err := installedSnapAssertions(m.state)
+	if err != nil {
+		return err
+	}
+	if len(installed) == 0 {
+		// nothing signed to check
+		return nil
+	}
+
+	m.state.Set("last-account-keys-refresh", now)
+
+	t := m.state.NewTask("refresh-account-keys", i18n.G("Refresh the account-keys that signed the installed snaps"))
+	chg := m.state.NewChange("refresh-account-keys", i18n.G("Check signing keys of installed snaps"))
+	chg.AddTask(t)
+
+	return nil
+}
+
+// doRefreshAccountKeys refetches the account-keys used by the installed
+// snaps and flags the snaps signed with revoked keys.
+func doRefreshAccountKeys(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if err := RefreshAccountKeys(st, 0); err != nil {
+		return err
+	}
+
+	revoked, err := RevokedSnaps(st)
+	if err != nil {
+		return err
+	}
+	for _, name := range revoked {
+		t.Errorf("snap %q current revision is signed with a revoked key", name)
+		logger.Noticef("Snap %q current revision is signed with a revoked key.", name)
+	}
+	return nil
+}
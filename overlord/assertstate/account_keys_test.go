@@ -0,0 +1,162 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// installSignedSnap sets up foo at revision 10 as installed with its
+// snap assertions in the system database.
+func (s *assertMgrSuite) installSignedSnap(c *C) {
+	s.prereqSnapAssertions(c, 10)
+
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "snap-id-1", Revision: snap.R(10)},
+		},
+		Current: snap.R(10),
+	})
+
+	err := assertstate.DoFetch(s.state, 0, func(f asserts.Fetcher) error {
+		return f.Fetch(&asserts.Ref{
+			Type:       asserts.SnapRevisionType,
+			PrimaryKey: []string{makeDigest(10)},
+		})
+	})
+	c.Assert(err, IsNil)
+}
+
+// revokeStoreKey makes the store offer a revision of the store
+// account-key revoked as of when it started being valid.
+func (s *assertMgrSuite) revokeStoreKey(c *C) {
+	storeKey := s.storeSigning.StoreAccountKey("")
+	pubKey, err := s.storeSigning.PublicKey("")
+	c.Assert(err, IsNil)
+	since := storeKey.Since().Format(time.RFC3339)
+	revoked := assertstest.NewAccountKey(s.storeSigning.RootSigning, s.storeSigning.TrustedAccount, map[string]interface{}{
+		"name":     "store",
+		"since":    since,
+		"until":    since,
+		"revision": "1",
+	}, pubKey, "")
+	err = s.storeSigning.Add(revoked)
+	c.Assert(err, IsNil)
+}
+
+func (s *assertMgrSuite) TestRefreshAccountKeys(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.installSignedSnap(c)
+
+	revoked, err := assertstate.RevokedSnaps(s.state)
+	c.Assert(err, IsNil)
+	c.Check(revoked, HasLen, 0)
+
+	s.revokeStoreKey(c)
+
+	// not known yet
+	revoked, err = assertstate.RevokedSnaps(s.state)
+	c.Assert(err, IsNil)
+	c.Check(revoked, HasLen, 0)
+
+	err = assertstate.RefreshAccountKeys(s.state, 0)
+	c.Assert(err, IsNil)
+
+	a, err := assertstate.DB(s.state).Find(asserts.AccountKeyType, map[string]string{
+		"public-key-sha3-384": s.storeSigning.KeyID,
+	})
+	c.Assert(err, IsNil)
+	c.Check(a.Revision(), Equals, 1)
+
+	revoked, err = assertstate.RevokedSnaps(s.state)
+	c.Assert(err, IsNil)
+	c.Check(revoked, DeepEquals, []string{"foo"})
+}
+
+func (s *assertMgrSuite) TestRefreshAccountKeysNothingInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := assertstate.RefreshAccountKeys(s.state, 0)
+	c.Assert(err, IsNil)
+}
+
+func (s *assertMgrSuite) TestEnsureRefreshesAccountKeys(c *C) {
+	now := time.Now()
+	restore := assertstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	s.installSignedSnap(c)
+	s.revokeStoreKey(c)
+	s.state.Unlock()
+
+	defer s.mgr.Stop()
+	s.settle()
+
+	s.state.Lock()
+	changes := s.state.Changes()
+	c.Assert(changes, HasLen, 1)
+	chg := changes[0]
+	c.Check(chg.Kind(), Equals, "refresh-account-keys")
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	c.Assert(chg.Tasks(), HasLen, 1)
+	c.Check(chg.Tasks()[0].Log(), HasLen, 1)
+	c.Check(chg.Tasks()[0].Log()[0], Matches, `.* ERROR snap "foo" current revision is signed with a revoked key`)
+
+	var last time.Time
+	c.Assert(s.state.Get("last-account-keys-refresh", &last), IsNil)
+	c.Check(last.Equal(now), Equals, true)
+	s.state.Unlock()
+
+	// not again until a day passed
+	now = now.Add(23 * time.Hour)
+	s.settle()
+	s.state.Lock()
+	c.Check(s.state.Changes(), HasLen, 1)
+	s.state.Unlock()
+
+	now = now.Add(2 * time.Hour)
+	s.settle()
+	s.state.Lock()
+	c.Check(s.state.Changes(), HasLen, 2)
+	s.state.Unlock()
+}
+
+func (s *assertMgrSuite) TestEnsureAccountKeysNothingInstalled(c *C) {
+	defer s.mgr.Stop()
+	s.settle()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(s.state.Changes(), HasLen, 0)
+}
@@ -45,6 +45,7 @@ import (
 // nothing in it violates existing assertions, or misses required
 // ones.
 type AssertManager struct {
+	state  *state.State
 	runner *state.TaskRunner
 }
 
@@ -53,6 +54,7 @@ func Manager(s *state.State) (*AssertManager, error) {
 	runner := state.NewTaskRunner(s)
 
 	runner.AddHandler("validate-snap", doValidateSnap, nil)
+	runner.AddHandler("refresh-account-keys", doRefreshAccountKeys, nil)
 
 	db, err := sysdb.Open()
 	if err != nil {
@@ -63,11 +65,14 @@ func Manager(s *state.State) (*AssertManager, error) {
 	ReplaceDB(s, db)
 	s.Unlock()
 
-	return &AssertManager{runner: runner}, nil
+	return &AssertManager{state: s, runner: runner}, nil
 }
 
 // Ensure implements StateManager.Ensure.
 func (m *AssertManager) Ensure() error {
+	if err := m.ensureAccountKeysRefreshed(); err != nil {
+		return err
+	}
 	m.runner.Ensure()
 	return nil
 }
@@ -112,6 +117,8 @@ func Add(s *state.State, a asserts.Assertion) error {
 type Batch struct {
 	bs   asserts.Backstore
 	refs []*asserts.Ref
+
+	committed []*asserts.Ref
 }
 
 // NewBatch creates a new Batch to accumulate assertions to add in one go to the system assertion database.
@@ -189,7 +196,19 @@ func (b *Batch) Commit(st *state.State) error {
 	// TODO: trigger w. caller a global sanity check if something is revoked
 	// (but try to save as much possible still),
 	// or err is a check error
-	return f.commit()
+	added, err := f.commit()
+	b.committed = make([]*asserts.Ref, len(added))
+	for i, a := range added {
+		b.committed[i] = a.Ref()
+	}
+	return err
+}
+
+// Committed returns references to the assertions that the last Commit
+// effectively added to the system assertion database, prerequisites
+// included, in the order they were added.
+func (b *Batch) Committed() []*asserts.Ref {
+	return b.committed
 }
 
 // TODO: snapstate also has this, move to auth, or change a bit the approach now that we have AuthContext in the store?
@@ -235,8 +254,10 @@ func (e *commitError) Error() string {
 }
 
 // commit does a best effort of adding all the fetched assertions to the system database.
-func (f *fetcher) commit() error {
+// It returns the assertions that were effectively added.
+func (f *fetcher) commit() ([]asserts.Assertion, error) {
 	var errs []error
+	var added []asserts.Assertion
 	for _, a := range f.fetched {
 		err := f.db.Add(a)
 		if revErr, ok := err.(*asserts.RevisionError); ok {
@@ -248,12 +269,14 @@ func (f *fetcher) commit() error {
 		}
 		if err != nil {
 			errs = append(errs, err)
+			continue
 		}
+		added = append(added, a)
 	}
 	if len(errs) != 0 {
-		return &commitError{errs: errs}
+		return added, &commitError{errs: errs}
 	}
-	return nil
+	return added, nil
 }
 
 func doFetch(s *state.State, userID int, fetching func(asserts.Fetcher) error) error {
@@ -283,7 +306,8 @@ func doFetch(s *state.State, userID int, fetching func(asserts.Fetcher) error) e
 	// TODO: trigger w. caller a global sanity check if a is revoked
 	// (but try to save as much possible still),
 	// or err is a check error
-	return f.commit()
+	_, err = f.commit()
+	return err
 }
 
 // doValidateSnap fetches the relevant assertions for the snap being installed and cross checks them with the snap.
@@ -469,4 +493,6 @@ func ValidateRefreshes(s *state.State, snapInfos []*snap.Info, userID int) (vali
 func init() {
 	// hook validation of refreshes into snapstate logic
 	snapstate.ValidateRefreshes = ValidateRefreshes
+	// hook enforcing of validation sets into snapstate logic
+	snapstate.EnforcedValidationSets = EnforcedValidationSets
 }
@@ -86,10 +86,14 @@ func (*fakeStore) Snap(string, string, bool, snap.Revision, *auth.UserState) (*s
 	panic("fakeStore.Snap not expected")
 }
 
-func (sto *fakeStore) Find(*store.Search, *auth.UserState) ([]*snap.Info, error) {
+func (sto *fakeStore) Find(*store.Search, *auth.UserState) ([]*snap.Info, *store.Paging, error) {
 	panic("fakeStore.Find not expected")
 }
 
+func (sto *fakeStore) Sections(*auth.UserState) ([]string, error) {
+	panic("fakeStore.Sections not expected")
+}
+
 func (sto *fakeStore) ListRefresh([]*store.RefreshCandidate, *auth.UserState) ([]*snap.Info, error) {
 	panic("fakeStore.ListRefresh not expected")
 }
@@ -98,6 +102,10 @@ func (sto *fakeStore) Download(string, *snap.DownloadInfo, progress.Meter, *auth
 	panic("fakeStore.Download not expected")
 }
 
+func (sto *fakeStore) SetDownloadRateLimit(int64) {
+	panic("fakeStore.SetDownloadRateLimit not expected")
+}
+
 func (sto *fakeStore) SuggestedCurrency() string {
 	panic("fakeStore.SuggestedCurrency not expected")
 }
@@ -270,6 +278,36 @@ func (s *assertMgrSuite) TestBatchAddStreamReturnsEffectivelyAddedRefs(c *C) {
 	c.Check(devAcct.(*asserts.Account).Username(), Equals, "developer1")
 }
 
+func (s *assertMgrSuite) TestBatchCommitted(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// prereq store key
+	err := assertstate.Add(s.state, s.storeSigning.StoreAccountKey(""))
+	c.Assert(err, IsNil)
+
+	batch := assertstate.NewBatch()
+	err = batch.Add(s.dev1Acct)
+	c.Assert(err, IsNil)
+	err = batch.Add(s.storeSigning.StoreAccountKey(""))
+	c.Assert(err, IsNil)
+
+	err = batch.Commit(s.state)
+	c.Assert(err, IsNil)
+	// the store key was already there
+	c.Check(batch.Committed(), DeepEquals, []*asserts.Ref{
+		{Type: asserts.AccountType, PrimaryKey: []string{s.dev1Acct.AccountID()}},
+	})
+
+	// nothing new the second time
+	batch = assertstate.NewBatch()
+	err = batch.Add(s.dev1Acct)
+	c.Assert(err, IsNil)
+	err = batch.Commit(s.state)
+	c.Assert(err, IsNil)
+	c.Check(batch.Committed(), HasLen, 0)
+}
+
 func fakeSnap(rev int) []byte {
 	fake := fmt.Sprintf("hsqs________________%d", rev)
 	return []byte(fake)
@@ -19,7 +19,20 @@
 
 package assertstate
 
+import (
+	"time"
+)
+
 // expose for testing
 var (
 	DoFetch = doFetch
 )
+
+// MockTimeNow mocks the current time used by the manager.
+func MockTimeNow(now func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = now
+	return func() {
+		timeNow = old
+	}
+}
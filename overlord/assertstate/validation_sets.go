@@ -0,0 +1,245 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+)
+
+// ValidationSetMode is the mode a validation set is tracked in.
+type ValidationSetMode string
+
+const (
+	// MonitorMode only reports whether the system satisfies the set.
+	MonitorMode ValidationSetMode = "monitor"
+	// EnforceMode refuses changes to snaps that would break the set.
+	EnforceMode ValidationSetMode = "enforce"
+)
+
+// ValidationSetTracking holds how a validation set is tracked on the system.
+type ValidationSetTracking struct {
+	AccountID string            `json:"account-id"`
+	Name      string            `json:"name"`
+	Mode      ValidationSetMode `json:"mode"`
+	// PinnedAt is the sequence the set was explicitly pinned to, 0
+	// if the latest known sequence was picked.
+	PinnedAt int `json:"pinned-at,omitempty"`
+	// Current is the sequence of the set in use.
+	Current int `json:"current"`
+}
+
+// Key returns the account-id/name key of the tracked validation set.
+func (vst *ValidationSetTracking) Key() string {
+	return snapasserts.ValidationSetKey(vst.AccountID, vst.Name)
+}
+
+// ValidationSets returns the validation sets tracked on the system,
+// indexed by their account-id/name keys.
+func ValidationSets(st *state.State) (map[string]*ValidationSetTracking, error) {
+	var vsets map[string]*ValidationSetTracking
+	err := st.Get("validation-sets", &vsets)
+	if err == state.ErrNoState {
+		return make(map[string]*ValidationSetTracking), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vsets, nil
+}
+
+// ValidationSetAssertion returns the validation-set assertion in use
+// for the tracked validation set.
+func ValidationSetAssertion(st *state.State, vst *ValidationSetTracking) (*asserts.ValidationSet, error) {
+	a, err := DB(st).Find(asserts.ValidationSetType, map[string]string{
+		"series":     release.Series,
+		"account-id": vst.AccountID,
+		"name":       vst.Name,
+		"sequence":   strconv.Itoa(vst.Current),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find validation set %s at sequence %d: %v", vst.Key(), vst.Current, err)
+	}
+	return a.(*asserts.ValidationSet), nil
+}
+
+// EnforcedValidationSets returns the assertions of the validation sets
+// tracked in enforce mode.
+func EnforcedValidationSets(st *state.State) ([]*asserts.ValidationSet, error) {
+	vsets, err := ValidationSets(st)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(vsets))
+	for key, vst := range vsets {
+		if vst.Mode == EnforceMode {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	enforced := make([]*asserts.ValidationSet, len(keys))
+	for i, key := range keys {
+		enforced[i], err = ValidationSetAssertion(st, vsets[key])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return enforced, nil
+}
+
+// InstalledSnaps returns the current revisions of the installed snaps
+// by name, as needed to check them against validation sets.
+func InstalledSnaps(st *state.State) (map[string]snap.Revision, error) {
+	snapStates, err := snapstate.All(st)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]snap.Revision, len(snapStates))
+	for name, snapst := range snapStates {
+		installed[name] = snapst.Current
+	}
+	return installed, nil
+}
+
+func latestValidationSet(st *state.State, accountID, name string) (*asserts.ValidationSet, error) {
+	as, err := DB(st).FindMany(asserts.ValidationSetType, map[string]string{
+		"series":     release.Series,
+		"account-id": accountID,
+		"name":       name,
+	})
+	if err == asserts.ErrNotFound {
+		return nil, fmt.Errorf("cannot find validation set %s in the system, specify its sequence to fetch it", snapasserts.ValidationSetKey(accountID, name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var latest *asserts.ValidationSet
+	for _, a := range as {
+		vs := a.(*asserts.ValidationSet)
+		if latest == nil || vs.Sequence() > latest.Sequence() {
+			latest = vs
+		}
+	}
+	return latest, nil
+}
+
+func fetchValidationSet(st *state.State, accountID, name string, sequence int, userID int) (*asserts.ValidationSet, error) {
+	ref := &asserts.Ref{
+		Type:       asserts.ValidationSetType,
+		PrimaryKey: []string{release.Series, accountID, name, strconv.Itoa(sequence)},
+	}
+	a, err := ref.Resolve(DB(st).Find)
+	if err == asserts.ErrNotFound {
+		err = doFetch(st, userID, func(f asserts.Fetcher) error {
+			return f.Fetch(ref)
+		})
+		if err != nil {
+			return nil, err
+		}
+		a, err = ref.Resolve(DB(st).Find)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.(*asserts.ValidationSet), nil
+}
+
+// ApplyValidationSet starts tracking the given validation set in the
+// given mode, or changes how it is tracked. A sequence of 0 picks the
+// latest sequence known to the system, otherwise the assertion is
+// fetched if needed. Enforcing a set the installed snaps do not
+// satisfy fails.
+func ApplyValidationSet(st *state.State, accountID, name string, sequence int, mode ValidationSetMode, userID int) (*ValidationSetTracking, error) {
+	if mode != MonitorMode && mode != EnforceMode {
+		return nil, fmt.Errorf("internal error: unknown validation set mode %q", mode)
+	}
+
+	var vs *asserts.ValidationSet
+	var err error
+	if sequence > 0 {
+		vs, err = fetchValidationSet(st, accountID, name, sequence, userID)
+	} else {
+		vs, err = latestValidationSet(st, accountID, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vst := &ValidationSetTracking{
+		AccountID: accountID,
+		Name:      name,
+		Mode:      mode,
+		PinnedAt:  sequence,
+		Current:   vs.Sequence(),
+	}
+
+	vsets, err := ValidationSets(st)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == EnforceMode {
+		enforced, err := EnforcedValidationSets(st)
+		if err != nil {
+			return nil, err
+		}
+		toCheck := []*asserts.ValidationSet{vs}
+		for _, other := range enforced {
+			if other.AccountID() != accountID || other.Name() != name {
+				toCheck = append(toCheck, other)
+			}
+		}
+		installed, err := InstalledSnaps(st)
+		if err != nil {
+			return nil, err
+		}
+		if err := snapasserts.CheckInstalledSnaps(toCheck, installed); err != nil {
+			return nil, fmt.Errorf("cannot enforce validation set %s: %v", vst.Key(), err)
+		}
+	}
+
+	vsets[vst.Key()] = vst
+	st.Set("validation-sets", vsets)
+	return vst, nil
+}
+
+// ForgetValidationSet stops tracking the given validation set.
+func ForgetValidationSet(st *state.State, accountID, name string) error {
+	vsets, err := ValidationSets(st)
+	if err != nil {
+		return err
+	}
+	key := snapasserts.ValidationSetKey(accountID, name)
+	if _, ok := vsets[key]; !ok {
+		return fmt.Errorf("validation set %s is not tracked", key)
+	}
+	delete(vsets, key)
+	st.Set("validation-sets", vsets)
+	return nil
+}
@@ -0,0 +1,198 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate_test
+
+import (
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *assertMgrSuite) validationSet(c *C, sequence int, snaps ...interface{}) *asserts.ValidationSet {
+	a, err := s.dev1Signing.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"series":     "16",
+		"account-id": s.dev1Acct.AccountID(),
+		"name":       "base-set",
+		"sequence":   strconv.Itoa(sequence),
+		"snaps":      snaps,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.storeSigning.Add(a)
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *assertMgrSuite) installSnap(name string, revno int) {
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: name, Revision: snap.R(revno)},
+		},
+		Current: snap.R(revno),
+	})
+}
+
+func (s *assertMgrSuite) TestValidationSetsNone(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	vsets, err := assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, HasLen, 0)
+
+	enforced, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(enforced, HasLen, 0)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetMonitorFetches(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.validationSet(c, 2, map[string]interface{}{
+		"name": "foo",
+		"id":   "foo-id",
+	})
+
+	// not satisfied, but only monitored
+	vst, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "base-set", 2, assertstate.MonitorMode, 0)
+	c.Assert(err, IsNil)
+	c.Check(vst, DeepEquals, &assertstate.ValidationSetTracking{
+		AccountID: s.dev1Acct.AccountID(),
+		Name:      "base-set",
+		Mode:      assertstate.MonitorMode,
+		PinnedAt:  2,
+		Current:   2,
+	})
+
+	vsets, err := assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, DeepEquals, map[string]*assertstate.ValidationSetTracking{
+		s.dev1Acct.AccountID() + "/base-set": vst,
+	})
+
+	// the assertion was fetched
+	vs, err := assertstate.ValidationSetAssertion(s.state, vst)
+	c.Assert(err, IsNil)
+	c.Check(vs.Sequence(), Equals, 2)
+
+	enforced, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(enforced, HasLen, 0)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetLatest(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "base-set", 0, assertstate.MonitorMode, 0)
+	c.Assert(err, ErrorMatches, `cannot find validation set .*/base-set in the system, specify its sequence to fetch it`)
+
+	var vsets []*asserts.ValidationSet
+	for i := 1; i <= 3; i++ {
+		vsets = append(vsets, s.validationSet(c, i, map[string]interface{}{
+			"name": "foo",
+			"id":   "foo-id",
+		}))
+	}
+	// fetch the first one with its prerequisites
+	_, err = assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "base-set", 1, assertstate.MonitorMode, 0)
+	c.Assert(err, IsNil)
+	// acknowledge the last one
+	c.Assert(assertstate.Add(s.state, vsets[2]), IsNil)
+
+	vst, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "base-set", 0, assertstate.MonitorMode, 0)
+	c.Assert(err, IsNil)
+	c.Check(vst.PinnedAt, Equals, 0)
+	c.Check(vst.Current, Equals, 3)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetEnforce(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.validationSet(c, 1, map[string]interface{}{
+		"name":     "foo",
+		"id":       "foo-id",
+		"revision": "3",
+	}, map[string]interface{}{
+		"name":     "bar",
+		"id":       "bar-id",
+		"presence": "invalid",
+	})
+
+	s.installSnap("foo", 2)
+	s.installSnap("bar", 1)
+
+	_, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "base-set", 1, assertstate.EnforceMode, 0)
+	c.Assert(err, ErrorMatches, `cannot enforce validation set .*/base-set: validation sets are not satisfied:
+- invalid snaps: bar \(.*/base-set\)
+- snaps at the wrong revision: foo \(.*/base-set\)`)
+
+	vsets, err := assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, HasLen, 0)
+
+	snapstate.Set(s.state, "bar", nil)
+	s.installSnap("foo", 3)
+
+	vst, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "base-set", 1, assertstate.EnforceMode, 0)
+	c.Assert(err, IsNil)
+	c.Check(vst.Mode, Equals, assertstate.EnforceMode)
+
+	enforced, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Assert(enforced, HasLen, 1)
+	c.Check(enforced[0].Name(), Equals, "base-set")
+
+	// hooked into snapstate
+	_, err = snapstate.Remove(s.state, "foo", snap.R(0))
+	c.Check(err, ErrorMatches, `snap "foo" is required by validation sets: .*/base-set`)
+}
+
+func (s *assertMgrSuite) TestForgetValidationSet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := assertstate.ForgetValidationSet(s.state, s.dev1Acct.AccountID(), "base-set")
+	c.Assert(err, ErrorMatches, `validation set .*/base-set is not tracked`)
+
+	s.validationSet(c, 1, map[string]interface{}{
+		"name": "foo",
+		"id":   "foo-id",
+	})
+	s.installSnap("foo", 1)
+	_, err = assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "base-set", 1, assertstate.EnforceMode, 0)
+	c.Assert(err, IsNil)
+
+	err = assertstate.ForgetValidationSet(s.state, s.dev1Acct.AccountID(), "base-set")
+	c.Assert(err, IsNil)
+
+	vsets, err := assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsets, HasLen, 0)
+}
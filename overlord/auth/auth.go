@@ -22,6 +22,7 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"sort"
 
@@ -222,6 +223,9 @@ type DeviceAssertions interface {
 
 	// DeviceSessionRequest produces a device-session-request with the given nonce, it also returns the device serial assertion.
 	DeviceSessionRequest(nonce string) (*asserts.DeviceSessionRequest, *asserts.Serial, error)
+
+	// ProxyStore returns the store assertion for the store the device model points to.
+	ProxyStore() (*asserts.Store, error)
 }
 
 var (
@@ -239,6 +243,10 @@ type AuthContext interface {
 
 	StoreID(fallback string) (string, error)
 
+	StoreURL(defaultURL *url.URL) (*url.URL, error)
+
+	FriendlyStores() ([]string, error)
+
 	DeviceSessionRequest(nonce string) (devSessionRequest []byte, serial []byte, err error)
 }
 
@@ -325,6 +333,45 @@ func (ac *authContext) StoreID(fallback string) (string, error) {
 	return fallback, nil
 }
 
+// StoreURL returns the URL of the store API according to the store
+// assertion for the store of the device model or the default one if
+// there is none (yet) or it does not set one.
+func (ac *authContext) StoreURL(defaultURL *url.URL) (*url.URL, error) {
+	// an explicitly chosen store overrides the one of the model
+	if ac.deviceAsserts == nil || os.Getenv("UBUNTU_STORE_ID") != "" {
+		return defaultURL, nil
+	}
+	store, err := ac.deviceAsserts.ProxyStore()
+	if err == state.ErrNoState {
+		return defaultURL, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if store.URL() == nil {
+		return defaultURL, nil
+	}
+	return store.URL(), nil
+}
+
+// FriendlyStores returns the ids of the stores the store of the device
+// model can fall back to for snaps it does not have itself, according
+// to its store assertion.
+func (ac *authContext) FriendlyStores() ([]string, error) {
+	// an explicitly chosen store overrides the one of the model
+	if ac.deviceAsserts == nil || os.Getenv("UBUNTU_STORE_ID") != "" {
+		return nil, nil
+	}
+	store, err := ac.deviceAsserts.ProxyStore()
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store.FriendlyStores(), nil
+}
+
 // DeviceSessionRequest produces a device-session-request with the given nonce, it also returns the encoded device serial assertion. It returns ErrNoSerial if the device serial is not yet initialized.
 func (ac *authContext) DeviceSessionRequest(nonce string) (deviceSessionRequest []byte, serial []byte, err error) {
 	if ac.deviceAsserts == nil {
@@ -20,6 +20,7 @@
 package auth_test
 
 import (
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -488,11 +489,24 @@ nonce: @NONCE@
 timestamp: @TS@
 sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij
 
+AXNpZw=`
+
+	exStore = `type: store
+authority-id: canonical
+store: my-brand-store-id
+operator-id: my-brand
+url: https://my-brand-store.example.com/
+friendly-stores:
+  - other-store-id
+timestamp: 2016-08-20T13:00:00Z
+sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij
+
 AXNpZw=`
 )
 
 type testDeviceAssertions struct {
 	nothing bool
+	noStore bool
 }
 
 func (da *testDeviceAssertions) Model() (*asserts.Model, error) {
@@ -535,6 +549,17 @@ func (da *testDeviceAssertions) DeviceSessionRequest(nonce string) (*asserts.Dev
 	return a1.(*asserts.DeviceSessionRequest), a2.(*asserts.Serial), nil
 }
 
+func (da *testDeviceAssertions) ProxyStore() (*asserts.Store, error) {
+	if da.nothing || da.noStore {
+		return nil, state.ErrNoState
+	}
+	a, err := asserts.Decode([]byte(exStore))
+	if err != nil {
+		return nil, err
+	}
+	return a.(*asserts.Store), nil
+}
+
 func (as *authSuite) TestAuthContextMissingDeviceAssertions(c *C) {
 	// no assertions in state
 	authContext := auth.NewAuthContext(as.state, &testDeviceAssertions{nothing: true})
@@ -545,6 +570,15 @@ func (as *authSuite) TestAuthContextMissingDeviceAssertions(c *C) {
 	storeID, err := authContext.StoreID("fallback")
 	c.Assert(err, IsNil)
 	c.Check(storeID, Equals, "fallback")
+
+	defaultURL, _ := url.Parse("https://default.example.com/")
+	storeURL, err := authContext.StoreURL(defaultURL)
+	c.Assert(err, IsNil)
+	c.Check(storeURL, Equals, defaultURL)
+
+	friendly, err := authContext.FriendlyStores()
+	c.Assert(err, IsNil)
+	c.Check(friendly, HasLen, 0)
 }
 
 func (as *authSuite) TestAuthContextWithDeviceAssertions(c *C) {
@@ -561,3 +595,42 @@ func (as *authSuite) TestAuthContextWithDeviceAssertions(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(storeID, Equals, "my-brand-store-id")
 }
+
+func (as *authSuite) TestAuthContextStoreURL(c *C) {
+	defaultURL, _ := url.Parse("https://default.example.com/")
+
+	authContext := auth.NewAuthContext(as.state, &testDeviceAssertions{})
+	storeURL, err := authContext.StoreURL(defaultURL)
+	c.Assert(err, IsNil)
+	c.Check(storeURL.String(), Equals, "https://my-brand-store.example.com/")
+
+	// the store id chosen explicitly wins
+	os.Setenv("UBUNTU_STORE_ID", "env-store-id")
+	defer os.Unsetenv("UBUNTU_STORE_ID")
+	storeURL, err = authContext.StoreURL(defaultURL)
+	c.Assert(err, IsNil)
+	c.Check(storeURL, Equals, defaultURL)
+}
+
+func (as *authSuite) TestAuthContextFriendlyStores(c *C) {
+	authContext := auth.NewAuthContext(as.state, &testDeviceAssertions{})
+	friendly, err := authContext.FriendlyStores()
+	c.Assert(err, IsNil)
+	c.Check(friendly, DeepEquals, []string{"other-store-id"})
+
+	// not with an explicitly chosen store
+	os.Setenv("UBUNTU_STORE_ID", "env-store-id")
+	defer os.Unsetenv("UBUNTU_STORE_ID")
+	friendly, err = authContext.FriendlyStores()
+	c.Assert(err, IsNil)
+	c.Check(friendly, HasLen, 0)
+}
+
+func (as *authSuite) TestAuthContextStoreURLNoStoreAssertion(c *C) {
+	defaultURL, _ := url.Parse("https://default.example.com/")
+
+	authContext := auth.NewAuthContext(as.state, &testDeviceAssertions{noStore: true})
+	storeURL, err := authContext.StoreURL(defaultURL)
+	c.Assert(err, IsNil)
+	c.Check(storeURL, Equals, defaultURL)
+}
@@ -94,6 +94,15 @@ func UpdateRevisions(ovld *overlord.Overlord) error {
 		for snapName, snapState := range installed {
 			if name == snapName {
 				if rev != snapState.Current {
+					// a change waiting for the boot
+					// rolls back by itself
+					pending, err := snapstate.WaitingForBoot(st, name)
+					if err != nil {
+						return err
+					}
+					if pending {
+						continue
+					}
 					ts, err := snapstate.RevertToRevision(st, name, rev, snapstate.Flags(0))
 					if err != nil {
 						return err
@@ -90,8 +90,8 @@ func (bs *bootedSuite) makeInstalledKernelOS(c *C, st *state.State) {
 		Current:  snap.R(2),
 	})
 
-	snaptest.MockSnap(c, "name: canonical-pc-linux\ntype: os\nversion: 1", kernelSI1)
-	snaptest.MockSnap(c, "name: canonical-pc-linux\ntype: os\nversion: 2", kernelSI2)
+	snaptest.MockSnap(c, "name: canonical-pc-linux\ntype: kernel\nversion: 1", kernelSI1)
+	snaptest.MockSnap(c, "name: canonical-pc-linux\ntype: kernel\nversion: 2", kernelSI2)
 	snapstate.Set(st, "canonical-pc-linux", &snapstate.SnapState{
 		SnapType: "kernel",
 		Active:   true,
@@ -125,6 +125,34 @@ func (bs *bootedSuite) TestUpdateRevisionsOSSimple(c *C) {
 	c.Assert(snapst.Active, Equals, true)
 }
 
+func (bs *bootedSuite) TestUpdateRevisionsSkipsSnapWaitingForBoot(c *C) {
+	st := bs.overlord.State()
+	bs.makeInstalledKernelOS(c, st)
+
+	st.Lock()
+	t := st.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: osSI2})
+	t.Set("boot-pending", true)
+	t.SetStatus(state.DoingStatus)
+	chg := st.NewChange("refresh-snap", "...")
+	chg.AddTask(t)
+	st.Unlock()
+
+	bs.bootloader.BootVars["snap_core"] = "ubuntu-core_1.snap"
+	err := boot.UpdateRevisions(bs.overlord)
+	c.Assert(err, IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+
+	// the waiting change rolls back by itself
+	c.Check(st.Changes(), HasLen, 1)
+	var snapst snapstate.SnapState
+	err = snapstate.Get(st, "ubuntu-core", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Current, Equals, snap.R(2))
+}
+
 func (bs *bootedSuite) TestUpdateRevisionsKernelSimple(c *C) {
 	st := bs.overlord.State()
 	bs.makeInstalledKernelOS(c, st)
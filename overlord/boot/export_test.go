@@ -23,6 +23,7 @@ var (
 	PopulateStateFromSeed    = populateStateFromSeed
 	NameAndRevnoFromSnap     = nameAndRevnoFromSnap
 	ImportAssertionsFromSeed = importAssertionsFromSeed
+	FinishPreseededSeed      = finishPreseededSeed
 )
 
 func MockFirstbootInitialNetworkConfig(f func() error) func() {
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 
 	"github.com/snapcore/snapd/asserts"
@@ -35,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
@@ -63,16 +65,50 @@ func populateStateFromSeed() error {
 		return err
 	}
 
-	seed, err := snap.ReadSeedYaml(filepath.Join(dirs.SnapSeedDir, "seed.yaml"))
+	tsAll, err := seedTaskSets(st)
 	if err != nil {
 		return err
 	}
+	if len(tsAll) == 0 {
+		return nil
+	}
 
-	tsAll := []*state.TaskSet{}
-	for i, sn := range seed.Snaps {
-		st.Lock()
+	st.Lock()
+	msg := fmt.Sprintf("First boot seeding")
+	chg := st.NewChange("seed", msg)
+	if release.Preseeding {
+		markPreseeded := chainPreseeded(st, chg, tsAll)
+		st.Unlock()
+		return preseedChange(ovld, chg, markPreseeded)
+	}
+	for i, ts := range tsAll {
+		if i > 0 {
+			ts.WaitAll(tsAll[i-1])
+		}
+		chg.AddAll(ts)
+	}
+	st.Unlock()
+
+	return runSeedChange(ovld, chg)
+}
+
+// seedTaskSets returns the task sets installing the snaps listed in
+// the seed.yaml, followed by the ones configuring them.
+func seedTaskSets(st *state.State) ([]*state.TaskSet, error) {
+	seed, err := snap.ReadSeedYaml(filepath.Join(dirs.SnapSeedDir, "seed.yaml"))
+	if err != nil {
+		return nil, err
+	}
 
-		flags := snapstate.Flags(0)
+	st.Lock()
+	defer st.Unlock()
+
+	tsAll := []*state.TaskSet{}
+	configTss := []*state.TaskSet{}
+	for _, sn := range seed.Snaps {
+		// the snaps get configured once all of them, and so the
+		// gadget with the defaults, are installed
+		flags := snapstate.Flags(snapstate.SkipConfigure)
 		if sn.DevMode {
 			flags |= snapstate.DevMode
 		}
@@ -84,40 +120,69 @@ func populateStateFromSeed() error {
 		} else {
 			si, err := snapasserts.DeriveSideInfo(path, assertstate.DB(st))
 			if err == asserts.ErrNotFound {
-				st.Unlock()
-				return fmt.Errorf("cannot find signatures with metadata for snap %q (%q)", sn.Name, path)
+				return nil, fmt.Errorf("cannot find signatures with metadata for snap %q (%q)", sn.Name, path)
 			}
 			if err != nil {
-				st.Unlock()
-				return err
+				return nil, err
 			}
 			sideInfo = *si
 			sideInfo.Private = sn.Private
 		}
 
 		ts, err := snapstate.InstallPath(st, &sideInfo, path, sn.Channel, flags)
-		if i > 0 {
-			ts.WaitAll(tsAll[i-1])
-		}
-		st.Unlock()
-
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		tsAll = append(tsAll, ts)
+		configTss = append(configTss, configstate.Configure(st, sn.Name, configstate.UseConfigDefaults))
 	}
-	if len(tsAll) == 0 {
-		return nil
-	}
+	return append(tsAll, configTss...), nil
+}
 
-	st.Lock()
-	msg := fmt.Sprintf("First boot seeding")
-	chg := st.NewChange("seed", msg)
+// chainPreseeded adds the task sets to the seed change split at their
+// link-snap or hook tasks: the tasks before run one snap after the
+// other while preseeding, the ones from there on wait for the returned
+// mark-preseeded task which holds them back until the image boots.
+func chainPreseeded(st *state.State, chg *state.Change, tsAll []*state.TaskSet) *state.Task {
+	markPreseeded := st.NewTask("mark-preseeded", "Wait for the image to boot")
+
+	var prevBefore, prevAfter *state.TaskSet
 	for _, ts := range tsAll {
+		tasks := ts.Tasks()
+		split := len(tasks)
+		for i, t := range tasks {
+			if t.Kind() == "link-snap" || t.Kind() == "run-hook" {
+				split = i
+				break
+			}
+		}
+		before := state.NewTaskSet(tasks[:split]...)
+		after := state.NewTaskSet(tasks[split:]...)
+
+		if prevBefore != nil {
+			before.WaitAll(prevBefore)
+		}
+		if prevAfter != nil {
+			after.WaitAll(prevAfter)
+		} else {
+			after.WaitFor(markPreseeded)
+		}
 		chg.AddAll(ts)
+		if len(before.Tasks()) != 0 {
+			prevBefore = before
+		}
+		prevAfter = after
 	}
-	st.Unlock()
+	markPreseeded.WaitAll(prevBefore)
+	chg.AddTask(markPreseeded)
+
+	return markPreseeded
+}
+
+// runSeedChange runs the seed change to the end.
+func runSeedChange(ovld *overlord.Overlord, chg *state.Change) error {
+	st := ovld.State()
 
 	// do it and wait for ready
 	ovld.Loop()
@@ -127,7 +192,7 @@ func populateStateFromSeed() error {
 
 	st.Lock()
 	status := chg.Status()
-	err = chg.Err()
+	err := chg.Err()
 	st.Unlock()
 	if status != state.DoneStatus {
 		ovld.Stop()
@@ -138,6 +203,92 @@ func populateStateFromSeed() error {
 	return ovld.Stop()
 }
 
+// finishPreseededSeed runs the rest of the seed change of a preseeded
+// image.
+func finishPreseededSeed() error {
+	ovld, err := overlord.New()
+	if err != nil {
+		return err
+	}
+	st := ovld.State()
+
+	st.Lock()
+	var chg *state.Change
+	for _, c := range st.Changes() {
+		if c.Kind() == "seed" && !c.Status().Ready() {
+			chg = c
+			break
+		}
+	}
+	st.Unlock()
+	if chg == nil {
+		return fmt.Errorf("cannot finish seeding: no seed change to finish in state %q", dirs.SnapStateFile)
+	}
+
+	return runSeedChange(ovld, chg)
+}
+
+// preseedChange runs the seed change up to the mark-preseeded task and
+// leaves the snaps it mounted unmounted again, as the image is not
+// booted.
+func preseedChange(ovld *overlord.Overlord, chg *state.Change, markPreseeded *state.Task) error {
+	settleErr := ovld.Settle()
+	defer ovld.Stop()
+
+	st := ovld.State()
+	st.Lock()
+	defer st.Unlock()
+
+	for _, t := range chg.Tasks() {
+		if t.Kind() != "mount-snap" || t.Status() != state.DoneStatus {
+			continue
+		}
+		ss, err := snapstate.TaskSnapSetup(t)
+		if err != nil {
+			return err
+		}
+		mountDir := snap.MountDir(ss.Name(), ss.Revision())
+		if output, err := exec.Command("umount", mountDir).CombinedOutput(); err != nil {
+			return fmt.Errorf("cannot unmount %q: %v", mountDir, osutil.OutputErr(output, err))
+		}
+	}
+
+	if markPreseeded.Status() != state.DoingStatus {
+		err := chg.Err()
+		if err == nil {
+			err = settleErr
+		}
+		if err == nil {
+			err = fmt.Errorf("seed change is %s", chg.Status())
+		}
+		return fmt.Errorf("cannot preseed: %v", err)
+	}
+	return nil
+}
+
+// Preseed runs the first boot seeding of the image ahead of time, up
+// to what needs the booted device, leaving the resulting state in the
+// image for FirstBoot to finish. It is to be run from the core snap of
+// the image, chrooted into a root made of it and the writable paths of
+// the image, see "snap prepare-image --preseed".
+func Preseed() error {
+	if release.OnClassic {
+		return fmt.Errorf("cannot preseed: not running in the root of an all-snap image")
+	}
+	release.Preseeding = true
+	defer func() {
+		release.Preseeding = false
+	}()
+
+	if firstboot.HasRun() {
+		return fmt.Errorf("cannot preseed: the image was booted already")
+	}
+	if osutil.FileExists(dirs.SnapStateFile) {
+		return fmt.Errorf("cannot preseed: state %q already exists", dirs.SnapStateFile)
+	}
+	return populateStateFromSeed()
+}
+
 func readAsserts(fn string, batch *assertstate.Batch) ([]*asserts.Ref, error) {
 	f, err := os.Open(fn)
 	if err != nil {
@@ -151,15 +302,32 @@ func importAssertionsFromSeed(st *state.State) error {
 	st.Lock()
 	defer st.Unlock()
 
-	assertSeedDir := filepath.Join(dirs.SnapSeedDir, "assertions")
+	modelAssertion, err := importSeedAssertions(st, dirs.SnapSeedDir)
+	if err != nil || modelAssertion == nil {
+		return err
+	}
+
+	// set device,model from the model assertion
+	auth.SetDevice(st, &auth.DeviceState{
+		Brand: modelAssertion.BrandID(),
+		Model: modelAssertion.Model(),
+	})
+
+	return nil
+}
+
+// importSeedAssertions adds the assertions of the seed in seedDir to
+// the assertion database of the state and returns the model assertion.
+func importSeedAssertions(st *state.State, seedDir string) (*asserts.Model, error) {
+	assertSeedDir := filepath.Join(seedDir, "assertions")
 	dc, err := ioutil.ReadDir(assertSeedDir)
 	if err != nil {
-		return fmt.Errorf("cannot read assert seed dir: %s", err)
+		return nil, fmt.Errorf("cannot read assert seed dir: %s", err)
 	}
 
 	// FIXME: remove this check once asserts are mandatory
 	if len(dc) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// collect
@@ -169,12 +337,12 @@ func importAssertionsFromSeed(st *state.State) error {
 		fn := filepath.Join(assertSeedDir, fi.Name())
 		refs, err := readAsserts(fn, batch)
 		if err != nil {
-			return fmt.Errorf("cannot read assertions: %s", err)
+			return nil, fmt.Errorf("cannot read assertions: %s", err)
 		}
 		for _, ref := range refs {
 			if ref.Type == asserts.ModelType {
 				if modelRef != nil && modelRef.Unique() != ref.Unique() {
-					return fmt.Errorf("cannot add more than one model assertion")
+					return nil, fmt.Errorf("cannot add more than one model assertion")
 				}
 				modelRef = ref
 			}
@@ -182,26 +350,18 @@ func importAssertionsFromSeed(st *state.State) error {
 	}
 	// verify we have one model assertion
 	if modelRef == nil {
-		return fmt.Errorf("need a model assertion")
+		return nil, fmt.Errorf("need a model assertion")
 	}
 
 	if err := batch.Commit(st); err != nil {
-		return err
+		return nil, err
 	}
 
 	a, err := modelRef.Resolve(assertstate.DB(st).Find)
 	if err != nil {
-		return fmt.Errorf("internal error: cannot find just added assertion %v: %v", modelRef, err)
+		return nil, fmt.Errorf("internal error: cannot find just added assertion %v: %v", modelRef, err)
 	}
-	modelAssertion := a.(*asserts.Model)
-
-	// set device,model from the model assertion
-	auth.SetDevice(st, &auth.DeviceState{
-		Brand: modelAssertion.BrandID(),
-		Model: modelAssertion.Model(),
-	})
-
-	return nil
+	return a.(*asserts.Model), nil
 }
 
 var firstbootInitialNetworkConfig = firstboot.InitialNetworkConfig
@@ -228,10 +388,15 @@ func FirstBoot() error {
 		logger.Noticef("Failed during inital network configuration: %s", err)
 	}
 
+	seed := populateStateFromSeed
+	if osutil.FileExists(dirs.SnapStateFile) {
+		// the image was preseeded
+		seed = finishPreseededSeed
+	}
 	// snappy will be in a very unhappy state if this happens,
 	// because populateStateFromSeed will error if there
 	// is a state file already
-	if err := populateStateFromSeed(); err != nil {
+	if err := seed(); err != nil {
 		return err
 	}
 
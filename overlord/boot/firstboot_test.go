@@ -38,6 +38,7 @@ import (
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/boot"
+	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
@@ -49,6 +50,7 @@ import (
 type FirstBootTestSuite struct {
 	systemctl   *testutil.MockCmd
 	mockUdevAdm *testutil.MockCmd
+	mockSnap    *testutil.MockCmd
 
 	storeSigning *assertstest.StoreStack
 	restore      func()
@@ -74,6 +76,8 @@ func (s *FirstBootTestSuite) SetUpTest(c *C) {
 	os.Setenv("SNAPPY_SQUASHFS_UNPACK_FOR_TESTS", "1")
 	s.systemctl = testutil.MockCommand(c, "systemctl", "")
 	s.mockUdevAdm = testutil.MockCommand(c, "udevadm", "")
+	// runs the hooks
+	s.mockSnap = testutil.MockCommand(c, "snap", "")
 
 	err = ioutil.WriteFile(filepath.Join(dirs.SnapSeedDir, "seed.yaml"), nil, 0644)
 	c.Assert(err, IsNil)
@@ -92,6 +96,7 @@ func (s *FirstBootTestSuite) TearDownTest(c *C) {
 	os.Unsetenv("SNAPPY_SQUASHFS_UNPACK_FOR_TESTS")
 	s.systemctl.Restore()
 	s.mockUdevAdm.Restore()
+	s.mockSnap.Restore()
 
 	s.restore()
 }
@@ -229,6 +234,174 @@ snaps:
 	c.Assert(info.DeveloperID, Equals, "")
 }
 
+func (s *FirstBootTestSuite) TestPreseedAndFinish(c *C) {
+	mount := testutil.MockCommand(c, "mount", "")
+	defer mount.Restore()
+	umount := testutil.MockCommand(c, "umount", "")
+	defer umount.Restore()
+	apparmorParser := testutil.MockCommand(c, "apparmor_parser", "")
+	defer apparmorParser.Restore()
+
+	var files []string
+	for _, name := range []string{"local", "other"} {
+		mockSnapFile := snaptest.MakeTestSnapWithFiles(c, fmt.Sprintf("name: %s\nversion: 1.0", name), nil)
+		targetSnapFile := filepath.Join(dirs.SnapSeedDir, "snaps", filepath.Base(mockSnapFile))
+		err := os.Rename(mockSnapFile, targetSnapFile)
+		c.Assert(err, IsNil)
+		files = append(files, filepath.Base(targetSnapFile))
+	}
+
+	assertsChain := s.makeModelAssertionChain(c)
+	writeAssertionsToFile("model.asserts", assertsChain)
+
+	content := []byte(fmt.Sprintf(`
+snaps:
+ - name: local
+   unasserted: true
+   file: %s
+ - name: other
+   unasserted: true
+   file: %s
+`, files[0], files[1]))
+	err := ioutil.WriteFile(filepath.Join(dirs.SnapSeedDir, "seed.yaml"), content, 0644)
+	c.Assert(err, IsNil)
+
+	restore := release.MockOnClassic(true)
+	err = boot.Preseed()
+	c.Check(err, ErrorMatches, `cannot preseed: not running in the root of an all-snap image`)
+	restore()
+
+	restore = release.MockOnClassic(false)
+	defer restore()
+	err = boot.Preseed()
+	c.Assert(err, IsNil)
+	c.Check(release.Preseeding, Equals, false)
+
+	localMountDir := filepath.Join(dirs.SnapMountDir, "local", "x1")
+	otherMountDir := filepath.Join(dirs.SnapMountDir, "other", "x1")
+	c.Check(mount.Calls(), DeepEquals, [][]string{
+		{"mount", "-t", "squashfs", "-o", "ro", filepath.Join(dirs.SnapBlobDir, "local_x1.snap"), localMountDir},
+		{"mount", "-t", "squashfs", "-o", "ro", filepath.Join(dirs.SnapBlobDir, "other_x1.snap"), otherMountDir},
+	})
+	c.Check(umount.Calls(), DeepEquals, [][]string{
+		{"umount", localMountDir},
+		{"umount", otherMountDir},
+	})
+	for _, call := range s.systemctl.Calls() {
+		c.Check(call[1], Not(Equals), "start")
+	}
+
+	readState := func() *state.State {
+		r, err := os.Open(dirs.SnapStateFile)
+		c.Assert(err, IsNil)
+		defer r.Close()
+		st, err := state.ReadState(nil, r)
+		c.Assert(err, IsNil)
+		return st
+	}
+
+	st := readState()
+	st.Lock()
+	c.Assert(st.Changes(), HasLen, 1)
+	chg := st.Changes()[0]
+	c.Check(chg.Kind(), Equals, "seed")
+	for _, t := range chg.Tasks() {
+		switch t.Kind() {
+		case "mark-preseeded":
+			c.Check(t.Status(), Equals, state.DoingStatus)
+		case "prepare-snap", "mount-snap", "copy-snap-data", "setup-profiles":
+			c.Check(t.Status(), Equals, state.DoneStatus, Commentf("%s", t.Summary()))
+		default:
+			c.Check(t.Status(), Equals, state.DoStatus, Commentf("%s", t.Summary()))
+		}
+	}
+	_, err = snapstate.CurrentInfo(st, "local")
+	c.Check(err, NotNil)
+	st.Unlock()
+
+	// preseeding only once
+	err = boot.Preseed()
+	c.Check(err, ErrorMatches, `cannot preseed: state ".*" already exists`)
+
+	// first boot finishes the seeding
+	err = boot.FinishPreseededSeed()
+	c.Assert(err, IsNil)
+
+	st = readState()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes()[0].Status(), Equals, state.DoneStatus)
+	for _, name := range []string{"local", "other"} {
+		info, err := snapstate.CurrentInfo(st, name)
+		c.Assert(err, IsNil)
+		c.Check(info.Revision, Equals, snap.R("x1"))
+	}
+}
+
+func (s *FirstBootTestSuite) TestFinishPreseededSeedNoChange(c *C) {
+	err := os.MkdirAll(filepath.Dir(dirs.SnapStateFile), 0755)
+	c.Assert(err, IsNil)
+	ovld, err := overlord.New()
+	c.Assert(err, IsNil)
+	// write the state
+	ovld.State().Lock()
+	ovld.State().Unlock()
+
+	err = boot.FinishPreseededSeed()
+	c.Assert(err, ErrorMatches, `cannot finish seeding: no seed change to finish in state ".*"`)
+}
+
+func (s *FirstBootTestSuite) TestPopulateFromSeedGadgetDefaults(c *C) {
+	devAcct := assertstest.NewAccount(s.storeSigning, "developer", map[string]interface{}{
+		"account-id": "developerid",
+	}, "")
+	writeAssertionsToFile("model.asserts", s.makeModelAssertionChain(c))
+
+	// listed before the gadget which has defaults for it
+	fooFn, fooAsserts := s.makeSeedSnap(c, "foo")
+	writeAssertionsToFile("foo.asserts", append(fooAsserts, devAcct))
+	gadgetFn, gadgetAsserts := s.makeSeedSnapWithFiles(c, "name: pc\ntype: gadget\nversion: 1.0", [][]string{
+		{"meta/gadget.yaml", `
+defaults:
+  foo-id:
+    some-key: some-value
+volumes:
+  pc:
+    bootloader: grub
+`},
+	})
+	writeAssertionsToFile("pc.asserts", append(gadgetAsserts, devAcct))
+
+	s.writeSeedYaml(c, fmt.Sprintf(`
+snaps:
+ - name: foo
+   file: %s
+ - name: pc
+   file: %s
+`, fooFn, gadgetFn))
+
+	err := boot.PopulateStateFromSeed()
+	c.Assert(err, IsNil)
+
+	c.Check(s.mockSnap.Calls(), DeepEquals, [][]string{
+		{"snap", "run", "--hook", "configure", "-r", "unset", "foo"},
+		{"snap", "run", "--hook", "configure", "-r", "unset", "pc"},
+	})
+
+	r, err := os.Open(dirs.SnapStateFile)
+	c.Assert(err, IsNil)
+	defer r.Close()
+	st, err := state.ReadState(nil, r)
+	c.Assert(err, IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+	var value string
+	err = configstate.NewTransaction(st).Get("foo", "some-key", &value)
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "some-value")
+}
+
 func writeAssertionsToFile(fn string, assertions []asserts.Assertion) {
 	multifn := filepath.Join(dirs.SnapSeedDir, "assertions", fn)
 	f, err := os.Create(multifn)
@@ -0,0 +1,170 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/asserts/sysdb"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// ValidateSeed checks the seed in seedDir the way the first boot would
+// use it, without installing anything, and reports all the problems
+// found at once.
+func ValidateSeed(seedDir string) error {
+	seed, err := snap.ReadSeedYaml(filepath.Join(seedDir, "seed.yaml"))
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	problem := func(format string, v ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, v...))
+	}
+
+	// a scratch assertion database founded like the one of the device
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   sysdb.Trusted(),
+	})
+	if err != nil {
+		return err
+	}
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+	assertstate.ReplaceDB(st, db)
+
+	model, err := importSeedAssertions(st, seedDir)
+	switch {
+	case err != nil:
+		problem("%v", err)
+	case model == nil:
+		problem("need a model assertion")
+	}
+	if err != nil {
+		// check the snaps against what can be made sense of
+		addSeedAssertions(db, seedDir)
+	}
+
+	seen := make(map[string]bool, len(seed.Snaps))
+	for _, sn := range seed.Snaps {
+		if seen[sn.Name] {
+			problem("snap %q is listed more than once", sn.Name)
+			continue
+		}
+		seen[sn.Name] = true
+
+		path := filepath.Join(seedDir, "snaps", sn.File)
+		if !osutil.FileExists(path) {
+			problem("cannot find snap %q file %q", sn.Name, path)
+			continue
+		}
+		if sn.Unasserted {
+			// nothing to check it against
+			continue
+		}
+
+		si, err := snapasserts.DeriveSideInfo(path, db)
+		if err == asserts.ErrNotFound {
+			problem("cannot find signatures with metadata for snap %q (%q)", sn.Name, path)
+			continue
+		}
+		if err != nil {
+			problem("%v", err)
+			continue
+		}
+		if si.RealName != sn.Name {
+			problem("snap %q file %q is snap %q according to its signatures", sn.Name, path, si.RealName)
+		}
+		if sn.SnapID != "" && sn.SnapID != si.SnapID {
+			problem("snap %q has snap-id %q, its signatures have %q", sn.Name, sn.SnapID, si.SnapID)
+		}
+	}
+
+	if model != nil {
+		required := append([]string{model.Kernel(), model.Gadget()}, model.RequiredSnaps()...)
+		for _, name := range required {
+			if name != "" && !seen[name] {
+				problem("snap %q required by the model is not in the seed", name)
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("cannot validate seed:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return nil
+}
+
+// addSeedAssertions adds to db whichever of the assertions of the seed
+// in seedDir can be decoded and added, in whatever order satisfies
+// their prerequisites.
+func addSeedAssertions(db *asserts.Database, seedDir string) {
+	assertSeedDir := filepath.Join(seedDir, "assertions")
+	dc, err := ioutil.ReadDir(assertSeedDir)
+	if err != nil {
+		return
+	}
+	var pending []asserts.Assertion
+	for _, fi := range dc {
+		f, err := os.Open(filepath.Join(assertSeedDir, fi.Name()))
+		if err != nil {
+			continue
+		}
+		dec := asserts.NewDecoder(f)
+		for {
+			a, err := dec.Decode()
+			if err != nil {
+				break
+			}
+			pending = append(pending, a)
+		}
+		f.Close()
+	}
+
+	for added := true; added; {
+		added = false
+		var left []asserts.Assertion
+		for _, a := range pending {
+			err := db.Add(a)
+			if err == nil {
+				added = true
+				continue
+			}
+			if _, ok := err.(*asserts.RevisionError); ok {
+				// known already
+				continue
+			}
+			left = append(left, a)
+		}
+		pending = left
+	}
+}
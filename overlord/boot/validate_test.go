@@ -0,0 +1,195 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/boot"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+// makeSeedSnap puts a snap with the given name into the seed and
+// returns its file name together with its snap-declaration and
+// snap-revision.
+func (s *FirstBootTestSuite) makeSeedSnap(c *C, name string) (string, []asserts.Assertion) {
+	return s.makeSeedSnapWithFiles(c, fmt.Sprintf("name: %s\nversion: 1.0", name), nil)
+}
+
+// makeSeedSnapWithFiles is like makeSeedSnap for a snap with the given
+// snap.yaml and files.
+func (s *FirstBootTestSuite) makeSeedSnapWithFiles(c *C, snapYaml string, files [][]string) (string, []asserts.Assertion) {
+	info, err := snap.InfoFromSnapYaml([]byte(snapYaml))
+	c.Assert(err, IsNil)
+	name := info.Name()
+
+	mockSnapFile := snaptest.MakeTestSnapWithFiles(c, snapYaml, files)
+	targetSnapFile := filepath.Join(dirs.SnapSeedDir, "snaps", filepath.Base(mockSnapFile))
+	err = os.Rename(mockSnapFile, targetSnapFile)
+	c.Assert(err, IsNil)
+
+	snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      name + "-id",
+		"publisher-id": "developerid",
+		"snap-name":    name,
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	sha3_384, size, err := asserts.SnapFileSHA3_384(targetSnapFile)
+	c.Assert(err, IsNil)
+	snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+		"snap-sha3-384": sha3_384,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-id":       name + "-id",
+		"developer-id":  "developerid",
+		"snap-revision": "1",
+		"timestamp":     time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	return filepath.Base(targetSnapFile), []asserts.Assertion{snapDecl, snapRev}
+}
+
+func (s *FirstBootTestSuite) writeSeedYaml(c *C, content string) {
+	err := ioutil.WriteFile(filepath.Join(dirs.SnapSeedDir, "seed.yaml"), []byte(content), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *FirstBootTestSuite) TestValidateSeedHappy(c *C) {
+	devAcct := assertstest.NewAccount(s.storeSigning, "developer", map[string]interface{}{
+		"account-id": "developerid",
+	}, "")
+	writeAssertionsToFile("model.asserts", s.makeModelAssertionChain(c))
+
+	kernelFn, kernelAsserts := s.makeSeedSnap(c, "pc-kernel")
+	writeAssertionsToFile("pc-kernel.asserts", append(kernelAsserts, devAcct))
+	gadgetFn, gadgetAsserts := s.makeSeedSnap(c, "pc")
+	writeAssertionsToFile("pc.asserts", append(gadgetAsserts, devAcct))
+	localFn, _ := s.makeSeedSnap(c, "local")
+
+	s.writeSeedYaml(c, fmt.Sprintf(`
+snaps:
+ - name: pc-kernel
+   snap-id: pc-kernel-id
+   file: %s
+ - name: pc
+   file: %s
+ - name: local
+   unasserted: true
+   file: %s
+`, kernelFn, gadgetFn, localFn))
+
+	err := boot.ValidateSeed(dirs.SnapSeedDir)
+	c.Assert(err, IsNil)
+}
+
+func (s *FirstBootTestSuite) TestValidateSeedReportsAllProblems(c *C) {
+	devAcct := assertstest.NewAccount(s.storeSigning, "developer", map[string]interface{}{
+		"account-id": "developerid",
+	}, "")
+	writeAssertionsToFile("model.asserts", s.makeModelAssertionChain(c))
+
+	// no snap-revision for the kernel
+	kernelFn, kernelAsserts := s.makeSeedSnap(c, "pc-kernel")
+	writeAssertionsToFile("pc-kernel.asserts", []asserts.Assertion{kernelAsserts[0], devAcct})
+	otherFn, otherAsserts := s.makeSeedSnap(c, "other")
+	writeAssertionsToFile("other.asserts", append(otherAsserts, devAcct))
+
+	s.writeSeedYaml(c, fmt.Sprintf(`
+snaps:
+ - name: pc-kernel
+   file: %s
+ - name: renamed
+   snap-id: renamed-id
+   file: %s
+ - name: local
+   unasserted: true
+   file: local_1.0_all.snap
+ - name: local
+   unasserted: true
+   file: local_1.0_all.snap
+`, kernelFn, otherFn))
+
+	err := boot.ValidateSeed(dirs.SnapSeedDir)
+	c.Assert(err, ErrorMatches, `cannot validate seed:
+- cannot find signatures with metadata for snap "pc-kernel" \(".*/pc-kernel_1.0_all.snap"\)
+- snap "renamed" file ".*/other_1.0_all.snap" is snap "other" according to its signatures
+- snap "renamed" has snap-id "renamed-id", its signatures have "other-id"
+- cannot find snap "local" file ".*/local_1.0_all.snap"
+- snap "local" is listed more than once
+- snap "pc" required by the model is not in the seed`)
+}
+
+func (s *FirstBootTestSuite) TestValidateSeedNoModel(c *C) {
+	localFn, _ := s.makeSeedSnap(c, "local")
+	s.writeSeedYaml(c, fmt.Sprintf(`
+snaps:
+ - name: local
+   unasserted: true
+   file: %s
+`, localFn))
+
+	err := boot.ValidateSeed(dirs.SnapSeedDir)
+	c.Assert(err, ErrorMatches, `cannot validate seed:
+- need a model assertion`)
+}
+
+func (s *FirstBootTestSuite) TestValidateSeedChecksSnapsWithBrokenModel(c *C) {
+	devAcct := assertstest.NewAccount(s.storeSigning, "developer", map[string]interface{}{
+		"account-id": "developerid",
+	}, "")
+	// two model assertions cannot be imported
+	chain := s.makeModelAssertionChain(c)
+	writeAssertionsToFile("model.asserts", chain)
+	otherModel := s.makeModelAssertion(c, "other-model")
+	writeAssertionsToFile("other-model.asserts", []asserts.Assertion{otherModel})
+
+	kernelFn, kernelAsserts := s.makeSeedSnap(c, "pc-kernel")
+	writeAssertionsToFile("pc-kernel.asserts", append(kernelAsserts, devAcct))
+	// no snap-revision for the gadget
+	gadgetFn, gadgetAsserts := s.makeSeedSnap(c, "pc")
+	writeAssertionsToFile("pc.asserts", []asserts.Assertion{gadgetAsserts[0], devAcct})
+
+	s.writeSeedYaml(c, fmt.Sprintf(`
+snaps:
+ - name: pc-kernel
+   file: %s
+ - name: pc
+   file: %s
+`, kernelFn, gadgetFn))
+
+	// the snaps are still checked
+	err := boot.ValidateSeed(dirs.SnapSeedDir)
+	c.Assert(err, ErrorMatches, `cannot validate seed:
+- cannot add more than one model assertion
+- cannot find signatures with metadata for snap "pc" \(".*/pc_1.0_all.snap"\)`)
+}
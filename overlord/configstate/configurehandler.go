@@ -19,7 +19,12 @@
 
 package configstate
 
-import "github.com/snapcore/snapd/overlord/hookstate"
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
 
 // configureHandler is the handler for the configure hook.
 type configureHandler struct {
@@ -61,13 +66,28 @@ func (h *configureHandler) Before() error {
 	defer h.context.Unlock()
 
 	transaction := ContextTransaction(h.context)
+	snapName := h.context.SnapName()
+
+	// Start from the defaults if asked to, e.g. on install.
+	var useDefaults bool
+	if err := h.context.Get("use-defaults", &useDefaults); err == nil && useDefaults && ConfigDefaults != nil {
+		defaults, err := ConfigDefaults(h.context.State(), snapName)
+		if err != nil && err != state.ErrNoState {
+			return fmt.Errorf("cannot get default configuration for snap %q: %v", snapName, err)
+		}
+		for key, value := range defaults {
+			if err := transaction.Set(snapName, key, value); err != nil {
+				return err
+			}
+		}
+	}
 
 	// Initialize the transaction if there's a patch provided in the
 	// context.
 	var patch map[string]interface{}
 	if err := h.context.Get("patch", &patch); err == nil {
 		for key, value := range patch {
-			transaction.Set(h.context.SnapName(), key, value)
+			transaction.Set(snapName, key, value)
 		}
 	}
 
@@ -20,6 +20,8 @@
 package configstate_test
 
 import (
+	"fmt"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/overlord/configstate"
@@ -69,3 +71,76 @@ func (s *configureHandlerSuite) TestBeforeInitializesTransaction(c *C) {
 	c.Check(transaction.Get("test-snap", "foo", &value), IsNil)
 	c.Check(value, Equals, "bar")
 }
+
+func (s *configureHandlerSuite) TestBeforeAppliesDefaultsBeforePatch(c *C) {
+	restore := configstate.MockConfigDefaults(func(st *state.State, snapName string) (map[string]interface{}, error) {
+		c.Check(snapName, Equals, "test-snap")
+		return map[string]interface{}{
+			"foo": "default",
+			"baz": "default",
+		}, nil
+	})
+	defer restore()
+
+	s.context.Lock()
+	s.context.Set("use-defaults", true)
+	s.context.Set("patch", map[string]interface{}{
+		"foo": "bar",
+	})
+	s.context.Unlock()
+
+	c.Check(s.handler.Before(), IsNil)
+
+	s.context.Lock()
+	transaction := configstate.ContextTransaction(s.context)
+	s.context.Unlock()
+
+	var value string
+	c.Check(transaction.Get("test-snap", "foo", &value), IsNil)
+	c.Check(value, Equals, "bar")
+	c.Check(transaction.Get("test-snap", "baz", &value), IsNil)
+	c.Check(value, Equals, "default")
+}
+
+func (s *configureHandlerSuite) TestBeforeIgnoresDefaultsUnlessAsked(c *C) {
+	restore := configstate.MockConfigDefaults(func(st *state.State, snapName string) (map[string]interface{}, error) {
+		c.Fatalf("unexpected call to ConfigDefaults")
+		return nil, nil
+	})
+	defer restore()
+
+	c.Check(s.handler.Before(), IsNil)
+}
+
+func (s *configureHandlerSuite) TestBeforeNoDefaults(c *C) {
+	restore := configstate.MockConfigDefaults(func(st *state.State, snapName string) (map[string]interface{}, error) {
+		return nil, state.ErrNoState
+	})
+	defer restore()
+
+	s.context.Lock()
+	s.context.Set("use-defaults", true)
+	s.context.Unlock()
+
+	c.Check(s.handler.Before(), IsNil)
+
+	s.context.Lock()
+	transaction := configstate.ContextTransaction(s.context)
+	s.context.Unlock()
+
+	var value string
+	c.Check(transaction.Get("test-snap", "foo", &value), ErrorMatches, `.*snap "test-snap" has no "foo" configuration option`)
+}
+
+func (s *configureHandlerSuite) TestBeforeDefaultsError(c *C) {
+	restore := configstate.MockConfigDefaults(func(st *state.State, snapName string) (map[string]interface{}, error) {
+		return nil, fmt.Errorf("boom")
+	})
+	defer restore()
+
+	s.context.Lock()
+	s.context.Set("use-defaults", true)
+	s.context.Unlock()
+
+	c.Check(s.handler.Before(), ErrorMatches, `cannot get default configuration for snap "test-snap": boom`)
+}
@@ -19,4 +19,13 @@
 
 package configstate
 
+import "github.com/snapcore/snapd/overlord/state"
+
 var NewConfigureHandler = newConfigureHandler
+
+// MockConfigDefaults mocks the retrieval of the default configuration.
+func MockConfigDefaults(f func(st *state.State, snapName string) (map[string]interface{}, error)) (restore func()) {
+	old := ConfigDefaults
+	ConfigDefaults = f
+	return func() { ConfigDefaults = old }
+}
@@ -38,3 +38,27 @@ func Change(s *state.State, snapName string, patchValues map[string]interface{})
 	task := hookstate.HookTask(s, hookTaskSummary, snapName, snap.Revision{}, "configure", initialContext)
 	return state.NewTaskSet(task)
 }
+
+const (
+	// UseConfigDefaults makes the configure hook start from the
+	// default configuration provided by the gadget for the snap.
+	UseConfigDefaults = 1 << iota
+)
+
+// ConfigDefaults allows to hook in retrieving the default configuration
+// of a snap. It returns state.ErrNoState if there is none.
+var ConfigDefaults func(s *state.State, snapName string) (map[string]interface{}, error)
+
+// Configure returns a taskset to run the configure hook of a snap, as
+// done when installing it.
+func Configure(s *state.State, snapName string, flags int) *state.TaskSet {
+	var initialContext map[string]interface{}
+	if flags&UseConfigDefaults != 0 {
+		initialContext = map[string]interface{}{
+			"use-defaults": true,
+		}
+	}
+	hookTaskSummary := fmt.Sprintf(i18n.G("Run configure hook for %s"), snapName)
+	task := hookstate.HookTask(s, hookTaskSummary, snapName, snap.Revision{}, "configure", initialContext)
+	return state.NewTaskSet(task)
+}
@@ -74,3 +74,35 @@ func (s *tasksetsSuite) TestChange(c *C) {
 		"foo": "bar",
 	})
 }
+
+func (s *tasksetsSuite) TestConfigure(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, t := range []struct {
+		flags       int
+		useDefaults bool
+	}{
+		{0, false},
+		{configstate.UseConfigDefaults, true},
+	} {
+		taskset := configstate.Configure(s.state, "test-snap", t.flags)
+		tasks := taskset.Tasks()
+		c.Assert(tasks, HasLen, 1)
+		task := tasks[0]
+		c.Assert(task.Kind(), Equals, "run-hook")
+
+		var setup hookstate.HookSetup
+		c.Assert(task.Get("hook-setup", &setup), IsNil)
+		c.Check(setup, DeepEquals, hookstate.HookSetup{Snap: "test-snap", Hook: "configure"})
+
+		var hookContext map[string]interface{}
+		err := task.Get("hook-context", &hookContext)
+		if t.useDefaults {
+			c.Check(err, IsNil)
+			c.Check(hookContext, DeepEquals, map[string]interface{}{"use-defaults": true})
+		} else {
+			c.Check(err, Equals, state.ErrNoState)
+		}
+	}
+}
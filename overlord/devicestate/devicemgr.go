@@ -73,6 +73,7 @@ func Manager(s *state.State, hookManager *hookstate.HookManager) (*DeviceManager
 
 	runner.AddHandler("generate-device-key", m.doGenerateDeviceKey, nil)
 	runner.AddHandler("request-serial", m.doRequestSerial, nil)
+	runner.AddHandler("mark-preseeded", m.doMarkPreseeded, nil)
 
 	return m, nil
 }
@@ -109,6 +110,12 @@ func (m *DeviceManager) ensureOperational() error {
 		return nil
 	}
 
+	if release.Preseeding {
+		// the device key and serial belong to each device, not
+		// to the image
+		return nil
+	}
+
 	if device.Brand == "" || device.Model == "" {
 		// need first-boot, loading of model assertion info
 		if release.OnClassic {
@@ -208,15 +215,321 @@ var (
 	serialRequestURL = deviceAPIBase + "devices"
 )
 
+// Reregister returns the tasks to get the registered device a new
+// serial, against a freshly generated device key, for its current
+// model or for newModel if not nil. newModel must be of the same
+// brand and series as the current model and is checked right away,
+// but it is only added to the system assertion database once the new
+// serial has been obtained, together with switching the device
+// identity. Failing tasks leave both untouched.
+func Reregister(st *state.State, newModel *asserts.Model) (*state.TaskSet, error) {
+	device, err := auth.Device(st)
+	if err != nil {
+		return nil, err
+	}
+	if device.Serial == "" {
+		return nil, fmt.Errorf("cannot reregister a device that is not registered yet")
+	}
+
+	if err := checkRegistrationInProgress(st, "reregister"); err != nil {
+		return nil, err
+	}
+
+	newDevice := &auth.DeviceState{
+		Brand: device.Brand,
+		Model: device.Model,
+	}
+	if newModel != nil {
+		if newModel.BrandID() != device.Brand {
+			return nil, fmt.Errorf("cannot reregister for a model of a different brand %q", newModel.BrandID())
+		}
+		if newModel.Series() != release.Series {
+			return nil, fmt.Errorf("cannot reregister for a model of series %q", newModel.Series())
+		}
+		if err := checkModel(st, newModel); err != nil {
+			return nil, fmt.Errorf("cannot reregister for model %s/%s: %v", newModel.BrandID(), newModel.Model(), err)
+		}
+		newDevice.Brand = newModel.BrandID()
+		newDevice.Model = newModel.Model()
+	}
+
+	return reregistrationTasks(st, newDevice, newModel, "")
+}
+
+var snapstateInstall = snapstate.Install
+
+// Remodel returns the tasks to move the registered device to
+// newModel, which must be of the same brand, series and architecture
+// as the current model. A different gadget snap is allowed only from
+// the same publisher as the current one. The snaps newly required by
+// newModel, including a different kernel or gadget, are installed on
+// behalf of userID from the channel they tracked before or otherwise
+// the one of the current kernel, and then the device is registered
+// again for newModel. newModel is checked right away but, as the
+// device identity, it is switched to only once all of this succeeded.
+// A failure undoes the installations, the previous kernel and gadget
+// are left installed.
+func Remodel(st *state.State, newModel *asserts.Model, userID int) ([]*state.TaskSet, error) {
+	device, err := auth.Device(st)
+	if err != nil {
+		return nil, err
+	}
+	if device.Serial == "" {
+		return nil, fmt.Errorf("cannot remodel a device that is not registered yet")
+	}
+
+	current, err := Model(st)
+	if err != nil {
+		return nil, fmt.Errorf("cannot remodel: cannot get current model: %v", err)
+	}
+	switch {
+	case newModel.BrandID() != current.BrandID():
+		return nil, fmt.Errorf("cannot remodel to a model of a different brand %q", newModel.BrandID())
+	case newModel.Series() != current.Series():
+		return nil, fmt.Errorf("cannot remodel to a model of a different series %q", newModel.Series())
+	case newModel.Architecture() != current.Architecture():
+		return nil, fmt.Errorf("cannot remodel to a model of a different architecture %q", newModel.Architecture())
+	}
+
+	if err := checkRegistrationInProgress(st, "remodel"); err != nil {
+		return nil, err
+	}
+
+	if err := checkModel(st, newModel); err != nil {
+		return nil, fmt.Errorf("cannot remodel to model %s/%s: %v", newModel.BrandID(), newModel.Model(), err)
+	}
+
+	newGadget := ""
+	if newModel.Gadget() != current.Gadget() {
+		newGadget = newModel.Gadget()
+		if err := checkNewGadget(st, newGadget); err != nil {
+			return nil, fmt.Errorf("cannot remodel to a model with a different gadget snap %q: %v", newGadget, err)
+		}
+	}
+
+	defaultChannel := "stable"
+	var kernelst snapstate.SnapState
+	err = snapstate.Get(st, current.Kernel(), &kernelst)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if kernelst.Channel != "" {
+		defaultChannel = kernelst.Channel
+	}
+
+	var tss []*state.TaskSet
+	needed := append([]string{newGadget, newModel.Kernel()}, newModel.RequiredSnaps()...)
+	for _, name := range needed {
+		if name == "" {
+			continue
+		}
+		var snapst snapstate.SnapState
+		err := snapstate.Get(st, name, &snapst)
+		if err == nil && snapst.HasCurrent() {
+			continue
+		}
+		if err != nil && err != state.ErrNoState {
+			return nil, err
+		}
+		channel := snapst.Channel
+		if channel == "" {
+			channel = defaultChannel
+		}
+		var flags snapstate.Flags
+		if name == newGadget {
+			flags = snapstate.ReplaceGadget
+		}
+		ts, err := snapstateInstall(st, name, channel, snap.R(0), userID, flags)
+		if err != nil {
+			return nil, fmt.Errorf("cannot remodel: %v", err)
+		}
+		tss = append(tss, ts)
+	}
+
+	regTs, err := reregistrationTasks(st, &auth.DeviceState{
+		Brand: newModel.BrandID(),
+		Model: newModel.Model(),
+	}, newModel, newGadget)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range tss {
+		regTs.WaitAll(ts)
+	}
+
+	return append(tss, regTs), nil
+}
+
+// checkRegistrationInProgress returns an error if the device is being
+// registered or moved to another model already.
+func checkRegistrationInProgress(st *state.State, op string) error {
+	for _, chg := range st.Changes() {
+		switch chg.Kind() {
+		case "become-operational", "reregister", "remodel":
+			if !chg.Status().Ready() {
+				return fmt.Errorf("cannot %s: device registration already in progress", op)
+			}
+		}
+	}
+	return nil
+}
+
+// checkModel checks that model is properly signed and not older than
+// a revision of it already known.
+func checkModel(st *state.State, model *asserts.Model) error {
+	db := assertstate.DB(st)
+	if err := db.Check(model); err != nil {
+		return err
+	}
+	a, err := db.Find(asserts.ModelType, map[string]string{
+		"series":   model.Series(),
+		"brand-id": model.BrandID(),
+		"model":    model.Model(),
+	})
+	if err == asserts.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if a.Revision() > model.Revision() {
+		return &asserts.RevisionError{Used: model.Revision(), Current: a.Revision()}
+	}
+	return nil
+}
+
+// checkNewGadget checks whether the gadget snap can be replaced by
+// the one named newGadget, which must be of the same publisher. A new
+// gadget that is not installed yet is checked when installed.
+func checkNewGadget(st *state.State, newGadget string) error {
+	info, err := snapstate.CurrentInfo(st, newGadget)
+	if err != nil {
+		// not installed
+		return nil
+	}
+	if info.Type != snap.TypeGadget {
+		return fmt.Errorf("snap %q is not a gadget", newGadget)
+	}
+	gadgetInfo, err := snapstate.GadgetInfo(st)
+	if err != nil {
+		return fmt.Errorf("cannot find current gadget snap: %v", err)
+	}
+	if info.DeveloperID == "" || info.DeveloperID != gadgetInfo.DeveloperID {
+		return fmt.Errorf("not of the same publisher as the current one")
+	}
+	return nil
+}
+
+// addModel adds model to the system assertion database, the same
+// revision of it already known is fine.
+func addModel(st *state.State, model *asserts.Model) error {
+	err := assertstate.Add(st, model)
+	if revErr, ok := err.(*asserts.RevisionError); ok && revErr.Used == revErr.Current {
+		return nil
+	}
+	return err
+}
+
+// reregistrationTasks returns the tasks to register the device with a
+// new key as newDevice, for newModel if not nil, running the
+// prepare-device hook of the gadget first. The gadget is newGadget if
+// set, it is replacing the current one then.
+func reregistrationTasks(st *state.State, newDevice *auth.DeviceState, newModel *asserts.Model, newGadget string) (*state.TaskSet, error) {
+	gadgetName := newGadget
+	hasPrepareDevice := true
+	if newGadget == "" {
+		gadgetInfo, err := snapstate.GadgetInfo(st)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find gadget snap: %v", err)
+		}
+		gadgetName = gadgetInfo.Name()
+		hasPrepareDevice = gadgetInfo.Hooks["prepare-device"] != nil
+	} else if gadgetInfo, err := snapstate.CurrentInfo(st, newGadget); err == nil {
+		hasPrepareDevice = gadgetInfo.Hooks["prepare-device"] != nil
+	}
+	// otherwise the new gadget is not installed yet, running a hook
+	// it doesn't have does nothing
+
+	tasks := []*state.Task{}
+
+	var prepareDevice *state.Task
+	if hasPrepareDevice {
+		summary := i18n.G("Run prepare-device hook")
+		prepareDevice = hookstate.HookTask(st, summary, gadgetName, snap.R(0), "prepare-device", nil)
+		tasks = append(tasks, prepareDevice)
+	}
+
+	genKey := st.NewTask("generate-device-key", i18n.G("Generate new device key"))
+	genKey.Set("new-device", newDevice)
+	if newModel != nil {
+		genKey.Set("new-model", string(asserts.Encode(newModel)))
+	}
+	if newGadget != "" {
+		genKey.Set("new-gadget", newGadget)
+	}
+	if prepareDevice != nil {
+		genKey.WaitFor(prepareDevice)
+	}
+	tasks = append(tasks, genKey)
+	requestSerial := st.NewTask("request-serial", i18n.G("Request new device serial"))
+	requestSerial.Set("new-device-task", genKey.ID())
+	requestSerial.WaitFor(genKey)
+	tasks = append(tasks, requestSerial)
+
+	return state.NewTaskSet(tasks...), nil
+}
+
+// newDevice returns the device identity being set up by a
+// reregistration together with the task holding it, or nil if t is
+// part of the initial registration.
+func newDevice(t *state.Task) (*auth.DeviceState, *state.Task, error) {
+	holder := t
+	var id string
+	err := t.Get("new-device-task", &id)
+	if err == nil {
+		holder = t.State().Task(id)
+		if holder == nil {
+			return nil, nil, fmt.Errorf("internal error: tasks are being pruned")
+		}
+	} else if err != state.ErrNoState {
+		return nil, nil, err
+	}
+
+	var device auth.DeviceState
+	err = holder.Get("new-device", &device)
+	if err == state.ErrNoState {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &device, holder, nil
+}
+
+// doMarkPreseeded holds back the rest of the seed change while
+// preseeding an image, the tasks waiting for it need the booted device.
+func (m *DeviceManager) doMarkPreseeded(t *state.Task, _ *tomb.Tomb) error {
+	if release.Preseeding {
+		return &state.Retry{}
+	}
+	return nil
+}
+
 func (m *DeviceManager) doGenerateDeviceKey(t *state.Task, _ *tomb.Tomb) error {
 	st := t.State()
 	st.Lock()
 	defer st.Unlock()
 
-	device, err := auth.Device(st)
+	device, holder, err := newDevice(t)
 	if err != nil {
 		return err
 	}
+	if device == nil {
+		device, err = auth.Device(st)
+		if err != nil {
+			return err
+		}
+	}
 
 	if device.KeyID != "" {
 		// nothing to do
@@ -235,7 +548,12 @@ func (m *DeviceManager) doGenerateDeviceKey(t *state.Task, _ *tomb.Tomb) error {
 	}
 
 	device.KeyID = privKey.PublicKey().ID()
-	auth.SetDevice(st, device)
+	if holder != nil {
+		// the device identity is switched only once we have the serial
+		holder.Set("new-device", device)
+	} else {
+		auth.SetDevice(st, device)
+	}
 	t.SetStatus(state.DoneStatus)
 	return nil
 }
@@ -246,6 +564,10 @@ func (m *DeviceManager) keyPair() (asserts.PrivateKey, error) {
 		return nil, err
 	}
 
+	return m.keyPairFor(device)
+}
+
+func (m *DeviceManager) keyPairFor(device *auth.DeviceState) (asserts.PrivateKey, error) {
 	if device.KeyID == "" {
 		return nil, state.ErrNoState
 	}
@@ -349,6 +671,9 @@ func submitSerialRequest(t *state.Task, serialRequest string, client *http.Clien
 	case 202:
 		return nil, errPoll
 	default:
+		if cfg.failOnRejection && resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, fmt.Errorf("device serial request was rejected: unexpected status %d", resp.StatusCode)
+		}
 		return nil, retryErr(t, "cannot deliver device serial request: unexpected status %d", resp.StatusCode)
 	}
 
@@ -430,6 +755,9 @@ type serialRequestConfig struct {
 	headers          map[string]string
 	proposedSerial   string
 	body             []byte
+	// failOnRejection is set when the request must fail instead of
+	// being retried if the serial service rejects it
+	failOnRejection bool
 }
 
 func (cfg *serialRequestConfig) applyHeaders(req *http.Request) {
@@ -438,16 +766,27 @@ func (cfg *serialRequestConfig) applyHeaders(req *http.Request) {
 	}
 }
 
-func getSerialRequestConfig(t *state.Task) (*serialRequestConfig, error) {
-	gadgetInfo, err := snapstate.GadgetInfo(t.State())
-	if err != nil {
-		return nil, fmt.Errorf("cannot find gadget snap and its name: %v", err)
+// getSerialRequestConfig returns the serial request configuration
+// from the gadget, the new one set on holder if replacing it.
+func getSerialRequestConfig(t *state.Task, holder *state.Task) (*serialRequestConfig, error) {
+	var gadgetName string
+	if holder != nil {
+		err := holder.Get("new-gadget", &gadgetName)
+		if err != nil && err != state.ErrNoState {
+			return nil, err
+		}
+	}
+	if gadgetName == "" {
+		gadgetInfo, err := snapstate.GadgetInfo(t.State())
+		if err != nil {
+			return nil, fmt.Errorf("cannot find gadget snap and its name: %v", err)
+		}
+		gadgetName = gadgetInfo.Name()
 	}
-	gadgetName := gadgetInfo.Name()
 
 	tr := configstate.NewTransaction(t.State())
 	var svcURL string
-	err = tr.GetMaybe(gadgetName, "device-service-url", &svcURL)
+	err := tr.GetMaybe(gadgetName, "device-service-url", &svcURL)
 	if err != nil {
 		return nil, err
 	}
@@ -509,17 +848,26 @@ func (m *DeviceManager) doRequestSerial(t *state.Task, _ *tomb.Tomb) error {
 	st.Lock()
 	defer st.Unlock()
 
-	cfg, err := getSerialRequestConfig(t)
+	device, holder, err := newDevice(t)
 	if err != nil {
 		return err
 	}
 
-	device, err := auth.Device(st)
+	cfg, err := getSerialRequestConfig(t, holder)
 	if err != nil {
 		return err
 	}
 
-	privKey, err := m.keyPair()
+	if holder != nil {
+		cfg.failOnRejection = true
+	} else {
+		device, err = auth.Device(st)
+		if err != nil {
+			return err
+		}
+	}
+
+	privKey, err := m.keyPairFor(device)
 	if err == state.ErrNoState {
 		return fmt.Errorf("internal error: cannot find device key pair")
 	}
@@ -537,8 +885,9 @@ func (m *DeviceManager) doRequestSerial(t *state.Task, _ *tomb.Tomb) error {
 
 	if len(serials) == 1 {
 		// means we saved the assertion but didn't get to the end of the task
-		device.Serial = serials[0].(*asserts.Serial).Serial()
-		auth.SetDevice(st, device)
+		if err := setDeviceSerial(st, device, serials[0].(*asserts.Serial), holder); err != nil {
+			return err
+		}
 		t.SetStatus(state.DoneStatus)
 		return nil
 	}
@@ -585,13 +934,41 @@ func (m *DeviceManager) doRequestSerial(t *state.Task, _ *tomb.Tomb) error {
 		return &state.Retry{}
 	}
 
-	device.Serial = serial.Serial()
-	auth.SetDevice(st, device)
+	if err := setDeviceSerial(st, device, serial, holder); err != nil {
+		return err
+	}
 
 	t.SetStatus(state.DoneStatus)
 	return nil
 }
 
+// setDeviceSerial records the obtained serial. When reregistering,
+// holder is the task holding the new device identity, which is then
+// switched to in one go, after adding the new model if any.
+func setDeviceSerial(st *state.State, device *auth.DeviceState, serial *asserts.Serial, holder *state.Task) error {
+	device.Serial = serial.Serial()
+	if holder != nil {
+		var encoded string
+		err := holder.Get("new-model", &encoded)
+		if err != nil && err != state.ErrNoState {
+			return err
+		}
+		if err == nil {
+			a, err := asserts.Decode([]byte(encoded))
+			if err != nil {
+				return fmt.Errorf("internal error: cannot decode new model: %v", err)
+			}
+			if err := addModel(st, a.(*asserts.Model)); err != nil {
+				return fmt.Errorf("cannot add new model: %v", err)
+			}
+		}
+		// the store session belonged to the previous identity
+		device.SessionMacaroon = ""
+	}
+	auth.SetDevice(st, device)
+	return nil
+}
+
 var repeatRequestSerial string
 
 // implementing auth.DeviceAssertions
@@ -644,6 +1021,14 @@ func (m *DeviceManager) DeviceSessionRequest(nonce string) (*asserts.DeviceSessi
 
 }
 
+// ProxyStore returns the store assertion for the store the device model points to.
+func (m *DeviceManager) ProxyStore() (*asserts.Store, error) {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	return ProxyStore(m.state)
+}
+
 // Model returns the device model assertion.
 func Model(st *state.State) (*asserts.Model, error) {
 	device, err := auth.Device(st)
@@ -670,6 +1055,30 @@ func Model(st *state.State) (*asserts.Model, error) {
 	return a.(*asserts.Model), nil
 }
 
+// ProxyStore returns the store assertion for the store the device
+// model points to, if the model sets one and the assertion is known.
+func ProxyStore(st *state.State) (*asserts.Store, error) {
+	model, err := Model(st)
+	if err != nil {
+		return nil, err
+	}
+	if model.Store() == "" {
+		return nil, state.ErrNoState
+	}
+
+	a, err := assertstate.DB(st).Find(asserts.StoreType, map[string]string{
+		"store": model.Store(),
+	})
+	if err == asserts.ErrNotFound {
+		return nil, state.ErrNoState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a.(*asserts.Store), nil
+}
+
 // Serial returns the device serial assertion.
 func Serial(st *state.State) (*asserts.Serial, error) {
 	device, err := auth.Device(st)
@@ -695,3 +1104,15 @@ func Serial(st *state.State) (*asserts.Serial, error) {
 
 	return a.(*asserts.Serial), nil
 }
+
+func modelGadget(st *state.State) (string, error) {
+	model, err := Model(st)
+	if err != nil {
+		return "", err
+	}
+	return model.Gadget(), nil
+}
+
+func init() {
+	snapstate.ModelGadget = modelGadget
+}
@@ -45,6 +45,7 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/store"
@@ -89,10 +90,14 @@ func (*fakeStore) Snap(string, string, bool, snap.Revision, *auth.UserState) (*s
 	panic("fakeStore.Snap not expected")
 }
 
-func (sto *fakeStore) Find(*store.Search, *auth.UserState) ([]*snap.Info, error) {
+func (sto *fakeStore) Find(*store.Search, *auth.UserState) ([]*snap.Info, *store.Paging, error) {
 	panic("fakeStore.Find not expected")
 }
 
+func (sto *fakeStore) Sections(*auth.UserState) ([]string, error) {
+	panic("fakeStore.Sections not expected")
+}
+
 func (sto *fakeStore) ListRefresh([]*store.RefreshCandidate, *auth.UserState) ([]*snap.Info, error) {
 	panic("fakeStore.ListRefresh not expected")
 }
@@ -101,6 +106,10 @@ func (sto *fakeStore) Download(string, *snap.DownloadInfo, progress.Meter, *auth
 	panic("fakeStore.Download not expected")
 }
 
+func (sto *fakeStore) SetDownloadRateLimit(int64) {
+	panic("fakeStore.SetDownloadRateLimit not expected")
+}
+
 func (sto *fakeStore) SuggestedCurrency() string {
 	panic("fakeStore.SuggestedCurrency not expected")
 }
@@ -226,8 +235,9 @@ func (s *deviceMgrSuite) mockServer(c *C, reqID string) *httptest.Server {
 
 func (s *deviceMgrSuite) setupGadget(c *C, snapYaml string) {
 	sideInfoGadget := &snap.SideInfo{
-		RealName: "gadget",
-		Revision: snap.R(2),
+		RealName:    "gadget",
+		Revision:    snap.R(2),
+		DeveloperID: "canonical",
 	}
 	snaptest.MockSnap(c, snapYaml, sideInfoGadget)
 	snapstate.Set(s.state, "gadget", &snapstate.SnapState{
@@ -306,6 +316,556 @@ version: gadget
 	c.Check(device.KeyID, Equals, privKey.PublicKey().ID())
 }
 
+func (s *deviceMgrSuite) TestNoDeviceRegistrationWhilePreseeding(c *C) {
+	restore := release.MockPreseeding(true)
+	defer restore()
+	r := devicestate.MockSerialRequestURL("http://serial.invalid")
+	defer r()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupGadget(c, `
+name: gadget
+type: gadget
+version: gadget
+`)
+	auth.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+
+	s.state.Unlock()
+	s.settle()
+	s.state.Lock()
+
+	c.Check(s.state.Changes(), HasLen, 0)
+}
+
+func (s *deviceMgrSuite) TestMarkPreseeded(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg := s.state.NewChange("seed", "...")
+	mark := s.state.NewTask("mark-preseeded", "...")
+	chg.AddTask(mark)
+
+	restore := release.MockPreseeding(true)
+	s.state.Unlock()
+	s.settle()
+	s.state.Lock()
+	restore()
+
+	// held back until the image boots
+	c.Check(mark.Status(), Equals, state.DoingStatus)
+
+	s.state.Unlock()
+	s.settle()
+	s.state.Lock()
+
+	c.Check(mark.Status(), Equals, state.DoneStatus)
+}
+
+func (s *deviceMgrSuite) mockReregistrationServer(c *C, reject bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/identity/api/v1/request-id":
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"request-id": "REQID-2"}`)
+		case "/identity/api/v1/devices":
+			if reject {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, IsNil)
+			a, err := asserts.Decode(b)
+			c.Assert(err, IsNil)
+			serialReq := a.(*asserts.SerialRequest)
+			serial, err := s.storeSigning.Sign(asserts.SerialType, map[string]interface{}{
+				"brand-id":            serialReq.BrandID(),
+				"model":               serialReq.Model(),
+				"serial":              "10000",
+				"device-key":          serialReq.HeaderString("device-key"),
+				"device-key-sha3-384": serialReq.SignKeyID(),
+				"timestamp":           time.Now().Format(time.RFC3339),
+			}, nil, "")
+			c.Assert(err, IsNil)
+			w.Header().Set("Content-Type", asserts.MediaType)
+			w.WriteHeader(http.StatusOK)
+			w.Write(asserts.Encode(serial))
+		}
+	}))
+}
+
+func (s *deviceMgrSuite) setupRegistered(c *C) *asserts.PrivateKey {
+	privKey, _ := assertstest.GenerateKey(752)
+	s.mgr.KeypairManager().Put(privKey)
+	s.setupGadget(c, `
+name: gadget
+type: gadget
+version: gadget
+`)
+	auth.SetDevice(s.state, &auth.DeviceState{
+		Brand:           "canonical",
+		Model:           "pc",
+		Serial:          "9999",
+		KeyID:           privKey.PublicKey().ID(),
+		SessionMacaroon: "old-session",
+	})
+	return &privKey
+}
+
+func (s *deviceMgrSuite) runReregister(c *C, newModel *asserts.Model) *state.Change {
+	ts, err := devicestate.Reregister(s.state, newModel)
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("reregister", "...")
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	s.settle()
+	s.state.Lock()
+	return chg
+}
+
+func (s *deviceMgrSuite) TestReregisterHappy(c *C) {
+	r1 := devicestate.MockKeyLength(752)
+	defer r1()
+	mockServer := s.mockReregistrationServer(c, false)
+	defer mockServer.Close()
+	r2 := devicestate.MockRequestIDURL(mockServer.URL + "/identity/api/v1/request-id")
+	defer r2()
+	r3 := devicestate.MockSerialRequestURL(mockServer.URL + "/identity/api/v1/devices")
+	defer r3()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	oldKey := s.setupRegistered(c)
+
+	chg := s.runReregister(c, nil)
+	c.Assert(chg.Err(), IsNil)
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+
+	device, err := auth.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device.Brand, Equals, "canonical")
+	c.Check(device.Model, Equals, "pc")
+	c.Check(device.Serial, Equals, "10000")
+	c.Check(device.KeyID, Not(Equals), (*oldKey).PublicKey().ID())
+	c.Check(device.SessionMacaroon, Equals, "")
+
+	a, err := s.db.Find(asserts.SerialType, map[string]string{
+		"brand-id": "canonical",
+		"model":    "pc",
+		"serial":   "10000",
+	})
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.Serial).DeviceKey().ID(), Equals, device.KeyID)
+	_, err = s.mgr.KeypairManager().Get(device.KeyID)
+	c.Check(err, IsNil)
+}
+
+func (s *deviceMgrSuite) TestReregisterNewModel(c *C) {
+	r1 := devicestate.MockKeyLength(752)
+	defer r1()
+	mockServer := s.mockReregistrationServer(c, false)
+	defer mockServer.Close()
+	r2 := devicestate.MockRequestIDURL(mockServer.URL + "/identity/api/v1/request-id")
+	defer r2()
+	r3 := devicestate.MockSerialRequestURL(mockServer.URL + "/identity/api/v1/devices")
+	defer r3()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupRegistered(c)
+
+	newModel, err := s.storeSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "canonical",
+		"model":        "pc2",
+		"gadget":       "gadget",
+		"kernel":       "kernel",
+		"architecture": "amd64",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	ts, err := devicestate.Reregister(s.state, newModel.(*asserts.Model))
+	c.Assert(err, IsNil)
+
+	// the model is not added before the serial is obtained
+	_, err = s.db.Find(asserts.ModelType, map[string]string{
+		"series":   "16",
+		"brand-id": "canonical",
+		"model":    "pc2",
+	})
+	c.Check(err, Equals, asserts.ErrNotFound)
+
+	chg := s.state.NewChange("reregister", "...")
+	chg.AddAll(ts)
+	s.state.Unlock()
+	s.settle()
+	s.state.Lock()
+	c.Assert(chg.Err(), IsNil)
+
+	// the checked model got added
+	_, err = s.db.Find(asserts.ModelType, map[string]string{
+		"series":   "16",
+		"brand-id": "canonical",
+		"model":    "pc2",
+	})
+	c.Check(err, IsNil)
+
+	device, err := auth.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device.Model, Equals, "pc2")
+	c.Check(device.Serial, Equals, "10000")
+}
+
+func (s *deviceMgrSuite) TestReregisterRejectedRollsBack(c *C) {
+	r1 := devicestate.MockKeyLength(752)
+	defer r1()
+	mockServer := s.mockReregistrationServer(c, true)
+	defer mockServer.Close()
+	r2 := devicestate.MockRequestIDURL(mockServer.URL + "/identity/api/v1/request-id")
+	defer r2()
+	r3 := devicestate.MockSerialRequestURL(mockServer.URL + "/identity/api/v1/devices")
+	defer r3()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	oldKey := s.setupRegistered(c)
+
+	chg := s.runReregister(c, nil)
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*device serial request was rejected: unexpected status 400.*`)
+
+	// the device identity is untouched
+	device, err := auth.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device, DeepEquals, &auth.DeviceState{
+		Brand:           "canonical",
+		Model:           "pc",
+		Serial:          "9999",
+		KeyID:           (*oldKey).PublicKey().ID(),
+		SessionMacaroon: "old-session",
+	})
+}
+
+func (s *deviceMgrSuite) TestReregisterNewRevisionRejectedKeepsModel(c *C) {
+	r1 := devicestate.MockKeyLength(752)
+	defer r1()
+	mockServer := s.mockReregistrationServer(c, true)
+	defer mockServer.Close()
+	r2 := devicestate.MockRequestIDURL(mockServer.URL + "/identity/api/v1/request-id")
+	defer r2()
+	r3 := devicestate.MockSerialRequestURL(mockServer.URL + "/identity/api/v1/devices")
+	defer r3()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupRegistered(c)
+	c.Assert(assertstate.Add(s.state, s.makeModel(c, "pc", nil)), IsNil)
+
+	chg := s.runReregister(c, s.makeModel(c, "pc", map[string]interface{}{
+		"revision": "1",
+	}))
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+
+	// the new revision of the model was not added
+	model, err := devicestate.Model(s.state)
+	c.Assert(err, IsNil)
+	c.Check(model.Revision(), Equals, 0)
+}
+
+func (s *deviceMgrSuite) TestReregisterErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	auth.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+	_, err := devicestate.Reregister(s.state, nil)
+	c.Check(err, ErrorMatches, `cannot reregister a device that is not registered yet`)
+
+	s.setupRegistered(c)
+	chg := s.state.NewChange("reregister", "...")
+	chg.AddTask(s.state.NewTask("generate-device-key", "..."))
+	_, err = devicestate.Reregister(s.state, nil)
+	c.Check(err, ErrorMatches, `cannot reregister: device registration already in progress`)
+}
+
+func (s *deviceMgrSuite) otherBrandModel(c *C) *asserts.Model {
+	privKey, _ := assertstest.GenerateKey(752)
+	otherSigning := assertstest.NewSigningDB("other-brand", privKey)
+	a, err := otherSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "other-brand",
+		"model":        "pc",
+		"gadget":       "gadget",
+		"kernel":       "kernel",
+		"architecture": "amd64",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.Model)
+}
+
+func (s *deviceMgrSuite) TestReregisterOtherBrand(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupRegistered(c)
+
+	_, err := devicestate.Reregister(s.state, s.otherBrandModel(c))
+	c.Check(err, ErrorMatches, `cannot reregister for a model of a different brand "other-brand"`)
+
+	// the rejected model was not added
+	_, err = s.db.Find(asserts.ModelType, map[string]string{
+		"series":   "16",
+		"brand-id": "other-brand",
+		"model":    "pc",
+	})
+	c.Check(err, Equals, asserts.ErrNotFound)
+}
+
+func (s *deviceMgrSuite) makeModel(c *C, modelName string, extraHeaders map[string]interface{}) *asserts.Model {
+	headers := map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "canonical",
+		"model":        modelName,
+		"gadget":       "gadget",
+		"kernel":       "kernel",
+		"architecture": "amd64",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+	for k, v := range extraHeaders {
+		headers[k] = v
+	}
+	a, err := s.storeSigning.Sign(asserts.ModelType, headers, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.Model)
+}
+
+func (s *deviceMgrSuite) setupRemodel(c *C) {
+	s.setupRegistered(c)
+	c.Assert(assertstate.Add(s.state, s.makeModel(c, "pc", nil)), IsNil)
+	sideInfoKernel := &snap.SideInfo{
+		RealName: "kernel",
+		Revision: snap.R(3),
+	}
+	snapstate.Set(s.state, "kernel", &snapstate.SnapState{
+		SnapType: "kernel",
+		Channel:  "edge",
+		Active:   true,
+		Sequence: []*snap.SideInfo{sideInfoKernel},
+		Current:  sideInfoKernel.Revision,
+	})
+}
+
+func (s *deviceMgrSuite) TestRemodelTasks(c *C) {
+	var installed []string
+	restore := devicestate.MockSnapstateInstall(func(st *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		// new snaps follow the channel of the current kernel
+		c.Check(channel, Equals, "edge")
+		c.Check(userID, Equals, 42)
+		installed = append(installed, name)
+		t := st.NewTask("fake-install-snap", name)
+		return state.NewTaskSet(t), nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupRemodel(c)
+
+	newModel := s.makeModel(c, "pc2", map[string]interface{}{
+		"kernel":         "other-kernel",
+		"required-snaps": []interface{}{"foo", "gadget"},
+	})
+
+	tss, err := devicestate.Remodel(s.state, newModel, 42)
+	c.Assert(err, IsNil)
+	// the already installed gadget is left alone
+	c.Check(installed, DeepEquals, []string{"other-kernel", "foo"})
+	c.Assert(tss, HasLen, 3)
+
+	regTasks := tss[2].Tasks()
+	c.Assert(regTasks, HasLen, 2)
+	genKey, requestSerial := regTasks[0], regTasks[1]
+	c.Check(genKey.Kind(), Equals, "generate-device-key")
+	c.Check(requestSerial.Kind(), Equals, "request-serial")
+	c.Check(genKey.WaitTasks(), DeepEquals, []*state.Task{
+		tss[0].Tasks()[0],
+		tss[1].Tasks()[0],
+	})
+
+	var newDevice auth.DeviceState
+	c.Assert(genKey.Get("new-device", &newDevice), IsNil)
+	c.Check(newDevice, DeepEquals, auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc2",
+	})
+	var id string
+	c.Assert(requestSerial.Get("new-device-task", &id), IsNil)
+	c.Check(id, Equals, genKey.ID())
+
+	var encoded string
+	c.Assert(genKey.Get("new-model", &encoded), IsNil)
+	c.Check(encoded, Equals, string(asserts.Encode(newModel)))
+
+	// the device identity and model are switched only by request-serial
+	device, err := auth.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device.Model, Equals, "pc")
+	_, err = s.db.Find(asserts.ModelType, map[string]string{
+		"series":   "16",
+		"brand-id": "canonical",
+		"model":    "pc2",
+	})
+	c.Check(err, Equals, asserts.ErrNotFound)
+}
+
+func (s *deviceMgrSuite) TestRemodelNewGadget(c *C) {
+	var installed []string
+	restore := devicestate.MockSnapstateInstall(func(st *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		installed = append(installed, name)
+		c.Check(flags, Equals, snapstate.Flags(snapstate.ReplaceGadget))
+		t := st.NewTask("fake-install-snap", name)
+		return state.NewTaskSet(t), nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupRemodel(c)
+
+	newModel := s.makeModel(c, "pc2", map[string]interface{}{
+		"gadget": "other-gadget",
+	})
+
+	tss, err := devicestate.Remodel(s.state, newModel, 0)
+	c.Assert(err, IsNil)
+	c.Check(installed, DeepEquals, []string{"other-gadget"})
+	c.Assert(tss, HasLen, 2)
+
+	// the prepare-device hook of the new gadget is run
+	regTasks := tss[1].Tasks()
+	c.Assert(regTasks, HasLen, 3)
+	prepareDevice, genKey := regTasks[0], regTasks[1]
+	c.Check(prepareDevice.Kind(), Equals, "run-hook")
+	var hooksup hookstate.HookSetup
+	c.Assert(prepareDevice.Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup.Snap, Equals, "other-gadget")
+	c.Check(hooksup.Hook, Equals, "prepare-device")
+	c.Check(prepareDevice.WaitTasks(), DeepEquals, []*state.Task{tss[0].Tasks()[0]})
+
+	var newGadget string
+	c.Assert(genKey.Get("new-gadget", &newGadget), IsNil)
+	c.Check(newGadget, Equals, "other-gadget")
+}
+
+func (s *deviceMgrSuite) TestRemodelInstalledGadgetOtherPublisher(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupRemodel(c)
+
+	sideInfo := &snap.SideInfo{
+		RealName:    "other-gadget",
+		Revision:    snap.R(1),
+		DeveloperID: "someone-else",
+	}
+	snaptest.MockSnap(c, "name: other-gadget\ntype: gadget\nversion: 1\n", sideInfo)
+	snapstate.Set(s.state, "other-gadget", &snapstate.SnapState{
+		SnapType: "gadget",
+		Active:   true,
+		Sequence: []*snap.SideInfo{sideInfo},
+		Current:  sideInfo.Revision,
+	})
+
+	newModel := s.makeModel(c, "pc2", map[string]interface{}{
+		"gadget": "other-gadget",
+	})
+	_, err := devicestate.Remodel(s.state, newModel, 0)
+	c.Check(err, ErrorMatches, `cannot remodel to a model with a different gadget snap "other-gadget": not of the same publisher as the current one`)
+}
+
+func (s *deviceMgrSuite) TestRemodelNothingToInstall(c *C) {
+	restore := devicestate.MockSnapstateInstall(func(st *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		c.Fatalf("unexpected install of %q", name)
+		return nil, nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupRemodel(c)
+
+	newModel := s.makeModel(c, "pc2", nil)
+
+	tss, err := devicestate.Remodel(s.state, newModel, 0)
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 1)
+	c.Check(tss[0].Tasks(), HasLen, 2)
+
+	// the model is added only with the new serial
+	_, err = s.db.Find(asserts.ModelType, map[string]string{
+		"series":   "16",
+		"brand-id": "canonical",
+		"model":    "pc2",
+	})
+	c.Check(err, Equals, asserts.ErrNotFound)
+}
+
+func (s *deviceMgrSuite) TestRemodelErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	auth.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+	_, err := devicestate.Remodel(s.state, s.makeModel(c, "pc2", nil), 0)
+	c.Check(err, ErrorMatches, `cannot remodel a device that is not registered yet`)
+
+	s.setupRemodel(c)
+
+	for _, t := range []struct {
+		headers map[string]interface{}
+		err     string
+	}{
+		{map[string]interface{}{"architecture": "armhf"}, `cannot remodel to a model of a different architecture "armhf"`},
+	} {
+		_, err := devicestate.Remodel(s.state, s.makeModel(c, "pc2", t.headers), 0)
+		c.Check(err, ErrorMatches, t.err)
+	}
+	_, err = devicestate.Remodel(s.state, s.otherBrandModel(c), 0)
+	c.Check(err, ErrorMatches, `cannot remodel to a model of a different brand "other-brand"`)
+
+	// none of the rejected models was added
+	_, err = s.db.Find(asserts.ModelType, map[string]string{
+		"series":   "16",
+		"brand-id": "canonical",
+		"model":    "pc2",
+	})
+	c.Check(err, Equals, asserts.ErrNotFound)
+
+	// an older revision of a known model is rejected
+	c.Assert(assertstate.Add(s.state, s.makeModel(c, "pc3", map[string]interface{}{
+		"revision": "2",
+	})), IsNil)
+	_, err = devicestate.Remodel(s.state, s.makeModel(c, "pc3", map[string]interface{}{
+		"revision": "1",
+	}), 0)
+	c.Check(err, ErrorMatches, `cannot remodel to model canonical/pc3: revision 1 is older than current revision 2`)
+
+	newModel := s.makeModel(c, "pc2", nil)
+	chg := s.state.NewChange("reregister", "...")
+	chg.AddTask(s.state.NewTask("generate-device-key", "..."))
+	_, err = devicestate.Remodel(s.state, newModel, 0)
+	c.Check(err, ErrorMatches, `cannot remodel: device registration already in progress`)
+}
+
 func (s *deviceMgrSuite) TestDoRequestSerialIdempotentAfterAddSerial(c *C) {
 	privKey, _ := assertstest.GenerateKey(1024)
 
@@ -708,6 +1268,84 @@ func (s *deviceMgrSuite) TestDeviceAssertionsModelAndSerial(c *C) {
 	c.Check(ser.Serial(), Equals, "8989")
 }
 
+func (s *deviceMgrSuite) TestDeviceAssertionsProxyStore(c *C) {
+	// nothing in the state
+	_, err := s.mgr.ProxyStore()
+	c.Check(err, Equals, state.ErrNoState)
+
+	s.state.Lock()
+	auth.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+	s.state.Unlock()
+
+	// a model without a store
+	model, err := s.storeSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "canonical",
+		"model":        "pc",
+		"gadget":       "pc",
+		"kernel":       "kernel",
+		"architecture": "amd64",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	s.state.Lock()
+	err = assertstate.Add(s.state, model)
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	_, err = s.mgr.ProxyStore()
+	c.Check(err, Equals, state.ErrNoState)
+
+	// a new revision pointing to a store, whose assertion is missing
+	model, err = s.storeSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "canonical",
+		"model":        "pc",
+		"gadget":       "pc",
+		"kernel":       "kernel",
+		"architecture": "amd64",
+		"store":        "brand-store",
+		"revision":     "1",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	s.state.Lock()
+	err = assertstate.Add(s.state, model)
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	_, err = s.mgr.ProxyStore()
+	c.Check(err, Equals, state.ErrNoState)
+
+	// have the store assertion
+	operator := assertstest.NewAccount(s.storeSigning, "operator", nil, "")
+	store, err := s.storeSigning.Sign(asserts.StoreType, map[string]interface{}{
+		"store":       "brand-store",
+		"operator-id": operator.AccountID(),
+		"url":         "https://brand-store.example.com/",
+		"timestamp":   time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	s.state.Lock()
+	err = assertstate.Add(s.state, operator)
+	c.Assert(err, IsNil)
+	err = assertstate.Add(s.state, store)
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+
+	sto, err := s.mgr.ProxyStore()
+	c.Assert(err, IsNil)
+	c.Check(sto.Store(), Equals, "brand-store")
+	c.Check(sto.URL().String(), Equals, "https://brand-store.example.com/")
+
+	s.state.Lock()
+	sto, err = devicestate.ProxyStore(s.state)
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	c.Check(sto.Store(), Equals, "brand-store")
+}
+
 func (s *deviceMgrSuite) TestDeviceAssertionsDeviceSessionRequest(c *C) {
 	// nothing there
 	_, _, err := s.mgr.DeviceSessionRequest("NONCE-1")
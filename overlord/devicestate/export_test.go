@@ -23,6 +23,9 @@ import (
 	"time"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
 )
 
 func MockKeyLength(n int) (restore func()) {
@@ -68,3 +71,11 @@ func MockRepeatRequestSerial(label string) (restore func()) {
 		repeatRequestSerial = old
 	}
 }
+
+func MockSnapstateInstall(f func(st *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error)) (restore func()) {
+	old := snapstateInstall
+	snapstateInstall = f
+	return func() {
+		snapstateInstall = old
+	}
+}
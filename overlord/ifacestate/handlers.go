@@ -106,6 +106,9 @@ func (m *InterfaceManager) doSetupProfiles(task *state.Task, _ *tomb.Tomb) error
 	if err := m.autoConnect(task, snapName, blacklist); err != nil {
 		return err
 	}
+	if err := m.gadgetConnect(task, snapInfo); err != nil {
+		return err
+	}
 	if err := setupSnapSecurity(task, snapInfo, ss.DevModeAllowed(), m.repo); err != nil {
 		return err
 	}
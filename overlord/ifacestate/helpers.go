@@ -23,12 +23,16 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/backends"
 	"github.com/snapcore/snapd/interfaces/builtin"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 )
 
@@ -212,3 +216,142 @@ func getConns(st *state.State) (map[string]connState, error) {
 func setConns(st *state.State, conns map[string]connState) {
 	st.Set("conns", conns)
 }
+
+// gadgetConnect establishes the connections declared by the gadget of
+// the device that involve the given newly installed snap, or all of
+// them when it is the gadget itself. Only the gadget named by the model
+// and published by its brand can declare connections.
+func (m *InterfaceManager) gadgetConnect(task *state.Task, snapInfo *snap.Info) error {
+	st := task.State()
+	snapName := snapInfo.Name()
+
+	var snapst snapstate.SnapState
+	err := snapstate.Get(st, snapName, &snapst)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if snapst.HasCurrent() {
+		// only on install, connections may have been changed since
+		return nil
+	}
+
+	model, err := devicestate.Model(st)
+	if err == state.ErrNoState {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the snaps in the repository by snap-id
+	snaps := make(map[string]*snap.Info)
+	for _, plug := range m.repo.AllPlugs("") {
+		snaps[plug.Snap.SnapID] = plug.Snap
+	}
+	for _, slot := range m.repo.AllSlots("") {
+		snaps[slot.Snap.SnapID] = slot.Snap
+	}
+	delete(snaps, "")
+
+	var gadget *snap.Info
+	if snapName == model.Gadget() {
+		gadget = snapInfo
+	} else {
+		gadget, err = snapstate.CurrentInfo(st, model.Gadget())
+		if err != nil {
+			// not linked yet while preseeding, look for it in
+			// the repository
+			for _, info := range snaps {
+				if info.Name() == model.Gadget() {
+					gadget = info
+					break
+				}
+			}
+		}
+		if gadget == nil {
+			return nil
+		}
+	}
+
+	gadgetInfo, err := snap.ReadGadgetInfo(gadget)
+	if err != nil {
+		return err
+	}
+	if len(gadgetInfo.Connections) == 0 {
+		return nil
+	}
+	if err := checkGadgetFromBrand(st, gadget, model); err != nil {
+		task.Logf("cannot use connections of gadget %q: %s", gadget.Name(), err)
+		return nil
+	}
+
+	conns, err := getConns(st)
+	if err != nil {
+		return err
+	}
+	affected := make(map[string]*snap.Info)
+	for _, gconn := range gadgetInfo.Connections {
+		plugSnap := snaps[gconn.Plug.SnapID]
+		slotSnap := snaps[gconn.Slot.SnapID]
+		if plugSnap == nil || slotSnap == nil {
+			// the other snap is not there (yet)
+			continue
+		}
+		if snapName != gadget.Name() && plugSnap.Name() != snapName && slotSnap.Name() != snapName {
+			continue
+		}
+		plugRef := &interfaces.PlugRef{Snap: plugSnap.Name(), Name: gconn.Plug.Plug}
+		slotRef := &interfaces.SlotRef{Snap: slotSnap.Name(), Name: gconn.Slot.Slot}
+		id := connID(plugRef, slotRef)
+		if _, ok := conns[id]; ok {
+			continue
+		}
+		if err := m.repo.Connect(plugRef.Snap, plugRef.Name, slotRef.Snap, slotRef.Name); err != nil {
+			task.Logf("cannot connect %s:%s to %s:%s as declared by gadget %q: %s",
+				plugRef.Snap, plugRef.Name, slotRef.Snap, slotRef.Name, gadget.Name(), err)
+			continue
+		}
+		conns[id] = connState{Interface: m.repo.Plug(plugRef.Snap, plugRef.Name).Interface, Auto: true}
+		for _, info := range []*snap.Info{plugSnap, slotSnap} {
+			if info.Name() != snapName {
+				affected[info.Name()] = info
+			}
+		}
+	}
+	setConns(st, conns)
+
+	// the snap itself is setup by the caller
+	for name, info := range affected {
+		var snapst snapstate.SnapState
+		err := snapstate.Get(st, name, &snapst)
+		if err != nil && err != state.ErrNoState {
+			return err
+		}
+		if err := setupSnapSecurity(task, info, snapst.DevModeAllowed(), m.repo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGadgetFromBrand checks that the gadget snap is asserted as
+// published by the brand of the model.
+func checkGadgetFromBrand(st *state.State, gadget *snap.Info, model *asserts.Model) error {
+	if gadget.SnapID == "" {
+		return fmt.Errorf("gadget is not asserted")
+	}
+	a, err := assertstate.DB(st).Find(asserts.SnapDeclarationType, map[string]string{
+		"series":  release.Series,
+		"snap-id": gadget.SnapID,
+	})
+	if err == asserts.ErrNotFound {
+		return fmt.Errorf("no snap-declaration for gadget")
+	}
+	if err != nil {
+		return err
+	}
+	if publisher := a.(*asserts.SnapDeclaration).PublisherID(); publisher != model.BrandID() {
+		return fmt.Errorf("gadget is published by %q, not by brand %q", publisher, model.BrandID())
+	}
+	return nil
+}
@@ -20,12 +20,19 @@
 package ifacestate_test
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
@@ -1032,3 +1039,207 @@ func (s *interfaceManagerSuite) TestSetupProfilesDevModeMultiple(c *C) {
 	c.Check(s.secBackend.SetupCalls[1].SnapInfo.Name(), Equals, siP.Name())
 	c.Check(s.secBackend.SetupCalls[1].DevMode, Equals, false)
 }
+
+var (
+	rootPrivKey, _  = assertstest.GenerateKey(1024)
+	storePrivKey, _ = assertstest.GenerateKey(752)
+	brandPrivKey, _ = assertstest.GenerateKey(752)
+)
+
+// mockModelAndGadgetDecl sets up a device with a model for the brand
+// "my-brand" naming the gadget "gadget", whose snap-declaration has
+// the given publisher.
+func (s *interfaceManagerSuite) mockModelAndGadgetDecl(c *C, gadgetPublisher string) {
+	storeSigning := assertstest.NewStoreStack("canonical", rootPrivKey, storePrivKey)
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   storeSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+
+	brandAcct := assertstest.NewAccount(storeSigning, "my-brand", map[string]interface{}{
+		"account-id":   "my-brand",
+		"verification": "certified",
+	}, "")
+	brandAccKey := assertstest.NewAccountKey(storeSigning, brandAcct, nil, brandPrivKey.PublicKey(), "")
+	brandSigning := assertstest.NewSigningDB("my-brand", brandPrivKey)
+	model, err := brandSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"authority-id": "my-brand",
+		"brand-id":     "my-brand",
+		"model":        "my-model",
+		"architecture": "amd64",
+		"gadget":       "gadget",
+		"kernel":       "kernel",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	assertions := []asserts.Assertion{storeSigning.StoreAccountKey(""), brandAcct, brandAccKey, model}
+	if gadgetPublisher != "my-brand" {
+		assertions = append(assertions, assertstest.NewAccount(storeSigning, gadgetPublisher, map[string]interface{}{
+			"account-id": gadgetPublisher,
+		}, ""))
+	}
+	gadgetDecl, err := storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      "gadget-id",
+		"snap-name":    "gadget",
+		"publisher-id": gadgetPublisher,
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	assertions = append(assertions, gadgetDecl)
+	for _, a := range assertions {
+		c.Assert(db.Add(a), IsNil)
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	assertstate.ReplaceDB(s.state, db)
+	err = auth.SetDevice(s.state, &auth.DeviceState{
+		Brand: "my-brand",
+		Model: "my-model",
+	})
+	c.Assert(err, IsNil)
+}
+
+var gadgetYaml = `
+name: gadget
+version: 1
+type: gadget
+slots:
+ slot:
+  interface: test
+`
+
+var gadgetConnectionsYaml = `
+connections:
+ - plug: consumer-id:plug
+   slot: gadget-id:slot
+volumes:
+ pc:
+  bootloader: grub
+`
+
+// mockSnapWithID mocks the given revision 1 snap with a snap-id, it
+// is only put into the state if installed.
+func (s *interfaceManagerSuite) mockSnapWithID(c *C, yamlText, snapID string, installed bool) *snap.Info {
+	sideInfo := &snap.SideInfo{
+		SnapID:   snapID,
+		Revision: snap.R(1),
+	}
+	snapInfo := snaptest.MockSnap(c, yamlText, sideInfo)
+	sideInfo.RealName = snapInfo.Name()
+	if snapInfo.Type == snap.TypeGadget {
+		err := ioutil.WriteFile(filepath.Join(snapInfo.MountDir(), "meta", "gadget.yaml"), []byte(gadgetConnectionsYaml), 0644)
+		c.Assert(err, IsNil)
+	}
+	if !installed {
+		return snapInfo
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.Set(s.state, snapInfo.Name(), &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{sideInfo},
+		Current:  sideInfo.Revision,
+		SnapType: string(snapInfo.Type),
+	})
+	return snapInfo
+}
+
+func (s *interfaceManagerSuite) runSetupProfiles(c *C, snapInfo *snap.Info) *state.Change {
+	mgr := s.manager(c)
+	change := s.addSetupSnapSecurityChange(c, &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: snapInfo.Name(),
+			SnapID:   snapInfo.SnapID,
+			Revision: snapInfo.Revision,
+		},
+	})
+	mgr.Ensure()
+	mgr.Wait()
+	mgr.Stop()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(change.Status(), Equals, state.DoneStatus)
+	return change
+}
+
+func (s *interfaceManagerSuite) TestSetupProfilesGadgetConnectionsOnInstall(c *C) {
+	s.mockIface(c, &interfaces.TestInterface{InterfaceName: "test"})
+	s.mockModelAndGadgetDecl(c, "my-brand")
+	s.mockSnapWithID(c, gadgetYaml, "gadget-id", true)
+	snapInfo := s.mockSnapWithID(c, consumerYaml, "consumer-id", false)
+
+	s.runSetupProfiles(c, snapInfo)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	var conns map[string]interface{}
+	err := s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, map[string]interface{}{
+		"consumer:plug gadget:slot": map[string]interface{}{
+			"interface": "test", "auto": true,
+		},
+	})
+
+	plug := s.privateMgr.Repository().Plug("consumer", "plug")
+	c.Assert(plug, NotNil)
+	c.Check(plug.Connections, DeepEquals, []interfaces.SlotRef{{Snap: "gadget", Name: "slot"}})
+
+	// both ends got their security setup
+	var setup []string
+	for _, call := range s.secBackend.SetupCalls {
+		setup = append(setup, call.SnapInfo.Name())
+	}
+	c.Check(setup, DeepEquals, []string{"gadget", "consumer"})
+}
+
+func (s *interfaceManagerSuite) TestSetupProfilesGadgetConnectionsWhenInstallingGadget(c *C) {
+	s.mockIface(c, &interfaces.TestInterface{InterfaceName: "test"})
+	s.mockModelAndGadgetDecl(c, "my-brand")
+	s.mockSnapWithID(c, consumerYaml, "consumer-id", true)
+	snapInfo := s.mockSnapWithID(c, gadgetYaml, "gadget-id", false)
+
+	s.runSetupProfiles(c, snapInfo)
+
+	plug := s.privateMgr.Repository().Plug("consumer", "plug")
+	c.Assert(plug, NotNil)
+	c.Check(plug.Connections, DeepEquals, []interfaces.SlotRef{{Snap: "gadget", Name: "slot"}})
+}
+
+func (s *interfaceManagerSuite) TestSetupProfilesGadgetConnectionsNotOnRefresh(c *C) {
+	s.mockIface(c, &interfaces.TestInterface{InterfaceName: "test"})
+	s.mockModelAndGadgetDecl(c, "my-brand")
+	s.mockSnapWithID(c, gadgetYaml, "gadget-id", true)
+	snapInfo := s.mockSnapWithID(c, consumerYaml, "consumer-id", true)
+
+	s.runSetupProfiles(c, snapInfo)
+
+	plug := s.privateMgr.Repository().Plug("consumer", "plug")
+	c.Assert(plug, NotNil)
+	c.Check(plug.Connections, HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestSetupProfilesGadgetConnectionsOnlyFromBrand(c *C) {
+	s.mockIface(c, &interfaces.TestInterface{InterfaceName: "test"})
+	s.mockModelAndGadgetDecl(c, "someone-else")
+	s.mockSnapWithID(c, gadgetYaml, "gadget-id", true)
+	snapInfo := s.mockSnapWithID(c, consumerYaml, "consumer-id", false)
+
+	change := s.runSetupProfiles(c, snapInfo)
+
+	plug := s.privateMgr.Repository().Plug("consumer", "plug")
+	c.Assert(plug, NotNil)
+	c.Check(plug.Connections, HasLen, 0)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(change.Tasks()[0].Log(), HasLen, 1)
+	c.Check(change.Tasks()[0].Log()[0], Matches, `.* cannot use connections of gadget "gadget": gadget is published by "someone-else", not by brand "my-brand"`)
+}
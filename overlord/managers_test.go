@@ -62,6 +62,7 @@ type mgrsSuite struct {
 	aa     *testutil.MockCmd
 	udev   *testutil.MockCmd
 	umount *testutil.MockCmd
+	snap   *testutil.MockCmd
 
 	snapDiscardNs *testutil.MockCmd
 
@@ -112,6 +113,8 @@ func (ms *mgrsSuite) SetUpTest(c *C) {
 	ms.aa = testutil.MockCommand(c, "apparmor_parser", "")
 	ms.udev = testutil.MockCommand(c, "udevadm", "")
 	ms.umount = testutil.MockCommand(c, "umount", "")
+	// runs the hooks
+	ms.snap = testutil.MockCommand(c, "snap", "")
 	ms.snapDiscardNs = testutil.MockCommand(c, "snap-discard-ns", "")
 	dirs.LibExecDir = ms.snapDiscardNs.BinDir()
 
@@ -137,6 +140,7 @@ func (ms *mgrsSuite) TearDownTest(c *C) {
 	ms.udev.Restore()
 	ms.aa.Restore()
 	ms.umount.Restore()
+	ms.snap.Restore()
 	ms.snapDiscardNs.Restore()
 }
 
@@ -709,12 +713,23 @@ type: os
 	st.Lock()
 	c.Assert(err, IsNil)
 
-	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("install-snap change failed with: %v", chg.Err()))
+	c.Assert(chg.Status(), Equals, state.DoingStatus, Commentf("install-snap change failed with: %v", chg.Err()))
 
 	c.Assert(bootloader.BootVars, DeepEquals, map[string]string{
 		"snap_try_core": "core_x1.snap",
 		"snap_mode":     "try",
 	})
+
+	// the change waits for the system to boot the new core
+	bootloader.BootVars["snap_mode"] = "trying"
+	c.Assert(partition.MarkBootSuccessful(bootloader), IsNil)
+
+	st.Unlock()
+	err = ms.o.Settle()
+	st.Lock()
+	c.Assert(err, IsNil)
+
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("install-snap change failed with: %v", chg.Err()))
 }
 
 func (ms *mgrsSuite) TestInstallKernelSnapUpdatesBootloader(c *C) {
@@ -751,12 +766,23 @@ type: kernel`
 	st.Lock()
 	c.Assert(err, IsNil)
 
-	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("install-snap change failed with: %v", chg.Err()))
+	c.Assert(chg.Status(), Equals, state.DoingStatus, Commentf("install-snap change failed with: %v", chg.Err()))
 
 	c.Assert(bootloader.BootVars, DeepEquals, map[string]string{
 		"snap_try_kernel": "krnl_x1.snap",
 		"snap_mode":       "try",
 	})
+
+	// the change waits for the system to boot the new kernel
+	bootloader.BootVars["snap_mode"] = "trying"
+	c.Assert(partition.MarkBootSuccessful(bootloader), IsNil)
+
+	st.Unlock()
+	err = ms.o.Settle()
+	st.Lock()
+	c.Assert(err, IsNil)
+
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("install-snap change failed with: %v", chg.Err()))
 }
 
 func (ms *mgrsSuite) installLocalTestSnap(c *C, snapYamlContent string) *snap.Info {
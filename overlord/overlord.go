@@ -243,10 +243,18 @@ func (o *Overlord) Loop() {
 	})
 }
 
-// Stop stops the ensure loop and the managers under the StateEngine.
+// Stop stops the ensure loop, if it was started, and the managers
+// under the StateEngine.
 func (o *Overlord) Stop() error {
+	o.ensureLock.Lock()
+	looping := o.ensureTimer != nil
+	o.ensureLock.Unlock()
+
+	var err1 error
 	o.loopTomb.Kill(nil)
-	err1 := o.loopTomb.Wait()
+	if looping {
+		err1 = o.loopTomb.Wait()
+	}
 	o.stateEng.Stop()
 	return err1
 }
@@ -183,6 +183,16 @@ func (ovs *overlordSuite) TestTrivialRunAndStop(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (ovs *overlordSuite) TestTrivialSettleAndStop(c *C) {
+	o, err := overlord.New()
+	c.Assert(err, IsNil)
+
+	c.Assert(o.Settle(), IsNil)
+
+	err = o.Stop()
+	c.Assert(err, IsNil)
+}
+
 func (ovs *overlordSuite) TestEnsureLoopRunAndStop(c *C) {
 	restoreIntv := overlord.MockEnsureInterval(10 * time.Millisecond)
 	defer restoreIntv()
@@ -30,10 +30,12 @@ import (
 // A StoreService can find, list available updates and download snaps.
 type StoreService interface {
 	Snap(name, channel string, devmode bool, revision snap.Revision, user *auth.UserState) (*snap.Info, error)
-	Find(search *store.Search, user *auth.UserState) ([]*snap.Info, error)
+	Find(search *store.Search, user *auth.UserState) ([]*snap.Info, *store.Paging, error)
+	Sections(user *auth.UserState) ([]string, error)
 	ListRefresh([]*store.RefreshCandidate, *auth.UserState) ([]*snap.Info, error)
 
 	Download(string, *snap.DownloadInfo, progress.Meter, *auth.UserState) (string, error)
+	SetDownloadRateLimit(bytesPerSecond int64)
 
 	Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error)
 
@@ -49,6 +51,7 @@ type managerBackend interface {
 	SetupSnap(snapFilePath string, si *snap.SideInfo, meter progress.Meter) error
 	CopySnapData(newSnap, oldSnap *snap.Info, meter progress.Meter) error
 	LinkSnap(info *snap.Info) error
+	UpdateKernelModulesAndFirmware(info *snap.Info) error
 	StartSnapServices(info *snap.Info, meter progress.Meter) error
 	StopSnapServices(info *snap.Info, meter progress.Meter) error
 
@@ -70,6 +70,13 @@ func (b Backend) LinkSnap(info *snap.Info) error {
 	return updateCurrentSymlinks(info)
 }
 
+// UpdateKernelModulesAndFirmware switches the kernel modules and
+// firmware of the system to the ones of the given kernel snap, once it
+// is the booted kernel.
+func (b Backend) UpdateKernelModulesAndFirmware(info *snap.Info) error {
+	return boot.UpdateKernelModulesAndFirmware(info)
+}
+
 func (b Backend) StartSnapServices(info *snap.Info, meter progress.Meter) error {
 	return wrappers.StartSnapServices(info, meter)
 }
@@ -20,13 +20,17 @@
 package backend_test
 
 import (
+	"io/ioutil"
 	"path/filepath"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/boot/boottest"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/partition"
 	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/systemd"
@@ -206,3 +210,31 @@ apps:
 	c.Check(osutil.FileExists(currentActiveSymlink), Equals, false)
 	c.Check(osutil.FileExists(currentDataSymlink), Equals, false)
 }
+
+func (s *linkSuite) TestUpdateKernelModulesAndFirmware(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+	bootloader := boottest.NewMockBootloader("mock", c.MkDir())
+	partition.ForceBootloader(bootloader)
+	defer partition.ForceBootloader(nil)
+
+	const yaml = `name: kernel
+version: 1.0
+type: kernel
+`
+
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "kernel.yaml"), []byte("modules: [btusb]\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = s.be.LinkSnap(info)
+	c.Assert(err, IsNil)
+	// not before the kernel is booted
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapKModModulesDir, "snap-kernel.conf")), Equals, false)
+
+	err = s.be.UpdateKernelModulesAndFirmware(info)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(dirs.SnapKModModulesDir, "snap-kernel.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "# This file is automatically generated.\nbtusb\n")
+}
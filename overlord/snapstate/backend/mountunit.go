@@ -28,6 +28,7 @@ import (
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/systemd"
 )
@@ -42,6 +43,18 @@ func addMountUnit(s *snap.Info, meter progress.Meter) error {
 		return err
 	}
 
+	if release.Preseeding {
+		// the systemd of the image is not running yet, enable the
+		// unit for when it boots and mount the snap directly
+		if err := sysd.Enable(mountUnitName); err != nil {
+			return err
+		}
+		if output, err := exec.Command("mount", "-t", "squashfs", "-o", "ro", s.MountFile(), s.MountDir()).CombinedOutput(); err != nil {
+			return osutil.OutputErr(output, err)
+		}
+		return nil
+	}
+
 	// we need to do a daemon-reload here to ensure that systemd really
 	// knows about this new mount unit file
 	if err := sysd.DaemonReload(); err != nil {
@@ -30,6 +30,7 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/testutil"
@@ -91,6 +92,38 @@ WantedBy=multi-user.target
 
 }
 
+func (s *mountunitSuite) TestAddMountUnitWhilePreseeding(c *C) {
+	restore := release.MockPreseeding(true)
+	defer restore()
+	mount := testutil.MockCommand(c, "mount", "")
+	defer mount.Restore()
+	var sysctlCalls [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		sysctlCalls = append(sysctlCalls, cmd)
+		return nil, nil
+	}
+
+	info := &snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "foo",
+			Revision: snap.R(13),
+		},
+		Version:       "1.1",
+		Architectures: []string{"all"},
+	}
+	err := backend.AddMountUnit(info, &s.nullProgress)
+	c.Assert(err, IsNil)
+
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapServicesDir, "snap-foo-13.mount")), Equals, true)
+	// no daemon-reload or start
+	c.Check(sysctlCalls, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "snap-foo-13.mount"},
+	})
+	c.Check(mount.Calls(), DeepEquals, [][]string{
+		{"mount", "-t", "squashfs", "-o", "ro", info.MountFile(), info.MountDir()},
+	})
+}
+
 func (s *mountunitSuite) TestRemoveMountUnit(c *C) {
 	info := &snap.Info{
 		SideInfo: snap.SideInfo{
@@ -86,6 +86,7 @@ type fakeStore struct {
 	fakeBackend         *fakeSnappyBackend
 	fakeCurrentProgress int
 	fakeTotalProgress   int
+	downloadRateLimit   int64
 	state               *state.State
 }
 
@@ -123,10 +124,14 @@ func (f *fakeStore) Snap(name, channel string, devmode bool, revision snap.Revis
 	return info, nil
 }
 
-func (f *fakeStore) Find(search *store.Search, user *auth.UserState) ([]*snap.Info, error) {
+func (f *fakeStore) Find(search *store.Search, user *auth.UserState) ([]*snap.Info, *store.Paging, error) {
 	panic("Find called")
 }
 
+func (f *fakeStore) Sections(user *auth.UserState) ([]string, error) {
+	panic("Sections called")
+}
+
 func (f *fakeStore) ListRefresh(cands []*store.RefreshCandidate, _ *auth.UserState) ([]*snap.Info, error) {
 	f.pokeStateLock()
 
@@ -218,6 +223,12 @@ func (f *fakeStore) Download(name string, snapInfo *snap.DownloadInfo, pb progre
 	return "downloaded-snap-path", nil
 }
 
+func (f *fakeStore) SetDownloadRateLimit(bytesPerSecond int64) {
+	f.pokeStateLock()
+
+	f.downloadRateLimit = bytesPerSecond
+}
+
 func (f *fakeStore) Buy(options *store.BuyOptions, user *auth.UserState) (*store.BuyResult, error) {
 	panic("Never expected fakeStore.Buy to be called")
 }
@@ -237,8 +248,9 @@ func (f *fakeStore) Assertion(*asserts.AssertionType, []string, *auth.UserState)
 type fakeSnappyBackend struct {
 	ops fakeOps
 
-	linkSnapFailTrigger     string
-	copySnapDataFailTrigger string
+	linkSnapFailTrigger            string
+	copySnapDataFailTrigger        string
+	updateKernelModulesFailTrigger string
 }
 
 func (f *fakeSnappyBackend) OpenSnapFile(snapFilePath string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
@@ -282,6 +294,9 @@ func (f *fakeSnappyBackend) ReadInfo(name string, si *snap.SideInfo) (*snap.Info
 	if name == "core" {
 		info.Type = snap.TypeOS
 	}
+	if name == "kernel" {
+		info.Type = snap.TypeKernel
+	}
 	return info, nil
 }
 
@@ -339,6 +354,22 @@ func (f *fakeSnappyBackend) LinkSnap(info *snap.Info) error {
 	return nil
 }
 
+func (f *fakeSnappyBackend) UpdateKernelModulesAndFirmware(info *snap.Info) error {
+	if info.MountDir() == f.updateKernelModulesFailTrigger {
+		f.ops = append(f.ops, fakeOp{
+			op:   "update-kernel-modules-and-firmware.failed",
+			name: info.MountDir(),
+		})
+		return errors.New("fail")
+	}
+
+	f.ops = append(f.ops, fakeOp{
+		op:   "update-kernel-modules-and-firmware",
+		name: info.MountDir(),
+	})
+	return nil
+}
+
 func (f *fakeSnappyBackend) StartSnapServices(info *snap.Info, meter progress.Meter) error {
 	f.ops = append(f.ops, fakeOp{
 		op:   "start-snap-services",
@@ -55,8 +55,9 @@ func checkAssumes(s *snap.Info) error {
 
 var openSnapFile = backend.OpenSnapFile
 
-// checkSnap ensures that the snap can be installed.
-func checkSnap(st *state.State, snapFilePath string, curInfo *snap.Info, flags Flags) error {
+// checkSnap ensures that the snap can be installed. si is the side
+// info of the candidate, if known.
+func checkSnap(st *state.State, snapFilePath string, si *snap.SideInfo, curInfo *snap.Info, flags Flags) error {
 	// This assumes that the snap was already verified or --dangerous was used.
 
 	s, _, err := openSnapFile(snapFilePath, nil)
@@ -102,7 +103,12 @@ func checkSnap(st *state.State, snapFilePath string, curInfo *snap.Info, flags F
 
 	// TODO: actually compare snap ids, from current gadget and candidate
 	if currentGadget.Name() != s.Name() {
-		return fmt.Errorf("cannot replace gadget snap with a different one")
+		if !flags.ReplaceGadget() {
+			return fmt.Errorf("cannot replace gadget snap with a different one")
+		}
+		if si == nil || si.DeveloperID == "" || si.DeveloperID != currentGadget.DeveloperID {
+			return fmt.Errorf("cannot replace gadget snap with one from a different publisher")
+		}
 	}
 
 	return nil
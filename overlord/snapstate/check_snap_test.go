@@ -67,7 +67,7 @@ architectures:
 	restore := snapstate.MockOpenSnapFile(openSnapFile)
 	defer restore()
 
-	err = snapstate.CheckSnap(nil, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(nil, "snap-path", nil, nil, 0)
 
 	errorMsg := fmt.Sprintf(`snap "hello" supported architectures (yadayada, blahblah) are incompatible with this system (%s)`, arch.UbuntuArchitecture())
 	c.Assert(err.Error(), Equals, errorMsg)
@@ -87,7 +87,7 @@ assumes: [f1, f2]`
 	restore := snapstate.MockOpenSnapFile(openSnapFile)
 	defer restore()
 
-	err = snapstate.CheckSnap(nil, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(nil, "snap-path", nil, nil, 0)
 	c.Check(err, ErrorMatches, `snap "foo" assumes unsupported features: f1, f2.*`)
 }
 
@@ -105,7 +105,7 @@ assumes: [common-data-dir]`
 	restore := snapstate.MockOpenSnapFile(openSnapFile)
 	defer restore()
 
-	err = snapstate.CheckSnap(nil, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(nil, "snap-path", nil, nil, 0)
 	c.Check(err, IsNil)
 }
 
@@ -145,7 +145,7 @@ version: 2
 	defer restore()
 
 	st.Unlock()
-	err = snapstate.CheckSnap(st, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(st, "snap-path", nil, nil, 0)
 	st.Lock()
 	c.Check(err, IsNil)
 }
@@ -186,11 +186,56 @@ version: 2
 	defer restore()
 
 	st.Unlock()
-	err = snapstate.CheckSnap(st, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(st, "snap-path", nil, nil, 0)
 	st.Lock()
 	c.Check(err, ErrorMatches, "cannot replace gadget snap with a different one")
 }
 
+func (s *checkSnapSuite) TestCheckSnapGadgetReplace(c *C) {
+	reset := release.MockOnClassic(false)
+	defer reset()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	si := &snap.SideInfo{RealName: "gadget", Revision: snap.R(2), DeveloperID: "brand"}
+	snaptest.MockSnap(c, `
+name: gadget
+type: gadget
+version: 1
+`, si)
+	snapstate.Set(st, "gadget", &snapstate.SnapState{
+		SnapType: "gadget",
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+
+	const yaml = `name: zgadget
+type: gadget
+version: 2
+`
+
+	info, err := snap.InfoFromSnapYaml([]byte(yaml))
+	c.Assert(err, IsNil)
+
+	var openSnapFile = func(path string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
+		return info, nil, nil
+	}
+	restore := snapstate.MockOpenSnapFile(openSnapFile)
+	defer restore()
+
+	st.Unlock()
+	defer st.Lock()
+	err = snapstate.CheckSnap(st, "snap-path", &snap.SideInfo{RealName: "zgadget", DeveloperID: "brand"}, nil, snapstate.ReplaceGadget)
+	c.Check(err, IsNil)
+	err = snapstate.CheckSnap(st, "snap-path", &snap.SideInfo{RealName: "zgadget", DeveloperID: "other"}, nil, snapstate.ReplaceGadget)
+	c.Check(err, ErrorMatches, "cannot replace gadget snap with one from a different publisher")
+	err = snapstate.CheckSnap(st, "snap-path", &snap.SideInfo{RealName: "zgadget", DeveloperID: "brand"}, nil, 0)
+	c.Check(err, ErrorMatches, "cannot replace gadget snap with a different one")
+}
+
 func (s *checkSnapSuite) TestCheckSnapGadgetMissingPrior(c *C) {
 	err := os.MkdirAll(filepath.Dir(dirs.SnapFirstBootStamp), 0755)
 	c.Assert(err, IsNil)
@@ -219,7 +264,7 @@ version: 1
 	defer restore()
 
 	st.Unlock()
-	err = snapstate.CheckSnap(st, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(st, "snap-path", nil, nil, 0)
 	st.Lock()
 	c.Check(err, ErrorMatches, "cannot find original gadget snap")
 }
@@ -247,7 +292,7 @@ version: 1
 	defer restore()
 
 	st.Unlock()
-	err = snapstate.CheckSnap(st, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(st, "snap-path", nil, nil, 0)
 	st.Lock()
 	c.Check(err, ErrorMatches, "cannot install a gadget snap on classic")
 }
@@ -268,7 +313,7 @@ confinement: devmode
 	restore := snapstate.MockOpenSnapFile(openSnapFile)
 	defer restore()
 
-	err = snapstate.CheckSnap(nil, "snap-path", nil, 0)
+	err = snapstate.CheckSnap(nil, "snap-path", nil, nil, 0)
 
 	c.Assert(err, ErrorMatches, ".* requires devmode or confinement override")
 }
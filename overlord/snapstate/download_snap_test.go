@@ -20,8 +20,13 @@
 package snapstate_test
 
 import (
+	"bytes"
+	"fmt"
+
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
@@ -196,3 +201,126 @@ func (s *downloadSnapSuite) TestDoUndoDownloadSnap(c *C) {
 	c.Assert(err, Equals, state.ErrNoState)
 
 }
+
+func (s *downloadSnapSuite) TestDoDownloadSnapSetsRateLimit(c *C) {
+	s.state.Lock()
+	tr := configstate.NewTransaction(s.state)
+	tr.Set("core", "download-rate-limit", 4096)
+	tr.Commit()
+
+	t := s.state.NewTask("download-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "foo",
+			Revision: snap.R(11),
+		},
+		DownloadInfo: &snap.DownloadInfo{
+			DownloadURL: "http://some-url.com/snap",
+		},
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(s.fakeStore.downloadRateLimit, Equals, int64(4096))
+}
+
+func (s *downloadSnapSuite) testDoDownloadSnapInvalidRateLimit(c *C, rateLimit interface{}, logged string) {
+	logbuf := bytes.NewBuffer(nil)
+	l, err := logger.NewConsoleLog(logbuf, logger.DefaultFlags)
+	c.Assert(err, IsNil)
+	logger.SetLogger(l)
+	defer logger.SetLogger(logger.NullLogger)
+
+	s.state.Lock()
+	tr := configstate.NewTransaction(s.state)
+	tr.Set("core", "download-rate-limit", rateLimit)
+	tr.Commit()
+
+	t := s.state.NewTask("download-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "foo",
+			Revision: snap.R(11),
+		},
+		DownloadInfo: &snap.DownloadInfo{
+			DownloadURL: "http://some-url.com/snap",
+		},
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the download goes ahead unlimited
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(s.fakeStore.downloadRateLimit, Equals, int64(0))
+	c.Check(logbuf.String(), Matches, "(?s).*"+logged+".*")
+}
+
+func (s *downloadSnapSuite) TestDoDownloadSnapNegativeRateLimit(c *C) {
+	s.testDoDownloadSnapInvalidRateLimit(c, -1, "Ignoring negative download rate limit -1 in core configuration")
+}
+
+func (s *downloadSnapSuite) TestDoDownloadSnapIllTypedRateLimit(c *C) {
+	s.testDoDownloadSnapInvalidRateLimit(c, "fast", "Ignoring invalid download rate limit in core configuration: .*")
+}
+
+func (s *downloadSnapSuite) TestConcurrentDownloadsAreLimited(c *C) {
+	restore := snapstate.MockMaxConcurrentDownloads(2)
+	defer restore()
+
+	s.state.Lock()
+	var tasks []*state.Task
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("foo%d", i)
+		chg := s.state.NewChange("install", "install "+name)
+		t := s.state.NewTask("download-snap", "test")
+		t.Set("snap-setup", &snapstate.SnapSetup{
+			SideInfo: &snap.SideInfo{
+				RealName: name,
+				Revision: snap.R(11),
+			},
+			DownloadInfo: &snap.DownloadInfo{
+				DownloadURL: "http://some-url.com/snap",
+			},
+		})
+		chg.AddTask(t)
+		tasks = append(tasks, t)
+	}
+	s.state.Unlock()
+
+	countDone := func() int {
+		s.state.Lock()
+		defer s.state.Unlock()
+		n := 0
+		for _, t := range tasks {
+			if t.Status() == state.DoneStatus {
+				n++
+			}
+		}
+		return n
+	}
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+	c.Check(countDone(), Equals, 2)
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+	c.Check(countDone(), Equals, 4)
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+	c.Check(countDone(), Equals, 5)
+}
@@ -79,6 +79,12 @@ func MockOpenSnapFile(mock func(path string, si *snap.SideInfo) (*snap.Info, sna
 	return func() { openSnapFile = prevOpenSnapFile }
 }
 
+func MockMaxConcurrentDownloads(n int) (restore func()) {
+	old := maxConcurrentDownloads
+	maxConcurrentDownloads = n
+	return func() { maxConcurrentDownloads = old }
+}
+
 var (
 	CheckSnap   = checkSnap
 	CanRemove   = canRemove
@@ -88,3 +94,11 @@ var (
 func PreviousSideInfo(snapst *SnapState) *snap.SideInfo {
 	return snapst.previousSideInfo()
 }
+
+func MockGadgetUpdate(update func(oldDir, newDir, backupDir string) error, rollback func(backupDir string) error) (restore func()) {
+	oldUpdate, oldRollback := gadgetUpdate, gadgetRollback
+	gadgetUpdate, gadgetRollback = update, rollback
+	return func() {
+		gadgetUpdate, gadgetRollback = oldUpdate, oldRollback
+	}
+}
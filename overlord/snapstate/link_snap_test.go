@@ -24,8 +24,10 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/boot/boottest"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/partition"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 )
@@ -225,6 +227,368 @@ func (s *linkSnapSuite) TestDoLinkSnapSuccessCoreRestarts(c *C) {
 	c.Check(t.Log()[0], Matches, `.*INFO Requested daemon restart\.`)
 }
 
+func (s *linkSnapSuite) TestDoLinkSnapCoreWaitsForBoot(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	bootloader := boottest.NewMockBootloader("mock", c.MkDir())
+	partition.ForceBootloader(bootloader)
+	defer partition.ForceBootloader(nil)
+	// as set by the backend linking the snap
+	bootloader.BootVars["snap_core"] = "core_32.snap"
+	bootloader.BootVars["snap_try_core"] = "core_33.snap"
+	bootloader.BootVars["snap_mode"] = "try"
+
+	s.state.Lock()
+	si := &snap.SideInfo{
+		RealName: "core",
+		Revision: snap.R(33),
+	}
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: si,
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	c.Check(t.Status(), Equals, state.DoingStatus)
+	c.Check(s.stateBackend.restartRequested, Equals, true)
+	c.Check(t.Log(), HasLen, 1)
+	c.Check(t.Log()[0], Matches, `.*INFO Requested system restart\.`)
+	var snapst snapstate.SnapState
+	err := snapstate.Get(s.state, "core", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Current, Equals, snap.R(33))
+	s.state.Unlock()
+
+	// booted, but not yet marked successful
+	bootloader.BootVars["snap_mode"] = "trying"
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	c.Check(t.Status(), Equals, state.DoingStatus)
+	s.state.Unlock()
+
+	// what MarkBootSuccessful does
+	bootloader.BootVars["snap_core"] = "core_33.snap"
+	bootloader.BootVars["snap_try_core"] = ""
+	bootloader.BootVars["snap_mode"] = ""
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(t.Log(), HasLen, 2)
+	c.Check(t.Log()[1], Matches, `.*INFO Confirmed system boot\.`)
+}
+
+func (s *linkSnapSuite) TestDoLinkSnapCoreBootRolledBack(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	bootloader := boottest.NewMockBootloader("mock", c.MkDir())
+	partition.ForceBootloader(bootloader)
+	defer partition.ForceBootloader(nil)
+	bootloader.BootVars["snap_core"] = "core_32.snap"
+	bootloader.BootVars["snap_try_core"] = "core_33.snap"
+	bootloader.BootVars["snap_mode"] = "try"
+
+	s.state.Lock()
+	si1 := &snap.SideInfo{
+		RealName: "core",
+		Revision: snap.R(32),
+	}
+	si2 := &snap.SideInfo{
+		RealName: "core",
+		Revision: snap.R(33),
+	}
+	snapstate.Set(s.state, "core", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si1},
+		Current:  si1.Revision,
+		Active:   true,
+		SnapType: "os",
+	})
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: si2,
+	})
+	chg := s.state.NewChange("dummy", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	// the bootloader fell back to the previous core
+	bootloader.BootVars["snap_mode"] = ""
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot finish installing snap "core" revision 33: the system failed to boot it and rolled back to the previous revision.*`)
+
+	var snapst snapstate.SnapState
+	err := snapstate.Get(s.state, "core", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Current, Equals, snap.R(32))
+	c.Check(snapst.Sequence, DeepEquals, []*snap.SideInfo{si1})
+}
+
+func (s *linkSnapSuite) kernelModulesOps() []fakeOp {
+	var ops []fakeOp
+	for _, op := range s.fakeBackend.ops {
+		if op.op == "update-kernel-modules-and-firmware" {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+func (s *linkSnapSuite) TestDoLinkSnapKernelModulesAfterBoot(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	bootloader := boottest.NewMockBootloader("mock", c.MkDir())
+	partition.ForceBootloader(bootloader)
+	defer partition.ForceBootloader(nil)
+	bootloader.BootVars["snap_kernel"] = "kernel_32.snap"
+	bootloader.BootVars["snap_try_kernel"] = "kernel_33.snap"
+	bootloader.BootVars["snap_mode"] = "try"
+
+	s.state.Lock()
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "kernel",
+			Revision: snap.R(33),
+		},
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	// nothing switched before the boot is confirmed
+	c.Check(s.kernelModulesOps(), HasLen, 0)
+
+	// what MarkBootSuccessful does
+	bootloader.BootVars["snap_kernel"] = "kernel_33.snap"
+	bootloader.BootVars["snap_try_kernel"] = ""
+	bootloader.BootVars["snap_mode"] = ""
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(s.kernelModulesOps(), DeepEquals, []fakeOp{{
+		op:   "update-kernel-modules-and-firmware",
+		name: snap.MountDir("kernel", snap.R(33)),
+	}})
+}
+
+func (s *linkSnapSuite) TestDoLinkSnapKernelBootRolledBackKeepsModules(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	bootloader := boottest.NewMockBootloader("mock", c.MkDir())
+	partition.ForceBootloader(bootloader)
+	defer partition.ForceBootloader(nil)
+	bootloader.BootVars["snap_kernel"] = "kernel_32.snap"
+	bootloader.BootVars["snap_try_kernel"] = "kernel_33.snap"
+	bootloader.BootVars["snap_mode"] = "try"
+
+	s.state.Lock()
+	si1 := &snap.SideInfo{
+		RealName: "kernel",
+		Revision: snap.R(32),
+	}
+	snapstate.Set(s.state, "kernel", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si1},
+		Current:  si1.Revision,
+		Active:   true,
+		SnapType: "kernel",
+	})
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "kernel",
+			Revision: snap.R(33),
+		},
+	})
+	s.state.NewChange("dummy", "...").AddTask(t)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	// the bootloader fell back to the previous kernel
+	bootloader.BootVars["snap_mode"] = ""
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	// the modules and firmware of the previous kernel stay
+	c.Check(s.kernelModulesOps(), HasLen, 0)
+}
+
+func (s *linkSnapSuite) TestDoLinkSnapKernelModulesFailureUndoes(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	bootloader := boottest.NewMockBootloader("mock", c.MkDir())
+	partition.ForceBootloader(bootloader)
+	defer partition.ForceBootloader(nil)
+	bootloader.BootVars["snap_kernel"] = "kernel_32.snap"
+	bootloader.BootVars["snap_try_kernel"] = "kernel_33.snap"
+	bootloader.BootVars["snap_mode"] = "try"
+	s.fakeBackend.updateKernelModulesFailTrigger = snap.MountDir("kernel", snap.R(33))
+
+	s.state.Lock()
+	si1 := &snap.SideInfo{
+		RealName: "kernel",
+		Revision: snap.R(32),
+	}
+	snapstate.Set(s.state, "kernel", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si1},
+		Current:  si1.Revision,
+		Active:   true,
+		SnapType: "kernel",
+	})
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "kernel",
+			Revision: snap.R(33),
+		},
+	})
+	chg := s.state.NewChange("dummy", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	// what MarkBootSuccessful does
+	bootloader.BootVars["snap_kernel"] = "kernel_33.snap"
+	bootloader.BootVars["snap_try_kernel"] = ""
+	bootloader.BootVars["snap_mode"] = ""
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot switch kernel modules and firmware to snap "kernel" revision 33: fail.*`)
+
+	var snapst snapstate.SnapState
+	err := snapstate.Get(s.state, "kernel", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Current, Equals, snap.R(32))
+	c.Check(snapst.Sequence, DeepEquals, []*snap.SideInfo{si1})
+}
+
+func (s *linkSnapSuite) TestUndoLinkSnapKernelModulesAfterBoot(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	bootloader := boottest.NewMockBootloader("mock", c.MkDir())
+	partition.ForceBootloader(bootloader)
+	defer partition.ForceBootloader(nil)
+	bootloader.BootVars["snap_kernel"] = "kernel_32.snap"
+	bootloader.BootVars["snap_try_kernel"] = "kernel_33.snap"
+	bootloader.BootVars["snap_mode"] = "try"
+
+	s.state.Lock()
+	si1 := &snap.SideInfo{
+		RealName: "kernel",
+		Revision: snap.R(32),
+	}
+	snapstate.Set(s.state, "kernel", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si1},
+		Current:  si1.Revision,
+		Active:   true,
+		SnapType: "kernel",
+	})
+	t := s.state.NewTask("link-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "kernel",
+			Revision: snap.R(33),
+		},
+	})
+	chg := s.state.NewChange("dummy", "...")
+	chg.AddTask(t)
+	terr := s.state.NewTask("error-trigger", "provoking total undo")
+	terr.WaitFor(t)
+	chg.AddTask(terr)
+	s.state.Unlock()
+
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+
+	// what MarkBootSuccessful does
+	bootloader.BootVars["snap_kernel"] = "kernel_33.snap"
+	bootloader.BootVars["snap_try_kernel"] = ""
+	bootloader.BootVars["snap_mode"] = ""
+	for i := 0; i < 3; i++ {
+		s.snapmgr.Ensure()
+		s.snapmgr.Wait()
+	}
+
+	s.state.Lock()
+	c.Check(t.Status(), Equals, state.UndoneStatus)
+	var pending string
+	err := s.state.Get("kernel-modules-pending", &pending)
+	c.Assert(err, IsNil)
+	c.Check(pending, Equals, "kernel")
+	s.state.Unlock()
+	// the new kernel is still running, so its modules stay
+	c.Check(s.kernelModulesOps(), DeepEquals, []fakeOp{{
+		op:   "update-kernel-modules-and-firmware",
+		name: snap.MountDir("kernel", snap.R(33)),
+	}})
+
+	// the previous kernel is set up for the next boot
+	bootloader.BootVars["snap_try_kernel"] = "kernel_32.snap"
+	bootloader.BootVars["snap_mode"] = "try"
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+	c.Check(s.kernelModulesOps(), HasLen, 1)
+
+	// and got booted
+	bootloader.BootVars["snap_kernel"] = "kernel_32.snap"
+	bootloader.BootVars["snap_try_kernel"] = ""
+	bootloader.BootVars["snap_mode"] = ""
+	s.snapmgr.Ensure()
+	s.snapmgr.Wait()
+	c.Check(s.kernelModulesOps(), DeepEquals, []fakeOp{{
+		op:   "update-kernel-modules-and-firmware",
+		name: snap.MountDir("kernel", snap.R(33)),
+	}, {
+		op:   "update-kernel-modules-and-firmware",
+		name: snap.MountDir("kernel", snap.R(32)),
+	}})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	err = s.state.Get("kernel-modules-pending", &pending)
+	c.Assert(err, IsNil)
+	c.Check(pending, Equals, "")
+}
+
 func (s *linkSnapSuite) TestDoUndoLinkSnapSequenceDidNotHaveCandidate(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
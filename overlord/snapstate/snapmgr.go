@@ -24,12 +24,17 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"gopkg.in/tomb.v2"
 
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
@@ -360,6 +365,9 @@ func Manager(s *state.State) (*SnapManager, error) {
 		runner:  runner,
 	}
 
+	// limit how many snaps are downloaded at the same time
+	runner.SetBlocked(blockedTask)
+
 	// this handler does nothing
 	runner.AddHandler("nop", func(t *state.Task, _ *tomb.Tomb) error {
 		return nil
@@ -370,10 +378,12 @@ func Manager(s *state.State) (*SnapManager, error) {
 	runner.AddHandler("download-snap", m.doDownloadSnap, m.undoPrepareSnap)
 	runner.AddHandler("mount-snap", m.doMountSnap, m.undoMountSnap)
 	runner.AddHandler("unlink-current-snap", m.doUnlinkCurrentSnap, m.undoUnlinkCurrentSnap)
+	runner.AddHandler("update-gadget-assets", m.doUpdateGadgetAssets, m.undoUpdateGadgetAssets)
 	runner.AddHandler("copy-snap-data", m.doCopySnapData, m.undoCopySnapData)
 	runner.AddHandler("link-snap", m.doLinkSnap, m.undoLinkSnap)
 	runner.AddHandler("start-snap-services", m.startSnapServices, m.stopSnapServices)
 	runner.AddHandler("cleanup", m.cleanup, nil)
+	runner.AddHandler("switch-snap-channel", m.doSwitchSnapChannel, m.undoSwitchSnapChannel)
 	// FIXME: port to native tasks and rename
 	//runner.AddHandler("garbage-collect", m.doGarbageCollect, nil)
 
@@ -474,6 +484,42 @@ func (m *SnapManager) undoPrepareSnap(t *state.Task, _ *tomb.Tomb) error {
 	return nil
 }
 
+// maxConcurrentDownloads is the maximum number of download-snap tasks
+// that are run at the same time.
+var maxConcurrentDownloads = 3
+
+// blockedTask is the task runner predicate that keeps download-snap
+// tasks from starting while maxConcurrentDownloads are already running.
+func blockedTask(t *state.Task, running []*state.Task) bool {
+	if t.Kind() != "download-snap" {
+		return false
+	}
+	downloading := 0
+	for _, rt := range running {
+		if rt.Kind() == "download-snap" {
+			downloading++
+		}
+	}
+	return downloading >= maxConcurrentDownloads
+}
+
+// downloadRateLimit returns the global download bandwidth limit in bytes
+// per second from the core configuration, 0 means unlimited. An invalid
+// limit is ignored rather than blocking all downloads.
+func downloadRateLimit(st *state.State) int64 {
+	var rateLimit int64
+	tr := configstate.NewTransaction(st)
+	if err := tr.GetMaybe("core", "download-rate-limit", &rateLimit); err != nil {
+		logger.Noticef("Ignoring invalid download rate limit in core configuration: %v", err)
+		return 0
+	}
+	if rateLimit < 0 {
+		logger.Noticef("Ignoring negative download rate limit %d in core configuration", rateLimit)
+		return 0
+	}
+	return rateLimit
+}
+
 func (m *SnapManager) doDownloadSnap(t *state.Task, _ *tomb.Tomb) error {
 	st := t.State()
 	st.Lock()
@@ -488,10 +534,14 @@ func (m *SnapManager) doDownloadSnap(t *state.Task, _ *tomb.Tomb) error {
 	st.Lock()
 	theStore := Store(st)
 	user, err := userFromUserID(st, ss.UserID)
-	st.Unlock()
 	if err != nil {
+		st.Unlock()
 		return err
 	}
+	rateLimit := downloadRateLimit(st)
+	st.Unlock()
+
+	theStore.SetDownloadRateLimit(rateLimit)
 
 	var downloadedSnapFile string
 	if ss.DownloadInfo == nil {
@@ -642,7 +692,60 @@ func (m *SnapManager) doDiscardSnap(t *state.Task, _ *tomb.Tomb) error {
 
 // Ensure implements StateManager.Ensure.
 func (m *SnapManager) Ensure() error {
+	err := m.ensureKernelModules()
 	m.runner.Ensure()
+	return err
+}
+
+// ensureKernelModules switches the kernel modules and firmware back to
+// the ones of the current kernel once it is booted again, after the
+// refresh of the kernel that had switched them got undone.
+func (m *SnapManager) ensureKernelModules() error {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	var name string
+	err := m.state.Get("kernel-modules-pending", &name)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if name == "" {
+		return nil
+	}
+
+	var snapst SnapState
+	err = Get(m.state, name, &snapst)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if err == state.ErrNoState || !snapst.HasCurrent() {
+		m.state.Set("kernel-modules-pending", "")
+		return nil
+	}
+	info, err := snapst.CurrentInfo()
+	if err != nil {
+		return err
+	}
+
+	booted, err := boot.CheckBooted(info)
+	if err == boot.ErrBootPending {
+		// check again after the reboot
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if booted {
+		m.state.Unlock()
+		err = m.backend.UpdateKernelModulesAndFirmware(info)
+		m.state.Lock()
+		if err != nil {
+			return fmt.Errorf("cannot switch kernel modules and firmware to snap %q revision %s: %v", info.Name(), info.Revision, err)
+		}
+	}
+	// if the bootloader fell back, the kernel in use is the one the
+	// modules and firmware are set up for already
+	m.state.Set("kernel-modules-pending", "")
 	return nil
 }
 
@@ -731,7 +834,7 @@ func (m *SnapManager) doMountSnap(t *state.Task, _ *tomb.Tomb) error {
 
 	m.backend.CurrentInfo(curInfo)
 
-	if err := checkSnap(t.State(), ss.SnapPath, curInfo, Flags(ss.Flags)); err != nil {
+	if err := checkSnap(t.State(), ss.SnapPath, ss.SideInfo, curInfo, Flags(ss.Flags)); err != nil {
 		return err
 	}
 
@@ -826,6 +929,52 @@ func (m *SnapManager) doUnlinkCurrentSnap(t *state.Task, _ *tomb.Tomb) error {
 	return nil
 }
 
+var (
+	gadgetUpdate   = gadget.Update
+	gadgetRollback = gadget.Rollback
+)
+
+func gadgetBackupDir(name string) string {
+	return filepath.Join(dirs.SnapGadgetBackupDir, name)
+}
+
+func (m *SnapManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	ss, snapst, err := snapSetupAndState(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	oldInfo, err := snapst.CurrentInfo()
+	if err == ErrNoCurrent && Flags(ss.Flags).ReplaceGadget() {
+		// the assets of the gadget being replaced are updated
+		t.State().Lock()
+		oldInfo, err = GadgetInfo(t.State())
+		t.State().Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	newInfo, err := readInfo(ss.Name(), ss.SideInfo)
+	if err != nil {
+		return err
+	}
+
+	return gadgetUpdate(oldInfo.MountDir(), newInfo.MountDir(), gadgetBackupDir(ss.Name()))
+}
+
+func (m *SnapManager) undoUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	ss, err := TaskSnapSetup(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return gadgetRollback(gadgetBackupDir(ss.Name()))
+}
+
 func (m *SnapManager) undoCopySnapData(t *state.Task, _ *tomb.Tomb) error {
 	t.State().Lock()
 	ss, snapst, err := snapSetupAndState(t)
@@ -870,9 +1019,20 @@ func (m *SnapManager) doCopySnapData(t *state.Task, _ *tomb.Tomb) error {
 	return m.backend.CopySnapData(newInfo, oldInfo, pb)
 }
 
-func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) error {
+func (m *SnapManager) doLinkSnap(t *state.Task, tomb *tomb.Tomb) error {
 	st := t.State()
 
+	st.Lock()
+	var bootPending bool
+	err := t.Get("boot-pending", &bootPending)
+	st.Unlock()
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if bootPending {
+		return m.finishLinkAfterBoot(t, tomb)
+	}
+
 	st.Lock()
 	defer st.Unlock()
 
@@ -940,10 +1100,33 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	t.Set("old-channel", oldChannel)
 	t.Set("old-current", oldCurrent)
 	t.Set("old-candidate-index", oldCandidateIndex)
+	// a new kernel or core is only done with once the system
+	// confirmed booting it
+	rebootRequired := !release.OnClassic && boot.KernelOrOsRebootRequired(newInfo)
 	// Do at the end so we only preserve the new state if it worked.
 	Set(st, ss.Name(), snapst)
 	// Make sure if state commits and snapst is mutated we won't be rerun
-	t.SetStatus(state.DoneStatus)
+	if rebootRequired {
+		t.Set("boot-pending", true)
+	} else {
+		t.SetStatus(state.DoneStatus)
+		// the kernel is the booted one already
+		st.Unlock()
+		err := m.updateKernelModulesAndFirmware(t, newInfo)
+		if err != nil {
+			// the task errors, so its undo will not be run by the
+			// task runner
+			if undoErr := m.undoLinkSnap(t, tomb); undoErr != nil {
+				st.Lock()
+				t.Errorf("cannot undo linking snap %q: %v", ss.Name(), undoErr)
+				st.Unlock()
+			}
+		}
+		st.Lock()
+		if err != nil {
+			return err
+		}
+	}
 
 	// if we just installed a core snap, request a restart
 	// so that we switch executing its snapd
@@ -953,16 +1136,125 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 		st.RequestRestart(state.RestartDaemon)
 		st.Lock()
 	}
-	if !release.OnClassic && (newInfo.Type == snap.TypeOS || newInfo.Type == snap.TypeKernel) {
+	if rebootRequired {
 		t.Logf("Requested system restart.")
 		st.Unlock()
 		st.RequestRestart(state.RestartSystem)
 		st.Lock()
+		return &state.Retry{}
 	}
 
 	return nil
 }
 
+// finishLinkAfterBoot completes linking a kernel or core snap once the
+// system confirmed booting it, and undoes the linking if the bootloader
+// fell back to the previous one instead.
+func (m *SnapManager) finishLinkAfterBoot(t *state.Task, tomb *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	ss, err := TaskSnapSetup(t)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	newInfo, err := readInfo(ss.Name(), ss.SideInfo)
+	if err != nil {
+		return err
+	}
+
+	booted, err := boot.CheckBooted(newInfo)
+	if err == boot.ErrBootPending {
+		// check again after the reboot
+		return &state.Retry{}
+	}
+	if err != nil {
+		return err
+	}
+	if booted {
+		st.Lock()
+		t.Logf("Confirmed system boot.")
+		st.Unlock()
+		err := m.updateKernelModulesAndFirmware(t, newInfo)
+		if err == nil {
+			return nil
+		}
+		if undoErr := m.undoLinkSnap(t, tomb); undoErr != nil {
+			st.Lock()
+			t.Errorf("cannot undo linking snap %q: %v", ss.Name(), undoErr)
+			st.Unlock()
+		}
+		return err
+	}
+
+	// the task errors, so its undo will not be run by the task runner
+	if err := m.undoLinkSnap(t, tomb); err != nil {
+		return err
+	}
+	return fmt.Errorf("cannot finish installing snap %q revision %s: the system failed to boot it and rolled back to the previous revision", ss.Name(), ss.Revision())
+}
+
+// updateKernelModulesAndFirmware switches the kernel modules and
+// firmware of the system to the ones of info, if it is a kernel, once
+// it is the booted one. On error the previous ones are kept.
+func (m *SnapManager) updateKernelModulesAndFirmware(t *state.Task, info *snap.Info) error {
+	if info.Type != snap.TypeKernel || release.OnClassic {
+		return nil
+	}
+	if err := m.backend.UpdateKernelModulesAndFirmware(info); err != nil {
+		return fmt.Errorf("cannot switch kernel modules and firmware to snap %q revision %s: %v", info.Name(), info.Revision, err)
+	}
+
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+	t.Set("kernel-modules-updated", true)
+	// nothing is left to switch back to
+	st.Set("kernel-modules-pending", "")
+	return nil
+}
+
+func (m *SnapManager) doSwitchSnapChannel(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+
+	st.Lock()
+	defer st.Unlock()
+
+	ss, snapst, err := snapSetupAndState(t)
+	if err != nil {
+		return err
+	}
+
+	// save for undoSwitchSnapChannel
+	t.Set("old-channel", snapst.Channel)
+
+	snapst.Channel = ss.Channel
+	Set(st, ss.Name(), snapst)
+	return nil
+}
+
+func (m *SnapManager) undoSwitchSnapChannel(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+
+	st.Lock()
+	defer st.Unlock()
+
+	ss, snapst, err := snapSetupAndState(t)
+	if err != nil {
+		return err
+	}
+
+	var oldChannel string
+	if err := t.Get("old-channel", &oldChannel); err != nil {
+		return err
+	}
+
+	snapst.Channel = oldChannel
+	Set(st, ss.Name(), snapst)
+	return nil
+}
+
 func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	st := t.State()
 
@@ -1039,6 +1331,17 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 		return err
 	}
 
+	var modulesUpdated bool
+	if err := t.Get("kernel-modules-updated", &modulesUpdated); err != nil && err != state.ErrNoState {
+		return err
+	}
+	if modulesUpdated && snapst.HasCurrent() {
+		// the new kernel is still running, switch back to the
+		// ones of the previous kernel only once it is booted again,
+		// see ensureKernelModules
+		st.Set("kernel-modules-pending", ss.Name())
+	}
+
 	// mark as inactive
 	Set(st, ss.Name(), snapst)
 	// Make sure if state commits and snapst is mutated we won't be rerun
@@ -26,14 +26,18 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/store"
@@ -97,6 +101,7 @@ func (s *snapmgrTestSuite) SetUpTest(c *C) {
 
 func (s *snapmgrTestSuite) TearDownTest(c *C) {
 	snapstate.ValidateRefreshes = nil
+	snapstate.EnforcedValidationSets = nil
 	s.reset()
 }
 
@@ -119,6 +124,9 @@ func verifyInstallUpdateTasks(c *C, curActive bool, ts *state.TaskSet, st *state
 	n := 7
 	if curActive {
 		n += 2
+	} else {
+		// configure hook of the new snap
+		n++
 	}
 	c.Assert(ts.Tasks()[i].Kind(), Equals, "download-snap")
 	i++
@@ -139,6 +147,10 @@ func verifyInstallUpdateTasks(c *C, curActive bool, ts *state.TaskSet, st *state
 	c.Assert(ts.Tasks()[i].Kind(), Equals, "link-snap")
 	i++
 	c.Assert(ts.Tasks()[i].Kind(), Equals, "start-snap-services")
+	if !curActive {
+		i++
+		c.Assert(ts.Tasks()[i].Kind(), Equals, "run-hook")
+	}
 	return n
 }
 
@@ -393,6 +405,123 @@ func (s *snapmgrTestSuite) TestRevertCreatesNoGCTasks(c *C) {
 	c.Assert(ts.Tasks()[i].Kind(), Equals, "start-snap-services")
 }
 
+func (s *snapmgrTestSuite) TestSwitchTasks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", Revision: snap.R(11)}},
+		Current:  snap.R(11),
+		Channel:  "stable",
+	})
+
+	ts, err := snapstate.Switch(s.state, "some-snap", "beta")
+	c.Assert(err, IsNil)
+
+	c.Assert(ts.Tasks(), HasLen, 1)
+	c.Check(ts.Tasks()[0].Kind(), Equals, "switch-snap-channel")
+	c.Check(ts.Tasks()[0].Summary(), Equals, `Switch snap "some-snap" to channel "beta"`)
+
+	ss, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(ss.Channel, Equals, "beta")
+	c.Check(ss.Revision(), Equals, snap.R(11))
+}
+
+func (s *snapmgrTestSuite) TestSwitchErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := snapstate.Switch(s.state, "some-snap", "beta")
+	c.Check(err, ErrorMatches, `cannot find snap "some-snap"`)
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", Revision: snap.R(11)}},
+		Current:  snap.R(11),
+	})
+
+	_, err = snapstate.Switch(s.state, "some-snap", "")
+	c.Check(err, ErrorMatches, `cannot switch snap "some-snap" to an empty channel`)
+
+	ts, err := snapstate.Switch(s.state, "some-snap", "beta")
+	c.Assert(err, IsNil)
+	// need a change to make the tasks visible
+	s.state.NewChange("switch", "...").AddAll(ts)
+
+	_, err = snapstate.Switch(s.state, "some-snap", "edge")
+	c.Check(err, ErrorMatches, `snap "some-snap" has changes in progress`)
+}
+
+func (s *snapmgrTestSuite) TestSwitchRunThrough(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", Revision: snap.R(11), Channel: "stable"}},
+		Current:  snap.R(11),
+		Channel:  "stable",
+	})
+
+	chg := s.state.NewChange("switch-snap", "switch a snap")
+	ts, err := snapstate.Switch(s.state, "some-snap", "beta")
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	// no refresh happened
+	c.Check(s.fakeBackend.ops, HasLen, 0)
+
+	var snapst snapstate.SnapState
+	err = snapstate.Get(s.state, "some-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Channel, Equals, "beta")
+	c.Check(snapst.Current, Equals, snap.R(11))
+	// the channel the current revision came from is untouched
+	c.Check(snapst.Sequence[0].Channel, Equals, "stable")
+}
+
+func (s *snapmgrTestSuite) TestSwitchUndo(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", Revision: snap.R(11)}},
+		Current:  snap.R(11),
+		Channel:  "stable",
+	})
+
+	chg := s.state.NewChange("switch-snap", "switch a snap")
+	ts, err := snapstate.Switch(s.state, "some-snap", "beta")
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	terr := s.state.NewTask("error-trigger", "provoking total undo")
+	terr.WaitAll(ts)
+	chg.AddTask(terr)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(ts.Tasks()[0].Status(), Equals, state.UndoneStatus)
+
+	var snapst snapstate.SnapState
+	err = snapstate.Get(s.state, "some-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Channel, Equals, "stable")
+}
+
 func (s *snapmgrTestSuite) TestEnableTasks(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -585,6 +714,36 @@ func (s *snapmgrTestSuite) TestInstallPathSnapIDRevisionUnset(c *C) {
 	c.Assert(err, ErrorMatches, fmt.Sprintf(`internal error: snap id set to install %q but revision is unset`, mockSnap))
 }
 
+func (s *snapmgrTestSuite) TestInstallPathConfigure(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	mockSnap := makeTestSnap(c, "name: some-snap\nversion: 1.0")
+	ts, err := snapstate.InstallPath(s.state, &snap.SideInfo{RealName: "some-snap"}, mockSnap, "", 0)
+	c.Assert(err, IsNil)
+
+	tasks := ts.Tasks()
+	configure := tasks[len(tasks)-1]
+	c.Assert(configure.Kind(), Equals, "run-hook")
+	c.Check(configure.WaitTasks(), DeepEquals, []*state.Task{tasks[len(tasks)-2]})
+	var hookContext map[string]interface{}
+	c.Assert(configure.Get("hook-context", &hookContext), IsNil)
+	c.Check(hookContext, DeepEquals, map[string]interface{}{"use-defaults": true})
+}
+
+func (s *snapmgrTestSuite) TestInstallPathSkipConfigure(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	mockSnap := makeTestSnap(c, "name: some-snap\nversion: 1.0")
+	ts, err := snapstate.InstallPath(s.state, &snap.SideInfo{RealName: "some-snap"}, mockSnap, "", snapstate.SkipConfigure)
+	c.Assert(err, IsNil)
+
+	for _, t := range ts.Tasks() {
+		c.Check(t.Kind(), Not(Equals), "run-hook")
+	}
+}
+
 func (s *snapmgrTestSuite) TestUpdateTasksPropagtesErrors(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -657,6 +816,158 @@ func (s *snapmgrTestSuite) TestUpdateChannelFallback(c *C) {
 	c.Check(ss.Channel, Equals, "edge")
 }
 
+func (s *snapmgrTestSuite) TestUpdateGadgetTasks(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+		SnapType: "gadget",
+	})
+
+	ts, err := snapstate.Update(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, 0)
+	c.Assert(err, IsNil)
+
+	kinds := make([]string, 0, 4)
+	for _, t := range ts.Tasks()[:4] {
+		kinds = append(kinds, t.Kind())
+	}
+	c.Check(kinds, DeepEquals, []string{"download-snap", "validate-snap", "mount-snap", "update-gadget-assets"})
+	c.Check(ts.Tasks()[4].WaitTasks(), DeepEquals, []*state.Task{ts.Tasks()[3]})
+}
+
+func (s *snapmgrTestSuite) TestUpdateGadgetOnClassicNoAssetsTask(c *C) {
+	restore := release.MockOnClassic(true)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+		SnapType: "gadget",
+	})
+
+	ts, err := snapstate.Update(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, 0)
+	c.Assert(err, IsNil)
+	for _, t := range ts.Tasks() {
+		c.Check(t.Kind(), Not(Equals), "update-gadget-assets")
+	}
+}
+
+func (s *snapmgrTestSuite) TestUpdateGadgetUndoRunThrough(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	var calls []string
+	restore = snapstate.MockGadgetUpdate(func(oldDir, newDir, backupDir string) error {
+		calls = append(calls, fmt.Sprintf("update %s %s %s", oldDir, newDir, backupDir))
+		return nil
+	}, func(backupDir string) error {
+		calls = append(calls, fmt.Sprintf("rollback %s", backupDir))
+		return nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+		SnapType: "gadget",
+	})
+
+	chg := s.state.NewChange("refresh", "refresh a gadget")
+	ts, err := snapstate.Update(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, 0)
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.fakeBackend.linkSnapFailTrigger = "/snap/some-snap/11"
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	backupDir := filepath.Join(dirs.SnapGadgetBackupDir, "some-snap")
+	c.Check(calls, DeepEquals, []string{
+		fmt.Sprintf("update %s %s %s", filepath.Join(dirs.SnapMountDir, "some-snap/7"), filepath.Join(dirs.SnapMountDir, "some-snap/11"), backupDir),
+		fmt.Sprintf("rollback %s", backupDir),
+	})
+}
+
+func (s *snapmgrTestSuite) TestInstallReplaceGadgetTasks(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ts, err := snapstate.Install(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, snapstate.ReplaceGadget)
+	c.Assert(err, IsNil)
+
+	kinds := make([]string, 0, 4)
+	for _, t := range ts.Tasks()[:4] {
+		kinds = append(kinds, t.Kind())
+	}
+	c.Check(kinds, DeepEquals, []string{"download-snap", "validate-snap", "mount-snap", "update-gadget-assets"})
+}
+
+func (s *snapmgrTestSuite) TestInstallReplaceGadgetUndoRunThrough(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	var calls []string
+	restore = snapstate.MockGadgetUpdate(func(oldDir, newDir, backupDir string) error {
+		calls = append(calls, fmt.Sprintf("update %s %s %s", oldDir, newDir, backupDir))
+		return nil
+	}, func(backupDir string) error {
+		calls = append(calls, fmt.Sprintf("rollback %s", backupDir))
+		return nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "gadget", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "gadget", Revision: snap.R(2)}},
+		Current:  snap.R(2),
+		SnapType: "gadget",
+	})
+
+	chg := s.state.NewChange("install", "replace the gadget")
+	ts, err := snapstate.Install(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, snapstate.ReplaceGadget)
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.fakeBackend.linkSnapFailTrigger = "/snap/some-snap/11"
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	// the assets of the replaced gadget are updated
+	backupDir := filepath.Join(dirs.SnapGadgetBackupDir, "some-snap")
+	c.Check(calls, DeepEquals, []string{
+		fmt.Sprintf("update %s %s %s", filepath.Join(dirs.SnapMountDir, "gadget/2"), filepath.Join(dirs.SnapMountDir, "some-snap/11"), backupDir),
+		fmt.Sprintf("rollback %s", backupDir),
+	})
+}
+
 func (s *snapmgrTestSuite) TestUpdatePassDevMode(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -840,10 +1151,12 @@ func (s *snapmgrTestSuite) TestInstallRunThrough(c *C) {
 	c.Check(task.Summary(), Equals, `Download snap "some-snap" (42) from channel "some-channel"`)
 
 	// check link/start snap summary
-	linkTask := ta[len(ta)-2]
+	linkTask := ta[len(ta)-3]
 	c.Check(linkTask.Summary(), Equals, `Make snap "some-snap" (42) available to the system`)
-	startTask := ta[len(ta)-1]
+	startTask := ta[len(ta)-2]
 	c.Check(startTask.Summary(), Equals, `Start snap "some-snap" (42) services`)
+	configureTask := ta[len(ta)-1]
+	c.Check(configureTask.Summary(), Equals, `Run configure hook for some-snap`)
 
 	// verify snap-setup in the task state
 	var ss snapstate.SnapSetup
@@ -1401,6 +1714,111 @@ func (s *snapmgrTestSuite) TestUpdateValidateRefreshesSaysNo(c *C) {
 	c.Assert(err, Equals, validateErr)
 }
 
+func mockValidationSet(c *C, snaps ...interface{}) *asserts.ValidationSet {
+	privKey, _ := assertstest.GenerateKey(752)
+	signingDB := assertstest.NewSigningDB("acme", privKey)
+	a, err := signingDB.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"series":     "16",
+		"account-id": "acme",
+		"name":       "base-set",
+		"sequence":   "1",
+		"snaps":      snaps,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *snapmgrTestSuite) mockEnforcedValidationSets(c *C, snaps ...interface{}) {
+	vs := mockValidationSet(c, snaps...)
+	snapstate.EnforcedValidationSets = func(st *state.State) ([]*asserts.ValidationSet, error) {
+		c.Check(st, Equals, s.state)
+		return []*asserts.ValidationSet{vs}, nil
+	}
+}
+
+func (s *snapmgrTestSuite) TestInstallValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockEnforcedValidationSets(c, map[string]interface{}{
+		"name":     "some-snap",
+		"id":       "some-snap-id",
+		"revision": "11",
+	}, map[string]interface{}{
+		"name":     "other-snap",
+		"id":       "other-snap-id",
+		"presence": "invalid",
+	})
+
+	_, err := snapstate.Install(s.state, "some-snap", "some-channel", snap.R(0), 0, 0)
+	c.Assert(err, IsNil)
+
+	_, err = snapstate.Install(s.state, "some-snap", "channel-for-7", snap.R(0), 0, 0)
+	c.Assert(err, ErrorMatches, `snap "some-snap" revision 7 is not the revision 11 required by validation sets: acme/base-set`)
+
+	_, err = snapstate.Install(s.state, "other-snap", "some-channel", snap.R(0), 0, 0)
+	c.Assert(err, ErrorMatches, `snap "other-snap" is invalid according to validation sets: acme/base-set`)
+}
+
+func (s *snapmgrTestSuite) TestUpdateValidationSets(c *C) {
+	si := snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-id",
+		Revision: snap.R(7),
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{&si},
+		Current:  si.Revision,
+	})
+
+	s.mockEnforcedValidationSets(c, map[string]interface{}{
+		"name":     "some-snap",
+		"id":       "some-snap-id",
+		"revision": "7",
+	})
+
+	_, err := snapstate.Update(s.state, "some-snap", "stable", snap.R(0), s.user.ID, 0)
+	c.Assert(err, ErrorMatches, `snap "some-snap" revision 11 is not the revision 7 required by validation sets: acme/base-set`)
+
+	// refresh all skips it
+	updates, tts, err := snapstate.UpdateMany(s.state, nil, 0)
+	c.Assert(err, IsNil)
+	c.Check(tts, HasLen, 0)
+	c.Check(updates, HasLen, 0)
+}
+
+func (s *snapmgrTestSuite) TestRemoveValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", Revision: snap.R(7)},
+			{RealName: "foo", Revision: snap.R(11)},
+		},
+		Current: snap.R(11),
+	})
+
+	s.mockEnforcedValidationSets(c, map[string]interface{}{
+		"name": "foo",
+		"id":   "foo-id",
+	})
+
+	_, err := snapstate.Remove(s.state, "foo", snap.R(0))
+	c.Assert(err, ErrorMatches, `snap "foo" is required by validation sets: acme/base-set`)
+
+	// removing an old revision is fine
+	_, err = snapstate.Remove(s.state, "foo", snap.R(7))
+	c.Assert(err, IsNil)
+}
+
 func (s *snapmgrTestSuite) TestUpdateBlockedRevision(c *C) {
 	si7 := snap.SideInfo{
 		RealName: "some-snap",
@@ -3112,6 +3530,101 @@ version: gadget
 	c.Check(info.Type, Equals, snap.TypeGadget)
 }
 
+func (s *snapmgrQuerySuite) TestGadgetInfoWhileReplaced(c *C) {
+	st := s.st
+	st.Lock()
+	defer st.Unlock()
+
+	for _, name := range []string{"gadget", "other-gadget"} {
+		sideInfo := &snap.SideInfo{
+			RealName: name,
+			Revision: snap.R(2),
+		}
+		snaptest.MockSnap(c, fmt.Sprintf("name: %s\ntype: gadget\nversion: 1\n", name), sideInfo)
+		snapstate.Set(st, name, &snapstate.SnapState{
+			SnapType: "gadget",
+			Active:   true,
+			Sequence: []*snap.SideInfo{sideInfo},
+			Current:  sideInfo.Revision,
+		})
+	}
+
+	_, err := snapstate.GadgetInfo(st)
+	c.Check(err, ErrorMatches, "internal error: cannot tell the current gadget snap apart")
+
+	modelGadget := "gadget"
+	snapstate.ModelGadget = func(*state.State) (string, error) {
+		return modelGadget, nil
+	}
+	defer func() { snapstate.ModelGadget = nil }()
+
+	info, err := snapstate.GadgetInfo(st)
+	c.Assert(err, IsNil)
+	c.Check(info.Name(), Equals, "gadget")
+
+	modelGadget = "other-gadget"
+	info, err = snapstate.GadgetInfo(st)
+	c.Assert(err, IsNil)
+	c.Check(info.Name(), Equals, "other-gadget")
+}
+
+func (s *snapmgrQuerySuite) TestConfigDefaults(c *C) {
+	st := s.st
+	st.Lock()
+	defer st.Unlock()
+
+	// no gadget
+	_, err := snapstate.ConfigDefaults(st, "some-snap")
+	c.Assert(err, Equals, state.ErrNoState)
+
+	sideInfoGadget := &snap.SideInfo{
+		RealName: "gadget",
+		Revision: snap.R(2),
+	}
+	info := snaptest.MockSnap(c, `
+name: gadget
+type: gadget
+version: gadget
+`, sideInfoGadget)
+	err = ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "gadget.yaml"), []byte(`
+defaults:
+  some-snap-ididididididididididid:
+    foo: bar
+volumes:
+  volume-id:
+    bootloader: grub
+`), 0644)
+	c.Assert(err, IsNil)
+	snapstate.Set(st, "gadget", &snapstate.SnapState{
+		SnapType: "gadget",
+		Active:   true,
+		Sequence: []*snap.SideInfo{sideInfoGadget},
+		Current:  sideInfoGadget.Revision,
+	})
+
+	sideInfo := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-ididididididididididid",
+		Revision: snap.R(1),
+	}
+	snapstate.Set(st, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{sideInfo},
+		Current:  sideInfo.Revision,
+		SnapType: "app",
+	})
+
+	defaults, err := snapstate.ConfigDefaults(st, "some-snap")
+	c.Assert(err, IsNil)
+	c.Check(defaults, DeepEquals, map[string]interface{}{
+		"foo": "bar",
+	})
+
+	// name1 is unasserted, so there cannot be defaults for it
+	_, err = snapstate.ConfigDefaults(st, "name1")
+	c.Assert(err, Equals, state.ErrNoState)
+}
+
 func (s *snapmgrQuerySuite) TestPreviousSideInfo(c *C) {
 	st := s.st
 	st.Lock()
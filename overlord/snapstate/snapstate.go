@@ -26,10 +26,14 @@ import (
 	"reflect"
 	"sort"
 
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
 )
@@ -46,6 +50,16 @@ const (
 	// JailMode is set when the user has requested confinement
 	// always be enforcing, even if the snap requests otherwise.
 	JailMode
+
+	// SkipConfigure is set when the caller takes care of running the
+	// configure hook of a newly installed snap itself, e.g. only once
+	// the gadget is there while seeding.
+	SkipConfigure
+
+	// ReplaceGadget is set when installing a gadget snap that replaces
+	// the current one, which must be of the same publisher, when
+	// moving the device to another model.
+	ReplaceGadget
 )
 
 func (f Flags) DevModeAllowed() bool {
@@ -60,11 +74,27 @@ func (f Flags) JailMode() bool {
 	return f&JailMode != 0
 }
 
+func (f Flags) SkipConfigure() bool {
+	return f&SkipConfigure != 0
+}
+
+func (f Flags) ReplaceGadget() bool {
+	return f&ReplaceGadget != 0
+}
+
 func doInstall(s *state.State, snapst *SnapState, ss *SnapSetup) (*state.TaskSet, error) {
 	if err := checkChangeConflict(s, ss.Name(), snapst); err != nil {
 		return nil, err
 	}
 
+	vsets, err := enforcedValidationSets(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := snapasserts.CheckSnapInstall(vsets, ss.Name(), ss.Revision()); err != nil {
+		return nil, err
+	}
+
 	if ss.SnapPath == "" && ss.Channel == "" {
 		ss.Channel = "stable"
 	}
@@ -110,6 +140,15 @@ func doInstall(s *state.State, snapst *SnapState, ss *SnapSetup) (*state.TaskSet
 		prev = mount
 	}
 
+	// gadget assets (boot loader, firmware) live outside of the snap
+	typ, err := snapst.Type()
+	updatingGadget := err == nil && typ == snap.TypeGadget && snapst.HasCurrent()
+	if (updatingGadget || Flags(ss.Flags).ReplaceGadget()) && !release.OnClassic {
+		updateGadget := s.NewTask("update-gadget-assets", fmt.Sprintf(i18n.G("Update assets from gadget %q%s"), ss.Name(), revisionStr))
+		addTask(updateGadget)
+		prev = updateGadget
+	}
+
 	if snapst.Active {
 		// unlink-current-snap (will stop services for copy-data)
 		stop := s.NewTask("stop-snap-services", fmt.Sprintf(i18n.G("Stop snap %q services"), ss.Name()))
@@ -143,6 +182,15 @@ func doInstall(s *state.State, snapst *SnapState, ss *SnapSetup) (*state.TaskSet
 	addTask(startSnapServices)
 	prev = startSnapServices
 
+	// configure a newly installed snap, starting from the defaults
+	// of the gadget
+	if !snapst.HasCurrent() && !Flags(ss.Flags).SkipConfigure() {
+		ts := configstate.Configure(s, ss.Name(), configstate.UseConfigDefaults)
+		ts.WaitFor(prev)
+		tasks = append(tasks, ts.Tasks()...)
+		prev = tasks[len(tasks)-1]
+	}
+
 	// Do not do that if we are reverting to a local revision
 	if snapst.HasCurrent() && !ss.Flags.Revert() {
 		seq := snapst.Sequence
@@ -190,7 +238,7 @@ func checkChangeConflict(s *state.State, snapName string, snapst *SnapState) err
 	for _, task := range s.Tasks() {
 		k := task.Kind()
 		chg := task.Change()
-		if (k == "link-snap" || k == "unlink-snap") && (chg == nil || !chg.Status().Ready()) {
+		if (k == "link-snap" || k == "unlink-snap" || k == "switch-snap-channel") && (chg == nil || !chg.Status().Ready()) {
 			ss, err := TaskSnapSetup(task)
 			if err != nil {
 				return fmt.Errorf("internal error: cannot obtain snap setup from task: %s", task.Summary())
@@ -222,6 +270,31 @@ func checkChangeConflict(s *state.State, snapName string, snapst *SnapState) err
 	return nil
 }
 
+// WaitingForBoot returns whether a change in progress linked the given
+// kernel or core snap and waits for the system to confirm booting it.
+func WaitingForBoot(st *state.State, name string) (bool, error) {
+	for _, t := range st.Tasks() {
+		if t.Kind() != "link-snap" || t.Status() != state.DoingStatus {
+			continue
+		}
+		var pending bool
+		if err := t.Get("boot-pending", &pending); err != nil && err != state.ErrNoState {
+			return false, err
+		}
+		if !pending {
+			continue
+		}
+		ss, err := TaskSnapSetup(t)
+		if err != nil {
+			return false, err
+		}
+		if ss.Name() == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // InstallPath returns a set of tasks for installing snap from a file path.
 // Note that the state must be locked by the caller.
 // The provided SideInfo can contain just a name which results in a
@@ -376,6 +449,18 @@ func refreshCandidates(st *state.State, names []string, user *auth.UserState) ([
 // ValidateRefreshes allows to hook validation into the handling of refresh candidates.
 var ValidateRefreshes func(s *state.State, refreshes []*snap.Info, userID int) (validated []*snap.Info, err error)
 
+// EnforcedValidationSets allows to hook retrieving the validation sets
+// enforced on the system, which installing, refreshing and removing
+// snaps must respect.
+var EnforcedValidationSets func(s *state.State) ([]*asserts.ValidationSet, error)
+
+func enforcedValidationSets(s *state.State) ([]*asserts.ValidationSet, error) {
+	if EnforcedValidationSets == nil {
+		return nil, nil
+	}
+	return EnforcedValidationSets(s)
+}
+
 // UpdateMany updates everything from the given list of names that the
 // store says is updateable. If the list is empty, update everything.
 // Note that the state must be locked by the caller.
@@ -473,6 +558,40 @@ func Update(s *state.State, name, channel string, revision snap.Revision, userID
 	return doInstall(s, &snapst, ss)
 }
 
+// Switch switches the channel a snap is tracking without refreshing it.
+// Note that the state must be locked by the caller.
+func Switch(s *state.State, name, channel string) (*state.TaskSet, error) {
+	if channel == "" {
+		return nil, fmt.Errorf("cannot switch snap %q to an empty channel", name)
+	}
+
+	var snapst SnapState
+	err := Get(s, name, &snapst)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if !snapst.HasCurrent() {
+		return nil, fmt.Errorf("cannot find snap %q", name)
+	}
+
+	if err := checkChangeConflict(s, name, nil); err != nil {
+		return nil, err
+	}
+
+	ss := &SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: name,
+			Revision: snapst.Current,
+		},
+		Channel: channel,
+	}
+
+	switchSnap := s.NewTask("switch-snap-channel", fmt.Sprintf(i18n.G("Switch snap %q to channel %q"), name, channel))
+	switchSnap.Set("snap-setup", &ss)
+
+	return state.NewTaskSet(switchSnap), nil
+}
+
 func infoForUpdate(s *state.State, snapst *SnapState, name, channel string, revision snap.Revision, userID int, flags Flags) (*snap.Info, error) {
 	if revision.Unset() {
 		// good ol' refresh
@@ -636,6 +755,14 @@ func Remove(s *state.State, name string, revision snap.Revision) (*state.TaskSet
 	if revision.Unset() {
 		removeAll = true
 		revision = snapst.Current
+
+		vsets, err := enforcedValidationSets(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := snapasserts.CheckSnapRemove(vsets, name); err != nil {
+			return nil, err
+		}
 	} else {
 		removeAll = false
 
@@ -879,12 +1006,18 @@ func ActiveInfos(s *state.State) ([]*snap.Info, error) {
 	return infos, nil
 }
 
+// ModelGadget allows to hook retrieving the name of the gadget snap of
+// the device model, which tells the current gadget apart while another
+// one is installed to replace it.
+var ModelGadget func(s *state.State) (string, error)
+
 // GadgetInfo finds the current gadget snap's info.
 func GadgetInfo(s *state.State) (*snap.Info, error) {
 	var stateMap map[string]*SnapState
 	if err := s.Get("snaps", &stateMap); err != nil && err != state.ErrNoState {
 		return nil, err
 	}
+	var gadgets []*SnapState
 	for _, snapState := range stateMap {
 		if !snapState.HasCurrent() {
 			continue
@@ -896,12 +1029,73 @@ func GadgetInfo(s *state.State) (*snap.Info, error) {
 		if typ != snap.TypeGadget {
 			continue
 		}
-		return snapState.CurrentInfo()
+		gadgets = append(gadgets, snapState)
+	}
+
+	switch len(gadgets) {
+	case 0:
+		return nil, state.ErrNoState
+	case 1:
+		return gadgets[0].CurrentInfo()
 	}
 
+	if ModelGadget == nil {
+		return nil, fmt.Errorf("internal error: cannot tell the current gadget snap apart")
+	}
+	name, err := ModelGadget(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapState := range gadgets {
+		info, err := snapState.CurrentInfo()
+		if err != nil {
+			return nil, err
+		}
+		if info.Name() == name {
+			return info, nil
+		}
+	}
 	return nil, state.ErrNoState
 }
 
+// ConfigDefaults returns the default configuration the gadget
+// provides for the given snap. It returns state.ErrNoState if there is
+// no gadget or it has no defaults for the snap.
+func ConfigDefaults(s *state.State, snapName string) (map[string]interface{}, error) {
+	gadget, err := GadgetInfo(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapst SnapState
+	if err := Get(s, snapName, &snapst); err != nil {
+		return nil, err
+	}
+	if !snapst.HasCurrent() {
+		return nil, state.ErrNoState
+	}
+	snapID := snapst.CurrentSideInfo().SnapID
+	if snapID == "" {
+		// unasserted snaps cannot be named in the gadget
+		return nil, state.ErrNoState
+	}
+
+	gadgetInfo, err := snap.ReadGadgetInfo(gadget)
+	if err != nil {
+		return nil, err
+	}
+	defaults, ok := gadgetInfo.Defaults[snapID]
+	if !ok {
+		return nil, state.ErrNoState
+	}
+	return defaults, nil
+}
+
+func init() {
+	// hook the gadget defaults into configuring newly installed snaps
+	configstate.ConfigDefaults = ConfigDefaults
+}
+
 // InstallMany installs everything from the given list of names.
 // Note that the state must be locked by the caller.
 func InstallMany(st *state.State, names []string, userID int) ([]string, []*state.TaskSet, error) {
@@ -68,7 +68,7 @@ type Bootloader interface {
 // InstallBootConfig installs the bootloader config from the gadget
 // snap dir into the right place.
 func InstallBootConfig(gadgetDir string) error {
-	for _, bl := range []Bootloader{&grub{}, &uboot{}} {
+	for _, bl := range []Bootloader{&grub{}, &uboot{}, &systemdBoot{}} {
 		// the bootloader config file has to be root of the gadget snap
 		gadgetFile := filepath.Join(gadgetDir, bl.Name()+".conf")
 		if !osutil.FileExists(gadgetFile) {
@@ -104,6 +104,11 @@ func FindBootloader() (Bootloader, error) {
 		return grub, nil
 	}
 
+	// no, try systemd-boot
+	if sdboot := newSystemdBoot(); sdboot != nil {
+		return sdboot, nil
+	}
+
 	// no, weeeee
 	return nil, ErrBootloader
 }
@@ -0,0 +1,233 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package partition
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// systemd-boot has no scripting, so the boot variables are kept in an
+// env file on the EFI system partition and turned into loader entries:
+// snapd.conf boots the good kernel and core, and while trying new ones
+// snapd-try+1.conf boots those. The try entry gets a single boot
+// attempt through the boot counting of systemd-boot, which renames it
+// once it was attempted, falling back to the good entry afterwards.
+const (
+	sdbootEntry    = "snapd.conf"
+	sdbootTryEntry = "snapd-try+1.conf"
+
+	// kernel command line argument set by the try entry
+	sdbootTryArg = "snapd_try=1"
+)
+
+type systemdBoot struct {
+}
+
+// newSystemdBoot create a new systemd-boot bootloader object
+func newSystemdBoot() Bootloader {
+	s := &systemdBoot{}
+	if !osutil.FileExists(s.ConfigFile()) {
+		return nil
+	}
+
+	return s
+}
+
+func (s *systemdBoot) Name() string {
+	return "systemd-boot"
+}
+
+// Dir returns the EFI system partition, where the kernel assets live.
+func (s *systemdBoot) Dir() string {
+	return filepath.Join(dirs.GlobalRootDir, "/boot/efi")
+}
+
+func (s *systemdBoot) ConfigFile() string {
+	return filepath.Join(s.Dir(), "loader", "loader.conf")
+}
+
+func (s *systemdBoot) envFile() string {
+	return filepath.Join(s.Dir(), "loader", "snapd.env")
+}
+
+func (s *systemdBoot) entriesDir() string {
+	return filepath.Join(s.Dir(), "loader", "entries")
+}
+
+func (s *systemdBoot) readEnv() (map[string]string, error) {
+	env := make(map[string]string)
+	f, err := os.Open(s.envFile())
+	if os.IsNotExist(err) {
+		return env, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l := strings.SplitN(line, "=", 2)
+		if len(l) != 2 {
+			return nil, fmt.Errorf("cannot parse %q: invalid line %q", s.envFile(), line)
+		}
+		env[l[0]] = l[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (s *systemdBoot) writeEnv(env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s=%s\n", k, env[k])
+	}
+	if err := os.MkdirAll(filepath.Dir(s.envFile()), 0755); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(s.envFile(), buf.Bytes(), 0644, 0)
+}
+
+func loaderEntry(title, kernel, core string, extra ...string) []byte {
+	options := append([]string{"snap_core=" + core, "snap_kernel=" + kernel}, extra...)
+	return []byte(fmt.Sprintf("title %s\nlinux /%s/kernel.img\ninitrd /%s/initrd.img\noptions %s\n",
+		title, kernel, kernel, strings.Join(options, " ")))
+}
+
+// writeEntries makes the loader entries match the given boot variables.
+func (s *systemdBoot) writeEntries(env map[string]string) error {
+	if err := os.MkdirAll(s.entriesDir(), 0755); err != nil {
+		return err
+	}
+
+	kernel, core := env["snap_kernel"], env["snap_core"]
+	if kernel != "" {
+		entry := loaderEntry("Ubuntu Core", kernel, core)
+		if err := osutil.AtomicWriteFile(filepath.Join(s.entriesDir(), sdbootEntry), entry, 0644, 0); err != nil {
+			return err
+		}
+	}
+
+	// drop the try entry, whatever its boot counting state
+	tryEntries, err := filepath.Glob(filepath.Join(s.entriesDir(), "snapd-try*.conf"))
+	if err != nil {
+		return err
+	}
+	for _, p := range tryEntries {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	if env[bootmodeVar] != modeTry {
+		return nil
+	}
+
+	if tryKernel := env["snap_try_kernel"]; tryKernel != "" {
+		kernel = tryKernel
+	}
+	if tryCore := env["snap_try_core"]; tryCore != "" {
+		core = tryCore
+	}
+	entry := loaderEntry("Ubuntu Core (try)", kernel, core, sdbootTryArg)
+	return osutil.AtomicWriteFile(filepath.Join(s.entriesDir(), sdbootTryEntry), entry, 0644, 0)
+}
+
+// bootedTryEntry returns whether the running system was booted from the
+// try entry.
+func bootedTryEntry() (bool, error) {
+	cmdline, err := ioutil.ReadFile(filepath.Join(dirs.GlobalRootDir, "/proc/cmdline"))
+	if err != nil {
+		return false, err
+	}
+	for _, arg := range strings.Fields(string(cmdline)) {
+		if arg == sdbootTryArg {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *systemdBoot) GetBootVar(name string) (string, error) {
+	env, err := s.readEnv()
+	if err != nil {
+		return "", err
+	}
+	value := env[name]
+	if name != bootmodeVar || value != modeTry {
+		return value, nil
+	}
+
+	// systemd-boot does not update the env, tell the try mode
+	// states apart the way the other bootloaders would have
+	if osutil.FileExists(filepath.Join(s.entriesDir(), sdbootTryEntry)) {
+		// not attempted yet
+		return modeTry, nil
+	}
+	tried, err := bootedTryEntry()
+	if err != nil {
+		return "", err
+	}
+	if tried {
+		return "trying", nil
+	}
+	// the attempt failed and systemd-boot fell back
+	return modeSuccess, nil
+}
+
+func (s *systemdBoot) SetBootVar(name, value string) error {
+	env, err := s.readEnv()
+	if err != nil {
+		return err
+	}
+
+	// already set, nothing to do; a new try needs a fresh try
+	// entry though
+	if old, ok := env[name]; ok && old == value && name != bootmodeVar {
+		return nil
+	}
+
+	env[name] = value
+	if err := s.writeEnv(env); err != nil {
+		return err
+	}
+	return s.writeEntries(env)
+}
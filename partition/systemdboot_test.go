@@ -0,0 +1,173 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package partition
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+)
+
+func (s *PartitionTestSuite) makeFakeSystemdBootConfig(c *C) {
+	sb := &systemdBoot{}
+	err := os.MkdirAll(filepath.Dir(sb.ConfigFile()), 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(sb.ConfigFile(), []byte("default snapd*\n"), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *PartitionTestSuite) mockCmdline(c *C, cmdline string) {
+	fn := filepath.Join(dirs.GlobalRootDir, "/proc/cmdline")
+	err := os.MkdirAll(filepath.Dir(fn), 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(fn, []byte(cmdline), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *PartitionTestSuite) TestNewSystemdBootNoConfigReturnsNil(c *C) {
+	sb := newSystemdBoot()
+	c.Assert(sb, IsNil)
+}
+
+func (s *PartitionTestSuite) TestGetBootloaderWithSystemdBoot(c *C) {
+	s.makeFakeSystemdBootConfig(c)
+
+	bootloader, err := FindBootloader()
+	c.Assert(err, IsNil)
+	c.Assert(bootloader, FitsTypeOf, &systemdBoot{})
+	c.Check(bootloader.Name(), Equals, "systemd-boot")
+	c.Check(bootloader.Dir(), Equals, filepath.Join(dirs.GlobalRootDir, "/boot/efi"))
+}
+
+func (s *PartitionTestSuite) TestSystemdBootSetGetBootVar(c *C) {
+	s.makeFakeSystemdBootConfig(c)
+	sb := newSystemdBoot()
+	c.Assert(sb, NotNil)
+
+	v, err := sb.GetBootVar("snap_core")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "")
+
+	c.Assert(sb.SetBootVar("snap_core", "core_1.snap"), IsNil)
+	c.Assert(sb.SetBootVar("snap_kernel", "pc-kernel_1.snap"), IsNil)
+
+	v, err = sb.GetBootVar("snap_core")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "core_1.snap")
+
+	env, err := ioutil.ReadFile(filepath.Join(dirs.GlobalRootDir, "/boot/efi/loader/snapd.env"))
+	c.Assert(err, IsNil)
+	c.Check(string(env), Equals, "snap_core=core_1.snap\nsnap_kernel=pc-kernel_1.snap\n")
+
+	entry, err := ioutil.ReadFile(filepath.Join(dirs.GlobalRootDir, "/boot/efi/loader/entries/snapd.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(entry), Equals, `title Ubuntu Core
+linux /pc-kernel_1.snap/kernel.img
+initrd /pc-kernel_1.snap/initrd.img
+options snap_core=core_1.snap snap_kernel=pc-kernel_1.snap
+`)
+}
+
+func (s *PartitionTestSuite) TestSystemdBootTryMode(c *C) {
+	s.makeFakeSystemdBootConfig(c)
+	sb := newSystemdBoot()
+	c.Assert(sb, NotNil)
+	tryEntry := filepath.Join(dirs.GlobalRootDir, "/boot/efi/loader/entries/snapd-try+1.conf")
+
+	c.Assert(sb.SetBootVar("snap_core", "core_1.snap"), IsNil)
+	c.Assert(sb.SetBootVar("snap_kernel", "pc-kernel_1.snap"), IsNil)
+	c.Assert(sb.SetBootVar("snap_try_kernel", "pc-kernel_2.snap"), IsNil)
+	c.Assert(sb.SetBootVar("snap_mode", "try"), IsNil)
+
+	entry, err := ioutil.ReadFile(tryEntry)
+	c.Assert(err, IsNil)
+	c.Check(string(entry), Equals, `title Ubuntu Core (try)
+linux /pc-kernel_2.snap/kernel.img
+initrd /pc-kernel_2.snap/initrd.img
+options snap_core=core_1.snap snap_kernel=pc-kernel_2.snap snapd_try=1
+`)
+
+	// not booted yet
+	v, err := sb.GetBootVar("snap_mode")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "try")
+
+	// systemd-boot counted the boot attempt of the try entry
+	attempted := filepath.Join(dirs.GlobalRootDir, "/boot/efi/loader/entries/snapd-try+0-1.conf")
+	c.Assert(os.Rename(tryEntry, attempted), IsNil)
+	s.mockCmdline(c, "snap_core=core_1.snap snap_kernel=pc-kernel_2.snap snapd_try=1 quiet")
+
+	v, err = sb.GetBootVar("snap_mode")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "trying")
+
+	// the usual protocol marks the boot successful
+	c.Assert(MarkBootSuccessful(sb), IsNil)
+
+	v, err = sb.GetBootVar("snap_kernel")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "pc-kernel_2.snap")
+	v, err = sb.GetBootVar("snap_mode")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "")
+	c.Check(osutil.FileExists(attempted), Equals, false)
+
+	entry, err = ioutil.ReadFile(filepath.Join(dirs.GlobalRootDir, "/boot/efi/loader/entries/snapd.conf"))
+	c.Assert(err, IsNil)
+	c.Check(string(entry), Matches, `(?s).*options snap_core=core_1.snap snap_kernel=pc-kernel_2.snap\n`)
+}
+
+func (s *PartitionTestSuite) TestSystemdBootTryModeFallback(c *C) {
+	s.makeFakeSystemdBootConfig(c)
+	sb := newSystemdBoot()
+	c.Assert(sb, NotNil)
+	tryEntry := filepath.Join(dirs.GlobalRootDir, "/boot/efi/loader/entries/snapd-try+1.conf")
+
+	c.Assert(sb.SetBootVar("snap_core", "core_1.snap"), IsNil)
+	c.Assert(sb.SetBootVar("snap_kernel", "pc-kernel_1.snap"), IsNil)
+	c.Assert(sb.SetBootVar("snap_try_core", "core_2.snap"), IsNil)
+	c.Assert(sb.SetBootVar("snap_mode", "try"), IsNil)
+
+	// the try entry failed to boot, systemd-boot used the good one
+	c.Assert(os.Rename(tryEntry, filepath.Join(filepath.Dir(tryEntry), "snapd-try+0-1.conf")), IsNil)
+	s.mockCmdline(c, "snap_core=core_1.snap snap_kernel=pc-kernel_1.snap quiet")
+
+	v, err := sb.GetBootVar("snap_mode")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "")
+
+	// nothing to mark
+	c.Assert(MarkBootSuccessful(sb), IsNil)
+	v, err = sb.GetBootVar("snap_core")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "core_1.snap")
+
+	// trying again gives a fresh try entry
+	c.Assert(sb.SetBootVar("snap_mode", "try"), IsNil)
+	c.Check(osutil.FileExists(tryEntry), Equals, true)
+	v, err = sb.GetBootVar("snap_mode")
+	c.Assert(err, IsNil)
+	c.Check(v, Equals, "try")
+}
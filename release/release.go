@@ -121,6 +121,12 @@ var OnClassic bool
 // ReleaseInfo contains data loaded from /etc/os-release on startup.
 var ReleaseInfo OS
 
+// Preseeding states whether the process is running the first boot
+// seeding of an image at image build time, instead of on the booted
+// device. Nothing may then be loaded into or started on the running
+// system, which is not the one being seeded.
+var Preseeding bool
+
 func init() {
 	ReleaseInfo = readOSRelease()
 	// Assume that we are running on Classic
@@ -141,6 +147,14 @@ func MockOnClassic(onClassic bool) (restore func()) {
 	return func() { OnClassic = old }
 }
 
+// MockPreseeding forces the process to appear to be preseeding an
+// image or not for testing purposes.
+func MockPreseeding(preseeding bool) (restore func()) {
+	old := Preseeding
+	Preseeding = preseeding
+	return func() { Preseeding = old }
+}
+
 // MockReleaseInfo fakes a given information to appear in ReleaseInfo,
 // as if it was read /etc/os-release on startup.
 func MockReleaseInfo(osRelease *OS) (restore func()) {
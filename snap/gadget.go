@@ -23,12 +23,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
 type gadgetYaml struct {
-	Volumes map[string]volume `yaml:"volumes,omitempty"`
+	Defaults    map[string]map[string]interface{} `yaml:"defaults,omitempty"`
+	Connections []connection                      `yaml:"connections,omitempty"`
+	Volumes     map[string]volume                 `yaml:"volumes,omitempty"`
+}
+
+type connection struct {
+	Plug string `yaml:"plug"`
+	Slot string `yaml:"slot"`
 }
 
 type volume struct {
@@ -62,7 +70,30 @@ type content struct {
 }
 
 type GadgetInfo struct {
-	Volumes map[string]Volume
+	// Defaults holds the default configuration the gadget provides
+	// for snaps (including the core snap), keyed by their snap-id.
+	Defaults map[string]map[string]interface{}
+	// Connections lists the interface connections the gadget wants
+	// established between the snaps of the device.
+	Connections []GadgetConnection
+	Volumes     map[string]Volume
+}
+
+// GadgetConnection is a plug/slot pair the gadget wants connected,
+// with the snaps referred to by their snap-id.
+type GadgetConnection struct {
+	Plug GadgetConnectionPlug
+	Slot GadgetConnectionSlot
+}
+
+type GadgetConnectionPlug struct {
+	SnapID string
+	Plug   string
+}
+
+type GadgetConnectionSlot struct {
+	SnapID string
+	Slot   string
 }
 
 type Volume struct {
@@ -95,9 +126,15 @@ type Content struct {
 }
 
 func ReadGadgetInfo(info *Info) (*GadgetInfo, error) {
+	return ReadGadgetInfoFromDir(info.MountDir())
+}
+
+// ReadGadgetInfoFromDir reads the gadget specific metadata from
+// meta/gadget.yaml of the gadget snap unpacked or mounted in dir.
+func ReadGadgetInfoFromDir(dir string) (*GadgetInfo, error) {
 	const errorFormat = "cannot read gadget snap details: %s"
 
-	gadgetYamlFn := filepath.Join(info.MountDir(), "meta", "gadget.yaml")
+	gadgetYamlFn := filepath.Join(dir, "meta", "gadget.yaml")
 	gmeta, err := ioutil.ReadFile(gadgetYamlFn)
 	if err != nil {
 		return nil, fmt.Errorf(errorFormat, err)
@@ -117,10 +154,10 @@ func ReadGadgetInfo(info *Info) (*GadgetInfo, error) {
 		switch v.Bootloader {
 		case "":
 			return nil, fmt.Errorf(errorFormat, "bootloader cannot be empty")
-		case "grub", "u-boot":
+		case "grub", "u-boot", "systemd-boot":
 			foundBootloader = true
 		default:
-			return nil, fmt.Errorf(errorFormat, "bootloader must be either grub or u-boot")
+			return nil, fmt.Errorf(errorFormat, "bootloader must be one of grub, u-boot or systemd-boot")
 		}
 	}
 	if !foundBootloader {
@@ -130,6 +167,20 @@ func ReadGadgetInfo(info *Info) (*GadgetInfo, error) {
 	gi := &GadgetInfo{
 		Volumes: make(map[string]Volume),
 	}
+	if len(gy.Defaults) != 0 {
+		gi.Defaults = make(map[string]map[string]interface{}, len(gy.Defaults))
+		for snapID, conf := range gy.Defaults {
+			defaults := make(map[string]interface{}, len(conf))
+			for key, value := range conf {
+				v, err := normalizeYamlValue(value)
+				if err != nil {
+					return nil, fmt.Errorf(errorFormat, fmt.Sprintf("defaults for %q: option %q: %v", snapID, key, err))
+				}
+				defaults[key] = v
+			}
+			gi.Defaults[snapID] = defaults
+		}
+	}
 	for k, v := range gy.Volumes {
 		gi.Volumes[k] = Volume{
 			Schema:     v.Schema,
@@ -162,5 +213,62 @@ func ReadGadgetInfo(info *Info) (*GadgetInfo, error) {
 		}
 	}
 
+	for _, conn := range gy.Connections {
+		plugSnapID, plug, err := parseConnectionEnd(conn.Plug)
+		if err != nil {
+			return nil, fmt.Errorf(errorFormat, fmt.Sprintf("connection plug %s", err))
+		}
+		slotSnapID, slot, err := parseConnectionEnd(conn.Slot)
+		if err != nil {
+			return nil, fmt.Errorf(errorFormat, fmt.Sprintf("connection slot %s", err))
+		}
+		gi.Connections = append(gi.Connections, GadgetConnection{
+			Plug: GadgetConnectionPlug{SnapID: plugSnapID, Plug: plug},
+			Slot: GadgetConnectionSlot{SnapID: slotSnapID, Slot: slot},
+		})
+	}
+
 	return gi, nil
 }
+
+// parseConnectionEnd splits the <snap-id>:<name> form used by the
+// gadget connections.
+func parseConnectionEnd(s string) (snapID, name string, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%q is not of the form <snap-id>:<name>", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// normalizeYamlValue turns the maps yaml decodes into maps with string
+// keys, so that the value can be stored as configuration.
+func normalizeYamlValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key is not a string (found %T)", k)
+			}
+			value, err := normalizeYamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, item := range x {
+			value, err := normalizeYamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = value
+		}
+		return l, nil
+	}
+	return v, nil
+}
@@ -21,6 +21,7 @@ package snap_test
 
 import (
 	"io/ioutil"
+	"os"
 	"path/filepath"
 
 	. "gopkg.in/check.v1"
@@ -122,6 +123,18 @@ func (s *gadgetYamlTestSuite) TestReadGadgetYamlValid(c *C) {
 	})
 }
 
+func (s *gadgetYamlTestSuite) TestReadGadgetInfoFromDir(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(dir, "meta"), 0755), IsNil)
+	err := ioutil.WriteFile(filepath.Join(dir, "meta", "gadget.yaml"), mockGadgetYaml, 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := snap.ReadGadgetInfoFromDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(ginfo.Volumes, HasLen, 1)
+	c.Check(ginfo.Volumes["volumename"].Bootloader, Equals, "u-boot")
+}
+
 func (s *gadgetYamlTestSuite) TestReadGadgetYamlEmptydBootloader(c *C) {
 	info := snaptest.MockSnap(c, mockGadgetSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
 	mockGadgetYamlBroken := []byte(`
@@ -149,7 +162,7 @@ volumes:
 	c.Assert(err, IsNil)
 
 	_, err = snap.ReadGadgetInfo(info)
-	c.Assert(err, ErrorMatches, "cannot read gadget snap details: bootloader must be either grub or u-boot")
+	c.Assert(err, ErrorMatches, "cannot read gadget snap details: bootloader must be one of grub, u-boot or systemd-boot")
 }
 
 func (s *gadgetYamlTestSuite) TestReadGadgetYamlMissingBootloader(c *C) {
@@ -161,3 +174,96 @@ func (s *gadgetYamlTestSuite) TestReadGadgetYamlMissingBootloader(c *C) {
 	_, err = snap.ReadGadgetInfo(info)
 	c.Assert(err, ErrorMatches, "cannot read gadget snap details: bootloader not declared in any volume")
 }
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlDefaults(c *C) {
+	info := snaptest.MockSnap(c, mockGadgetSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
+	mockGadgetYamlWithDefaults := append([]byte(`
+defaults:
+  some-snap-id:
+    foo: bar
+    nested:
+      count: 3
+      list: [a, {key: value}]
+`), mockGadgetYaml...)
+
+	err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "gadget.yaml"), mockGadgetYamlWithDefaults, 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := snap.ReadGadgetInfo(info)
+	c.Assert(err, IsNil)
+	c.Check(ginfo.Defaults, DeepEquals, map[string]map[string]interface{}{
+		"some-snap-id": {
+			"foo": "bar",
+			"nested": map[string]interface{}{
+				"count": 3,
+				"list":  []interface{}{"a", map[string]interface{}{"key": "value"}},
+			},
+		},
+	})
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlDefaultsNonStringKey(c *C) {
+	info := snaptest.MockSnap(c, mockGadgetSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
+	mockGadgetYamlWithDefaults := append([]byte(`
+defaults:
+  some-snap-id:
+    foo:
+      1: one
+`), mockGadgetYaml...)
+
+	err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "gadget.yaml"), mockGadgetYamlWithDefaults, 0644)
+	c.Assert(err, IsNil)
+
+	_, err = snap.ReadGadgetInfo(info)
+	c.Assert(err, ErrorMatches, `cannot read gadget snap details: defaults for "some-snap-id": option "foo": key is not a string \(found int\)`)
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlConnections(c *C) {
+	info := snaptest.MockSnap(c, mockGadgetSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
+	mockGadgetYamlWithConnections := append([]byte(`
+connections:
+  - plug: app-snap-id:serial
+    slot: gadget-snap-id:serial-1
+  - plug: app-snap-id:gpio
+    slot: gadget-snap-id:gpio-17
+`), mockGadgetYaml...)
+
+	err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "gadget.yaml"), mockGadgetYamlWithConnections, 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := snap.ReadGadgetInfo(info)
+	c.Assert(err, IsNil)
+	c.Check(ginfo.Connections, DeepEquals, []snap.GadgetConnection{
+		{
+			Plug: snap.GadgetConnectionPlug{SnapID: "app-snap-id", Plug: "serial"},
+			Slot: snap.GadgetConnectionSlot{SnapID: "gadget-snap-id", Slot: "serial-1"},
+		},
+		{
+			Plug: snap.GadgetConnectionPlug{SnapID: "app-snap-id", Plug: "gpio"},
+			Slot: snap.GadgetConnectionSlot{SnapID: "gadget-snap-id", Slot: "gpio-17"},
+		},
+	})
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlConnectionsInvalid(c *C) {
+	info := snaptest.MockSnap(c, mockGadgetSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
+
+	for _, t := range []struct {
+		conn string
+		err  string
+	}{
+		{"plug: app-snap-id\n    slot: gadget-snap-id:serial-1", `connection plug "app-snap-id" is not of the form <snap-id>:<name>`},
+		{"plug: app-snap-id:serial\n    slot: :serial-1", `connection slot ":serial-1" is not of the form <snap-id>:<name>`},
+		{"plug: app-snap-id:serial", `connection slot "" is not of the form <snap-id>:<name>`},
+	} {
+		mockGadgetYamlWithConnections := append([]byte(`
+connections:
+  - `+t.conn+`
+`), mockGadgetYaml...)
+		err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "gadget.yaml"), mockGadgetYamlWithConnections, 0644)
+		c.Assert(err, IsNil)
+
+		_, err = snap.ReadGadgetInfo(info)
+		c.Check(err, ErrorMatches, "cannot read gadget snap details: "+t.err)
+	}
+}
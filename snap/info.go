@@ -149,6 +149,20 @@ type Info struct {
 	MustBuy bool
 
 	Screenshots []ScreenshotInfo
+
+	// Channels maps channel names to what the store has in them.
+	Channels map[string]*ChannelSnapInfo
+}
+
+// ChannelSnapInfo is the minimum information that can be used to clearly
+// distinguish different revisions of the same snap published in the store.
+type ChannelSnapInfo struct {
+	Revision    Revision        `json:"revision"`
+	Version     string          `json:"version"`
+	Channel     string          `json:"channel"`
+	Epoch       string          `json:"epoch"`
+	Confinement ConfinementType `json:"confinement"`
+	Size        int64           `json:"size"`
 }
 
 // Name returns the blessed name for the snap.
@@ -0,0 +1,81 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type kernelYaml struct {
+	Modules  []string `yaml:"modules,omitempty"`
+	Firmware []string `yaml:"firmware,omitempty"`
+}
+
+// KernelInfo holds the kernel snap specific metadata.
+type KernelInfo struct {
+	// Modules lists the kernel modules to load at boot.
+	Modules []string
+	// Firmware lists directories under firmware/ in the kernel snap
+	// to make available under the same name in the system firmware
+	// directory.
+	Firmware []string
+}
+
+// ReadKernelInfo reads the kernel specific metadata from meta/kernel.yaml
+// of the kernel snap, the metadata is empty if there is no such file.
+func ReadKernelInfo(info *Info) (*KernelInfo, error) {
+	const errorFormat = "cannot read kernel snap details: %s"
+
+	kernelYamlFn := filepath.Join(info.MountDir(), "meta", "kernel.yaml")
+	kmeta, err := ioutil.ReadFile(kernelYamlFn)
+	if os.IsNotExist(err) {
+		return &KernelInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(errorFormat, err)
+	}
+
+	var ky kernelYaml
+	if err := yaml.Unmarshal(kmeta, &ky); err != nil {
+		return nil, fmt.Errorf(errorFormat, err)
+	}
+
+	for _, module := range ky.Modules {
+		if module == "" || strings.ContainsAny(module, " \t\n/") {
+			return nil, fmt.Errorf(errorFormat, fmt.Sprintf("invalid module name %q", module))
+		}
+	}
+	for _, dir := range ky.Firmware {
+		if dir == "" || filepath.IsAbs(dir) || filepath.Clean(dir) != dir || dir == "." || dir == ".." || strings.HasPrefix(dir, "../") {
+			return nil, fmt.Errorf(errorFormat, fmt.Sprintf("invalid firmware directory %q", dir))
+		}
+	}
+
+	return &KernelInfo{
+		Modules:  ky.Modules,
+		Firmware: ky.Firmware,
+	}, nil
+}
@@ -0,0 +1,102 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snap_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type kernelYamlTestSuite struct{}
+
+var _ = Suite(&kernelYamlTestSuite{})
+
+var mockKernelSnapYaml = `
+name: pc-kernel
+type: kernel
+version: 4.4
+`
+
+func (s *kernelYamlTestSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+}
+
+func (s *kernelYamlTestSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("/")
+}
+
+func (s *kernelYamlTestSuite) TestReadKernelYamlMissing(c *C) {
+	info := snaptest.MockSnap(c, mockKernelSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
+
+	kinfo, err := snap.ReadKernelInfo(info)
+	c.Assert(err, IsNil)
+	c.Check(kinfo, DeepEquals, &snap.KernelInfo{})
+}
+
+func (s *kernelYamlTestSuite) TestReadKernelYamlValid(c *C) {
+	info := snaptest.MockSnap(c, mockKernelSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
+	err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "kernel.yaml"), []byte(`
+version: 4.4.0-42
+modules:
+  - nvme
+  - br_netfilter
+firmware:
+  - brcm
+  - ti-connectivity/wl18xx
+`), 0644)
+	c.Assert(err, IsNil)
+
+	kinfo, err := snap.ReadKernelInfo(info)
+	c.Assert(err, IsNil)
+	c.Check(kinfo, DeepEquals, &snap.KernelInfo{
+		Modules:  []string{"nvme", "br_netfilter"},
+		Firmware: []string{"brcm", "ti-connectivity/wl18xx"},
+	})
+}
+
+func (s *kernelYamlTestSuite) TestReadKernelYamlInvalid(c *C) {
+	info := snaptest.MockSnap(c, mockKernelSnapYaml, &snap.SideInfo{Revision: snap.R(42)})
+
+	for _, t := range []struct {
+		yaml string
+		err  string
+	}{
+		{"modules: [\"\"]", `invalid module name ""`},
+		{"modules: [\"a b\"]", `invalid module name "a b"`},
+		{"modules: [foo/bar]", `invalid module name "foo/bar"`},
+		{"firmware: [/lib/firmware]", `invalid firmware directory "/lib/firmware"`},
+		{"firmware: [../etc]", `invalid firmware directory "../etc"`},
+		{"firmware: [..]", `invalid firmware directory ".."`},
+		{"firmware: [brcm/]", `invalid firmware directory "brcm/"`},
+		{"firmware: [\"\"]", `invalid firmware directory ""`},
+	} {
+		err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "kernel.yaml"), []byte(t.yaml), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = snap.ReadKernelInfo(info)
+		c.Check(err, ErrorMatches, "cannot read kernel snap details: "+t.err, Commentf(t.yaml))
+	}
+}
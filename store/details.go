@@ -28,6 +28,7 @@ type snapDetails struct {
 	AnonDownloadURL  string             `json:"anon_download_url,omitempty"`
 	Architectures    []string           `json:"architecture"`
 	Channel          string             `json:"channel,omitempty"`
+	ChannelMapList   []channelMap       `json:"channel_maps_list,omitempty"`
 	DownloadSha3_384 string             `json:"download_sha3_384,omitempty"`
 	Summary          string             `json:"summary,omitempty"`
 	Description      string             `json:"description,omitempty"`
@@ -58,6 +59,25 @@ type snapDetails struct {
 	Confinement string `json:"confinement"`
 }
 
+// channelMap lists what is published in each channel of the store
+// for one architecture.
+type channelMap struct {
+	Architecture string                   `json:"architecture"`
+	Map          []channelSnapInfoDetails `json:"map"`
+}
+
+// channelSnapInfoDetails is the information about a snap revision
+// published in one channel.
+type channelSnapInfoDetails struct {
+	Channel      string `json:"channel"`
+	Info         string `json:"info"`
+	Revision     int    `json:"revision"`
+	Version      string `json:"version"`
+	Epoch        string `json:"epoch"`
+	Confinement  string `json:"confinement"`
+	DownloadSize int64  `json:"binary_filesize"`
+}
+
 type snapDeltaDetail struct {
 	FromRevision    int    `json:"from_revision"`
 	ToRevision      int    `json:"to_revision"`
@@ -53,6 +53,9 @@ var (
 	// ErrTOSNotAccepted is returned when the user has not accepted the store's terms of service.
 	ErrTOSNotAccepted = errors.New("terms of service not accepted")
 
+	// ErrStoreUnavailable is returned when the store cannot be reached or keeps failing requests, it is then not contacted until it had time to recover.
+	ErrStoreUnavailable = errors.New("store is unavailable")
+
 	// ErrNoPaymentMethods is returned when the user has no valid payment methods associated with their account.
 	ErrNoPaymentMethods = errors.New("no payment methods")
 )
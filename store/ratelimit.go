@@ -0,0 +1,104 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	timeNow = time.Now
+	sleep   = time.Sleep
+)
+
+// minRateLimitChunk is the smallest amount of data read at once from
+// a rate limited reader.
+const minRateLimitChunk = 1024
+
+// rateLimiter hands out a bandwidth budget in bytes per second that
+// is shared by all the readers using it.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	// next is the earliest time at which more data can be consumed
+	next time.Time
+}
+
+// setRate sets the limit in bytes per second, 0 means unlimited.
+func (l *rateLimiter) setRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.rate = bytesPerSecond
+}
+
+func (l *rateLimiter) getRate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// reserve accounts for n bytes just consumed and returns how long
+// the caller must wait before consuming more.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 || n <= 0 {
+		return 0
+	}
+	now := timeNow()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	return l.next.Sub(now)
+}
+
+// rateLimitedReader is an io.Reader that throttles reading from the
+// underlying reader according to a rateLimiter.
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (lr *rateLimitedReader) Read(p []byte) (int, error) {
+	rate := lr.limiter.getRate()
+	if rate == 0 {
+		return lr.r.Read(p)
+	}
+	// read at most a tenth of the budget of one second at once
+	// so that concurrent readers get to share the bandwidth
+	chunk := int(rate / 10)
+	if chunk < minRateLimitChunk {
+		chunk = minRateLimitChunk
+	}
+	if len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := lr.r.Read(p)
+	if d := lr.limiter.reserve(n); d > 0 {
+		sleep(d)
+	}
+	return n, err
+}
@@ -0,0 +1,110 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type rateLimitSuite struct {
+	now    time.Time
+	slept  []time.Duration
+	reset  func()
+	source string
+}
+
+var _ = Suite(&rateLimitSuite{})
+
+func (s *rateLimitSuite) SetUpTest(c *C) {
+	s.now = time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.slept = nil
+	oldTimeNow := timeNow
+	oldSleep := sleep
+	timeNow = func() time.Time { return s.now }
+	sleep = func(d time.Duration) {
+		s.slept = append(s.slept, d)
+		s.now = s.now.Add(d)
+	}
+	s.reset = func() {
+		timeNow = oldTimeNow
+		sleep = oldSleep
+	}
+	s.source = strings.Repeat("x", 4096)
+}
+
+func (s *rateLimitSuite) TearDownTest(c *C) {
+	s.reset()
+}
+
+func (s *rateLimitSuite) TestUnlimited(c *C) {
+	var l rateLimiter
+	data, err := ioutil.ReadAll(&rateLimitedReader{r: strings.NewReader(s.source), limiter: &l})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, s.source)
+	c.Check(s.slept, HasLen, 0)
+}
+
+func (s *rateLimitSuite) TestLimited(c *C) {
+	var l rateLimiter
+	l.setRate(1024)
+	data, err := ioutil.ReadAll(&rateLimitedReader{r: strings.NewReader(s.source), limiter: &l})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, s.source)
+	// 4096 bytes at 1024 bytes/s
+	var total time.Duration
+	for _, d := range s.slept {
+		c.Check(d <= time.Second, Equals, true)
+		total += d
+	}
+	c.Check(total, Equals, 4*time.Second)
+}
+
+func (s *rateLimitSuite) TestLimitIsShared(c *C) {
+	var l rateLimiter
+	l.setRate(2048)
+	r1 := &rateLimitedReader{r: strings.NewReader(s.source), limiter: &l}
+	r2 := &rateLimitedReader{r: strings.NewReader(s.source), limiter: &l}
+
+	buf := make([]byte, 4096)
+	n, err := r1.Read(buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1024)
+	// no time has passed, the second reader has to wait for its
+	// own share and the one used by the first reader
+	s.now = s.now.Add(-s.slept[0])
+	n, err = r2.Read(buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1024)
+	c.Check(s.slept, DeepEquals, []time.Duration{500 * time.Millisecond, time.Second})
+}
+
+func (s *rateLimitSuite) TestNegativeRateMeansUnlimited(c *C) {
+	var l rateLimiter
+	l.setRate(-1)
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(&rateLimitedReader{r: strings.NewReader(s.source), limiter: &l})
+	c.Assert(err, IsNil)
+	c.Check(s.slept, HasLen, 0)
+}
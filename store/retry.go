@@ -0,0 +1,172 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// retryStrategy describes how requests to the store are retried.
+type retryStrategy struct {
+	// attempts is the total number of attempts for a request
+	attempts int
+	// initialDelay is the delay before the first retry, doubled for
+	// every subsequent one up to maxDelay
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	// maxRetryAfter caps how long a Retry-After from the store is honoured
+	maxRetryAfter time.Duration
+}
+
+var defaultRetryStrategy = retryStrategy{
+	attempts:      5,
+	initialDelay:  250 * time.Millisecond,
+	maxDelay:      5 * time.Second,
+	maxRetryAfter: 30 * time.Second,
+}
+
+// jitter randomizes the given delay to somewhere between half of it
+// and all of it, so that clients don't retry in lockstep.
+var jitter = func(d time.Duration) time.Duration {
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// delay returns how long to wait before the given retry (0-based).
+func (rs *retryStrategy) delay(retry int) time.Duration {
+	d := rs.initialDelay
+	for i := 0; i < retry && d < rs.maxDelay; i++ {
+		d *= 2
+	}
+	if d > rs.maxDelay {
+		d = rs.maxDelay
+	}
+	return jitter(d)
+}
+
+// retryAfter returns the delay requested by the Retry-After header of
+// the response, if any, capped to maxRetryAfter.
+func (rs *retryStrategy) retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(timeNow())
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > rs.maxRetryAfter {
+		d = rs.maxRetryAfter
+	}
+	return d
+}
+
+// isIdempotent tells whether requests with the given method can
+// safely be retried.
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// isUnavailableStatus tells whether the status code means the store
+// is (temporarily) not able to serve the request.
+func isUnavailableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+const (
+	// circuitFailureThreshold is how many requests in a row need to
+	// fail for an endpoint to be considered down
+	circuitFailureThreshold = 3
+	// circuitCooldown is for how long no requests are made to an
+	// endpoint considered down
+	circuitCooldown = 30 * time.Second
+)
+
+type endpointHealth struct {
+	failures  int
+	openUntil time.Time
+}
+
+// circuitBreaker keeps track of failed requests per endpoint (scheme
+// and host) and stops requests to endpoints that keep failing until
+// they have had time to recover.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointHealth
+}
+
+func endpointOf(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// allow tells whether a request to the endpoint can be made. Once the
+// cooldown is over requests are let through again, and the next
+// failure opens the circuit right away.
+func (cb *circuitBreaker) allow(endpoint string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	h := cb.endpoints[endpoint]
+	if h == nil {
+		return true
+	}
+	return !timeNow().Before(h.openUntil)
+}
+
+func (cb *circuitBreaker) success(endpoint string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.endpoints, endpoint)
+}
+
+func (cb *circuitBreaker) failure(endpoint string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.endpoints == nil {
+		cb.endpoints = make(map[string]*endpointHealth)
+	}
+	h := cb.endpoints[endpoint]
+	if h == nil {
+		h = &endpointHealth{}
+		cb.endpoints[endpoint] = h
+	}
+	h.failures++
+	if h.failures >= circuitFailureThreshold {
+		h.openUntil = timeNow().Add(circuitCooldown)
+	}
+}
@@ -0,0 +1,272 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type retrySuite struct {
+	now   time.Time
+	slept []time.Duration
+	reset func()
+}
+
+var _ = Suite(&retrySuite{})
+
+func (s *retrySuite) SetUpTest(c *C) {
+	s.now = time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.slept = nil
+	oldTimeNow := timeNow
+	oldSleep := sleep
+	oldJitter := jitter
+	oldStrategy := defaultRetryStrategy
+	timeNow = func() time.Time { return s.now }
+	sleep = func(d time.Duration) {
+		s.slept = append(s.slept, d)
+		s.now = s.now.Add(d)
+	}
+	jitter = func(d time.Duration) time.Duration { return d }
+	defaultRetryStrategy = retryStrategy{
+		attempts:      4,
+		initialDelay:  100 * time.Millisecond,
+		maxDelay:      300 * time.Millisecond,
+		maxRetryAfter: 10 * time.Second,
+	}
+	s.reset = func() {
+		timeNow = oldTimeNow
+		sleep = oldSleep
+		jitter = oldJitter
+		defaultRetryStrategy = oldStrategy
+	}
+}
+
+func (s *retrySuite) TearDownTest(c *C) {
+	s.reset()
+}
+
+func (s *retrySuite) request(c *C, sto *Store, method, serverURL string) (*http.Response, error) {
+	u, err := url.Parse(serverURL)
+	c.Assert(err, IsNil)
+	return sto.doRequest(&http.Client{}, &requestOptions{Method: method, URL: u}, nil)
+}
+
+func mustParseURL(c *C, s string) *url.URL {
+	u, err := url.Parse(s)
+	c.Assert(err, IsNil)
+	return u
+}
+
+func (s *retrySuite) TestDelay(c *C) {
+	rs := defaultRetryStrategy
+	c.Check(rs.delay(0), Equals, 100*time.Millisecond)
+	c.Check(rs.delay(1), Equals, 200*time.Millisecond)
+	c.Check(rs.delay(2), Equals, 300*time.Millisecond)
+	c.Check(rs.delay(10), Equals, 300*time.Millisecond)
+}
+
+func (s *retrySuite) TestRetriesUntilSuccess(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer mockServer.Close()
+
+	resp, err := s.request(c, New(&Config{}, nil), "GET", mockServer.URL)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, http.StatusOK)
+	c.Check(n, Equals, 3)
+	c.Check(s.slept, DeepEquals, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond})
+}
+
+func (s *retrySuite) TestGivesUp(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer mockServer.Close()
+
+	_, err := s.request(c, New(&Config{}, nil), "GET", mockServer.URL)
+	c.Check(err, Equals, ErrStoreUnavailable)
+	c.Check(n, Equals, 4)
+	c.Check(s.slept, HasLen, 3)
+}
+
+func (s *retrySuite) TestHonoursRetryAfter(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			// dates are honoured too, and capped
+			w.Header().Set("Retry-After", s.now.Add(time.Minute).Format(http.TimeFormat))
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer mockServer.Close()
+
+	resp, err := s.request(c, New(&Config{}, nil), "GET", mockServer.URL)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, http.StatusOK)
+	c.Check(s.slept, DeepEquals, []time.Duration{2 * time.Second, 10 * time.Second})
+}
+
+func (s *retrySuite) TestDoesNotRetryNonIdempotent(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	sto := New(&Config{}, nil)
+	for i := 0; i < circuitFailureThreshold; i++ {
+		// the response is handed back as is
+		resp, err := s.request(c, sto, "POST", mockServer.URL)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, http.StatusServiceUnavailable)
+	}
+	c.Check(n, Equals, circuitFailureThreshold)
+	c.Check(s.slept, HasLen, 0)
+
+	// and the failures don't trip the circuit breaker
+	c.Check(sto.breaker.allow(endpointOf(mustParseURL(c, mockServer.URL))), Equals, true)
+}
+
+func (s *retrySuite) TestDoesNotRetryNonIdempotentNetworkErrors(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serverURL := mockServer.URL
+	mockServer.Close()
+
+	_, err := s.request(c, New(&Config{}, nil), "POST", serverURL)
+	c.Assert(err, NotNil)
+	c.Check(err, Not(Equals), ErrStoreUnavailable)
+	c.Check(err, ErrorMatches, ".*connection refused.*")
+	c.Check(s.slept, HasLen, 0)
+}
+
+func (s *retrySuite) TestDoesNotRetryClientErrors(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mockServer.Close()
+
+	resp, err := s.request(c, New(&Config{}, nil), "GET", mockServer.URL)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, http.StatusNotFound)
+	c.Check(n, Equals, 1)
+}
+
+func (s *retrySuite) TestRetriesNetworkErrors(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serverURL := mockServer.URL
+	mockServer.Close()
+
+	_, err := s.request(c, New(&Config{}, nil), "GET", serverURL)
+	c.Check(err, Equals, ErrStoreUnavailable)
+	c.Check(s.slept, HasLen, 3)
+}
+
+func (s *retrySuite) TestCircuitBreaker(c *C) {
+	n := 0
+	down := true
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer mockServer.Close()
+
+	defaultRetryStrategy.attempts = 2
+	sto := New(&Config{}, nil)
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		_, err := s.request(c, sto, "GET", mockServer.URL)
+		c.Check(err, Equals, ErrStoreUnavailable)
+	}
+	c.Check(n, Equals, 2*circuitFailureThreshold)
+
+	// the store is not contacted anymore
+	_, err := s.request(c, sto, "GET", mockServer.URL+"/other")
+	c.Check(err, Equals, ErrStoreUnavailable)
+	c.Check(n, Equals, 2*circuitFailureThreshold)
+
+	// other stores are not affected
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+	resp, err := s.request(c, sto, "GET", other.URL)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+
+	// after the cooldown the store is tried again
+	s.now = s.now.Add(circuitCooldown)
+	down = false
+	resp, err = s.request(c, sto, "GET", mockServer.URL)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, http.StatusOK)
+	c.Check(n, Equals, 2*circuitFailureThreshold+1)
+}
+
+func (s *retrySuite) TestCircuitBreakerReopensOnFailure(c *C) {
+	cb := &circuitBreaker{}
+	for i := 0; i < circuitFailureThreshold; i++ {
+		c.Check(cb.allow("https://store"), Equals, true)
+		cb.failure("https://store")
+	}
+	c.Check(cb.allow("https://store"), Equals, false)
+
+	s.now = s.now.Add(circuitCooldown)
+	c.Check(cb.allow("https://store"), Equals, true)
+	// a single failure is enough to open it again
+	cb.failure("https://store")
+	c.Check(cb.allow("https://store"), Equals, false)
+
+	s.now = s.now.Add(circuitCooldown)
+	cb.success("https://store")
+	cb.failure("https://store")
+	c.Check(cb.allow("https://store"), Equals, true)
+}
@@ -32,9 +32,9 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/snapcore/snapd/arch"
 	"github.com/snapcore/snapd/asserts"
@@ -122,6 +122,27 @@ func infoFromRemote(d snapDetails) *snap.Info {
 	}
 	info.Screenshots = screenshots
 
+	// the store only sends the channel map for the requested architecture
+	for _, chMap := range d.ChannelMapList {
+		for _, ch := range chMap.Map {
+			// channels that track another one have no revision of their own
+			if ch.Info != "released" {
+				continue
+			}
+			if info.Channels == nil {
+				info.Channels = make(map[string]*snap.ChannelSnapInfo)
+			}
+			info.Channels[ch.Channel] = &snap.ChannelSnapInfo{
+				Revision:    snap.R(ch.Revision),
+				Version:     ch.Version,
+				Channel:     ch.Channel,
+				Epoch:       ch.Epoch,
+				Confinement: snap.ConfinementType(ch.Confinement),
+				Size:        ch.DownloadSize,
+			}
+		}
+	}
+
 	return info
 }
 
@@ -129,6 +150,7 @@ func infoFromRemote(d snapDetails) *snap.Info {
 type Config struct {
 	SearchURI         *url.URL
 	DetailsURI        *url.URL
+	SectionsURI       *url.URL
 	BulkURI           *url.URL
 	AssertionsURI     *url.URL
 	PurchasesURI      *url.URL
@@ -149,6 +171,7 @@ type Config struct {
 type Store struct {
 	searchURI         *url.URL
 	detailsURI        *url.URL
+	sectionsURI       *url.URL
 	bulkURI           *url.URL
 	assertionsURI     *url.URL
 	purchasesURI      *url.URL
@@ -167,6 +190,12 @@ type Store struct {
 
 	authContext auth.AuthContext
 
+	// downloadLimiter throttles all downloads together
+	downloadLimiter rateLimiter
+
+	// breaker tracks failing store endpoints
+	breaker circuitBreaker
+
 	mu                sync.Mutex
 	suggestedCurrency string
 }
@@ -215,6 +244,12 @@ func cpiURL() string {
 	return "https://search.apps.ubuntu.com/api/v1/"
 }
 
+// cpiURLForced tells whether the URL of the store API was forced for
+// testing or staging.
+func cpiURLForced() bool {
+	return useStaging() || os.Getenv("SNAPPY_FORCE_CPI_URL") != ""
+}
+
 func authLocation() string {
 	if useStaging() {
 		return "login.staging.ubuntu.com"
@@ -241,6 +276,12 @@ func assertsURL() string {
 	return "https://assertions.ubuntu.com/v1/"
 }
 
+// assertsURLForced tells whether the URL of the assertions service was
+// forced for testing or staging.
+func assertsURLForced() bool {
+	return useStaging() || os.Getenv("SNAPPY_FORCE_SAS_URL") != ""
+}
+
 func myappsURL() string {
 	if useStaging() {
 		return "https://myapps.developer.staging.ubuntu.com/"
@@ -248,6 +289,15 @@ func myappsURL() string {
 	return "https://myapps.developer.ubuntu.com/"
 }
 
+// endpoint paths relative to the URL of a store as set by its store assertion
+const (
+	searchEndpPath     = "api/v1/snaps/search"
+	detailsEndpPath    = "api/v1/snaps/details/"
+	bulkEndpPath       = "api/v1/snaps/metadata"
+	sectionsEndpPath   = "api/v1/snaps/sections"
+	assertionsEndpPath = "api/v1/snaps/assertions/"
+)
+
 var defaultConfig = Config{}
 
 // DefaultConfig returns a copy of the default configuration ready to be adapted.
@@ -278,6 +328,11 @@ func init() {
 		panic(err)
 	}
 
+	defaultConfig.SectionsURI, err = storeBaseURI.Parse("snaps/sections")
+	if err != nil {
+		panic(err)
+	}
+
 	assertsBaseURI, err := url.Parse(assertsURL())
 	if err != nil {
 		panic(err)
@@ -304,10 +359,57 @@ func init() {
 	}
 }
 
+type searchLink struct {
+	Href string `json:"href"`
+}
+
 type searchResults struct {
 	Payload struct {
 		Packages []snapDetails `json:"clickindex:package"`
 	} `json:"_embedded"`
+	Links struct {
+		Self *searchLink `json:"self"`
+		Last *searchLink `json:"last"`
+	} `json:"_links"`
+}
+
+// pageFromLink returns the page a link to search results points to,
+// or 0 if it cannot tell.
+func pageFromLink(link *searchLink) int {
+	if link == nil {
+		return 0
+	}
+	u, err := url.Parse(link.Href)
+	if err != nil {
+		return 0
+	}
+	page, err := strconv.Atoi(u.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 0
+	}
+	return page
+}
+
+// paging returns the paging information of the search results, or nil
+// if the store sent none.
+func (r *searchResults) paging() *Paging {
+	page := pageFromLink(r.Links.Self)
+	if page == 0 {
+		return nil
+	}
+	pages := pageFromLink(r.Links.Last)
+	if pages < page {
+		pages = page
+	}
+	return &Paging{Page: page, Pages: pages}
+}
+
+type sectionResults struct {
+	Payload struct {
+		Sections []struct {
+			Name string `json:"name"`
+		} `json:"clickindex:sections"`
+	} `json:"_embedded"`
 }
 
 // The fields we are interested in
@@ -367,6 +469,7 @@ func New(cfg *Config, authContext auth.AuthContext) *Store {
 	return &Store{
 		searchURI:         searchURI,
 		detailsURI:        detailsURI,
+		sectionsURI:       cfg.SectionsURI,
 		bulkURI:           cfg.BulkURI,
 		assertionsURI:     cfg.AssertionsURI,
 		purchasesURI:      cfg.PurchasesURI,
@@ -382,6 +485,32 @@ func New(cfg *Config, authContext auth.AuthContext) *Store {
 	}
 }
 
+// endpointURL returns the URL to use for the store endpoint at
+// endpPath, relative to the URL of the store the device model points
+// to if its store assertion sets one, otherwise defaultURL. A forced
+// URL (see cpiURLForced and assertsURLForced) is never overridden.
+func (s *Store) endpointURL(defaultURL *url.URL, endpPath string, forced bool) (*url.URL, error) {
+	if s.authContext == nil || forced {
+		return defaultURL, nil
+	}
+	storeURL, err := s.authContext.StoreURL(nil)
+	if err != nil {
+		return nil, err
+	}
+	if storeURL == nil {
+		return defaultURL, nil
+	}
+	u, err := storeURL.Parse(endpPath)
+	if err != nil {
+		return nil, err
+	}
+	if defaultURL != nil {
+		// keep the query of the default URL, i.e. its fields parameter
+		u.RawQuery = defaultURL.RawQuery
+	}
+	return u, nil
+}
+
 // LoginUser logs user in the store and returns the authentication macaroons.
 func LoginUser(username, password, otp string) (string, string, error) {
 	macaroon, err := requestStoreMacaroon()
@@ -529,6 +658,15 @@ func (s *Store) setStoreID(r *http.Request) {
 	if storeID != "" {
 		r.Header.Set("X-Ubuntu-Store", storeID)
 	}
+	if s.authContext != nil {
+		// let the store fall back to the stores it is friends with
+		friendly, err := s.authContext.FriendlyStores()
+		if err != nil {
+			logger.Debugf("cannot get friendly stores from state: %v", err)
+		} else if len(friendly) != 0 {
+			r.Header.Set("X-Ubuntu-Friendly-Stores", strings.Join(friendly, ","))
+		}
+	}
 }
 
 // requestOptions specifies parameters for store requests.
@@ -543,12 +681,7 @@ type requestOptions struct {
 
 // doRequest does an authenticated request to the store handling a potential macaroon refresh required if needed
 func (s *Store) doRequest(client *http.Client, reqOptions *requestOptions, user *auth.UserState) (*http.Response, error) {
-	req, err := s.newRequest(reqOptions, user)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := client.Do(req)
+	resp, err := s.retryRequest(client, reqOptions, user)
 	if err != nil {
 		return nil, err
 	}
@@ -591,6 +724,68 @@ func (s *Store) doRequest(client *http.Client, reqOptions *requestOptions, user
 	return resp, err
 }
 
+// retryRequest performs the request, retrying idempotent ones that
+// fail because of the network or because the store is temporarily
+// unable to serve them, failing with ErrStoreUnavailable once it gives
+// up. Idempotent requests to an endpoint that kept failing are not
+// attempted at all until it has had time to recover. Other requests
+// are performed once and their response or error returned as is.
+func (s *Store) retryRequest(client *http.Client, reqOptions *requestOptions, user *auth.UserState) (*http.Response, error) {
+	strategy := defaultRetryStrategy
+	if !isIdempotent(reqOptions.Method) || strategy.attempts <= 1 {
+		req, err := s.newRequest(reqOptions, user)
+		if err != nil {
+			return nil, err
+		}
+		return client.Do(req)
+	}
+
+	endpoint := endpointOf(reqOptions.URL)
+	if !s.breaker.allow(endpoint) {
+		return nil, ErrStoreUnavailable
+	}
+
+	for attempt := 1; ; attempt++ {
+		// the request (and its body) needs rebuilding for every attempt
+		req, err := s.newRequest(reqOptions, user)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err == nil && !isUnavailableStatus(resp.StatusCode) {
+			s.breaker.success(endpoint)
+			return resp, nil
+		}
+		if attempt >= strategy.attempts {
+			s.breaker.failure(endpoint)
+			if err != nil {
+				logger.Noticef("Cannot %s %s: %v", reqOptions.Method, reqOptions.URL, err)
+			} else {
+				oops := ""
+				if oopsID := resp.Header.Get("X-Oops-Id"); oopsID != "" {
+					oops = " [" + oopsID + "]"
+				}
+				logger.Noticef("Cannot %s %s: got HTTP status code %d%s", reqOptions.Method, reqOptions.URL, resp.StatusCode, oops)
+				resp.Body.Close()
+			}
+			return nil, ErrStoreUnavailable
+		}
+
+		wait := strategy.delay(attempt - 1)
+		if err != nil {
+			logger.Debugf("Retrying %s %s after error: %v", reqOptions.Method, reqOptions.URL, err)
+		} else {
+			if retryAfter := strategy.retryAfter(resp); retryAfter > 0 {
+				wait = retryAfter
+			}
+			logger.Debugf("Retrying %s %s after HTTP status code %d", reqOptions.Method, reqOptions.URL, resp.StatusCode)
+			resp.Body.Close()
+		}
+		sleep(wait)
+	}
+}
+
 // build a new http.Request with headers for the store
 func (s *Store) newRequest(reqOptions *requestOptions, user *auth.UserState) (*http.Request, error) {
 	var body io.Reader
@@ -821,7 +1016,11 @@ func mustBuy(prices map[string]float64, purchases []*purchase) bool {
 
 // Snap returns the snap.Info for the store hosted snap with the given name or an error.
 func (s *Store) Snap(name, channel string, devmode bool, revision snap.Revision, user *auth.UserState) (*snap.Info, error) {
-	u, err := s.detailsURI.Parse(name)
+	detailsURI, err := s.endpointURL(s.detailsURI, detailsEndpPath, cpiURLForced())
+	if err != nil {
+		return nil, err
+	}
+	u, err := detailsURI.Parse(name)
 	if err != nil {
 		return nil, err
 	}
@@ -891,21 +1090,45 @@ type Search struct {
 	Query   string
 	Private bool
 	Prefix  bool
+	// Section restricts the search to the snaps in the given section
+	Section string
+	// Publisher restricts the search to the snaps of the given publisher
+	Publisher string
+	// Confinement restricts the search to snaps with the given
+	// confinement, it defaults to strict
+	Confinement snap.ConfinementType
+	// Architecture searches snaps for the given architecture instead
+	// of the one of the store
+	Architecture string
+	// Page and PageSize select the page of results to return, the
+	// store defaults are used if they are not set
+	Page     int
+	PageSize int
+}
+
+// Paging tells which page of the results of a search was returned.
+type Paging struct {
+	// Page is the number of the returned page, starting from 1
+	Page int
+	// Pages is the total number of pages of results
+	Pages int
 }
 
 // Find finds  (installable) snaps from the store, matching the
-// given Search.
-func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, error) {
+// given Search. It also returns which page of the results it got, if
+// the store tells.
+func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, *Paging, error) {
 	searchTerm := search.Query
 
 	if search.Private && user == nil {
-		return nil, ErrUnauthenticated
+		return nil, nil, ErrUnauthenticated
 	}
 
 	searchTerm = strings.TrimSpace(searchTerm)
 
-	if searchTerm == "" {
-		return nil, ErrEmptyQuery
+	// a section or a publisher can be browsed without a query
+	if searchTerm == "" && search.Section == "" && search.Publisher == "" {
+		return nil, nil, ErrEmptyQuery
 	}
 
 	// these characters might have special meaning on the search
@@ -915,17 +1138,25 @@ func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, error)
 	// "-" might also be special on the server, but it's also a
 	// valid part of a package name, so we let it pass
 	if strings.ContainsAny(searchTerm, `+=&|><!(){}[]^"~*?:\/`) {
-		return nil, ErrBadQuery
+		return nil, nil, ErrBadQuery
+	}
+
+	if search.Page < 0 || search.PageSize < 0 {
+		return nil, nil, ErrBadQuery
 	}
 
-	u := *s.searchURI // make a copy, so we can mutate it
+	searchURI, err := s.endpointURL(s.searchURI, searchEndpPath, cpiURLForced())
+	if err != nil {
+		return nil, nil, err
+	}
+	u := *searchURI // make a copy, so we can mutate it
 	q := u.Query()
 
 	if search.Private {
 		if search.Prefix {
 			// The store only supports "fuzzy" search for private snaps.
 			// See http://search.apps.ubuntu.com/docs/
-			return nil, ErrBadQuery
+			return nil, nil, ErrBadQuery
 		}
 
 		q.Set("private", "true")
@@ -933,11 +1164,32 @@ func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, error)
 
 	if search.Prefix {
 		q.Set("name", searchTerm)
-	} else {
+	} else if searchTerm != "" {
 		q.Set("q", searchTerm)
 	}
 
-	q.Set("confinement", "strict")
+	if search.Section != "" {
+		q.Set("section", search.Section)
+	}
+	if search.Publisher != "" {
+		q.Set("publisher", search.Publisher)
+	}
+
+	switch search.Confinement {
+	case "":
+		q.Set("confinement", string(snap.StrictConfinement))
+	case snap.StrictConfinement, snap.DevmodeConfinement:
+		q.Set("confinement", string(search.Confinement))
+	default:
+		return nil, nil, ErrBadQuery
+	}
+
+	if search.Page > 0 {
+		q.Set("page", strconv.Itoa(search.Page))
+	}
+	if search.PageSize > 0 {
+		q.Set("size", strconv.Itoa(search.PageSize))
+	}
 	u.RawQuery = q.Encode()
 
 	reqOptions := &requestOptions{
@@ -945,25 +1197,30 @@ func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, error)
 		URL:    &u,
 		Accept: halJsonContentType,
 	}
+	if search.Architecture != "" {
+		reqOptions.ExtraHeaders = map[string]string{
+			"X-Ubuntu-Architecture": search.Architecture,
+		}
+	}
 	resp, err := s.doRequest(s.client, reqOptions, user)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, respToError(resp, "search")
+		return nil, nil, respToError(resp, "search")
 	}
 
 	if ct := resp.Header.Get("Content-Type"); ct != halJsonContentType {
-		return nil, fmt.Errorf("received an unexpected content type (%q) when trying to search via %q", ct, resp.Request.URL)
+		return nil, nil, fmt.Errorf("received an unexpected content type (%q) when trying to search via %q", ct, resp.Request.URL)
 	}
 
 	var searchData searchResults
 
 	dec := json.NewDecoder(resp.Body)
 	if err := dec.Decode(&searchData); err != nil {
-		return nil, fmt.Errorf("cannot decode reply (got %v) when trying to search via %q", err, resp.Request.URL)
+		return nil, nil, fmt.Errorf("cannot decode reply (got %v) when trying to search via %q", err, resp.Request.URL)
 	}
 
 	snaps := make([]*snap.Info, len(searchData.Payload.Packages))
@@ -978,7 +1235,46 @@ func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, error)
 
 	s.extractSuggestedCurrency(resp)
 
-	return snaps, nil
+	return snaps, searchData.paging(), nil
+}
+
+// Sections retrieves the list of available store sections.
+func (s *Store) Sections(user *auth.UserState) ([]string, error) {
+	sectionsURI, err := s.endpointURL(s.sectionsURI, sectionsEndpPath, cpiURLForced())
+	if err != nil {
+		return nil, err
+	}
+	reqOptions := &requestOptions{
+		Method: "GET",
+		URL:    sectionsURI,
+		Accept: halJsonContentType,
+	}
+	resp, err := s.doRequest(s.client, reqOptions, user)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, respToError(resp, "retrieve sections")
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != halJsonContentType {
+		return nil, fmt.Errorf("received an unexpected content type (%q) when trying to retrieve the sections via %q", ct, resp.Request.URL)
+	}
+
+	var sectionData sectionResults
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&sectionData); err != nil {
+		return nil, fmt.Errorf("cannot decode reply (got %v) when trying to get sections via %q", err, resp.Request.URL)
+	}
+
+	sectionNames := make([]string, len(sectionData.Payload.Sections))
+	for i, section := range sectionData.Payload.Sections {
+		sectionNames[i] = section.Name
+	}
+
+	return sectionNames, nil
 }
 
 // RefreshCandidate contains information for the store about the currently
@@ -1053,9 +1349,13 @@ func (s *Store) ListRefresh(installed []*RefreshCandidate, user *auth.UserState)
 		return nil, err
 	}
 
+	bulkURI, err := s.endpointURL(s.bulkURI, bulkEndpPath, cpiURLForced())
+	if err != nil {
+		return nil, err
+	}
 	reqOptions := &requestOptions{
 		Method:      "POST",
-		URL:         s.bulkURI,
+		URL:         bulkURI,
 		Accept:      halJsonContentType,
 		ContentType: "application/json",
 		Data:        jsonData,
@@ -1164,8 +1464,12 @@ func (s *Store) Download(name string, downloadInfo *snap.DownloadInfo, pbar prog
 	return w.Name(), w.Sync()
 }
 
-// 3 pₙ₊₁ ≥ 5 pₙ; last entry should be 0 -- the sleep is done at the end of the loop
-var downloadBackoffs = []int{113, 191, 331, 557, 929, 0}
+// SetDownloadRateLimit sets the global bandwidth limit, in bytes per
+// second, shared by all the downloads done through the store. A limit
+// of 0 means downloads are not throttled.
+func (s *Store) SetDownloadRateLimit(bytesPerSecond int64) {
+	s.downloadLimiter.setRate(bytesPerSecond)
+}
 
 // download writes an http.Request showing a progress.Meter
 var download = func(name, downloadURL string, user *auth.UserState, s *Store, w io.Writer, pbar progress.Meter) error {
@@ -1179,37 +1483,27 @@ var download = func(name, downloadURL string, user *auth.UserState, s *Store, w
 		URL:    storeURL,
 	}
 
-	var resp *http.Response
-	for _, n := range downloadBackoffs {
-		// we do *not* want to reuse the client between iterations in
-		// this case as it will have internal state (e.g. cached
-		// connections) that led us to an error (the default client is
-		// documented as not reusing the transport unless the body is
-		// read to EOF and closed, so this is a belt-and-braces thing).
-		r, err := s.doRequest(&http.Client{}, reqOptions, user)
-		if err != nil {
-			return err
-		}
-		defer r.Body.Close()
-
-		resp = r
-
-		if r.StatusCode != 500 {
-			break
-		}
-		time.Sleep(time.Duration(n) * time.Millisecond)
+	// failed attempts are retried by doRequest; we do *not* want to
+	// reuse the shared client for downloads as it will have internal
+	// state (e.g. cached connections) from other requests.
+	resp, err := s.doRequest(&http.Client{}, reqOptions, user)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != 200 {
 		return &ErrDownload{Code: resp.StatusCode, URL: resp.Request.URL}
 	}
 
+	body := &rateLimitedReader{r: resp.Body, limiter: &s.downloadLimiter}
 	if pbar != nil {
 		pbar.Start(name, float64(resp.ContentLength))
 		mw := io.MultiWriter(w, pbar)
-		_, err = io.Copy(mw, resp.Body)
+		_, err = io.Copy(mw, body)
 		pbar.Finished()
 	} else {
-		_, err = io.Copy(w, resp.Body)
+		_, err = io.Copy(w, body)
 	}
 
 	return err
@@ -1267,7 +1561,11 @@ type assertionSvcError struct {
 
 // Assertion retrivies the assertion for the given type and primary key.
 func (s *Store) Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error) {
-	url, err := s.assertionsURI.Parse(path.Join(assertType.Name, path.Join(primaryKey...)))
+	assertionsURI, err := s.endpointURL(s.assertionsURI, assertionsEndpPath, assertsURLForced())
+	if err != nil {
+		return nil, err
+	}
+	url, err := assertionsURI.Parse(path.Join(assertType.Name, path.Join(primaryKey...)))
 	if err != nil {
 		return nil, err
 	}
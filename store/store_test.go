@@ -33,6 +33,7 @@ import (
 	"path"
 	"strings"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/macaroon.v1"
@@ -54,8 +55,8 @@ type remoteRepoTestSuite struct {
 	user   *auth.UserState
 	device *auth.DeviceState
 
-	origDownloadFunc func(string, string, *auth.UserState, *Store, io.Writer, progress.Meter) error
-	origBackoffs     []int
+	origDownloadFunc  func(string, string, *auth.UserState, *Store, io.Writer, progress.Meter) error
+	origRetryStrategy retryStrategy
 }
 
 func TestStore(t *testing.T) { TestingT(t) }
@@ -101,7 +102,9 @@ type testAuthContext struct {
 	device *auth.DeviceState
 	user   *auth.UserState
 
-	storeID string
+	storeID        string
+	storeURL       *url.URL
+	friendlyStores []string
 }
 
 func (ac *testAuthContext) Device() (*auth.DeviceState, error) {
@@ -131,6 +134,17 @@ func (ac *testAuthContext) StoreID(fallback string) (string, error) {
 	return fallback, nil
 }
 
+func (ac *testAuthContext) StoreURL(defaultURL *url.URL) (*url.URL, error) {
+	if ac.storeURL != nil {
+		return ac.storeURL, nil
+	}
+	return defaultURL, nil
+}
+
+func (ac *testAuthContext) FriendlyStores() ([]string, error) {
+	return ac.friendlyStores, nil
+}
+
 func (ac *testAuthContext) DeviceSessionRequest(nonce string) ([]byte, []byte, error) {
 	serial, err := asserts.Decode([]byte(exSerial))
 	if err != nil {
@@ -207,8 +221,13 @@ func createTestDevice() *auth.DeviceState {
 func (t *remoteRepoTestSuite) SetUpTest(c *C) {
 	t.store = New(nil, nil)
 	t.origDownloadFunc = download
-	t.origBackoffs = downloadBackoffs
-	downloadBackoffs = []int{2, 5, 0}
+	t.origRetryStrategy = defaultRetryStrategy
+	defaultRetryStrategy = retryStrategy{
+		attempts:      3,
+		initialDelay:  time.Millisecond,
+		maxDelay:      2 * time.Millisecond,
+		maxRetryAfter: 5 * time.Millisecond,
+	}
 	dirs.SetRootDir(c.MkDir())
 	c.Assert(os.MkdirAll(dirs.SnapMountDir, 0755), IsNil)
 
@@ -228,7 +247,7 @@ func (t *remoteRepoTestSuite) SetUpTest(c *C) {
 
 func (t *remoteRepoTestSuite) TearDownTest(c *C) {
 	download = t.origDownloadFunc
-	downloadBackoffs = t.origBackoffs
+	defaultRetryStrategy = t.origRetryStrategy
 }
 
 func (t *remoteRepoTestSuite) TearDownSuite(c *C) {
@@ -357,6 +376,28 @@ func (t *remoteRepoTestSuite) TestActualDownload(c *C) {
 	c.Check(n, Equals, 1)
 }
 
+func (t *remoteRepoTestSuite) TestActualDownloadRateLimited(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 3000))
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	var slept time.Duration
+	oldSleep := sleep
+	sleep = func(d time.Duration) {
+		slept += d
+	}
+	defer func() { sleep = oldSleep }()
+
+	theStore := New(&Config{}, nil)
+	theStore.SetDownloadRateLimit(1000)
+	var buf bytes.Buffer
+	c.Assert(download("foo", mockServer.URL, nil, theStore, &buf, nil), IsNil)
+	c.Check(buf.Len(), Equals, 3000)
+	c.Check(slept >= 2*time.Second, Equals, true)
+}
+
 func (t *remoteRepoTestSuite) TestActualDownload404(c *C) {
 	n := 0
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -387,10 +428,8 @@ func (t *remoteRepoTestSuite) TestActualDownload500(c *C) {
 	theStore := New(&Config{}, nil)
 	var buf bytes.Buffer
 	err := download("foo", mockServer.URL, nil, theStore, &buf, nil)
-	c.Assert(err, NotNil)
-	c.Assert(err, FitsTypeOf, &ErrDownload{})
-	c.Check(err.(*ErrDownload).Code, Equals, http.StatusInternalServerError)
-	c.Check(n, Equals, len(downloadBackoffs)) // woo!!
+	c.Check(err, Equals, ErrStoreUnavailable)
+	c.Check(n, Equals, defaultRetryStrategy.attempts)
 }
 
 type downloadBehaviour []struct {
@@ -870,6 +909,7 @@ http --pretty=format --print b https://search.apps.ubuntu.com/api/v1/snaps/detai
 on 2016-07-03. Then, by hand:
  * set prices to {"EUR": 0.99, "USD": 1.23}.
  * Screenshot URLS set manually.
+ * channel_maps_list set manually.
 
 On Ubuntu, apt install httpie xsel (although you could get http from
 the http snap instead).
@@ -894,6 +934,17 @@ const MockDetailsJSON = `{
     ],
     "binary_filesize": 20480,
     "channel": "edge",
+    "channel_maps_list": [
+        {
+            "architecture": "amd64",
+            "map": [
+                {"channel": "stable", "info": "released", "revision": 26, "version": "6.1", "epoch": "0", "confinement": "strict", "binary_filesize": 20480},
+                {"channel": "candidate", "info": "tracking"},
+                {"channel": "beta", "info": "tracking"},
+                {"channel": "edge", "info": "released", "revision": 27, "version": "6.3", "epoch": "0", "confinement": "strict", "binary_filesize": 20480}
+            ]
+        }
+    ],
     "confinement": "strict",
     "content": "application",
     "description": "This is a simple hello world example.",
@@ -985,6 +1036,58 @@ const mockSinglePurchaseInteractiveJSON = `
 }
 `
 
+func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDetailsBrandStoreURL(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/api/v1/snaps/details/hello-world")
+		c.Check(r.URL.Query().Get("channel"), Equals, "edge")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, MockDetailsJSON)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	storeURL, err := url.Parse(mockServer.URL)
+	c.Assert(err, IsNil)
+	detailsURI, err := url.Parse("https://default.example.com/details/")
+	c.Assert(err, IsNil)
+	cfg := Config{
+		DetailsURI: detailsURI,
+	}
+	authContext := &testAuthContext{c: c, device: t.device, storeURL: storeURL}
+	repo := New(&cfg, authContext)
+
+	result, err := repo.Snap("hello-world", "edge", true, snap.R(0), nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Name(), Equals, "hello-world")
+}
+
+func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDetailsForcedURLNotOverridden(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/details/hello-world")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, MockDetailsJSON)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	os.Setenv("SNAPPY_FORCE_CPI_URL", mockServer.URL+"/")
+	defer os.Unsetenv("SNAPPY_FORCE_CPI_URL")
+
+	storeURL, err := url.Parse("https://brand.example.com/")
+	c.Assert(err, IsNil)
+	detailsURI, err := url.Parse(mockServer.URL + "/details/")
+	c.Assert(err, IsNil)
+	cfg := Config{
+		DetailsURI: detailsURI,
+	}
+	authContext := &testAuthContext{c: c, device: t.device, storeURL: storeURL}
+	repo := New(&cfg, authContext)
+
+	result, err := repo.Snap("hello-world", "edge", true, snap.R(0), nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Name(), Equals, "hello-world")
+}
+
 func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDetails(c *C) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.UserAgent(), Equals, userAgent)
@@ -1045,6 +1148,24 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDetails(c *C) {
 		},
 	})
 	c.Check(result.MustBuy, Equals, true)
+	c.Check(result.Channels, DeepEquals, map[string]*snap.ChannelSnapInfo{
+		"stable": {
+			Revision:    snap.R(26),
+			Version:     "6.1",
+			Channel:     "stable",
+			Epoch:       "0",
+			Confinement: snap.StrictConfinement,
+			Size:        20480,
+		},
+		"edge": {
+			Revision:    snap.R(27),
+			Version:     "6.3",
+			Channel:     "edge",
+			Epoch:       "0",
+			Confinement: snap.StrictConfinement,
+			Size:        20480,
+		},
+	})
 
 	// Make sure the epoch (currently not sent by the store) defaults to "0"
 	c.Check(result.Epoch, Equals, "0")
@@ -1068,6 +1189,8 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryNonDefaults(c *C) {
 
 		c.Check(r.Header.Get("X-Ubuntu-Series"), Equals, "21")
 		c.Check(r.Header.Get("X-Ubuntu-Architecture"), Equals, "archXYZ")
+		_, ok := r.Header["X-Ubuntu-Friendly-Stores"]
+		c.Check(ok, Equals, false)
 
 		w.WriteHeader(http.StatusOK)
 		io.WriteString(w, MockDetailsJSON)
@@ -1096,6 +1219,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryStoreIDFromAuthContext(c
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		storeID := r.Header.Get("X-Ubuntu-Store")
 		c.Check(storeID, Equals, "my-brand-store-id")
+		c.Check(r.Header.Get("X-Ubuntu-Friendly-Stores"), Equals, "other-store-id,another-store-id")
 
 		w.WriteHeader(http.StatusOK)
 		io.WriteString(w, MockDetailsJSON)
@@ -1111,7 +1235,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryStoreIDFromAuthContext(c
 	cfg.Series = "21"
 	cfg.Architecture = "archXYZ"
 	cfg.StoreID = "fallback"
-	repo := New(cfg, &testAuthContext{c: c, device: t.device, storeID: "my-brand-store-id"})
+	repo := New(cfg, &testAuthContext{c: c, device: t.device, storeID: "my-brand-store-id", friendlyStores: []string{"other-store-id", "another-store-id"}})
 	c.Assert(repo, NotNil)
 
 	// the actual test
@@ -1220,7 +1344,9 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDetailsOopses(c *C) {
 
 	// the actual test
 	_, err = repo.Snap("hello-world", "edge", false, snap.R(0), nil)
-	c.Assert(err, ErrorMatches, `cannot get details for snap "hello-world" in channel "edge": got unexpected HTTP status code 5.. via GET to "http://\S+" \[OOPS-[[:xdigit:]]*\]`)
+	c.Assert(err, Equals, ErrStoreUnavailable)
+	// the details of the failure are logged
+	c.Check(t.logbuf.String(), Matches, `(?s).*Cannot GET http://\S+: got HTTP status code 5.. \[OOPS-[[:xdigit:]]*\].*`)
 }
 
 /*
@@ -1385,6 +1511,31 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreFindQueries(c *C) {
 	}
 }
 
+func (t *remoteRepoTestSuite) TestUbuntuStoreFindBrandStoreURL(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/api/v1/snaps/search")
+		c.Check(r.URL.Query().Get("q"), Equals, "hello")
+		// the configured fields are kept
+		c.Check(r.URL.Query().Get("fields"), Equals, "abc,def")
+		n++
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	storeURL, _ := url.Parse(mockServer.URL)
+	searchURI, _ := url.Parse("https://default.example.com/search")
+	cfg := Config{
+		SearchURI:    searchURI,
+		DetailFields: []string{"abc", "def"},
+	}
+	authContext := &testAuthContext{c: c, device: t.device, storeURL: storeURL}
+	repo := New(&cfg, authContext)
+
+	repo.Find(&Search{Query: "hello"}, nil)
+	c.Check(n, Equals, 1)
+}
+
 func (t *remoteRepoTestSuite) TestUbuntuStoreFindPrivate(c *C) {
 	n := 0
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1420,26 +1571,214 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreFindPrivate(c *C) {
 	repo := New(&cfg, nil)
 	c.Assert(repo, NotNil)
 
-	_, err := repo.Find(&Search{Query: "foo", Private: true}, t.user)
+	_, _, err := repo.Find(&Search{Query: "foo", Private: true}, t.user)
 	c.Check(err, IsNil)
 
-	_, err = repo.Find(&Search{Query: "foo", Private: true}, nil)
+	_, _, err = repo.Find(&Search{Query: "foo", Private: true}, nil)
 	c.Check(err, Equals, ErrUnauthenticated)
 
-	_, err = repo.Find(&Search{Query: "name:foo", Private: true}, t.user)
+	_, _, err = repo.Find(&Search{Query: "name:foo", Private: true}, t.user)
 	c.Check(err, Equals, ErrBadQuery)
 }
 
 func (t *remoteRepoTestSuite) TestUbuntuStoreFindFailures(c *C) {
 	repo := New(&Config{SearchURI: new(url.URL)}, nil)
-	_, err := repo.Find(&Search{}, nil)
+	_, _, err := repo.Find(&Search{}, nil)
 	c.Check(err, Equals, ErrEmptyQuery)
-	_, err = repo.Find(&Search{Query: "foo:bar"}, nil)
+	_, _, err = repo.Find(&Search{Query: "foo:bar"}, nil)
+	c.Check(err, Equals, ErrBadQuery)
+	_, _, err = repo.Find(&Search{Query: "foo", Private: true, Prefix: true}, t.user)
+	c.Check(err, Equals, ErrBadQuery)
+}
+
+func (t *remoteRepoTestSuite) TestUbuntuStoreFindFilters(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch n {
+		case 0:
+			c.Check(query.Get("q"), Equals, "")
+			c.Check(query.Get("section"), Equals, "featured")
+			c.Check(query.Get("confinement"), Equals, "strict")
+			c.Check(query.Get("page"), Equals, "")
+			c.Check(query.Get("size"), Equals, "")
+			c.Check(r.Header.Get("X-Ubuntu-Architecture"), Equals, arch.UbuntuArchitecture())
+		case 1:
+			c.Check(query.Get("q"), Equals, "hello")
+			c.Check(query.Get("publisher"), Equals, "canonical")
+			c.Check(query.Get("confinement"), Equals, "devmode")
+			c.Check(query.Get("page"), Equals, "2")
+			c.Check(query.Get("size"), Equals, "10")
+			c.Check(r.Header.Get("X-Ubuntu-Architecture"), Equals, "armhf")
+		default:
+			c.Fatalf("what? %d", n)
+		}
+
+		w.Header().Set("Content-Type", "application/hal+json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, MockSearchJSON)
+
+		n++
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	serverURL, _ := url.Parse(mockServer.URL)
+	searchURI, _ := serverURL.Parse("/search")
+	cfg := Config{
+		SearchURI: searchURI,
+	}
+	repo := New(&cfg, nil)
+	c.Assert(repo, NotNil)
+
+	snaps, paging, err := repo.Find(&Search{Section: "featured"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 1)
+	c.Check(paging, DeepEquals, &Paging{Page: 1, Pages: 1})
+
+	snaps, _, err = repo.Find(&Search{
+		Query:        "hello",
+		Publisher:    "canonical",
+		Confinement:  snap.DevmodeConfinement,
+		Architecture: "armhf",
+		Page:         2,
+		PageSize:     10,
+	}, nil)
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 1)
+	c.Check(n, Equals, 2)
+}
+
+func (t *remoteRepoTestSuite) TestUbuntuStoreFindPaging(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query().Get("page"), Equals, "2")
+		w.Header().Set("Content-Type", "application/hal+json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{
+    "_embedded": {"clickindex:package": []},
+    "_links": {
+        "first": {"href": "https://search.apps.ubuntu.com/api/v1/search?q=hello&page=1"},
+        "last": {"href": "https://search.apps.ubuntu.com/api/v1/search?q=hello&page=5"},
+        "next": {"href": "https://search.apps.ubuntu.com/api/v1/search?q=hello&page=3"},
+        "self": {"href": "https://search.apps.ubuntu.com/api/v1/search?q=hello&page=2"}
+    }
+}`)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	serverURL, _ := url.Parse(mockServer.URL)
+	searchURI, _ := serverURL.Parse("/search")
+	repo := New(&Config{SearchURI: searchURI}, nil)
+	c.Assert(repo, NotNil)
+
+	snaps, paging, err := repo.Find(&Search{Query: "hello", Page: 2}, nil)
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 0)
+	c.Check(paging, DeepEquals, &Paging{Page: 2, Pages: 5})
+}
+
+func (t *remoteRepoTestSuite) TestUbuntuStoreFindBadFilters(c *C) {
+	repo := New(&Config{SearchURI: new(url.URL)}, nil)
+	_, _, err := repo.Find(&Search{Query: "foo", Confinement: "classic"}, nil)
+	c.Check(err, Equals, ErrBadQuery)
+	_, _, err = repo.Find(&Search{Query: "foo", Page: -1}, nil)
 	c.Check(err, Equals, ErrBadQuery)
-	_, err = repo.Find(&Search{Query: "foo", Private: true, Prefix: true}, t.user)
+	_, _, err = repo.Find(&Search{Query: "foo", PageSize: -1}, nil)
 	c.Check(err, Equals, ErrBadQuery)
 }
 
+/* acquired via:
+curl -s -H "accept: application/hal+json" -H "X-Ubuntu-Release: 16" -H "X-Ubuntu-Wire-Protocol: 1" 'https://search.apps.ubuntu.com/api/v1/snaps/sections' | python -m json.tool
+*/
+const MockSectionsJSON = `{
+    "_embedded": {
+        "clickindex:sections": [
+            {
+                "name": "featured"
+            },
+            {
+                "name": "database"
+            }
+        ]
+    },
+    "_links": {
+        "self": {
+            "href": "http://api.snapcraft.io/api/v1/snaps/sections"
+        }
+    }
+}
+`
+
+func (t *remoteRepoTestSuite) TestUbuntuStoreSections(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/snaps/sections")
+		c.Check(r.Header.Get("X-Device-Authorization"), Equals, `Macaroon root="device-macaroon"`)
+		w.Header().Set("Content-Type", "application/hal+json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, MockSectionsJSON)
+		n++
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	serverURL, _ := url.Parse(mockServer.URL)
+	sectionsURI, _ := serverURL.Parse("/snaps/sections")
+	cfg := Config{
+		SectionsURI: sectionsURI,
+	}
+	authContext := &testAuthContext{c: c, device: t.device}
+	repo := New(&cfg, authContext)
+	c.Assert(repo, NotNil)
+
+	sections, err := repo.Sections(t.user)
+	c.Check(err, IsNil)
+	c.Check(sections, DeepEquals, []string{"featured", "database"})
+	c.Check(n, Equals, 1)
+}
+
+func (t *remoteRepoTestSuite) TestUbuntuStoreSectionsBrandStoreURL(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/brand/api/v1/snaps/sections")
+		w.Header().Set("Content-Type", "application/hal+json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, MockSectionsJSON)
+		n++
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	storeURL, _ := url.Parse(mockServer.URL + "/brand/")
+	otherURI, _ := url.Parse("https://default.example.com/snaps/sections")
+	// the store URL from the store assertion wins over the configured ones
+	authContext := &testAuthContext{c: c, device: t.device, storeURL: storeURL}
+	repo := New(&Config{SectionsURI: otherURI}, authContext)
+
+	sections, err := repo.Sections(t.user)
+	c.Check(err, IsNil)
+	c.Check(sections, DeepEquals, []string{"featured", "database"})
+	c.Check(n, Equals, 1)
+}
+
+func (t *remoteRepoTestSuite) TestUbuntuStoreSectionsFails(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusTeapot), http.StatusTeapot)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	serverURL, _ := url.Parse(mockServer.URL)
+	sectionsURI, _ := serverURL.Parse("/snaps/sections")
+	repo := New(&Config{SectionsURI: sectionsURI}, nil)
+
+	sections, err := repo.Sections(nil)
+	c.Check(err, ErrorMatches, `cannot retrieve sections: got unexpected HTTP status code 418 via GET to "http://.*/snaps/sections"`)
+	c.Check(sections, IsNil)
+}
+
 func (t *remoteRepoTestSuite) TestUbuntuStoreFindFails(c *C) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.URL.Query().Get("q"), Equals, "hello")
@@ -1458,7 +1797,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreFindFails(c *C) {
 	repo := New(&cfg, nil)
 	c.Assert(repo, NotNil)
 
-	snaps, err := repo.Find(&Search{Query: "hello"}, nil)
+	snaps, _, err := repo.Find(&Search{Query: "hello"}, nil)
 	c.Check(err, ErrorMatches, `cannot search: got unexpected HTTP status code 418 via GET to "http://\S+[?&]q=hello.*"`)
 	c.Check(snaps, HasLen, 0)
 }
@@ -1481,7 +1820,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreFindBadContentType(c *C) {
 	repo := New(&cfg, nil)
 	c.Assert(repo, NotNil)
 
-	snaps, err := repo.Find(&Search{Query: "hello"}, nil)
+	snaps, _, err := repo.Find(&Search{Query: "hello"}, nil)
 	c.Check(err, ErrorMatches, `received an unexpected content type \("text/plain[^"]+"\) when trying to search via "http://\S+[?&]q=hello.*"`)
 	c.Check(snaps, HasLen, 0)
 }
@@ -1507,7 +1846,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreFindBadBody(c *C) {
 	repo := New(&cfg, nil)
 	c.Assert(repo, NotNil)
 
-	snaps, err := repo.Find(&Search{Query: "hello"}, nil)
+	snaps, _, err := repo.Find(&Search{Query: "hello"}, nil)
 	c.Check(err, ErrorMatches, `cannot decode reply \(got invalid character.*\) when trying to search via "http://\S+[?&]q=hello.*"`)
 	c.Check(snaps, HasLen, 0)
 }
@@ -1549,7 +1888,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreFindAuthFailed(c *C) {
 	repo := New(&cfg, nil)
 	c.Assert(repo, NotNil)
 
-	snaps, err := repo.Find(&Search{Query: "foo"}, t.user)
+	snaps, _, err := repo.Find(&Search{Query: "foo"}, t.user)
 	c.Assert(err, IsNil)
 
 	// Check that we log an error.
@@ -2087,6 +2426,7 @@ func (t *remoteRepoTestSuite) TestMyAppsURLDependsOnEnviron(c *C) {
 func (t *remoteRepoTestSuite) TestDefaultConfig(c *C) {
 	c.Check(strings.HasPrefix(defaultConfig.SearchURI.String(), "https://search.apps.ubuntu.com/api/v1/snaps/search"), Equals, true)
 	c.Check(strings.HasPrefix(defaultConfig.BulkURI.String(), "https://search.apps.ubuntu.com/api/v1/snaps/metadata"), Equals, true)
+	c.Check(defaultConfig.SectionsURI.String(), Equals, "https://search.apps.ubuntu.com/api/v1/snaps/sections")
 	c.Check(defaultConfig.AssertionsURI.String(), Equals, "https://assertions.ubuntu.com/v1/assertions/")
 }
 
@@ -3036,8 +3376,9 @@ func (t *remoteRepoTestSuite) TestUbuntuStorePaymentMethodsHandles401(c *C) {
 }
 
 var readyToBuyTests = []struct {
-	Input func(w http.ResponseWriter)
-	Test  func(c *C, err error)
+	Input      func(w http.ResponseWriter)
+	Test       func(c *C, err error)
+	NumOfCalls int
 }{
 	{
 		// A user account the is ready for purchasing
@@ -3119,9 +3460,10 @@ var readyToBuyTests = []struct {
 }`)
 		},
 		Test: func(c *C, err error) {
-			c.Assert(err, NotNil)
-			c.Check(err.Error(), Equals, `store reported an error: message 1`)
+			c.Check(err, Equals, ErrStoreUnavailable)
 		},
+		// the request is retried
+		NumOfCalls: 3,
 	},
 }
 
@@ -3158,6 +3500,10 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreReadyToBuy(c *C) {
 
 		err = repo.ReadyToBuy(t.user)
 		test.Test(c, err)
-		c.Check(purchaseServerGetCalled, Equals, 1)
+		numOfCalls := test.NumOfCalls
+		if numOfCalls == 0 {
+			numOfCalls = 1
+		}
+		c.Check(purchaseServerGetCalled, Equals, numOfCalls)
 	}
 }
@@ -438,7 +438,9 @@ func MountUnitPath(baseDir, ext string) string {
 
 func (s *systemd) WriteMountUnitFile(name, what, where, fstype string) (string, error) {
 	extra := ""
-	if osutil.IsDirectory(what) {
+	// fstype "bind" asks for a bind mount of what even if it is not
+	// there yet
+	if fstype == "bind" || osutil.IsDirectory(what) {
 		extra = "Options=bind\n"
 		fstype = "none"
 	}
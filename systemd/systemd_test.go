@@ -330,6 +330,27 @@ WantedBy=multi-user.target
 `, snapDir))
 }
 
+func (s *SystemdTestSuite) TestWriteMountUnitForBind(c *C) {
+	mountUnitName, err := New("", nil).WriteMountUnitFile("foo", "/snap/foo/1/dir", "/lib/foo", "bind")
+	c.Assert(err, IsNil)
+	defer os.Remove(mountUnitName)
+
+	mount, err := ioutil.ReadFile(filepath.Join(dirs.SnapServicesDir, mountUnitName))
+	c.Assert(err, IsNil)
+	c.Assert(string(mount), Equals, `[Unit]
+Description=Mount unit for foo
+
+[Mount]
+What=/snap/foo/1/dir
+Where=/lib/foo
+Type=none
+Options=bind
+
+[Install]
+WantedBy=multi-user.target
+`)
+}
+
 func (s *SystemdTestSuite) TestRestartCondUnmarshal(c *C) {
 	for cond := range RestartMap {
 		bs := []byte(cond)